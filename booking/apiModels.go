@@ -0,0 +1,292 @@
+package booking
+
+import "time"
+
+// CreateBookingRequest books a service, the booking ends after the service duration when no end is given.
+// Latitude and Longitude locate the address so the servitor's check in can be verified against it.
+type CreateBookingRequest struct {
+	ServiceID      int        `json:"service_id" binding:"required"`
+	ScheduledStart time.Time  `json:"scheduled_start" binding:"required"`
+	ScheduledEnd   *time.Time `json:"scheduled_end"`
+	Address        string     `json:"address" binding:"required,max=512"`
+	Notes          string     `json:"notes" binding:"max=1024"`
+	Latitude       *float64   `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude      *float64   `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	// Units is how many units of a per unit service are booked, one when left out
+	Units int `json:"units" binding:"min=0,max=100000"`
+}
+
+// QuotedBooking books a service at the time and price the servitor quoted for a job.
+type QuotedBooking struct {
+	ServiceID      int
+	CustomerID     int
+	ScheduledStart time.Time
+	ScheduledEnd   time.Time
+	Address        string
+	Notes          string
+	Price          int64
+	Currency       string
+	Latitude       *float64
+	Longitude      *float64
+}
+
+type FetchBookingsRequest struct {
+	Role   string `form:"role" binding:"omitempty,oneof=customer servitor"`
+	Status string `form:"status"`
+}
+
+type BookingReasonRequest struct {
+	Reason string `json:"reason" binding:"max=512"`
+}
+
+type RateBookingRequest struct {
+	Rating int `json:"rating" binding:"required,min=1,max=5"`
+}
+
+type BookingResponse struct {
+	ID                 int                `json:"id"`
+	ServiceID          int                `json:"service_id"`
+	CustomerID         int                `json:"customer_id"`
+	ServitorID         int                `json:"servitor_id"`
+	SeriesID           *int               `json:"series_id,omitempty"`
+	Occurrence         int                `json:"occurrence,omitempty"`
+	Status             string             `json:"status"`
+	ScheduledStart     time.Time          `json:"scheduled_start"`
+	ScheduledEnd       time.Time          `json:"scheduled_end"`
+	Address            string             `json:"address"`
+	Notes              string             `json:"notes,omitempty"`
+	Price              int64              `json:"price"`
+	Currency           string             `json:"currency"`
+	PricingModel       string             `json:"pricing_model,omitempty"`
+	Units              int                `json:"units,omitempty"`
+	Latitude           *float64           `json:"latitude,omitempty"`
+	Longitude          *float64           `json:"longitude,omitempty"`
+	ActualMinutes      *int               `json:"actual_minutes,omitempty"`
+	FinalPrice         *int64             `json:"final_price,omitempty"`
+	Rating             *int               `json:"rating,omitempty"`
+	CancellationPolicy CancellationPolicy `json:"cancellation_policy"`
+	CancellationFee    *int64             `json:"cancellation_fee,omitempty"`
+	RefundAmount       *int64             `json:"refund_amount,omitempty"`
+	ConfirmedAt        *time.Time         `json:"confirmed_at,omitempty"`
+	StartedAt          *time.Time         `json:"started_at,omitempty"`
+	CompletedAt        *time.Time         `json:"completed_at,omitempty"`
+	CancelledAt        *time.Time         `json:"cancelled_at,omitempty"`
+	NoShowAt           *time.Time         `json:"no_show_at,omitempty"`
+	CancelledBy        int                `json:"cancelled_by,omitempty"`
+	CancellationReason string             `json:"cancellation_reason,omitempty"`
+	CreatedOn          time.Time          `json:"created_on"`
+}
+
+type StatusChangeResponse struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedBy  int       `json:"changed_by"`
+	Fee        *int64    `json:"fee,omitempty"`
+	Refund     *int64    `json:"refund,omitempty"`
+	ChangedOn  time.Time `json:"changed_on"`
+}
+
+// CheckRequest is where the servitor's device is as they check in or out, AccuracyMeters is the
+// accuracy the device reported for the position.
+type CheckRequest struct {
+	Latitude       *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude      *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	AccuracyMeters float64  `json:"accuracy_meters" binding:"min=0"`
+}
+
+type CheckResponse struct {
+	Kind           string    `json:"kind"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	AccuracyMeters float64   `json:"accuracy_meters,omitempty"`
+	DistanceMeters *float64  `json:"distance_meters,omitempty"`
+	Verified       bool      `json:"verified"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+type UploadBookingPhotoRequest struct {
+	Stage string `form:"stage" binding:"required,oneof=before after"`
+}
+
+type BookingPhotoResponse struct {
+	ID         int       `json:"id"`
+	Stage      string    `json:"stage"`
+	UploadedBy int       `json:"uploaded_by"`
+	Url        string    `json:"url"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+// VisitResponse is the record of the servitor's visit for a booking: when and where they checked in
+// and out, how long the work took, what it came to and the photos taken of it.
+type VisitResponse struct {
+	BookingID      int                    `json:"booking_id"`
+	Status         string                 `json:"status"`
+	ScheduledStart time.Time              `json:"scheduled_start"`
+	ScheduledEnd   time.Time              `json:"scheduled_end"`
+	StartedAt      *time.Time             `json:"started_at,omitempty"`
+	CompletedAt    *time.Time             `json:"completed_at,omitempty"`
+	ActualMinutes  *int                   `json:"actual_minutes,omitempty"`
+	PricingModel   string                 `json:"pricing_model,omitempty"`
+	Price          int64                  `json:"price"`
+	FinalPrice     *int64                 `json:"final_price,omitempty"`
+	Currency       string                 `json:"currency"`
+	Checks         []CheckResponse        `json:"checks"`
+	Photos         []BookingPhotoResponse `json:"photos"`
+}
+
+// CancellationPolicy is the policy a booking was made under, fees are percentages of its price.
+type CancellationPolicy struct {
+	FreeCancellationHours      int `json:"free_cancellation_hours"`
+	LateCancellationFeePercent int `json:"late_cancellation_fee_percent"`
+	NoShowFeePercent           int `json:"no_show_fee_percent"`
+}
+
+// SlotsRequest asks for the free slots of a service, the period defaults to the coming week.
+type SlotsRequest struct {
+	ServiceID int        `form:"service_id" binding:"required"`
+	From      *time.Time `form:"from"`
+	To        *time.Time `form:"to"`
+}
+
+type SlotResponse struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// AvailabilityWindow is a weekly period bookings are taken in, Weekday counts from Sunday as 0.
+type AvailabilityWindow struct {
+	Weekday   int    `json:"weekday" binding:"min=0,max=6"`
+	StartTime string `json:"start_time" binding:"required"`
+	EndTime   string `json:"end_time" binding:"required"`
+}
+
+// ScheduleRequest replaces a servitor's availability, the slot step defaults to 30 minutes.
+type ScheduleRequest struct {
+	TimeZone        string               `json:"time_zone" binding:"required"`
+	BufferMinutes   int                  `json:"buffer_minutes" binding:"min=0,max=240"`
+	SlotStepMinutes int                  `json:"slot_step_minutes" binding:"omitempty,min=5,max=240"`
+	Windows         []AvailabilityWindow `json:"windows" binding:"max=50,dive"`
+}
+
+type ScheduleResponse struct {
+	ServitorID      int                  `json:"servitor_id"`
+	TimeZone        string               `json:"time_zone"`
+	BufferMinutes   int                  `json:"buffer_minutes"`
+	SlotStepMinutes int                  `json:"slot_step_minutes"`
+	Windows         []AvailabilityWindow `json:"windows"`
+	LastUpdatedOn   time.Time            `json:"last_updated_on"`
+}
+
+// RescheduleBookingRequest moves a booking, the booking keeps its length when no end is given.
+type RescheduleBookingRequest struct {
+	ScheduledStart time.Time  `json:"scheduled_start" binding:"required"`
+	ScheduledEnd   *time.Time `json:"scheduled_end"`
+	Address        *string    `json:"address" binding:"omitempty,max=512"`
+	Notes          *string    `json:"notes" binding:"omitempty,max=1024"`
+}
+
+// CreateSeriesRequest books a service repeatedly. Rule is a subset of the iCalendar RRULE, for example
+// FREQ=WEEKLY;INTERVAL=2;COUNT=10 or FREQ=MONTHLY;UNTIL=20271231, and the first occurrence starts at
+// FirstStart. Occurrences that cannot be booked fail the request unless SkipConflicts is set.
+type CreateSeriesRequest struct {
+	ServiceID     int       `json:"service_id" binding:"required"`
+	FirstStart    time.Time `json:"first_start" binding:"required"`
+	Rule          string    `json:"rule" binding:"required,max=128"`
+	Address       string    `json:"address" binding:"required,max=512"`
+	Notes         string    `json:"notes" binding:"max=1024"`
+	SkipConflicts bool      `json:"skip_conflicts"`
+}
+
+type UpdateSeriesRequest struct {
+	Address *string `json:"address" binding:"omitempty,max=512"`
+	Notes   *string `json:"notes" binding:"omitempty,max=1024"`
+}
+
+type SeriesConflictResponse struct {
+	Occurrence     int       `json:"occurrence"`
+	ScheduledStart time.Time `json:"scheduled_start"`
+	ScheduledEnd   time.Time `json:"scheduled_end"`
+	Reason         string    `json:"reason"`
+}
+
+type SeriesResponse struct {
+	ID              int                      `json:"id,omitempty"`
+	ServiceID       int                      `json:"service_id,omitempty"`
+	CustomerID      int                      `json:"customer_id,omitempty"`
+	ServitorID      int                      `json:"servitor_id,omitempty"`
+	Rule            string                   `json:"rule"`
+	FirstStart      time.Time                `json:"first_start"`
+	DurationMinutes int                      `json:"duration_minutes"`
+	TimeZone        string                   `json:"time_zone"`
+	Address         string                   `json:"address"`
+	Notes           string                   `json:"notes,omitempty"`
+	Status          string                   `json:"status"`
+	Bookings        []BookingResponse        `json:"bookings"`
+	Conflicts       []SeriesConflictResponse `json:"conflicts"`
+	CreatedOn       time.Time                `json:"created_on"`
+}
+
+type CalendarFeedResponse struct {
+	Url       string    `json:"url"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// SubscribeCalendarRequest imports the calendar published at Url, webcal addresses are accepted.
+type SubscribeCalendarRequest struct {
+	Name string `json:"name" binding:"required,max=128"`
+	Url  string `json:"url" binding:"required,max=2048"`
+}
+
+type UploadCalendarRequest struct {
+	Name string `form:"name" binding:"required,max=128"`
+}
+
+type CalendarSourceResponse struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Url          string     `json:"url,omitempty"`
+	BusyPeriods  int        `json:"busy_periods"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedOn    time.Time  `json:"created_on"`
+}
+
+// JoinWaitlistRequest waits for a slot of the service starting between EarliestStart and LatestStart,
+// at most 31 days apart. The address and notes go on the booking once a held slot is claimed.
+type JoinWaitlistRequest struct {
+	ServiceID     int       `json:"service_id" binding:"required"`
+	EarliestStart time.Time `json:"earliest_start" binding:"required"`
+	LatestStart   time.Time `json:"latest_start" binding:"required"`
+	Address       string    `json:"address" binding:"required,max=512"`
+	Notes         string    `json:"notes" binding:"max=1024"`
+	Latitude      *float64  `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude     *float64  `json:"longitude" binding:"omitempty,min=-180,max=180"`
+}
+
+// WaitlistHoldResponse is the slot held for a waitlisted customer, it is released at ExpiresAt
+// unless the customer claims it.
+type WaitlistHoldResponse struct {
+	BookingID int       `json:"booking_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type WaitlistEntryResponse struct {
+	ID            int                   `json:"id"`
+	ServiceID     int                   `json:"service_id"`
+	CustomerID    int                   `json:"customer_id"`
+	ServitorID    int                   `json:"servitor_id"`
+	EarliestStart time.Time             `json:"earliest_start"`
+	LatestStart   time.Time             `json:"latest_start"`
+	Address       string                `json:"address"`
+	Notes         string                `json:"notes,omitempty"`
+	Latitude      *float64              `json:"latitude,omitempty"`
+	Longitude     *float64              `json:"longitude,omitempty"`
+	Status        string                `json:"status"`
+	Hold          *WaitlistHoldResponse `json:"hold,omitempty"`
+	CreatedOn     time.Time             `json:"created_on"`
+}
@@ -0,0 +1,412 @@
+package booking
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"servhunt/booking/dao"
+	"servhunt/infra/ical"
+	"servhunt/infra/utils"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxCalendarBytes bounds the size of an uploaded or fetched calendar.
+	MaxCalendarBytes = 2 << 20
+
+	// calendarFetchTimeout bounds how long fetching a subscribed calendar may take.
+	calendarFetchTimeout = 20 * time.Second
+
+	// busyHorizon is how far ahead the busy times of imported calendars are kept.
+	busyHorizon = 180 * 24 * time.Hour
+
+	// feedHistory is how far back bookings are kept in the published feed.
+	feedHistory = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidCalendarURL    = errors.New("calendar url must be a public http, https or webcal address")
+	ErrCalendarTooLarge      = fmt.Errorf("calendars can be at most %d bytes", MaxCalendarBytes)
+	ErrCalendarFetch         = errors.New("the calendar could not be fetched")
+	ErrCalendarNotSubscribed = errors.New("uploaded calendars are synced by uploading them again")
+)
+
+// feedStatuses maps booking statuses to the status of their event in the feed, bookings in other
+// statuses are left out.
+var feedStatuses = map[string]string{
+	dao.RequestedStatus:  ical.TentativeStatus,
+	dao.ConfirmedStatus:  ical.ConfirmedStatus,
+	dao.InProgressStatus: ical.ConfirmedStatus,
+	dao.CompletedStatus:  ical.ConfirmedStatus,
+	dao.CancelledStatus:  ical.CancelledStatus,
+}
+
+// calendarClient fetches subscribed calendars, refusing to connect to addresses that are not public
+// so calendar urls cannot be used to reach services inside the network.
+var calendarClient = &http.Client{
+	Timeout: calendarFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !publicIP(ip) {
+					return ErrInvalidCalendarURL
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// CalendarFeed returns the address the caller's bookings are published at, creating it the first time.
+func (b *BookingServiceImpl) CalendarFeed(ctx context.Context, caller *utils.Caller) (*CalendarFeedResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	feed, err := b.BookingRepo.GetCalendarFeed(ctx, caller.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return b.RotateCalendarFeed(ctx, caller)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := b.toCalendarFeedResponse(*feed)
+	return &res, nil
+}
+
+// RotateCalendarFeed moves the caller's feed to a new secret address, the old one stops working.
+func (b *BookingServiceImpl) RotateCalendarFeed(ctx context.Context, caller *utils.Caller) (*CalendarFeedResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	feed, err := b.BookingRepo.SaveCalendarFeed(ctx, dao.CalendarFeed{
+		ServitorID: caller.ID,
+		Token:      hex.EncodeToString(secret),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := b.toCalendarFeedResponse(*feed)
+	return &res, nil
+}
+
+// WriteCalendar writes the iCalendar feed published under the token, holding the servitor's
+// bookings from the last month onwards.
+func (b *BookingServiceImpl) WriteCalendar(ctx context.Context, token string, w io.Writer) error {
+	feed, err := b.BookingRepo.GetCalendarFeedByToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	bookings, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{
+		ServitorID: feed.ServitorID,
+		EndsAfter:  time.Now().Add(-feedHistory),
+	})
+	if err != nil {
+		return err
+	}
+
+	var serviceIds []int
+	for _, booking := range *bookings {
+		serviceIds = append(serviceIds, booking.ServiceID)
+	}
+	titles := map[int]string{}
+	services, err := b.services.GetServicesByIDs(ctx, serviceIds)
+	if err != nil {
+		return err
+	}
+	for _, svc := range *services {
+		titles[svc.ID] = svc.ServiceName
+	}
+
+	cal := ical.Calendar{Name: "servhunt bookings"}
+	for _, booking := range *bookings {
+		status, ok := feedStatuses[booking.Status]
+		if !ok {
+			continue
+		}
+		summary := titles[booking.ServiceID]
+		if summary == "" {
+			summary = "servhunt booking"
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          fmt.Sprintf("booking-%d@servhunt", booking.ID),
+			Summary:      summary,
+			Description:  booking.Notes,
+			Location:     booking.Address,
+			Status:       status,
+			Start:        booking.ScheduledStart,
+			End:          booking.ScheduledEnd,
+			LastModified: booking.LastUpdatedOn,
+		})
+	}
+	return ical.Write(w, cal)
+}
+
+// SubscribeCalendar imports the calendar at the url, it is synced again periodically.
+func (b *BookingServiceImpl) SubscribeCalendar(ctx context.Context, caller *utils.Caller,
+	request SubscribeCalendarRequest) (*CalendarSourceResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	address, err := calendarURL(request.Url)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := b.fetchBusyPeriods(ctx, caller.ID, address)
+	if err != nil {
+		return nil, err
+	}
+	source, err := b.BookingRepo.CreateCalendarSource(ctx, dao.CalendarSource{
+		ServitorID: caller.ID,
+		Name:       request.Name,
+		Url:        address,
+	}, periods)
+	if err != nil {
+		return nil, err
+	}
+	res := toCalendarSourceResponse(*source)
+	return &res, nil
+}
+
+// UploadCalendar imports an ICS file, its busy times stay until the calendar is removed.
+func (b *BookingServiceImpl) UploadCalendar(ctx context.Context, caller *utils.Caller,
+	request UploadCalendarRequest, r io.Reader) (*CalendarSourceResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	periods, err := b.busyPeriods(ctx, caller.ID, r)
+	if err != nil {
+		return nil, err
+	}
+	source, err := b.BookingRepo.CreateCalendarSource(ctx, dao.CalendarSource{
+		ServitorID: caller.ID,
+		Name:       request.Name,
+	}, periods)
+	if err != nil {
+		return nil, err
+	}
+	res := toCalendarSourceResponse(*source)
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) CalendarSources(ctx context.Context, caller *utils.Caller) (*[]CalendarSourceResponse, error) {
+	sources, err := b.BookingRepo.CalendarSources(ctx, caller.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := []CalendarSourceResponse{}
+	for _, source := range *sources {
+		res = append(res, toCalendarSourceResponse(source))
+	}
+	return &res, nil
+}
+
+// SyncCalendarSource fetches a subscribed calendar again. A failed fetch is recorded on the
+// calendar and its busy times from the last sync are kept.
+func (b *BookingServiceImpl) SyncCalendarSource(ctx context.Context, caller *utils.Caller,
+	id int) (*CalendarSourceResponse, error) {
+	source, err := b.ownedCalendarSource(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if source.Url == "" {
+		return nil, ErrCalendarNotSubscribed
+	}
+	if err = b.syncCalendarSource(ctx, *source); err != nil {
+		return nil, err
+	}
+	source, err = b.BookingRepo.GetCalendarSourceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toCalendarSourceResponse(*source)
+	return &res, nil
+}
+
+// DeleteCalendarSource removes an imported calendar, its busy times no longer block bookings and the
+// slots they free are offered to the waitlist.
+func (b *BookingServiceImpl) DeleteCalendarSource(ctx context.Context, caller *utils.Caller, id int) error {
+	source, err := b.ownedCalendarSource(ctx, caller, id)
+	if err != nil {
+		return err
+	}
+	if err = b.BookingRepo.DeleteCalendarSource(ctx, id); err != nil {
+		return err
+	}
+	b.offerFreedSlots(ctx, source.ServitorID)
+	return nil
+}
+
+// SyncCalendars fetches every subscribed calendar again, failures are recorded on the calendar.
+func (b *BookingServiceImpl) SyncCalendars(ctx context.Context) error {
+	sources, err := b.BookingRepo.SubscribedCalendarSources(ctx)
+	if err != nil {
+		return err
+	}
+	for _, source := range *sources {
+		if err = b.syncCalendarSource(ctx, source); err != nil {
+			logger.Warn("error syncing calendar", zap.Int("calendar.id", source.ID),
+				zap.NamedError("error.message", err))
+		}
+	}
+	return nil
+}
+
+// RunCalendarSyncJob syncs subscribed calendars on every tick of the interval, it blocks until the
+// context is cancelled.
+func RunCalendarSyncJob(ctx context.Context, svc BookingService, interval time.Duration) {
+	if interval <= 0 {
+		logger.Warn("calendar sync job disabled, no sync interval configured")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svc.SyncCalendars(ctx); err != nil {
+				logger.Error("error syncing calendars", zap.NamedError("error.message", err))
+			}
+		}
+	}
+}
+
+func (b *BookingServiceImpl) syncCalendarSource(ctx context.Context, source dao.CalendarSource) error {
+	periods, err := b.fetchBusyPeriods(ctx, source.ServitorID, source.Url)
+	if err != nil {
+		if recordErr := b.BookingRepo.SetCalendarSourceError(ctx, source.ID, err.Error()); recordErr != nil {
+			logger.Error("error recording calendar sync error", zap.Int("calendar.id", source.ID),
+				zap.NamedError("error.message", recordErr))
+		}
+		return err
+	}
+	return b.BookingRepo.ReplaceBusyPeriods(ctx, source.ID, periods)
+}
+
+// fetchBusyPeriods downloads the calendar at the address and reads its busy times.
+func (b *BookingServiceImpl) fetchBusyPeriods(ctx context.Context, servitorId int, address string) ([]dao.BusyPeriod, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, ErrInvalidCalendarURL
+	}
+	req.Header.Set("Accept", "text/calendar")
+	resp, err := calendarClient.Do(req)
+	if errors.Is(err, ErrInvalidCalendarURL) {
+		return nil, ErrInvalidCalendarURL
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCalendarFetch, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrCalendarFetch, resp.Status)
+	}
+	return b.busyPeriods(ctx, servitorId, resp.Body)
+}
+
+// busyPeriods reads the times the calendar shows the servitor busy over the coming months. Events
+// marked free or cancelled do not count, and times without a zone are read in the servitor's.
+func (b *BookingServiceImpl) busyPeriods(ctx context.Context, servitorId int, r io.Reader) ([]dao.BusyPeriod, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxCalendarBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCalendarFetch, err)
+	}
+	if len(data) > MaxCalendarBytes {
+		return nil, ErrCalendarTooLarge
+	}
+	loc := time.UTC
+	if schedule, err := b.BookingRepo.GetSchedule(ctx, servitorId); err == nil {
+		loc = scheduleLocation(*schedule)
+	}
+	events, err := ical.Parse(bytes.NewReader(data), loc)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Now().Add(-24 * time.Hour)
+	to := from.Add(busyHorizon)
+	periods := []dao.BusyPeriod{}
+	for _, event := range events {
+		if event.Transparent || event.Status == ical.CancelledStatus || !event.End.After(event.Start) {
+			continue
+		}
+		for _, occurrence := range event.Occurrences(from, to) {
+			periods = append(periods, dao.BusyPeriod{StartsAt: occurrence.Start, EndsAt: occurrence.End})
+		}
+	}
+	return periods, nil
+}
+
+// ownedCalendarSource loads the imported calendar if it belongs to the caller or the caller is an administrator.
+func (b *BookingServiceImpl) ownedCalendarSource(ctx context.Context, caller *utils.Caller, id int) (*dao.CalendarSource, error) {
+	source, err := b.BookingRepo.GetCalendarSourceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && source.ServitorID != caller.ID {
+		return nil, ErrNotParticipant
+	}
+	return source, nil
+}
+
+// calendarURL checks the address a calendar is subscribed at, webcal addresses are fetched over https.
+func calendarURL(address string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(address))
+	if err != nil || u.Host == "" {
+		return "", ErrInvalidCalendarURL
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "webcal", "webcals":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", ErrInvalidCalendarURL
+	}
+	return u.String(), nil
+}
+
+func (b *BookingServiceImpl) toCalendarFeedResponse(feed dao.CalendarFeed) CalendarFeedResponse {
+	return CalendarFeedResponse{
+		Url:       fmt.Sprintf("%s/%s.ics", strings.TrimRight(b.feedURL, "/"), feed.Token),
+		CreatedOn: feed.CreatedOn,
+	}
+}
+
+func toCalendarSourceResponse(source dao.CalendarSource) CalendarSourceResponse {
+	return CalendarSourceResponse{
+		ID:           source.ID,
+		Name:         source.Name,
+		Url:          source.Url,
+		BusyPeriods:  source.BusyPeriods,
+		LastSyncedAt: source.LastSyncedAt,
+		LastError:    source.LastError,
+		CreatedOn:    source.CreatedOn,
+	}
+}
@@ -0,0 +1,48 @@
+package booking
+
+import (
+	"servhunt/booking/dao"
+	"servhunt/infra/utils"
+	"time"
+)
+
+// cancellationCharges applies the booking's cancellation policy to a move to the status, returning
+// the fee the customer is charged and the part of the price refunded to them. Both are nil when the
+// move is neither a cancellation nor a no show.
+//
+// Customers cancelling a booking that was ever confirmed within FreeCancellationHours of its start
+// pay LateCancellationFeePercent of the booked total, a no show costs NoShowFeePercent. Rescheduling
+// a confirmed booking back to requested does not waive the fee. Cancellations by the servitor or an
+// administrator, and of bookings that were never confirmed, are refunded in full.
+func cancellationCharges(booking dao.Booking, status string, byCustomer bool, now time.Time) (*int64, *int64) {
+	total := bookedTotal(booking)
+	var fee int64
+	switch status {
+	case dao.CancelledStatus:
+		freeUntil := booking.ScheduledStart.Add(-time.Duration(booking.FreeCancellationHours) * time.Hour)
+		if byCustomer && booking.ConfirmedAt != nil && !now.Before(freeUntil) {
+			fee = percentOf(total, booking.LateCancellationFeePercent)
+		}
+	case dao.NoShowStatus:
+		fee = percentOf(total, booking.NoShowFeePercent)
+	default:
+		return nil, nil
+	}
+	refund := total - fee
+	return &fee, &refund
+}
+
+// bookedTotal is what the booking comes to as booked, hourly bookings for their scheduled length.
+func bookedTotal(booking dao.Booking) int64 {
+	return billedPrice(booking, int(booking.ScheduledEnd.Sub(booking.ScheduledStart).Minutes()))
+}
+
+// percentOf is the given percentage of an amount in minor units, rounded half up.
+func percentOf(amount int64, percent int) int64 {
+	return (amount*int64(percent) + 50) / 100
+}
+
+// isCustomer reports whether the caller acts as the booking's customer, administrators never do.
+func isCustomer(booking dao.Booking, caller *utils.Caller) bool {
+	return booking.CustomerID == caller.ID && !caller.IsAdmin()
+}
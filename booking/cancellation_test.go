@@ -0,0 +1,61 @@
+package booking
+
+import (
+	"servhunt/booking/dao"
+	svcdao "servhunt/servitorservices/dao"
+	"testing"
+	"time"
+)
+
+func TestCancellationCharges(t *testing.T) {
+	start := at(monday, 10, 0)
+	confirmed := start.Add(-48 * time.Hour)
+	base := dao.Booking{
+		Price:                      1000,
+		PricingModel:               svcdao.FixedPricing,
+		ScheduledStart:             start,
+		ScheduledEnd:               start.Add(2 * time.Hour),
+		FreeCancellationHours:      24,
+		LateCancellationFeePercent: 50,
+		NoShowFeePercent:           100,
+	}
+	tests := []struct {
+		name       string
+		edit       func(*dao.Booking)
+		status     string
+		byCustomer bool
+		now        time.Time
+		wantFee    int64
+		wantRefund int64
+	}{
+		{"early cancellation", func(b *dao.Booking) { b.ConfirmedAt = &confirmed }, dao.CancelledStatus, true, start.Add(-25 * time.Hour), 0, 1000},
+		{"late cancellation", func(b *dao.Booking) { b.ConfirmedAt = &confirmed }, dao.CancelledStatus, true, start.Add(-time.Hour), 500, 500},
+		{"never confirmed", func(b *dao.Booking) {}, dao.CancelledStatus, true, start.Add(-time.Hour), 0, 1000},
+		{"rescheduled after confirming", func(b *dao.Booking) {
+			b.ConfirmedAt = &confirmed
+			b.Status = dao.RequestedStatus
+		}, dao.CancelledStatus, true, start.Add(-time.Hour), 500, 500},
+		{"by the servitor", func(b *dao.Booking) { b.ConfirmedAt = &confirmed }, dao.CancelledStatus, false, start.Add(-time.Hour), 0, 1000},
+		{"hourly", func(b *dao.Booking) {
+			b.ConfirmedAt = &confirmed
+			b.PricingModel = svcdao.HourlyPricing
+		}, dao.CancelledStatus, true, start.Add(-time.Hour), 1000, 1000},
+		{"per unit", func(b *dao.Booking) {
+			b.PricingModel = svcdao.PerUnitPricing
+			b.Units = 3
+		}, dao.NoShowStatus, false, start.Add(time.Hour), 3000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := base
+			tt.edit(&booking)
+			fee, refund := cancellationCharges(booking, tt.status, tt.byCustomer, tt.now)
+			if fee == nil || refund == nil {
+				t.Fatalf("cancellationCharges() = nil, want fee %d and refund %d", tt.wantFee, tt.wantRefund)
+			}
+			if *fee != tt.wantFee || *refund != tt.wantRefund {
+				t.Errorf("cancellationCharges() = %d, %d, want %d, %d", *fee, *refund, tt.wantFee, tt.wantRefund)
+			}
+		})
+	}
+}
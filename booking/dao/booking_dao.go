@@ -0,0 +1,877 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"time"
+)
+
+var (
+	// ErrStatusChanged is returned when a booking moved to another status while a change was being made.
+	ErrStatusChanged = errors.New("booking status has changed, please retry")
+
+	// ErrSlotTaken is returned when a booking would overlap another active booking of the servitor.
+	ErrSlotTaken = errors.New("the servitor is already booked at that time")
+
+	// ErrNoSchedule is returned when booking a servitor who has not published their availability.
+	ErrNoSchedule = errors.New("the servitor has not set their availability")
+
+	// ErrAlreadyRated is returned when rating a booking the customer rated before.
+	ErrAlreadyRated = errors.New("the booking has been rated already")
+
+	// ErrWaitlistChanged is returned when a waitlist entry moved to another status while a change was being made.
+	ErrWaitlistChanged = errors.New("waitlist entry has changed, please retry")
+)
+
+// activeStatuses are the statuses of bookings that hold on to their time slot.
+var activeStatuses = []string{HeldStatus, RequestedStatus, ConfirmedStatus, InProgressStatus}
+
+// statusTimestamps names the column stamped when a booking enters a status.
+var statusTimestamps = map[string]string{
+	ConfirmedStatus:  "confirmed_at",
+	InProgressStatus: "started_at",
+	CompletedStatus:  "completed_at",
+	CancelledStatus:  "cancelled_at",
+	NoShowStatus:     "no_show_at",
+}
+
+type BookingRepo interface {
+	CreateBooking(ctx context.Context, booking Booking, buffer time.Duration) (*Booking, error)
+	GetBookingByID(ctx context.Context, id int) (*Booking, error)
+	Bookings(ctx context.Context, filter BookingFilter) (*[]Booking, error)
+	ChangeBookingStatus(ctx context.Context, change BookingStatusChange) (*Booking, error)
+	CheckBooking(ctx context.Context, change BookingStatusChange, check BookingCheck, actualMinutes *int,
+		finalPrice *int64) (*Booking, error)
+	CompleteBooking(ctx context.Context, change BookingStatusChange, actualMinutes int, finalPrice int64) (*Booking, error)
+	RateBooking(ctx context.Context, id int, rating int) (*Booking, error)
+	BookingChecks(ctx context.Context, bookingId int) (*[]BookingCheck, error)
+	CountBookingPhotos(ctx context.Context, bookingId int) (int64, error)
+	CreateBookingPhoto(ctx context.Context, photo BookingPhoto) (*BookingPhoto, error)
+	BookingPhotos(ctx context.Context, bookingId int) (*[]BookingPhoto, error)
+	BookingHistory(ctx context.Context, bookingId int) (*[]BookingStatusChange, error)
+	CountUpcomingBookings(ctx context.Context, serviceId int, after time.Time) (int64, error)
+	ActiveBookings(ctx context.Context, servitorIds []int, from time.Time, to time.Time) (*[]Booking, error)
+	GetSchedule(ctx context.Context, servitorId int) (*Schedule, error)
+	GetSchedules(ctx context.Context, servitorIds []int) (*[]Schedule, error)
+	SaveSchedule(ctx context.Context, schedule Schedule) (*Schedule, error)
+	RescheduleBooking(ctx context.Context, booking Booking, buffer time.Duration, changedBy int) (*Booking, error)
+	CreateSeries(ctx context.Context, series BookingSeries) (*BookingSeries, error)
+	GetSeriesByID(ctx context.Context, id int) (*BookingSeries, error)
+	SeriesList(ctx context.Context, filter BookingFilter) (*[]BookingSeries, error)
+	SaveSeriesProgress(ctx context.Context, series BookingSeries, conflicts []SeriesConflict) error
+	UpdateSeriesDetails(ctx context.Context, series BookingSeries, after time.Time) error
+	GetCalendarFeed(ctx context.Context, servitorId int) (*CalendarFeed, error)
+	GetCalendarFeedByToken(ctx context.Context, token string) (*CalendarFeed, error)
+	SaveCalendarFeed(ctx context.Context, feed CalendarFeed) (*CalendarFeed, error)
+	CreateCalendarSource(ctx context.Context, source CalendarSource, periods []BusyPeriod) (*CalendarSource, error)
+	GetCalendarSourceByID(ctx context.Context, id int) (*CalendarSource, error)
+	CalendarSources(ctx context.Context, servitorId int) (*[]CalendarSource, error)
+	SubscribedCalendarSources(ctx context.Context) (*[]CalendarSource, error)
+	ReplaceBusyPeriods(ctx context.Context, sourceId int, periods []BusyPeriod) error
+	SetCalendarSourceError(ctx context.Context, sourceId int, message string) error
+	DeleteCalendarSource(ctx context.Context, id int) error
+	BusyPeriods(ctx context.Context, servitorIds []int, from time.Time, to time.Time) (*[]BusyPeriod, error)
+	CreateWaitlistEntry(ctx context.Context, entry WaitlistEntry) (*WaitlistEntry, error)
+	GetWaitlistEntryByID(ctx context.Context, id int) (*WaitlistEntry, error)
+	WaitlistEntries(ctx context.Context, filter WaitlistFilter) (*[]WaitlistEntry, error)
+	WaitlistServitors(ctx context.Context, after time.Time) ([]int, error)
+	HoldWaitlistSlot(ctx context.Context, entryId int, booking Booking, buffer time.Duration,
+		expiresAt time.Time) (*Booking, error)
+	CloseWaitlistEntry(ctx context.Context, entryId int, from string, to string,
+		change *BookingStatusChange) (*WaitlistEntry, error)
+	LapseEndedWaitlistEntries(ctx context.Context, before time.Time) error
+}
+
+type BookingRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewBookingRepoImpl(repo *dao.Repository) BookingRepo {
+	return &BookingRepoImpl{repo: repo}
+}
+
+// CreateBooking requests the booking unless it comes within buffer of another active booking of
+// the servitor. The servitor's schedule row is locked while checking so concurrent requests for
+// overlapping times are serialised and only the first one is booked.
+func (b *BookingRepoImpl) CreateBooking(ctx context.Context, booking Booking, buffer time.Duration) (*Booking, error) {
+	if booking.Status == "" {
+		booking.Status = RequestedStatus
+	}
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createBooking(tx, &booking, buffer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// createBooking locks the servitor's schedule row, checks the slot is free and creates the booking
+// along with its first status change.
+func createBooking(tx *gorm.DB, booking *Booking, buffer time.Duration) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Schedule{}).
+		Where("servitor_id = ?", booking.ServitorID).Take(&Schedule{}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoSchedule
+	}
+	if err != nil {
+		return err
+	}
+	if err = checkSlotFree(tx, *booking, buffer); err != nil {
+		return err
+	}
+	if err = tx.Model(&Booking{}).Create(booking).Error; err != nil {
+		return err
+	}
+	return tx.Model(&BookingStatusChange{}).Create(&BookingStatusChange{
+		BookingID: booking.ID,
+		ToStatus:  booking.Status,
+		ChangedBy: booking.CustomerID,
+	}).Error
+}
+
+// checkSlotFree fails with ErrSlotTaken when the booking comes within buffer of another active
+// booking of the servitor or overlaps a time their imported calendars show them busy. It is run
+// with the servitor's schedule row locked.
+func checkSlotFree(tx *gorm.DB, booking Booking, buffer time.Duration) error {
+	var overlapping int64
+	err := tx.Model(&Booking{}).Where("servitor_id = ? AND status IN ? AND id <> ?", booking.ServitorID,
+		activeStatuses, booking.ID).
+		Where("scheduled_start < ? AND scheduled_end > ?", booking.ScheduledEnd.Add(buffer),
+			booking.ScheduledStart.Add(-buffer)).Count(&overlapping).Error
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return ErrSlotTaken
+	}
+	err = tx.Model(&BusyPeriod{}).Where("servitor_id = ?", booking.ServitorID).
+		Where("starts_at < ? AND ends_at > ?", booking.ScheduledEnd.Add(buffer), booking.ScheduledStart.Add(-buffer)).
+		Count(&overlapping).Error
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return ErrSlotTaken
+	}
+	return nil
+}
+
+func (b *BookingRepoImpl) GetBookingByID(ctx context.Context, id int) (*Booking, error) {
+	var booking Booking
+	err := b.repo.DB.WithContext(ctx).Model(&Booking{}).Where("id = ?", id).Take(&booking).Error
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// Bookings returns the matching bookings, soonest first.
+func (b *BookingRepoImpl) Bookings(ctx context.Context, filter BookingFilter) (*[]Booking, error) {
+	var bookings []Booking
+	db := b.repo.DB.WithContext(ctx).Model(&Booking{})
+	if filter.CustomerID != 0 {
+		db = db.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.ServitorID != 0 {
+		db = db.Where("servitor_id = ?", filter.ServitorID)
+	}
+	if filter.SeriesID != 0 {
+		db = db.Where("series_id = ?", filter.SeriesID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if !filter.EndsAfter.IsZero() {
+		db = db.Where("scheduled_end > ?", filter.EndsAfter)
+	}
+	if !filter.EndsBefore.IsZero() {
+		db = db.Where("scheduled_end <= ?", filter.EndsBefore)
+	}
+	if !filter.StartsAfter.IsZero() {
+		db = db.Where("scheduled_start > ?", filter.StartsAfter)
+	}
+	if !filter.StartsBefore.IsZero() {
+		db = db.Where("scheduled_start <= ?", filter.StartsBefore)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		db = db.Where("created_on <= ?", filter.CreatedBefore)
+	}
+	if err := db.Order("scheduled_start, id").Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	return &bookings, nil
+}
+
+// ChangeBookingStatus moves a booking from change.FromStatus to change.ToStatus, stamps the time it
+// entered the status and records the change, failing with ErrStatusChanged if the booking is no
+// longer in change.FromStatus.
+func (b *BookingRepoImpl) ChangeBookingStatus(ctx context.Context, change BookingStatusChange) (*Booking, error) {
+	var booking *Booking
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		booking, err = applyStatusChange(tx, change, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CheckBooking records the servitor checking in or out along with the status change it makes, on
+// check out the visit's length and final price are stored too.
+func (b *BookingRepoImpl) CheckBooking(ctx context.Context, change BookingStatusChange, check BookingCheck,
+	actualMinutes *int, finalPrice *int64) (*Booking, error) {
+	updates := map[string]interface{}{}
+	if actualMinutes != nil {
+		updates["actual_minutes"] = *actualMinutes
+	}
+	if finalPrice != nil {
+		updates["final_price"] = *finalPrice
+	}
+	var booking *Booking
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if booking, err = applyStatusChange(tx, change, updates); err != nil {
+			return err
+		}
+		return tx.Model(&BookingCheck{}).Create(&check).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CompleteBooking completes a booking nobody checked out of, storing the length and final price
+// it is billed for.
+func (b *BookingRepoImpl) CompleteBooking(ctx context.Context, change BookingStatusChange, actualMinutes int,
+	finalPrice int64) (*Booking, error) {
+	var booking *Booking
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		booking, err = applyStatusChange(tx, change, map[string]interface{}{
+			"actual_minutes": actualMinutes,
+			"final_price":    finalPrice,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// RateBooking stores the customer's rating of a completed booking, failing with ErrStatusChanged
+// when the booking is not completed and ErrAlreadyRated when it was rated before.
+func (b *BookingRepoImpl) RateBooking(ctx context.Context, id int, rating int) (*Booking, error) {
+	var booking Booking
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Booking{}).Where("id = ?", id).
+			Take(&booking).Error
+		if err != nil {
+			return err
+		}
+		if booking.Status != CompletedStatus {
+			return ErrStatusChanged
+		}
+		if booking.Rating != nil {
+			return ErrAlreadyRated
+		}
+		now := time.Now()
+		booking.Rating, booking.RatedAt = &rating, &now
+		return tx.Model(&Booking{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"rating":   rating,
+			"rated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// applyStatusChange moves the locked booking to the new status and records the change, failing
+// with ErrStatusChanged when the booking left the status the change was made from. Columns in
+// extra are updated along with the status.
+func applyStatusChange(tx *gorm.DB, change BookingStatusChange, extra map[string]interface{}) (*Booking, error) {
+	var booking Booking
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Booking{}).Where("id = ?", change.BookingID).
+		Take(&booking).Error
+	if err != nil {
+		return nil, err
+	}
+	if booking.Status != change.FromStatus {
+		return nil, ErrStatusChanged
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":          change.ToStatus,
+		"last_updated_on": now,
+	}
+	for column, value := range extra {
+		updates[column] = value
+	}
+	if column, ok := statusTimestamps[change.ToStatus]; ok {
+		updates[column] = now
+	}
+	if change.ToStatus == CancelledStatus {
+		updates["cancelled_by"] = change.ChangedBy
+		updates["cancellation_reason"] = change.Reason
+	}
+	if change.Fee != nil {
+		updates["cancellation_fee"] = *change.Fee
+	}
+	if change.Refund != nil {
+		updates["refund_amount"] = *change.Refund
+	}
+	if err = tx.Model(&Booking{}).Where("id = ?", change.BookingID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err = tx.Model(&BookingStatusChange{}).Create(&change).Error; err != nil {
+		return nil, err
+	}
+	if err = tx.Model(&Booking{}).Where("id = ?", change.BookingID).Take(&booking).Error; err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (b *BookingRepoImpl) BookingChecks(ctx context.Context, bookingId int) (*[]BookingCheck, error) {
+	var checks []BookingCheck
+	err := b.repo.DB.WithContext(ctx).Model(&BookingCheck{}).Where("booking_id = ?", bookingId).
+		Order("id").Find(&checks).Error
+	if err != nil {
+		return nil, err
+	}
+	return &checks, nil
+}
+
+func (b *BookingRepoImpl) CountBookingPhotos(ctx context.Context, bookingId int) (int64, error) {
+	var count int64
+	err := b.repo.DB.WithContext(ctx).Model(&BookingPhoto{}).Where("booking_id = ?", bookingId).Count(&count).Error
+	return count, err
+}
+
+func (b *BookingRepoImpl) CreateBookingPhoto(ctx context.Context, photo BookingPhoto) (*BookingPhoto, error) {
+	if err := b.repo.DB.WithContext(ctx).Model(&BookingPhoto{}).Create(&photo).Error; err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func (b *BookingRepoImpl) BookingPhotos(ctx context.Context, bookingId int) (*[]BookingPhoto, error) {
+	var photos []BookingPhoto
+	err := b.repo.DB.WithContext(ctx).Model(&BookingPhoto{}).Where("booking_id = ?", bookingId).
+		Order("id").Find(&photos).Error
+	if err != nil {
+		return nil, err
+	}
+	return &photos, nil
+}
+
+func (b *BookingRepoImpl) BookingHistory(ctx context.Context, bookingId int) (*[]BookingStatusChange, error) {
+	var history []BookingStatusChange
+	err := b.repo.DB.WithContext(ctx).Model(&BookingStatusChange{}).Where("booking_id = ?", bookingId).
+		Order("id").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// CountUpcomingBookings counts the active bookings of the service that end after the given time,
+// bookings in progress are counted whatever their schedule.
+func (b *BookingRepoImpl) CountUpcomingBookings(ctx context.Context, serviceId int, after time.Time) (int64, error) {
+	var count int64
+	err := b.repo.DB.WithContext(ctx).Model(&Booking{}).Where("service_id = ?", serviceId).
+		Where("status = ? OR (status IN ? AND scheduled_end > ?)", InProgressStatus,
+			[]string{HeldStatus, RequestedStatus, ConfirmedStatus}, after).
+		Count(&count).Error
+	return count, err
+}
+
+// ActiveBookings returns the active bookings of the servitors that overlap the period, soonest first.
+func (b *BookingRepoImpl) ActiveBookings(ctx context.Context, servitorIds []int, from time.Time,
+	to time.Time) (*[]Booking, error) {
+	var bookings []Booking
+	if len(servitorIds) == 0 {
+		return &bookings, nil
+	}
+	err := b.repo.DB.WithContext(ctx).Model(&Booking{}).
+		Where("servitor_id IN ? AND status IN ?", servitorIds, activeStatuses).
+		Where("scheduled_start < ? AND scheduled_end > ?", to, from).
+		Order("scheduled_start").Find(&bookings).Error
+	if err != nil {
+		return nil, err
+	}
+	return &bookings, nil
+}
+
+func (b *BookingRepoImpl) GetSchedule(ctx context.Context, servitorId int) (*Schedule, error) {
+	var schedule Schedule
+	err := b.repo.DB.WithContext(ctx).Model(&Schedule{}).Where("servitor_id = ?", servitorId).
+		Preload("Windows", func(db *gorm.DB) *gorm.DB { return db.Order("weekday, start_time") }).
+		Take(&schedule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (b *BookingRepoImpl) GetSchedules(ctx context.Context, servitorIds []int) (*[]Schedule, error) {
+	var schedules []Schedule
+	if len(servitorIds) == 0 {
+		return &schedules, nil
+	}
+	err := b.repo.DB.WithContext(ctx).Model(&Schedule{}).Where("servitor_id IN ?", servitorIds).
+		Preload("Windows").Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+	return &schedules, nil
+}
+
+// SaveSchedule creates or replaces the servitor's schedule along with its availability windows.
+func (b *BookingRepoImpl) SaveSchedule(ctx context.Context, schedule Schedule) (*Schedule, error) {
+	schedule.LastUpdatedOn = time.Now()
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "servitor_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"time_zone", "buffer_minutes", "slot_step_minutes", "last_updated_on"}),
+		}).Omit("Windows").Create(&schedule).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("servitor_id = ?", schedule.ServitorID).Delete(&AvailabilityWindow{}).Error; err != nil {
+			return err
+		}
+		if len(schedule.Windows) == 0 {
+			return nil
+		}
+		for i := range schedule.Windows {
+			schedule.Windows[i].ServitorID = schedule.ServitorID
+		}
+		return tx.Create(&schedule.Windows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// RescheduleBooking moves a requested or confirmed booking to the booking's new times and address,
+// keeping it clear of the servitor's other bookings the same way CreateBooking does. A change of
+// status, such as a confirmed booking going back to requested, is recorded in its history.
+func (b *BookingRepoImpl) RescheduleBooking(ctx context.Context, booking Booking, buffer time.Duration,
+	changedBy int) (*Booking, error) {
+	var current Booking
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Schedule{}).
+			Where("servitor_id = ?", booking.ServitorID).Take(&Schedule{}).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNoSchedule
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Booking{}).Where("id = ?", booking.ID).
+			Take(&current).Error
+		if err != nil {
+			return err
+		}
+		if current.Status != RequestedStatus && current.Status != ConfirmedStatus {
+			return ErrStatusChanged
+		}
+		if err = checkSlotFree(tx, booking, buffer); err != nil {
+			return err
+		}
+		err = tx.Model(&Booking{}).Where("id = ?", booking.ID).Updates(map[string]interface{}{
+			"scheduled_start": booking.ScheduledStart,
+			"scheduled_end":   booking.ScheduledEnd,
+			"address":         booking.Address,
+			"notes":           booking.Notes,
+			"status":          booking.Status,
+			"last_updated_on": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if booking.Status != current.Status {
+			err = tx.Model(&BookingStatusChange{}).Create(&BookingStatusChange{
+				BookingID:  booking.ID,
+				FromStatus: current.Status,
+				ToStatus:   booking.Status,
+				Reason:     "rescheduled",
+				ChangedBy:  changedBy,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Booking{}).Where("id = ?", booking.ID).Take(&current).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+func (b *BookingRepoImpl) CreateSeries(ctx context.Context, series BookingSeries) (*BookingSeries, error) {
+	series.Status = ActiveSeries
+	if err := b.repo.DB.WithContext(ctx).Model(&BookingSeries{}).Omit("Conflicts").Create(&series).Error; err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (b *BookingRepoImpl) GetSeriesByID(ctx context.Context, id int) (*BookingSeries, error) {
+	var series BookingSeries
+	err := b.repo.DB.WithContext(ctx).Model(&BookingSeries{}).Where("id = ?", id).
+		Preload("Conflicts", func(db *gorm.DB) *gorm.DB { return db.Order("occurrence") }).
+		Take(&series).Error
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// SeriesList returns the matching series, newest first. Status filters on the series status.
+func (b *BookingRepoImpl) SeriesList(ctx context.Context, filter BookingFilter) (*[]BookingSeries, error) {
+	var series []BookingSeries
+	db := b.repo.DB.WithContext(ctx).Model(&BookingSeries{})
+	if filter.CustomerID != 0 {
+		db = db.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.ServitorID != 0 {
+		db = db.Where("servitor_id = ?", filter.ServitorID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if err := db.Order("created_on DESC, id DESC").Find(&series).Error; err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// SaveSeriesProgress stores how far the series was materialised along with the occurrences that
+// could not be booked. A series cancelled in the meantime stays cancelled.
+func (b *BookingRepoImpl) SaveSeriesProgress(ctx context.Context, series BookingSeries, conflicts []SeriesConflict) error {
+	return b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&BookingSeries{}).Where("id = ? AND status <> ?", series.ID, CancelledSeries).
+			Updates(map[string]interface{}{
+				"status":          series.Status,
+				"next_index":      series.NextIndex,
+				"occurrences":     series.Occurrences,
+				"last_updated_on": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		if len(conflicts) == 0 {
+			return nil
+		}
+		for i := range conflicts {
+			conflicts[i].SeriesID = series.ID
+		}
+		return tx.Model(&SeriesConflict{}).Create(&conflicts).Error
+	})
+}
+
+// UpdateSeriesDetails changes the address and notes of the series and of its requested and
+// confirmed occurrences starting after the given time.
+func (b *BookingRepoImpl) UpdateSeriesDetails(ctx context.Context, series BookingSeries, after time.Time) error {
+	now := time.Now()
+	return b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&BookingSeries{}).Where("id = ?", series.ID).Updates(map[string]interface{}{
+			"address":         series.Address,
+			"notes":           series.Notes,
+			"last_updated_on": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Booking{}).Where("series_id = ? AND status IN ? AND scheduled_start > ?", series.ID,
+			[]string{HeldStatus, RequestedStatus, ConfirmedStatus}, after).
+			Updates(map[string]interface{}{
+				"address":         series.Address,
+				"notes":           series.Notes,
+				"last_updated_on": now,
+			}).Error
+	})
+}
+
+func (b *BookingRepoImpl) GetCalendarFeed(ctx context.Context, servitorId int) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := b.repo.DB.WithContext(ctx).Model(&CalendarFeed{}).Where("servitor_id = ?", servitorId).Take(&feed).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (b *BookingRepoImpl) GetCalendarFeedByToken(ctx context.Context, token string) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := b.repo.DB.WithContext(ctx).Model(&CalendarFeed{}).Where("token = ?", token).Take(&feed).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// SaveCalendarFeed creates the servitor's feed or replaces its token.
+func (b *BookingRepoImpl) SaveCalendarFeed(ctx context.Context, feed CalendarFeed) (*CalendarFeed, error) {
+	feed.CreatedOn = time.Now()
+	err := b.repo.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Model(&CalendarFeed{}).
+		Create(&feed).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// CreateCalendarSource stores the imported calendar along with the times it shows the servitor busy.
+func (b *BookingRepoImpl) CreateCalendarSource(ctx context.Context, source CalendarSource,
+	periods []BusyPeriod) (*CalendarSource, error) {
+	now := time.Now()
+	source.LastSyncedAt = &now
+	source.BusyPeriods = len(periods)
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&CalendarSource{}).Create(&source).Error; err != nil {
+			return err
+		}
+		return createBusyPeriods(tx, source, periods)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+func (b *BookingRepoImpl) GetCalendarSourceByID(ctx context.Context, id int) (*CalendarSource, error) {
+	var source CalendarSource
+	err := b.repo.DB.WithContext(ctx).Model(&CalendarSource{}).Where("id = ?", id).Take(&source).Error
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+func (b *BookingRepoImpl) CalendarSources(ctx context.Context, servitorId int) (*[]CalendarSource, error) {
+	var sources []CalendarSource
+	err := b.repo.DB.WithContext(ctx).Model(&CalendarSource{}).Where("servitor_id = ?", servitorId).
+		Order("id").Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sources, nil
+}
+
+// SubscribedCalendarSources returns the imported calendars that are fetched from a URL.
+func (b *BookingRepoImpl) SubscribedCalendarSources(ctx context.Context) (*[]CalendarSource, error) {
+	var sources []CalendarSource
+	err := b.repo.DB.WithContext(ctx).Model(&CalendarSource{}).Where("url <> ''").Order("id").Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sources, nil
+}
+
+// ReplaceBusyPeriods swaps the busy times of the calendar for the ones it was synced with last and
+// clears its sync error.
+func (b *BookingRepoImpl) ReplaceBusyPeriods(ctx context.Context, sourceId int, periods []BusyPeriod) error {
+	return b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var source CalendarSource
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&CalendarSource{}).Where("id = ?", sourceId).
+			Take(&source).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("source_id = ?", sourceId).Delete(&BusyPeriod{}).Error; err != nil {
+			return err
+		}
+		if err = createBusyPeriods(tx, source, periods); err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Model(&CalendarSource{}).Where("id = ?", sourceId).Updates(map[string]interface{}{
+			"busy_periods":    len(periods),
+			"last_synced_at":  now,
+			"last_error":      "",
+			"last_updated_on": now,
+		}).Error
+	})
+}
+
+func (b *BookingRepoImpl) SetCalendarSourceError(ctx context.Context, sourceId int, message string) error {
+	return b.repo.DB.WithContext(ctx).Model(&CalendarSource{}).Where("id = ?", sourceId).
+		Updates(map[string]interface{}{
+			"last_error":      message,
+			"last_updated_on": time.Now(),
+		}).Error
+}
+
+// DeleteCalendarSource removes the imported calendar and the busy times it brought in.
+func (b *BookingRepoImpl) DeleteCalendarSource(ctx context.Context, id int) error {
+	return b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", id).Delete(&BusyPeriod{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&CalendarSource{}).Error
+	})
+}
+
+// BusyPeriods returns the imported busy times of the servitors that overlap the period, soonest first.
+func (b *BookingRepoImpl) BusyPeriods(ctx context.Context, servitorIds []int, from time.Time,
+	to time.Time) (*[]BusyPeriod, error) {
+	var periods []BusyPeriod
+	if len(servitorIds) == 0 {
+		return &periods, nil
+	}
+	err := b.repo.DB.WithContext(ctx).Model(&BusyPeriod{}).Where("servitor_id IN ?", servitorIds).
+		Where("starts_at < ? AND ends_at > ?", to, from).Order("starts_at").Find(&periods).Error
+	if err != nil {
+		return nil, err
+	}
+	return &periods, nil
+}
+
+func createBusyPeriods(tx *gorm.DB, source CalendarSource, periods []BusyPeriod) error {
+	if len(periods) == 0 {
+		return nil
+	}
+	for i := range periods {
+		periods[i].SourceID = source.ID
+		periods[i].ServitorID = source.ServitorID
+	}
+	return tx.Model(&BusyPeriod{}).CreateInBatches(&periods, 500).Error
+}
+
+func (b *BookingRepoImpl) CreateWaitlistEntry(ctx context.Context, entry WaitlistEntry) (*WaitlistEntry, error) {
+	entry.Status = WaitingEntry
+	if err := b.repo.DB.WithContext(ctx).Model(&WaitlistEntry{}).Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (b *BookingRepoImpl) GetWaitlistEntryByID(ctx context.Context, id int) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	err := b.repo.DB.WithContext(ctx).Model(&WaitlistEntry{}).Where("id = ?", id).Take(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// WaitlistEntries returns the matching waitlist entries in the order they joined the waitlist.
+func (b *BookingRepoImpl) WaitlistEntries(ctx context.Context, filter WaitlistFilter) (*[]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	db := b.repo.DB.WithContext(ctx).Model(&WaitlistEntry{})
+	if filter.CustomerID != 0 {
+		db = db.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.ServitorID != 0 {
+		db = db.Where("servitor_id = ?", filter.ServitorID)
+	}
+	if filter.ServiceID != 0 {
+		db = db.Where("service_id = ?", filter.ServiceID)
+	}
+	if len(filter.Statuses) > 0 {
+		db = db.Where("status IN ?", filter.Statuses)
+	}
+	if !filter.LatestStartAfter.IsZero() {
+		db = db.Where("latest_start > ?", filter.LatestStartAfter)
+	}
+	if err := db.Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return &entries, nil
+}
+
+// WaitlistServitors returns the servitors with customers still waiting for a slot starting after the time.
+func (b *BookingRepoImpl) WaitlistServitors(ctx context.Context, after time.Time) ([]int, error) {
+	var servitorIds []int
+	err := b.repo.DB.WithContext(ctx).Model(&WaitlistEntry{}).Where("status = ? AND latest_start > ?", WaitingEntry, after).
+		Distinct().Pluck("servitor_id", &servitorIds).Error
+	return servitorIds, err
+}
+
+// HoldWaitlistSlot books the slot as held for the waiting entry until expiresAt, the slot is checked
+// the same way CreateBooking does. It fails with ErrWaitlistChanged when the entry stopped waiting.
+func (b *BookingRepoImpl) HoldWaitlistSlot(ctx context.Context, entryId int, booking Booking, buffer time.Duration,
+	expiresAt time.Time) (*Booking, error) {
+	booking.Status = HeldStatus
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var entry WaitlistEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&WaitlistEntry{}).Where("id = ?", entryId).
+			Take(&entry).Error
+		if err != nil {
+			return err
+		}
+		if entry.Status != WaitingEntry {
+			return ErrWaitlistChanged
+		}
+		if err = createBooking(tx, &booking, buffer); err != nil {
+			return err
+		}
+		return tx.Model(&WaitlistEntry{}).Where("id = ?", entryId).Updates(map[string]interface{}{
+			"status":          OfferedEntry,
+			"booking_id":      booking.ID,
+			"hold_expires_at": expiresAt,
+			"last_updated_on": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// CloseWaitlistEntry moves the entry from one status to another along with the change to its held
+// booking, if any, failing with ErrWaitlistChanged when the entry is no longer in from.
+func (b *BookingRepoImpl) CloseWaitlistEntry(ctx context.Context, entryId int, from string, to string,
+	change *BookingStatusChange) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	err := b.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&WaitlistEntry{}).Where("id = ?", entryId).
+			Take(&entry).Error
+		if err != nil {
+			return err
+		}
+		if entry.Status != from {
+			return ErrWaitlistChanged
+		}
+		err = tx.Model(&WaitlistEntry{}).Where("id = ?", entryId).Updates(map[string]interface{}{
+			"status":          to,
+			"last_updated_on": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			if _, err = applyStatusChange(tx, *change, nil); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&WaitlistEntry{}).Where("id = ?", entryId).Take(&entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// LapseEndedWaitlistEntries closes the entries still waiting for a slot that had to start before the time.
+func (b *BookingRepoImpl) LapseEndedWaitlistEntries(ctx context.Context, before time.Time) error {
+	return b.repo.DB.WithContext(ctx).Model(&WaitlistEntry{}).Where("status = ? AND latest_start <= ?", WaitingEntry, before).
+		Updates(map[string]interface{}{
+			"status":          LapsedEntry,
+			"last_updated_on": time.Now(),
+		}).Error
+}
@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"servhunt/infra/dao"
+)
+
+// testDSNEnv names the MySQL database the repo tests run against, the slot lock relies on row
+// locking so it cannot be faked.
+const testDSNEnv = "SERVHUNT_TEST_MYSQL_DSN"
+
+const concurrentBookings = 8
+
+func testRepo(t *testing.T) (*BookingRepoImpl, int) {
+	t.Helper()
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(concurrentBookings + 2)
+	err = db.AutoMigrate(&Schedule{}, &AvailabilityWindow{}, &Booking{}, &BookingStatusChange{},
+		&CalendarSource{}, &BusyPeriod{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servitorId := int(time.Now().UnixNano() % 1000000000)
+	if err = db.Create(&Schedule{ServitorID: servitorId, TimeZone: "UTC"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("booking_id IN (?)", db.Model(&Booking{}).Select("id").Where("servitor_id = ?", servitorId)).
+			Delete(&BookingStatusChange{})
+		db.Where("servitor_id = ?", servitorId).Delete(&Booking{})
+		db.Where("servitor_id = ?", servitorId).Delete(&BusyPeriod{})
+		db.Where("servitor_id = ?", servitorId).Delete(&CalendarSource{})
+		db.Where("servitor_id = ?", servitorId).Delete(&Schedule{})
+		sqlDB.Close()
+	})
+	return &BookingRepoImpl{repo: dao.InitRepository(db)}, servitorId
+}
+
+func testBooking(servitorId int, customerId int, start time.Time, minutes int) Booking {
+	return Booking{
+		ServiceID:      1,
+		CustomerID:     customerId,
+		ServitorID:     servitorId,
+		ScheduledStart: start,
+		ScheduledEnd:   start.Add(time.Duration(minutes) * time.Minute),
+	}
+}
+
+// raceBookings creates the bookings all at once and returns the ones booked, every other attempt
+// must fail with ErrSlotTaken.
+func raceBookings(t *testing.T, repo *BookingRepoImpl, bookings []Booking, buffer time.Duration) []Booking {
+	t.Helper()
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		booked []Booking
+		start  = make(chan struct{})
+	)
+	for _, booking := range bookings {
+		wg.Add(1)
+		go func(booking Booking) {
+			defer wg.Done()
+			<-start
+			created, err := repo.CreateBooking(context.Background(), booking, buffer)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				booked = append(booked, *created)
+			case !errors.Is(err, ErrSlotTaken):
+				t.Errorf("booking %v - %v: got %v, want ErrSlotTaken", booking.ScheduledStart,
+					booking.ScheduledEnd, err)
+			}
+		}(booking)
+	}
+	close(start)
+	wg.Wait()
+	return booked
+}
+
+func TestCreateBookingConcurrentOverlaps(t *testing.T) {
+	repo, servitorId := testRepo(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+
+	bookings := []Booking{}
+	for i := 0; i < concurrentBookings; i++ {
+		// every booking overlaps every other, starting up to 35 minutes apart
+		bookings = append(bookings, testBooking(servitorId, i+1, base.Add(time.Duration(i*5)*time.Minute), 60))
+	}
+	if booked := raceBookings(t, repo, bookings, 0); len(booked) != 1 {
+		t.Fatalf("got %d bookings, want exactly 1", len(booked))
+	}
+}
+
+func TestCreateBookingConcurrentBufferEdges(t *testing.T) {
+	repo, servitorId := testRepo(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(72 * time.Hour)
+	buffer := 15 * time.Minute
+
+	// The two slots do not overlap but start within the buffer of each other's end
+	bookings := []Booking{}
+	for i := 0; i < concurrentBookings; i++ {
+		if i%2 == 0 {
+			bookings = append(bookings, testBooking(servitorId, i+1, base, 60))
+		} else {
+			bookings = append(bookings, testBooking(servitorId, i+1, base.Add(74*time.Minute), 60))
+		}
+	}
+	booked := raceBookings(t, repo, bookings, buffer)
+	if len(booked) != 1 {
+		t.Fatalf("got %d bookings, want exactly 1", len(booked))
+	}
+	winner := booked[0]
+
+	tests := []struct {
+		name    string
+		start   time.Time
+		wantErr error
+	}{
+		{"a minute inside the buffer after", winner.ScheduledEnd.Add(buffer - time.Minute), ErrSlotTaken},
+		{"a minute inside the buffer before", winner.ScheduledStart.Add(-buffer - 59*time.Minute), ErrSlotTaken},
+		{"right at the buffer after", winner.ScheduledEnd.Add(buffer), nil},
+		{"right at the buffer before", winner.ScheduledStart.Add(-buffer - time.Hour), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.CreateBooking(context.Background(), testBooking(servitorId, 99, tt.start, 60), buffer)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateBookingConcurrentBusyPeriods(t *testing.T) {
+	repo, servitorId := testRepo(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(96 * time.Hour)
+	buffer := 10 * time.Minute
+
+	_, err := repo.CreateCalendarSource(context.Background(), CalendarSource{ServitorID: servitorId, Name: "work"},
+		[]BusyPeriod{{StartsAt: base, EndsAt: base.Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start      time.Time
+		wantBooked int
+	}{
+		{"overlapping the busy period", base.Add(30 * time.Minute), 0},
+		{"inside the buffer of the busy period", base.Add(time.Hour + buffer - time.Minute), 0},
+		{"right at the buffer of the busy period", base.Add(time.Hour + buffer), 1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bookings := []Booking{}
+			for j := 0; j < concurrentBookings; j++ {
+				bookings = append(bookings, testBooking(servitorId, i*concurrentBookings+j+1, tt.start, 45))
+			}
+			if booked := raceBookings(t, repo, bookings, buffer); len(booked) != tt.wantBooked {
+				t.Errorf("got %d bookings, want %d", len(booked), tt.wantBooked)
+			}
+		})
+	}
+}
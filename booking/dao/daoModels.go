@@ -0,0 +1,263 @@
+package dao
+
+import (
+	"time"
+)
+
+// Statuses a booking moves through, completed, cancelled and no_show are final. A held booking keeps
+// a freed slot for a waitlisted customer until they claim it, which requests it, or the hold lapses.
+const (
+	HeldStatus       = "held"
+	RequestedStatus  = "requested"
+	ConfirmedStatus  = "confirmed"
+	InProgressStatus = "in_progress"
+	CompletedStatus  = "completed"
+	CancelledStatus  = "cancelled"
+	NoShowStatus     = "no_show"
+)
+
+// Booking is a customer's request for a service at a time and address, Price is in minor units of
+// Currency and copied from the service when the booking is requested.
+type Booking struct {
+	ID             int       `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID      int       `gorm:"index" json:"service_id"`
+	CustomerID     int       `gorm:"index" json:"customer_id"`
+	ServitorID     int       `gorm:"index" json:"servitor_id"`
+	SeriesID       *int      `gorm:"index" json:"series_id"`
+	Occurrence     int       `json:"occurrence"`
+	Status         string    `gorm:"type:varchar(16);index" json:"status"`
+	ScheduledStart time.Time `gorm:"index" json:"scheduled_start"`
+	ScheduledEnd   time.Time `json:"scheduled_end"`
+	Address        string    `gorm:"type:varchar(512)" json:"address"`
+	Notes          string    `gorm:"type:varchar(1024)" json:"notes"`
+	Price          int64     `json:"price"`
+	Currency       string    `gorm:"type:varchar(3)" json:"currency"`
+	// PricingModel is copied from the service, Price is the hourly rate of hourly bookings and the
+	// rate per unit of per unit bookings, which are for Units units
+	PricingModel string `gorm:"type:varchar(16)" json:"pricing_model"`
+	Units        int    `gorm:"default:1" json:"units"`
+	// Latitude and Longitude locate the address when the customer shared their position
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	// the cancellation policy of the service when the booking was made
+	FreeCancellationHours      int `json:"free_cancellation_hours"`
+	LateCancellationFeePercent int `json:"late_cancellation_fee_percent"`
+	NoShowFeePercent           int `json:"no_show_fee_percent"`
+	// CancellationFee and RefundAmount are set once the booking is cancelled or a no show
+	CancellationFee    *int64     `json:"cancellation_fee"`
+	RefundAmount       *int64     `json:"refund_amount"`
+	ConfirmedAt        *time.Time `json:"confirmed_at"`
+	StartedAt          *time.Time `json:"started_at"`
+	CompletedAt        *time.Time `json:"completed_at"`
+	CancelledAt        *time.Time `json:"cancelled_at"`
+	NoShowAt           *time.Time `json:"no_show_at"`
+	CancelledBy        int        `json:"cancelled_by"`
+	CancellationReason string     `gorm:"type:varchar(512)" json:"cancellation_reason"`
+	// ActualMinutes and FinalPrice are set when the servitor checks out, hourly bookings are billed
+	// for the minutes worked
+	ActualMinutes *int   `json:"actual_minutes"`
+	FinalPrice    *int64 `json:"final_price"`
+	// Rating is the customer's score of the completed booking from 1 to 5, a servitor's rating is
+	// the average over their bookings
+	Rating        *int       `gorm:"index" json:"rating"`
+	RatedAt       *time.Time `json:"rated_at"`
+	CreatedOn     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// BookingStatusChange records a move of a booking between statuses.
+type BookingStatusChange struct {
+	ID         int    `gorm:"primary_key; auto_increment" json:"id"`
+	BookingID  int    `gorm:"index" json:"booking_id"`
+	FromStatus string `gorm:"type:varchar(16)" json:"from_status"`
+	ToStatus   string `gorm:"type:varchar(16)" json:"to_status"`
+	Reason     string `gorm:"type:varchar(512)" json:"reason"`
+	ChangedBy  int    `json:"changed_by"`
+	// Fee and Refund are what the cancellation policy charged or refunded for the change
+	Fee       *int64    `json:"fee"`
+	Refund    *int64    `json:"refund"`
+	CreatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// Kinds of booking checks, servitors check in on arrival and out when they leave.
+const (
+	CheckIn  = "check_in"
+	CheckOut = "check_out"
+)
+
+// BookingCheck is where the servitor's device was when they checked in to or out of a booking.
+// DistanceMeters is how far that was from the booking site, nil when the site is not known, and
+// Verified tells whether it was close enough to count as being there.
+type BookingCheck struct {
+	ID             int       `gorm:"primary_key; auto_increment" json:"id"`
+	BookingID      int       `gorm:"index" json:"booking_id"`
+	Kind           string    `gorm:"type:varchar(16)" json:"kind"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	AccuracyMeters float64   `json:"accuracy_meters"`
+	DistanceMeters *float64  `json:"distance_meters"`
+	Verified       bool      `json:"verified"`
+	CreatedOn      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// Stages of booking photos, taken before the work starts and after it is done.
+const (
+	BeforePhoto = "before"
+	AfterPhoto  = "after"
+)
+
+// BookingPhoto is a photo of the work taken by either participant, kept as evidence.
+type BookingPhoto struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	BookingID  int       `gorm:"index" json:"booking_id"`
+	Stage      string    `gorm:"type:varchar(8)" json:"stage"`
+	UploadedBy int       `json:"uploaded_by"`
+	StorageKey string    `gorm:"type:varchar(256)" json:"storage_key"`
+	Url        string    `gorm:"type:varchar(512)" json:"url"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// BookingFilter narrows down the bookings or series listed for a user, empty fields are ignored.
+type BookingFilter struct {
+	CustomerID    int
+	ServitorID    int
+	SeriesID      int
+	Status        string
+	EndsAfter     time.Time
+	EndsBefore    time.Time
+	StartsAfter   time.Time
+	StartsBefore  time.Time
+	CreatedBefore time.Time
+}
+
+// Statuses of a waitlist entry, booked, lapsed and left are final.
+const (
+	WaitingEntry = "waiting"
+	OfferedEntry = "offered"
+	BookedEntry  = "booked"
+	LapsedEntry  = "lapsed"
+	LeftEntry    = "left"
+)
+
+// WaitlistEntry is a customer waiting for a slot of a service starting between EarliestStart and
+// LatestStart. When a slot frees up the entry is offered a held booking for it, BookingID, until
+// HoldExpiresAt.
+type WaitlistEntry struct {
+	ID            int        `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID     int        `gorm:"index" json:"service_id"`
+	CustomerID    int        `gorm:"index" json:"customer_id"`
+	ServitorID    int        `gorm:"index" json:"servitor_id"`
+	EarliestStart time.Time  `json:"earliest_start"`
+	LatestStart   time.Time  `gorm:"index" json:"latest_start"`
+	Address       string     `gorm:"type:varchar(512)" json:"address"`
+	Notes         string     `gorm:"type:varchar(1024)" json:"notes"`
+	Latitude      *float64   `json:"latitude"`
+	Longitude     *float64   `json:"longitude"`
+	Status        string     `gorm:"type:varchar(16);index" json:"status"`
+	BookingID     *int       `json:"booking_id"`
+	HoldExpiresAt *time.Time `json:"hold_expires_at"`
+	CreatedOn     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// WaitlistFilter narrows down the waitlist entries listed, empty fields are ignored.
+type WaitlistFilter struct {
+	CustomerID       int
+	ServitorID       int
+	ServiceID        int
+	Statuses         []string
+	LatestStartAfter time.Time
+}
+
+// Statuses of a booking series, a series is complete once its rule produced its last occurrence.
+const (
+	ActiveSeries    = "active"
+	CompleteSeries  = "complete"
+	CancelledSeries = "cancelled"
+)
+
+// BookingSeries books a service again and again following Rule, a subset of the iCalendar RRULE.
+// Occurrences are materialised as bookings a while ahead, NextIndex is the next date the rule
+// produces to look at and Occurrences counts the dates produced so far.
+type BookingSeries struct {
+	ID              int              `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID       int              `gorm:"index" json:"service_id"`
+	CustomerID      int              `gorm:"index" json:"customer_id"`
+	ServitorID      int              `gorm:"index" json:"servitor_id"`
+	Rule            string           `gorm:"type:varchar(128)" json:"rule"`
+	FirstStart      time.Time        `json:"first_start"`
+	DurationMinutes int              `json:"duration_minutes"`
+	TimeZone        string           `gorm:"type:varchar(64)" json:"time_zone"`
+	Address         string           `gorm:"type:varchar(512)" json:"address"`
+	Notes           string           `gorm:"type:varchar(1024)" json:"notes"`
+	Status          string           `gorm:"type:varchar(16);index" json:"status"`
+	NextIndex       int              `json:"next_index"`
+	Occurrences     int              `json:"occurrences"`
+	Conflicts       []SeriesConflict `gorm:"foreignKey:SeriesID" json:"conflicts"`
+	CreatedOn       time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn   time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// SeriesConflict records an occurrence of a series that could not be booked.
+type SeriesConflict struct {
+	ID             int       `gorm:"primary_key; auto_increment" json:"id"`
+	SeriesID       int       `gorm:"index" json:"series_id"`
+	Occurrence     int       `json:"occurrence"`
+	ScheduledStart time.Time `json:"scheduled_start"`
+	ScheduledEnd   time.Time `json:"scheduled_end"`
+	Reason         string    `gorm:"type:varchar(255)" json:"reason"`
+	CreatedOn      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// Schedule lays out when a servitor takes bookings. Bookings are kept BufferMinutes apart and slots
+// start every SlotStepMinutes within the availability windows, which are read in TimeZone.
+type Schedule struct {
+	ServitorID      int                  `gorm:"primary_key" json:"servitor_id"`
+	TimeZone        string               `gorm:"type:varchar(64)" json:"time_zone"`
+	BufferMinutes   int                  `json:"buffer_minutes"`
+	SlotStepMinutes int                  `json:"slot_step_minutes"`
+	Windows         []AvailabilityWindow `gorm:"foreignKey:ServitorID;references:ServitorID" json:"windows"`
+	LastUpdatedOn   time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// AvailabilityWindow is a weekly period a servitor takes bookings in, Weekday counts from Sunday as 0
+// and StartTime and EndTime are HH:MM wall clock times.
+type AvailabilityWindow struct {
+	ID         int    `gorm:"primary_key; auto_increment" json:"id"`
+	ServitorID int    `gorm:"index" json:"servitor_id"`
+	Weekday    int    `json:"weekday"`
+	StartTime  string `gorm:"type:varchar(5)" json:"start_time"`
+	EndTime    string `gorm:"type:varchar(5)" json:"end_time"`
+}
+
+// CalendarFeed holds the secret token a servitor's bookings are published under as an iCalendar feed.
+type CalendarFeed struct {
+	ServitorID int       `gorm:"primary_key" json:"servitor_id"`
+	Token      string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// CalendarSource is a calendar a servitor imported, either subscribed to at Url or uploaded when
+// Url is empty. Its busy events block the servitor's availability.
+type CalendarSource struct {
+	ID            int        `gorm:"primary_key; auto_increment" json:"id"`
+	ServitorID    int        `gorm:"index" json:"servitor_id"`
+	Name          string     `gorm:"type:varchar(128)" json:"name"`
+	Url           string     `gorm:"type:varchar(2048)" json:"url"`
+	BusyPeriods   int        `json:"busy_periods"`
+	LastSyncedAt  *time.Time `json:"last_synced_at"`
+	LastError     string     `gorm:"type:varchar(512)" json:"last_error"`
+	CreatedOn     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// BusyPeriod is a time an imported calendar shows the servitor as busy.
+type BusyPeriod struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	SourceID   int       `gorm:"index" json:"source_id"`
+	ServitorID int       `gorm:"index:idx_busy_servitor" json:"servitor_id"`
+	StartsAt   time.Time `gorm:"index:idx_busy_servitor" json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+}
@@ -0,0 +1,646 @@
+package booking
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"servhunt/booking/dao"
+	"servhunt/infra/ical"
+	"servhunt/infra/imaging"
+	"servhunt/infra/utils"
+	"servhunt/storage"
+	"strconv"
+	"strings"
+)
+
+type BookingHandler interface {
+	RequestBooking(ctx *gin.Context)
+	MyBookings(ctx *gin.Context)
+	GetBooking(ctx *gin.Context)
+	BookingHistory(ctx *gin.Context)
+	AcceptBooking(ctx *gin.Context)
+	DeclineBooking(ctx *gin.Context)
+	StartBooking(ctx *gin.Context)
+	CompleteBooking(ctx *gin.Context)
+	CancelBooking(ctx *gin.Context)
+	ReportNoShow(ctx *gin.Context)
+	RateBooking(ctx *gin.Context)
+	Slots(ctx *gin.Context)
+	GetSchedule(ctx *gin.Context)
+	SaveSchedule(ctx *gin.Context)
+	RescheduleBooking(ctx *gin.Context)
+	CreateSeries(ctx *gin.Context)
+	MySeries(ctx *gin.Context)
+	GetSeries(ctx *gin.Context)
+	UpdateSeries(ctx *gin.Context)
+	CancelSeries(ctx *gin.Context)
+	GetCalendarFeed(ctx *gin.Context)
+	RotateCalendarFeed(ctx *gin.Context)
+	CalendarFeed(ctx *gin.Context)
+	SubscribeCalendar(ctx *gin.Context)
+	UploadCalendar(ctx *gin.Context)
+	CalendarSources(ctx *gin.Context)
+	SyncCalendarSource(ctx *gin.Context)
+	DeleteCalendarSource(ctx *gin.Context)
+	CheckIn(ctx *gin.Context)
+	CheckOut(ctx *gin.Context)
+	UploadBookingPhoto(ctx *gin.Context)
+	BookingVisit(ctx *gin.Context)
+	JoinWaitlist(ctx *gin.Context)
+	MyWaitlist(ctx *gin.Context)
+	ClaimWaitlistSlot(ctx *gin.Context)
+	LeaveWaitlist(ctx *gin.Context)
+}
+
+type BookingHandlerImpl struct {
+	BookingService
+}
+
+func NewBookingHandlerImpl(svc BookingService) BookingHandler {
+	return &BookingHandlerImpl{BookingService: svc}
+}
+
+// bookingError writes the response for a failed booking call and reports whether there was one.
+func bookingError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotParticipant), errors.Is(err, ErrMoveNotAllowed), errors.Is(err, ErrNotServitor),
+		errors.Is(err, ErrNotWaitlisted), errors.Is(err, ErrNotCustomer), errors.Is(err, ErrCheckRequired):
+		utils.APIResponse(ctx, "You cannot make that change to the booking", http.StatusForbidden,
+			false, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, dao.ErrStatusChanged),
+		errors.Is(err, ErrServiceUnavailable), errors.Is(err, ErrBookingStartPassed),
+		errors.Is(err, ErrBookingNotStarted), errors.Is(err, dao.ErrSlotTaken), errors.Is(err, dao.ErrNoSchedule),
+		errors.Is(err, ErrOutsideAvailability), errors.Is(err, ErrSeriesEnded), errors.Is(err, ErrPhotosClosed),
+		errors.Is(err, ErrAlreadyWaitlisted), errors.Is(err, ErrWaitlistClosed), errors.Is(err, ErrNoHold),
+		errors.Is(err, ErrHoldExpired), errors.Is(err, dao.ErrWaitlistChanged), errors.Is(err, ErrRatingClosed),
+		errors.Is(err, dao.ErrAlreadyRated):
+		utils.APIResponse(ctx, "Failed to update booking", http.StatusConflict, false, err.Error())
+	case errors.Is(err, ErrOwnService), errors.Is(err, ErrInvalidSchedule), errors.Is(err, ErrUnknownRole),
+		errors.Is(err, ErrInvalidRange), errors.Is(err, ErrInvalidAvailability), errors.Is(err, ErrInvalidRule),
+		errors.Is(err, ErrInvalidCalendarURL), errors.Is(err, ical.ErrInvalidCalendar),
+		errors.Is(err, ErrCalendarNotSubscribed), errors.Is(err, ErrInvalidSite), errors.Is(err, ErrTooManyPhotos),
+		errors.Is(err, storage.ErrUnsupportedPhoto):
+		utils.APIResponse(ctx, "Failed to update booking", http.StatusBadRequest, false, err.Error())
+	case errors.Is(err, ErrCalendarTooLarge):
+		utils.APIResponse(ctx, "Calendar is too large", http.StatusRequestEntityTooLarge, false, err.Error())
+	case errors.Is(err, storage.ErrPhotoTooLarge), errors.Is(err, imaging.ErrTooManyPixels):
+		utils.APIResponse(ctx, "Photo is too large", http.StatusRequestEntityTooLarge, false, err.Error())
+	case errors.Is(err, ErrCalendarFetch):
+		utils.APIResponse(ctx, "Failed to fetch calendar", http.StatusBadGateway, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (b *BookingHandlerImpl) RequestBooking(ctx *gin.Context) {
+	req := CreateBookingRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := b.BookingService.RequestBooking(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking requested successfully", http.StatusCreated, true, booking)
+}
+
+func (b *BookingHandlerImpl) MyBookings(ctx *gin.Context) {
+	req := FetchBookingsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	bookings, err := b.BookingService.UserBookings(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Bookings successfully returned", http.StatusOK, true, bookings)
+}
+
+func (b *BookingHandlerImpl) Slots(ctx *gin.Context) {
+	req := SlotsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	slots, err := b.BookingService.Slots(ctx, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Slots successfully returned", http.StatusOK, true, slots)
+}
+
+func (b *BookingHandlerImpl) GetSchedule(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	schedule, err := b.BookingService.GetSchedule(ctx, caller)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Schedule successfully returned", http.StatusOK, true, schedule)
+}
+
+func (b *BookingHandlerImpl) SaveSchedule(ctx *gin.Context) {
+	req := ScheduleRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	schedule, err := b.BookingService.SaveSchedule(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Schedule saved successfully", http.StatusOK, true, schedule)
+}
+
+func (b *BookingHandlerImpl) GetBooking(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := b.BookingService.GetBooking(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking successfully returned", http.StatusOK, true, booking)
+}
+
+func (b *BookingHandlerImpl) BookingHistory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	history, err := b.BookingService.BookingHistory(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking history successfully returned", http.StatusOK, true, history)
+}
+
+func (b *BookingHandlerImpl) AcceptBooking(ctx *gin.Context) {
+	b.changeStatus(ctx, b.BookingService.AcceptBooking, "Booking accepted")
+}
+
+func (b *BookingHandlerImpl) StartBooking(ctx *gin.Context) {
+	b.changeStatus(ctx, b.BookingService.StartBooking, "Booking started")
+}
+
+func (b *BookingHandlerImpl) CompleteBooking(ctx *gin.Context) {
+	b.changeStatus(ctx, b.BookingService.CompleteBooking, "Booking completed")
+}
+
+func (b *BookingHandlerImpl) ReportNoShow(ctx *gin.Context) {
+	b.changeStatus(ctx, b.BookingService.ReportNoShow, "No show reported")
+}
+
+func (b *BookingHandlerImpl) RateBooking(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := RateBookingRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := b.BookingService.RateBooking(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking rated successfully", http.StatusOK, true, booking)
+}
+
+func (b *BookingHandlerImpl) DeclineBooking(ctx *gin.Context) {
+	b.changeStatusWithReason(ctx, b.BookingService.DeclineBooking, "Booking declined")
+}
+
+func (b *BookingHandlerImpl) CancelBooking(ctx *gin.Context) {
+	b.changeStatusWithReason(ctx, b.BookingService.CancelBooking, "Booking cancelled")
+}
+
+func (b *BookingHandlerImpl) RescheduleBooking(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := RescheduleBookingRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := b.BookingService.RescheduleBooking(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking rescheduled successfully", http.StatusOK, true, booking)
+}
+
+func (b *BookingHandlerImpl) CreateSeries(ctx *gin.Context) {
+	req := CreateSeriesRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	series, err := b.BookingService.CreateSeries(ctx, caller, req)
+	if errors.Is(err, ErrSeriesConflicts) {
+		utils.APIResponse(ctx, "Some occurrences conflict, nothing was booked", http.StatusConflict,
+			false, series)
+		return
+	}
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Series booked successfully", http.StatusCreated, true, series)
+}
+
+func (b *BookingHandlerImpl) MySeries(ctx *gin.Context) {
+	req := FetchBookingsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	series, err := b.BookingService.UserSeries(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Series successfully returned", http.StatusOK, true, series)
+}
+
+func (b *BookingHandlerImpl) GetSeries(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	series, err := b.BookingService.GetSeries(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Series successfully returned", http.StatusOK, true, series)
+}
+
+func (b *BookingHandlerImpl) UpdateSeries(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := UpdateSeriesRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	series, err := b.BookingService.UpdateSeries(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Series updated successfully", http.StatusOK, true, series)
+}
+
+func (b *BookingHandlerImpl) CancelSeries(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// the reason is optional so an empty body is allowed
+	req := BookingReasonRequest{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+				false, err.Error())
+			return
+		}
+	}
+	caller, _ := utils.GetCaller(ctx)
+	series, err := b.BookingService.CancelSeries(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Series cancelled", http.StatusOK, true, series)
+}
+
+func (b *BookingHandlerImpl) GetCalendarFeed(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	feed, err := b.BookingService.CalendarFeed(ctx, caller)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar feed successfully returned", http.StatusOK, true, feed)
+}
+
+func (b *BookingHandlerImpl) RotateCalendarFeed(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	feed, err := b.BookingService.RotateCalendarFeed(ctx, caller)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar feed moved to a new address", http.StatusOK, true, feed)
+}
+
+// CalendarFeed serves a servitor's bookings as an iCalendar file, the secret token in the address
+// stands in for authentication so calendar apps can subscribe to it.
+func (b *BookingHandlerImpl) CalendarFeed(ctx *gin.Context) {
+	token := strings.TrimSuffix(ctx.Param("token"), ".ics")
+	var buf bytes.Buffer
+	if err := b.BookingService.WriteCalendar(ctx, token, &buf); bookingError(ctx, err) {
+		return
+	}
+	ctx.Header("Cache-Control", "private, max-age=300")
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+func (b *BookingHandlerImpl) SubscribeCalendar(ctx *gin.Context) {
+	req := SubscribeCalendarRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	source, err := b.BookingService.SubscribeCalendar(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar imported successfully", http.StatusCreated, true, source)
+}
+
+func (b *BookingHandlerImpl) UploadCalendar(ctx *gin.Context) {
+	// Leave room for the other form fields next to the largest accepted file
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxCalendarBytes+1<<20)
+	req := UploadCalendarRequest{}
+	if err := ctx.ShouldBind(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read form", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		utils.APIResponse(ctx, "A file is required", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	defer file.Close()
+	caller, _ := utils.GetCaller(ctx)
+	source, err := b.BookingService.UploadCalendar(ctx, caller, req, file)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar imported successfully", http.StatusCreated, true, source)
+}
+
+func (b *BookingHandlerImpl) CalendarSources(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	sources, err := b.BookingService.CalendarSources(ctx, caller)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendars successfully returned", http.StatusOK, true, sources)
+}
+
+func (b *BookingHandlerImpl) SyncCalendarSource(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	source, err := b.BookingService.SyncCalendarSource(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar synced successfully", http.StatusOK, true, source)
+}
+
+func (b *BookingHandlerImpl) DeleteCalendarSource(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if err = b.BookingService.DeleteCalendarSource(ctx, caller, id); bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Calendar removed successfully", http.StatusOK, true, nil)
+}
+
+func (b *BookingHandlerImpl) CheckIn(ctx *gin.Context) {
+	b.check(ctx, b.BookingService.CheckIn, "Checked in successfully")
+}
+
+func (b *BookingHandlerImpl) CheckOut(ctx *gin.Context) {
+	b.check(ctx, b.BookingService.CheckOut, "Checked out successfully")
+}
+
+func (b *BookingHandlerImpl) UploadBookingPhoto(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// Leave room for the other form fields next to the largest accepted photo
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, storage.MaxPhotoBytes+1<<20)
+	req := UploadBookingPhotoRequest{}
+	if err := ctx.ShouldBind(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read form", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		utils.APIResponse(ctx, "A file is required", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	defer file.Close()
+	caller, _ := utils.GetCaller(ctx)
+	photo, err := b.BookingService.UploadBookingPhoto(ctx, caller, id, req, file)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Photo uploaded successfully", http.StatusCreated, true, photo)
+}
+
+func (b *BookingHandlerImpl) BookingVisit(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	visit, err := b.BookingService.BookingVisit(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Visit successfully returned", http.StatusOK, true, visit)
+}
+
+func (b *BookingHandlerImpl) check(ctx *gin.Context, check checkFunc, message string) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := CheckRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	visit, err := check(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, message, http.StatusOK, true, visit)
+}
+
+type checkFunc func(ctx context.Context, caller *utils.Caller, id int, request CheckRequest) (*VisitResponse, error)
+
+type statusFunc func(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+
+type reasonStatusFunc func(ctx context.Context, caller *utils.Caller, id int, request BookingReasonRequest) (*BookingResponse, error)
+
+func (b *BookingHandlerImpl) changeStatus(ctx *gin.Context, change statusFunc, message string) {
+	b.changeStatusWithReason(ctx, func(c context.Context, caller *utils.Caller, id int,
+		_ BookingReasonRequest) (*BookingResponse, error) {
+		return change(c, caller, id)
+	}, message)
+}
+
+func (b *BookingHandlerImpl) changeStatusWithReason(ctx *gin.Context, change reasonStatusFunc, message string) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// the reason is optional so an empty body is allowed
+	req := BookingReasonRequest{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+				false, err.Error())
+			return
+		}
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := change(ctx, caller, id, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, message, http.StatusOK, true, booking)
+}
+
+func (b *BookingHandlerImpl) JoinWaitlist(ctx *gin.Context) {
+	req := JoinWaitlistRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	entry, err := b.BookingService.JoinWaitlist(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Joined the waitlist successfully", http.StatusCreated, true, entry)
+}
+
+func (b *BookingHandlerImpl) MyWaitlist(ctx *gin.Context) {
+	req := FetchBookingsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	entries, err := b.BookingService.UserWaitlist(ctx, caller, req)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Waitlist successfully returned", http.StatusOK, true, entries)
+}
+
+func (b *BookingHandlerImpl) ClaimWaitlistSlot(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booking, err := b.BookingService.ClaimWaitlistSlot(ctx, caller, id)
+	if bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Booking requested successfully", http.StatusOK, true, booking)
+}
+
+func (b *BookingHandlerImpl) LeaveWaitlist(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if err = b.BookingService.LeaveWaitlist(ctx, caller, id); bookingError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Left the waitlist successfully", http.StatusOK, true, nil)
+}
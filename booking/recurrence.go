@@ -0,0 +1,127 @@
+package booking
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSeriesCount bounds the number of occurrences a series may ask for with COUNT.
+const MaxSeriesCount = 104
+
+// untilLayouts are the forms UNTIL is accepted in, a bare date means the end of that day in UTC.
+var untilLayouts = []string{"20060102T150405Z", "20060102"}
+
+var ErrInvalidRule = errors.New("rule must be FREQ=WEEKLY with INTERVAL 1 or 2 or FREQ=MONTHLY, " +
+	"optionally ended by COUNT or UNTIL but not both")
+
+// recurrence is the supported subset of an iCalendar RRULE: weekly, bi-weekly and monthly
+// repeats of the first occurrence, ended by a count or a date or running until cancelled.
+type recurrence struct {
+	frequency string
+	interval  int
+	count     int
+	until     *time.Time
+}
+
+// seriesDate is a date a series falls on. index counts every date the rule produced, number only
+// counts the dates that exist.
+type seriesDate struct {
+	index  int
+	number int
+	start  time.Time
+}
+
+// parseRule reads rules such as "FREQ=WEEKLY;INTERVAL=2;COUNT=10" or "RRULE:FREQ=MONTHLY;UNTIL=20271231".
+func parseRule(rule string) (*recurrence, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	r := recurrence{interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, ErrInvalidRule
+		}
+		switch key {
+		case "FREQ":
+			r.frequency = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, ErrInvalidRule
+			}
+			r.interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 || count > MaxSeriesCount {
+				return nil, ErrInvalidRule
+			}
+			r.count = count
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, ErrInvalidRule
+			}
+			r.until = &until
+		default:
+			return nil, ErrInvalidRule
+		}
+	}
+	switch {
+	case r.frequency == "WEEKLY" && (r.interval == 1 || r.interval == 2):
+	case r.frequency == "MONTHLY" && r.interval == 1:
+	default:
+		return nil, ErrInvalidRule
+	}
+	if r.count > 0 && r.until != nil {
+		return nil, ErrInvalidRule
+	}
+	return &r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	var err error
+	for _, layout := range untilLayouts {
+		var until time.Time
+		if until, err = time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			return until, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// date returns the index'th date the rule produces from first, keeping the wall clock time of
+// first across daylight saving changes. Monthly dates that do not exist, such as the 31st of
+// April, are reported as missing and do not count towards COUNT.
+func (r recurrence) date(first time.Time, index int) (time.Time, bool) {
+	if r.frequency == "MONTHLY" {
+		date := time.Date(first.Year(), first.Month()+time.Month(index*r.interval), first.Day(),
+			first.Hour(), first.Minute(), first.Second(), 0, first.Location())
+		return date, date.Day() == first.Day()
+	}
+	return time.Date(first.Year(), first.Month(), first.Day()+7*r.interval*index,
+		first.Hour(), first.Minute(), first.Second(), 0, first.Location()), true
+}
+
+// dates lists the dates the rule produces from first that start no later than upTo, carrying on
+// from nextIndex and the produced dates already counted. done reports whether the rule has no
+// more dates to give.
+func (r recurrence) dates(first time.Time, nextIndex int, produced int, upTo time.Time) (dates []seriesDate, done bool) {
+	for index := nextIndex; ; index++ {
+		start, ok := r.date(first, index)
+		if !ok {
+			continue
+		}
+		if (r.count > 0 && produced >= r.count) || (r.until != nil && start.After(*r.until)) {
+			return dates, true
+		}
+		if start.After(upTo) {
+			return dates, false
+		}
+		produced++
+		dates = append(dates, seriesDate{index: index, number: produced, start: start})
+	}
+}
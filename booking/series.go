@@ -0,0 +1,419 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"servhunt/booking/dao"
+	"servhunt/infra/utils"
+	svcdao "servhunt/servitorservices/dao"
+	"time"
+)
+
+// DefaultSeriesHorizon is how far ahead series occurrences are booked when no horizon is configured.
+const DefaultSeriesHorizon = 8 * 7 * 24 * time.Hour
+
+var (
+	ErrSeriesConflicts = errors.New("some occurrences of the series cannot be booked")
+	ErrSeriesEnded     = errors.New("the series has ended")
+)
+
+// CreateSeries books the service for the caller on every date of the rule up to the series horizon,
+// later dates are booked by ExtendSeries as the horizon moves on. When some of the dates cannot be
+// booked nothing is booked and the conflicts are returned with ErrSeriesConflicts, unless the
+// request asks to skip them.
+func (b *BookingServiceImpl) CreateSeries(ctx context.Context, caller *utils.Caller,
+	request CreateSeriesRequest) (*SeriesResponse, error) {
+	svc, schedule, err := b.bookableService(ctx, caller, request.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := parseRule(request.Rule)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !request.FirstStart.After(now) {
+		return nil, ErrInvalidSchedule
+	}
+	duration := bookingDuration(*svc)
+	series := dao.BookingSeries{
+		ServiceID:       svc.ID,
+		CustomerID:      caller.ID,
+		ServitorID:      svc.UserID,
+		Rule:            request.Rule,
+		FirstStart:      request.FirstStart,
+		DurationMinutes: int(duration / time.Minute),
+		TimeZone:        scheduleLocation(*schedule).String(),
+		Address:         request.Address,
+		Notes:           request.Notes,
+	}
+
+	dates, _ := rule.dates(request.FirstStart.In(scheduleLocation(*schedule)), 0, 0, now.Add(b.seriesHorizon))
+	if len(dates) == 0 {
+		return nil, ErrInvalidSchedule
+	}
+	buffer := scheduleBuffer(*schedule)
+	busy, err := b.busyTimes(ctx, []int{svc.UserID}, dates[0].start.Add(-buffer),
+		dates[len(dates)-1].start.Add(duration+buffer))
+	if err != nil {
+		return nil, err
+	}
+	conflicts := []SeriesConflictResponse{}
+	for _, date := range dates {
+		period := span{start: date.start, end: date.start.Add(duration)}
+		if err = occurrenceConflict(*schedule, period, busy[svc.UserID]); err != nil {
+			conflicts = append(conflicts, SeriesConflictResponse{
+				Occurrence:     date.number,
+				ScheduledStart: period.start,
+				ScheduledEnd:   period.end,
+				Reason:         err.Error(),
+			})
+		}
+	}
+	if len(conflicts) > 0 && !request.SkipConflicts {
+		return &SeriesResponse{Rule: request.Rule, Bookings: []BookingResponse{}, Conflicts: conflicts},
+			ErrSeriesConflicts
+	}
+
+	created, err := b.BookingRepo.CreateSeries(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.materialise(ctx, created, svc, now.Add(b.seriesHorizon)); err != nil {
+		return nil, err
+	}
+	return b.seriesResponse(ctx, created.ID)
+}
+
+func (b *BookingServiceImpl) GetSeries(ctx context.Context, caller *utils.Caller, id int) (*SeriesResponse, error) {
+	if _, err := b.participantSeries(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	return b.seriesResponse(ctx, id)
+}
+
+// UserSeries lists the series the caller booked, or was booked for as a servitor when the role is servitor.
+func (b *BookingServiceImpl) UserSeries(ctx context.Context, caller *utils.Caller,
+	request FetchBookingsRequest) (*[]SeriesResponse, error) {
+	filter := dao.BookingFilter{Status: request.Status}
+	switch request.Role {
+	case "", utils.CustomerUserType:
+		filter.CustomerID = caller.ID
+	case utils.ServitorUserType:
+		filter.ServitorID = caller.ID
+	default:
+		return nil, ErrUnknownRole
+	}
+	series, err := b.BookingRepo.SeriesList(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	res := []SeriesResponse{}
+	for _, s := range *series {
+		res = append(res, toSeriesResponse(s, nil))
+	}
+	return &res, nil
+}
+
+// UpdateSeries changes the address and notes of the series and its upcoming occurrences, only the
+// customer who booked the series may change it.
+func (b *BookingServiceImpl) UpdateSeries(ctx context.Context, caller *utils.Caller, id int,
+	request UpdateSeriesRequest) (*SeriesResponse, error) {
+	series, err := b.participantSeries(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && series.CustomerID != caller.ID {
+		return nil, ErrMoveNotAllowed
+	}
+	if series.Status == dao.CancelledSeries {
+		return nil, ErrSeriesEnded
+	}
+	if request.Address != nil {
+		series.Address = *request.Address
+	}
+	if request.Notes != nil {
+		series.Notes = *request.Notes
+	}
+	if err = b.BookingRepo.UpdateSeriesDetails(ctx, *series, time.Now()); err != nil {
+		return nil, err
+	}
+	return b.seriesResponse(ctx, id)
+}
+
+// CancelSeries stops the series and cancels its upcoming occurrences, occurrences in progress or
+// already over are left as they are. The freed slots are offered to the waitlist.
+func (b *BookingServiceImpl) CancelSeries(ctx context.Context, caller *utils.Caller, id int,
+	request BookingReasonRequest) (*SeriesResponse, error) {
+	series, err := b.participantSeries(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if series.Status == dao.CancelledSeries {
+		return nil, ErrSeriesEnded
+	}
+	series.Status = dao.CancelledSeries
+	if err = b.BookingRepo.SaveSeriesProgress(ctx, *series, nil); err != nil {
+		return nil, err
+	}
+	bookings, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{SeriesID: id})
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range *bookings {
+		if booking.Status != dao.RequestedStatus && booking.Status != dao.ConfirmedStatus {
+			continue
+		}
+		fee, refund := cancellationCharges(booking, dao.CancelledStatus, isCustomer(booking, caller), time.Now())
+		_, err = b.BookingRepo.ChangeBookingStatus(ctx, dao.BookingStatusChange{
+			BookingID:  booking.ID,
+			FromStatus: booking.Status,
+			ToStatus:   dao.CancelledStatus,
+			Reason:     request.Reason,
+			ChangedBy:  caller.ID,
+			Fee:        fee,
+			Refund:     refund,
+		})
+		if err != nil && !errors.Is(err, dao.ErrStatusChanged) {
+			return nil, err
+		}
+	}
+	b.offerFreedSlots(ctx, series.ServitorID)
+	return b.seriesResponse(ctx, id)
+}
+
+// RescheduleBooking moves a requested or confirmed booking, such as one occurrence of a series, to
+// another time or address. The booking keeps its length when no end is given, and a confirmed
+// booking moved by anyone but its servitor goes back to requested for the servitor to accept again.
+// The slot it leaves is offered to the waitlist.
+func (b *BookingServiceImpl) RescheduleBooking(ctx context.Context, caller *utils.Caller, id int,
+	request RescheduleBookingRequest) (*BookingResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if booking.Status != dao.RequestedStatus && booking.Status != dao.ConfirmedStatus {
+		return nil, ErrInvalidTransition
+	}
+	end := request.ScheduledStart.Add(booking.ScheduledEnd.Sub(booking.ScheduledStart))
+	if request.ScheduledEnd != nil {
+		end = *request.ScheduledEnd
+	}
+	if !request.ScheduledStart.After(time.Now()) || !end.After(request.ScheduledStart) {
+		return nil, ErrInvalidSchedule
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, booking.ServitorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, dao.ErrNoSchedule
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !withinWindows(*schedule, span{start: request.ScheduledStart, end: end}) {
+		return nil, ErrOutsideAvailability
+	}
+	booking.ScheduledStart = request.ScheduledStart
+	booking.ScheduledEnd = end
+	if request.Address != nil {
+		booking.Address = *request.Address
+	}
+	if request.Notes != nil {
+		booking.Notes = *request.Notes
+	}
+	if booking.Status == dao.ConfirmedStatus && booking.ServitorID != caller.ID && !caller.IsAdmin() {
+		booking.Status = dao.RequestedStatus
+	}
+	moved, err := b.BookingRepo.RescheduleBooking(ctx, *booking, scheduleBuffer(*schedule), caller.ID)
+	if err != nil {
+		return nil, err
+	}
+	b.offerFreedSlots(ctx, moved.ServitorID)
+	res := toBookingResponse(*moved)
+	return &res, nil
+}
+
+// ExtendSeries books the occurrences of active series that came within the series horizon. Series
+// whose service can no longer be booked are left alone until it can.
+func (b *BookingServiceImpl) ExtendSeries(ctx context.Context) error {
+	series, err := b.BookingRepo.SeriesList(ctx, dao.BookingFilter{Status: dao.ActiveSeries})
+	if err != nil {
+		return err
+	}
+	upTo := time.Now().Add(b.seriesHorizon)
+	for i := range *series {
+		s := &(*series)[i]
+		svc, err := b.services.GetServiceByID(ctx, s.ServiceID)
+		if err != nil || svc.Status != svcdao.PublishedStatus {
+			continue
+		}
+		if err = b.materialise(ctx, s, svc, upTo); err != nil {
+			logger.Error("error extending booking series", zap.Int("series.id", s.ID),
+				zap.NamedError("error.message", err))
+		}
+	}
+	return nil
+}
+
+// RunSeriesJob extends booking series on every tick of the interval, it blocks until the context is
+// cancelled.
+func RunSeriesJob(ctx context.Context, svc BookingService, interval time.Duration) {
+	if interval <= 0 {
+		logger.Warn("series job disabled, no series interval configured")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svc.ExtendSeries(ctx); err != nil {
+				logger.Error("error extending booking series", zap.NamedError("error.message", err))
+			}
+		}
+	}
+}
+
+// materialise books the dates of the series up to upTo, recording the ones that cannot be booked
+// as conflicts, and saves how far it got.
+func (b *BookingServiceImpl) materialise(ctx context.Context, series *dao.BookingSeries, svc *svcdao.Service,
+	upTo time.Time) error {
+	rule, err := parseRule(series.Rule)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(series.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, series.ServitorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		schedule, err = &dao.Schedule{ServitorID: series.ServitorID}, nil
+	}
+	if err != nil {
+		return err
+	}
+	duration := time.Duration(series.DurationMinutes) * time.Minute
+	dates, done := rule.dates(series.FirstStart.In(loc), series.NextIndex, series.Occurrences, upTo)
+
+	now := time.Now()
+	var conflicts []dao.SeriesConflict
+	var failed error
+	for _, date := range dates {
+		period := span{start: date.start, end: date.start.Add(duration)}
+		if period.start.After(now) {
+			err = ErrOutsideAvailability
+			if withinWindows(*schedule, period) {
+				_, err = b.BookingRepo.CreateBooking(ctx, dao.Booking{
+					ServiceID:                  svc.ID,
+					CustomerID:                 series.CustomerID,
+					ServitorID:                 series.ServitorID,
+					SeriesID:                   &series.ID,
+					Occurrence:                 date.number,
+					ScheduledStart:             period.start,
+					ScheduledEnd:               period.end,
+					Address:                    series.Address,
+					Notes:                      series.Notes,
+					Price:                      svc.Price,
+					Currency:                   svc.Currency,
+					PricingModel:               svc.PricingModel,
+					FreeCancellationHours:      svc.FreeCancellationHours,
+					LateCancellationFeePercent: svc.LateCancellationFeePercent,
+					NoShowFeePercent:           svc.NoShowFeePercent,
+				}, scheduleBuffer(*schedule))
+			}
+			if errors.Is(err, ErrOutsideAvailability) || errors.Is(err, dao.ErrSlotTaken) ||
+				errors.Is(err, dao.ErrNoSchedule) {
+				conflicts = append(conflicts, dao.SeriesConflict{
+					Occurrence:     date.number,
+					ScheduledStart: period.start,
+					ScheduledEnd:   period.end,
+					Reason:         err.Error(),
+				})
+			} else if err != nil {
+				failed = err
+				break
+			}
+		}
+		series.NextIndex = date.index + 1
+		series.Occurrences = date.number
+	}
+	if done && failed == nil {
+		series.Status = dao.CompleteSeries
+	}
+	if err = b.BookingRepo.SaveSeriesProgress(ctx, *series, conflicts); err != nil {
+		return err
+	}
+	return failed
+}
+
+// occurrenceConflict reports why the period cannot be booked with the schedule, if it cannot.
+func occurrenceConflict(schedule dao.Schedule, period span, busy []span) error {
+	if !withinWindows(schedule, period) {
+		return ErrOutsideAvailability
+	}
+	if clashes(period, busy, scheduleBuffer(schedule)) {
+		return dao.ErrSlotTaken
+	}
+	return nil
+}
+
+// participantSeries loads the series if the caller is its customer, its servitor or an administrator.
+func (b *BookingServiceImpl) participantSeries(ctx context.Context, caller *utils.Caller, id int) (*dao.BookingSeries, error) {
+	series, err := b.BookingRepo.GetSeriesByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && series.CustomerID != caller.ID && series.ServitorID != caller.ID {
+		return nil, ErrNotParticipant
+	}
+	return series, nil
+}
+
+// seriesResponse loads the series with its bookings and conflicts.
+func (b *BookingServiceImpl) seriesResponse(ctx context.Context, id int) (*SeriesResponse, error) {
+	series, err := b.BookingRepo.GetSeriesByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{SeriesID: id})
+	if err != nil {
+		return nil, err
+	}
+	res := toSeriesResponse(*series, *bookings)
+	return &res, nil
+}
+
+func toSeriesResponse(series dao.BookingSeries, bookings []dao.Booking) SeriesResponse {
+	res := SeriesResponse{
+		ID:              series.ID,
+		ServiceID:       series.ServiceID,
+		CustomerID:      series.CustomerID,
+		ServitorID:      series.ServitorID,
+		Rule:            series.Rule,
+		FirstStart:      series.FirstStart,
+		DurationMinutes: series.DurationMinutes,
+		TimeZone:        series.TimeZone,
+		Address:         series.Address,
+		Notes:           series.Notes,
+		Status:          series.Status,
+		Bookings:        []BookingResponse{},
+		Conflicts:       []SeriesConflictResponse{},
+		CreatedOn:       series.CreatedOn,
+	}
+	for _, booking := range bookings {
+		res.Bookings = append(res.Bookings, toBookingResponse(booking))
+	}
+	for _, conflict := range series.Conflicts {
+		res.Conflicts = append(res.Conflicts, SeriesConflictResponse{
+			Occurrence:     conflict.Occurrence,
+			ScheduledStart: conflict.ScheduledStart,
+			ScheduledEnd:   conflict.ScheduledEnd,
+			Reason:         conflict.Reason,
+		})
+	}
+	return res
+}
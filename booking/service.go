@@ -0,0 +1,846 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"servhunt/booking/dao"
+	"servhunt/infra/geo"
+	"servhunt/infra/utils"
+	"servhunt/notification"
+	"servhunt/scheduler"
+	svcdao "servhunt/servitorservices/dao"
+	"servhunt/storage"
+	"time"
+)
+
+// defaultBookingDuration is used for services that do not state how long they take.
+const defaultBookingDuration = time.Hour
+
+// BookingCompletedAction is recorded for the customer when a booking is completed.
+const BookingCompletedAction = "booking_completed"
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrNotParticipant      = errors.New("booking belongs to another customer and servitor")
+	ErrMoveNotAllowed      = errors.New("you cannot make that change to the booking")
+	ErrInvalidTransition   = errors.New("the booking cannot move to that status")
+	ErrServiceUnavailable  = errors.New("the service is not open for bookings")
+	ErrOwnService          = errors.New("servitors cannot book their own services")
+	ErrInvalidSchedule     = errors.New("a booking must start in the future and end after it starts")
+	ErrBookingNotStarted   = errors.New("a no show can only be reported once the booking was due to start")
+	ErrBookingStartPassed  = errors.New("the booking was due to start already and can no longer be accepted")
+	ErrUnknownRole         = errors.New("role must be customer or servitor")
+	ErrOutsideAvailability = errors.New("the booking falls outside the servitor's availability")
+	ErrInvalidRange        = errors.New("the period must end after it starts and span at most 31 days")
+	ErrInvalidAvailability = errors.New("availability needs a valid time zone and HH:MM windows that end after they start and do not overlap")
+	ErrNotServitor         = errors.New("only servitors can set their availability")
+	ErrNotCustomer         = errors.New("only the customer of the booking can rate it")
+	ErrRatingClosed        = errors.New("only completed bookings can be rated")
+	ErrCheckRequired       = errors.New("servitors start bookings by checking in and complete them by checking out")
+)
+
+// Who may move a booking between two statuses, administrators may make every move.
+const (
+	customerMove = 1 << iota
+	servitorMove
+)
+
+// bookingTransitions lists the statuses a booking can move to from each status and who may make
+// the move. A servitor declining a request cancels it.
+var bookingTransitions = map[string]map[string]int{
+	dao.RequestedStatus: {
+		dao.ConfirmedStatus: servitorMove,
+		dao.CancelledStatus: customerMove | servitorMove,
+	},
+	dao.ConfirmedStatus: {
+		dao.InProgressStatus: servitorMove,
+		dao.CancelledStatus:  customerMove | servitorMove,
+		dao.NoShowStatus:     servitorMove,
+	},
+	dao.InProgressStatus: {
+		dao.CompletedStatus: servitorMove,
+	},
+}
+
+// ActionRecorder is notified of user actions that may qualify a referral for a reward.
+type ActionRecorder interface {
+	RecordQualifyingAction(ctx context.Context, userId int, action string) error
+}
+
+type BookingService interface {
+	RequestBooking(ctx context.Context, caller *utils.Caller, request CreateBookingRequest) (*BookingResponse, error)
+	GetBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	UserBookings(ctx context.Context, caller *utils.Caller, request FetchBookingsRequest) (*[]BookingResponse, error)
+	AcceptBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	DeclineBooking(ctx context.Context, caller *utils.Caller, id int, request BookingReasonRequest) (*BookingResponse, error)
+	StartBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	CompleteBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	CancelBooking(ctx context.Context, caller *utils.Caller, id int, request BookingReasonRequest) (*BookingResponse, error)
+	ReportNoShow(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	RateBooking(ctx context.Context, caller *utils.Caller, id int, request RateBookingRequest) (*BookingResponse, error)
+	BookingHistory(ctx context.Context, caller *utils.Caller, id int) (*[]StatusChangeResponse, error)
+	HasUpcomingBookings(ctx context.Context, serviceId int) (bool, error)
+	Slots(ctx context.Context, request SlotsRequest) (*[]SlotResponse, error)
+	GetSchedule(ctx context.Context, caller *utils.Caller) (*ScheduleResponse, error)
+	SaveSchedule(ctx context.Context, caller *utils.Caller, request ScheduleRequest) (*ScheduleResponse, error)
+	AvailableServices(ctx context.Context, serviceIds []int, from time.Time, to time.Time) ([]int, error)
+	CheckQuotedTime(ctx context.Context, servitorId int, start time.Time, end time.Time) error
+	BookQuote(ctx context.Context, request QuotedBooking) (*BookingResponse, error)
+	FreeServitors(ctx context.Context, servitorIds []int, from time.Time, to time.Time) ([]int, error)
+	BookDispatch(ctx context.Context, serviceId int, customerId int, address string, notes string,
+		site geo.Point) (*BookingResponse, error)
+	CheckIn(ctx context.Context, caller *utils.Caller, id int, request CheckRequest) (*VisitResponse, error)
+	CheckOut(ctx context.Context, caller *utils.Caller, id int, request CheckRequest) (*VisitResponse, error)
+	UploadBookingPhoto(ctx context.Context, caller *utils.Caller, id int, request UploadBookingPhotoRequest,
+		file io.Reader) (*BookingPhotoResponse, error)
+	BookingVisit(ctx context.Context, caller *utils.Caller, id int) (*VisitResponse, error)
+	RescheduleBooking(ctx context.Context, caller *utils.Caller, id int, request RescheduleBookingRequest) (*BookingResponse, error)
+	CreateSeries(ctx context.Context, caller *utils.Caller, request CreateSeriesRequest) (*SeriesResponse, error)
+	GetSeries(ctx context.Context, caller *utils.Caller, id int) (*SeriesResponse, error)
+	UserSeries(ctx context.Context, caller *utils.Caller, request FetchBookingsRequest) (*[]SeriesResponse, error)
+	UpdateSeries(ctx context.Context, caller *utils.Caller, id int, request UpdateSeriesRequest) (*SeriesResponse, error)
+	CancelSeries(ctx context.Context, caller *utils.Caller, id int, request BookingReasonRequest) (*SeriesResponse, error)
+	ExtendSeries(ctx context.Context) error
+	CalendarFeed(ctx context.Context, caller *utils.Caller) (*CalendarFeedResponse, error)
+	RotateCalendarFeed(ctx context.Context, caller *utils.Caller) (*CalendarFeedResponse, error)
+	WriteCalendar(ctx context.Context, token string, w io.Writer) error
+	SubscribeCalendar(ctx context.Context, caller *utils.Caller, request SubscribeCalendarRequest) (*CalendarSourceResponse, error)
+	UploadCalendar(ctx context.Context, caller *utils.Caller, request UploadCalendarRequest, r io.Reader) (*CalendarSourceResponse, error)
+	CalendarSources(ctx context.Context, caller *utils.Caller) (*[]CalendarSourceResponse, error)
+	SyncCalendarSource(ctx context.Context, caller *utils.Caller, id int) (*CalendarSourceResponse, error)
+	DeleteCalendarSource(ctx context.Context, caller *utils.Caller, id int) error
+	SyncCalendars(ctx context.Context) error
+	PlanTasks(ctx context.Context, tasks scheduler.TaskScheduler) error
+	RemindBooking(ctx context.Context, reminder BookingReminder) error
+	ExpireRequest(ctx context.Context, id int) error
+	CompleteStaleBooking(ctx context.Context, id int) error
+	JoinWaitlist(ctx context.Context, caller *utils.Caller, request JoinWaitlistRequest) (*WaitlistEntryResponse, error)
+	UserWaitlist(ctx context.Context, caller *utils.Caller, request FetchBookingsRequest) (*[]WaitlistEntryResponse, error)
+	ClaimWaitlistSlot(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error)
+	LeaveWaitlist(ctx context.Context, caller *utils.Caller, id int) error
+	OfferWaitlistSlots(ctx context.Context, servitorId int) error
+	ExpireWaitlistHold(ctx context.Context, id int) error
+}
+
+type BookingServiceImpl struct {
+	dao.BookingRepo
+	services      svcdao.ServiceRepo
+	actions       ActionRecorder
+	seriesHorizon time.Duration
+	feedURL       string
+	blobs         storage.BlobStore
+	checkInRadius float64
+	notifier      notification.Notifier
+	tasks         scheduler.TaskScheduler
+	requestTTL    time.Duration
+	staleAfter    time.Duration
+	waitlistHold  time.Duration
+}
+
+// NewBookingServiceImpl creates the booking service, occurrences of booking series are booked
+// seriesHorizon ahead or DefaultSeriesHorizon when it is not set. Calendar feeds are published
+// under feedURL and blobs keeps the booking photos. Check ins within checkInRadius meters of the
+// booking site are verified, DefaultCheckInRadius is used when it is not set. Requests the servitor
+// does not answer within requestTTL expire and bookings still in progress staleAfter past their end
+// are completed, notifier sends the reminders and expiries. Freed slots are offered to the waitlist
+// in tasks queued on tasks and held for waitlisted customers for waitlistHold, DefaultWaitlistHold
+// when it is not set.
+func NewBookingServiceImpl(repo dao.BookingRepo, services svcdao.ServiceRepo, actions ActionRecorder,
+	notifier notification.Notifier, tasks scheduler.TaskScheduler, seriesHorizon time.Duration, feedURL string, blobs storage.BlobStore,
+	checkInRadius float64, requestTTL time.Duration, staleAfter time.Duration,
+	waitlistHold time.Duration) BookingService {
+	if seriesHorizon <= 0 {
+		seriesHorizon = DefaultSeriesHorizon
+	}
+	if checkInRadius <= 0 {
+		checkInRadius = DefaultCheckInRadius
+	}
+	if requestTTL <= 0 {
+		requestTTL = DefaultRequestTTL
+	}
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	if waitlistHold <= 0 {
+		waitlistHold = DefaultWaitlistHold
+	}
+	return &BookingServiceImpl{BookingRepo: repo, services: services, actions: actions, seriesHorizon: seriesHorizon,
+		feedURL: feedURL, blobs: blobs, checkInRadius: checkInRadius, notifier: notifier, tasks: tasks,
+		requestTTL: requestTTL, staleAfter: staleAfter, waitlistHold: waitlistHold}
+}
+
+// RequestBooking books a published service for the caller at the price the service is listed at.
+func (b *BookingServiceImpl) RequestBooking(ctx context.Context, caller *utils.Caller,
+	request CreateBookingRequest) (*BookingResponse, error) {
+	if (request.Latitude == nil) != (request.Longitude == nil) {
+		return nil, ErrInvalidSite
+	}
+	svc, schedule, err := b.bookableService(ctx, caller, request.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	end := request.ScheduledStart.Add(bookingDuration(*svc))
+	if request.ScheduledEnd != nil {
+		end = *request.ScheduledEnd
+	}
+	if !request.ScheduledStart.After(time.Now()) || !end.After(request.ScheduledStart) {
+		return nil, ErrInvalidSchedule
+	}
+	if !withinWindows(*schedule, span{start: request.ScheduledStart, end: end}) {
+		return nil, ErrOutsideAvailability
+	}
+	units := 1
+	if svc.PricingModel == svcdao.PerUnitPricing && request.Units > 1 {
+		units = request.Units
+	}
+
+	booking, err := b.BookingRepo.CreateBooking(ctx, dao.Booking{
+		ServiceID:                  svc.ID,
+		CustomerID:                 caller.ID,
+		ServitorID:                 svc.UserID,
+		ScheduledStart:             request.ScheduledStart,
+		ScheduledEnd:               end,
+		Address:                    request.Address,
+		Notes:                      request.Notes,
+		Price:                      svc.Price,
+		Currency:                   svc.Currency,
+		PricingModel:               svc.PricingModel,
+		Units:                      units,
+		Latitude:                   request.Latitude,
+		Longitude:                  request.Longitude,
+		FreeCancellationHours:      svc.FreeCancellationHours,
+		LateCancellationFeePercent: svc.LateCancellationFeePercent,
+		NoShowFeePercent:           svc.NoShowFeePercent,
+	}, scheduleBuffer(*schedule))
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*booking)
+	return &res, nil
+}
+
+// CheckQuotedTime reports why the servitor could not be booked for the quoted period, if they could
+// not. Quoted times may fall outside the servitor's availability windows since the servitor picked
+// them, they still have to keep clear of the servitor's other bookings and busy times.
+func (b *BookingServiceImpl) CheckQuotedTime(ctx context.Context, servitorId int, start time.Time,
+	end time.Time) error {
+	if !start.After(time.Now()) || !end.After(start) {
+		return ErrInvalidSchedule
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, servitorId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.ErrNoSchedule
+	}
+	if err != nil {
+		return err
+	}
+	buffer := scheduleBuffer(*schedule)
+	busy, err := b.busyTimes(ctx, []int{servitorId}, start.Add(-buffer), end.Add(buffer))
+	if err != nil {
+		return err
+	}
+	if clashes(span{start: start, end: end}, busy[servitorId], buffer) {
+		return dao.ErrSlotTaken
+	}
+	return nil
+}
+
+// BookQuote books the service at the quoted time and price. The booking is confirmed straight away
+// since the servitor offered it and the customer accepted, and priced as fixed since the quote
+// covers the whole job.
+func (b *BookingServiceImpl) BookQuote(ctx context.Context, request QuotedBooking) (*BookingResponse, error) {
+	svc, err := b.services.GetServiceByID(ctx, request.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	if svc.Status != svcdao.PublishedStatus {
+		return nil, ErrServiceUnavailable
+	}
+	if svc.UserID == request.CustomerID {
+		return nil, ErrOwnService
+	}
+	if err = b.CheckQuotedTime(ctx, svc.UserID, request.ScheduledStart, request.ScheduledEnd); err != nil {
+		return nil, err
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, svc.UserID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	booking, err := b.BookingRepo.CreateBooking(ctx, dao.Booking{
+		ServiceID:                  svc.ID,
+		CustomerID:                 request.CustomerID,
+		ServitorID:                 svc.UserID,
+		Status:                     dao.ConfirmedStatus,
+		ScheduledStart:             request.ScheduledStart,
+		ScheduledEnd:               request.ScheduledEnd,
+		Address:                    request.Address,
+		Notes:                      request.Notes,
+		Price:                      request.Price,
+		Currency:                   request.Currency,
+		PricingModel:               svcdao.FixedPricing,
+		Latitude:                   request.Latitude,
+		Longitude:                  request.Longitude,
+		FreeCancellationHours:      svc.FreeCancellationHours,
+		LateCancellationFeePercent: svc.LateCancellationFeePercent,
+		NoShowFeePercent:           svc.NoShowFeePercent,
+		ConfirmedAt:                &now,
+	}, scheduleBuffer(*schedule))
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*booking)
+	return &res, nil
+}
+
+// FreeServitors returns the servitors that have published their availability and are free for the
+// whole period, taking their buffer between bookings into account.
+func (b *BookingServiceImpl) FreeServitors(ctx context.Context, servitorIds []int, from time.Time,
+	to time.Time) ([]int, error) {
+	schedules, err := b.BookingRepo.GetSchedules(ctx, servitorIds)
+	if err != nil || len(*schedules) == 0 {
+		return nil, err
+	}
+	var maxBuffer time.Duration
+	for _, schedule := range *schedules {
+		if buffer := scheduleBuffer(schedule); buffer > maxBuffer {
+			maxBuffer = buffer
+		}
+	}
+	busy, err := b.busyTimes(ctx, servitorIds, from.Add(-maxBuffer), to.Add(maxBuffer))
+	if err != nil {
+		return nil, err
+	}
+	var free []int
+	for _, schedule := range *schedules {
+		if !clashes(span{start: from, end: to}, busy[schedule.ServitorID], scheduleBuffer(schedule)) {
+			free = append(free, schedule.ServitorID)
+		}
+	}
+	return free, nil
+}
+
+// BookDispatch books the service for a job dispatched to its servitor, starting right away at the
+// listed price. The booking is confirmed since the servitor accepted the job, site locates the address.
+func (b *BookingServiceImpl) BookDispatch(ctx context.Context, serviceId int, customerId int, address string,
+	notes string, site geo.Point) (*BookingResponse, error) {
+	svc, err := b.services.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if svc.Status != svcdao.PublishedStatus {
+		return nil, ErrServiceUnavailable
+	}
+	if svc.UserID == customerId {
+		return nil, ErrOwnService
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, svc.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, dao.ErrNoSchedule
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	booking, err := b.BookingRepo.CreateBooking(ctx, dao.Booking{
+		ServiceID:                  svc.ID,
+		CustomerID:                 customerId,
+		ServitorID:                 svc.UserID,
+		Status:                     dao.ConfirmedStatus,
+		ScheduledStart:             now,
+		ScheduledEnd:               now.Add(bookingDuration(*svc)),
+		Address:                    address,
+		Notes:                      notes,
+		Price:                      svc.Price,
+		Currency:                   svc.Currency,
+		PricingModel:               svc.PricingModel,
+		Latitude:                   &site.Latitude,
+		Longitude:                  &site.Longitude,
+		FreeCancellationHours:      svc.FreeCancellationHours,
+		LateCancellationFeePercent: svc.LateCancellationFeePercent,
+		NoShowFeePercent:           svc.NoShowFeePercent,
+		ConfirmedAt:                &now,
+	}, scheduleBuffer(*schedule))
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*booking)
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) GetBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*booking)
+	return &res, nil
+}
+
+// UserBookings lists the bookings the caller made, or received as a servitor when the role is servitor.
+func (b *BookingServiceImpl) UserBookings(ctx context.Context, caller *utils.Caller,
+	request FetchBookingsRequest) (*[]BookingResponse, error) {
+	filter := dao.BookingFilter{Status: request.Status}
+	switch request.Role {
+	case "", utils.CustomerUserType:
+		filter.CustomerID = caller.ID
+	case utils.ServitorUserType:
+		filter.ServitorID = caller.ID
+	default:
+		return nil, ErrUnknownRole
+	}
+	bookings, err := b.BookingRepo.Bookings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	res := []BookingResponse{}
+	for _, booking := range *bookings {
+		res = append(res, toBookingResponse(booking))
+	}
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) AcceptBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error) {
+	return b.changeStatus(ctx, caller, id, dao.ConfirmedStatus, "")
+}
+
+func (b *BookingServiceImpl) DeclineBooking(ctx context.Context, caller *utils.Caller, id int,
+	request BookingReasonRequest) (*BookingResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && booking.ServitorID != caller.ID {
+		return nil, ErrMoveNotAllowed
+	}
+	if booking.Status != dao.RequestedStatus {
+		return nil, fmt.Errorf("%w: only requested bookings can be declined", ErrInvalidTransition)
+	}
+	return b.changeStatus(ctx, caller, id, dao.CancelledStatus, request.Reason)
+}
+
+// StartBooking lets an administrator start the booking, servitors check in instead so their
+// position is recorded.
+func (b *BookingServiceImpl) StartBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error) {
+	if !caller.IsAdmin() {
+		return nil, ErrCheckRequired
+	}
+	return b.changeStatus(ctx, caller, id, dao.InProgressStatus, "")
+}
+
+// CompleteBooking lets an administrator finish the booking, servitors check out instead. With no
+// check out to time the visit the booking is billed as booked, hourly bookings for their scheduled
+// length. The referral programme is told the customer completed one.
+func (b *BookingServiceImpl) CompleteBooking(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error) {
+	if !caller.IsAdmin() {
+		return nil, ErrCheckRequired
+	}
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := bookingTransitions[booking.Status][dao.CompletedStatus]; !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, booking.Status, dao.CompletedStatus)
+	}
+	minutes := int(booking.ScheduledEnd.Sub(booking.ScheduledStart).Minutes())
+	changed, err := b.BookingRepo.CompleteBooking(ctx, dao.BookingStatusChange{
+		BookingID:  id,
+		FromStatus: booking.Status,
+		ToStatus:   dao.CompletedStatus,
+		ChangedBy:  caller.ID,
+	}, minutes, bookedTotal(*booking))
+	if err != nil {
+		return nil, err
+	}
+	b.recordCompletion(ctx, changed.CustomerID)
+	res := toBookingResponse(*changed)
+	return &res, nil
+}
+
+// recordCompletion lets the referral programme know the customer completed a booking.
+func (b *BookingServiceImpl) recordCompletion(ctx context.Context, customerId int) {
+	if err := b.actions.RecordQualifyingAction(ctx, customerId, BookingCompletedAction); err != nil {
+		logger.Error("error recording qualifying action", zap.Int("user.id", customerId),
+			zap.NamedError("error.message", err))
+	}
+}
+
+func (b *BookingServiceImpl) CancelBooking(ctx context.Context, caller *utils.Caller, id int,
+	request BookingReasonRequest) (*BookingResponse, error) {
+	return b.changeStatus(ctx, caller, id, dao.CancelledStatus, request.Reason)
+}
+
+func (b *BookingServiceImpl) ReportNoShow(ctx context.Context, caller *utils.Caller, id int) (*BookingResponse, error) {
+	return b.changeStatus(ctx, caller, id, dao.NoShowStatus, "")
+}
+
+// RateBooking records how the customer rated a completed booking, each booking is rated once.
+// Servitors are filtered and ranked by these ratings, which only their customers can give.
+func (b *BookingServiceImpl) RateBooking(ctx context.Context, caller *utils.Caller, id int,
+	request RateBookingRequest) (*BookingResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if booking.CustomerID != caller.ID {
+		return nil, ErrNotCustomer
+	}
+	if booking.Status != dao.CompletedStatus {
+		return nil, ErrRatingClosed
+	}
+	rated, err := b.BookingRepo.RateBooking(ctx, id, request.Rating)
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*rated)
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) BookingHistory(ctx context.Context, caller *utils.Caller, id int) (*[]StatusChangeResponse, error) {
+	if _, err := b.participantBooking(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	history, err := b.BookingRepo.BookingHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := []StatusChangeResponse{}
+	for _, change := range *history {
+		res = append(res, StatusChangeResponse{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Reason:     change.Reason,
+			ChangedBy:  change.ChangedBy,
+			Fee:        change.Fee,
+			Refund:     change.Refund,
+			ChangedOn:  change.CreatedOn,
+		})
+	}
+	return &res, nil
+}
+
+// HasUpcomingBookings reports whether the service has bookings that are in progress or still to come.
+func (b *BookingServiceImpl) HasUpcomingBookings(ctx context.Context, serviceId int) (bool, error) {
+	count, err := b.BookingRepo.CountUpcomingBookings(ctx, serviceId, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Slots lists the times the service can be booked at between the requested bounds, which default
+// to the coming week.
+func (b *BookingServiceImpl) Slots(ctx context.Context, request SlotsRequest) (*[]SlotResponse, error) {
+	from, to, err := slotRange(request.From, request.To)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := b.services.GetServiceByID(ctx, request.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	res := []SlotResponse{}
+	if svc.Status != svcdao.PublishedStatus {
+		return &res, nil
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, svc.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	duration := bookingDuration(*svc)
+	busy, err := b.busyTimes(ctx, []int{svc.UserID}, from.Add(-scheduleBuffer(*schedule)),
+		to.Add(duration+scheduleBuffer(*schedule)))
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range freeSlots(*schedule, duration, busy[svc.UserID], from, to) {
+		res = append(res, SlotResponse{Start: slot.start, End: slot.end})
+	}
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) GetSchedule(ctx context.Context, caller *utils.Caller) (*ScheduleResponse, error) {
+	schedule, err := b.BookingRepo.GetSchedule(ctx, caller.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := toScheduleResponse(*schedule)
+	return &res, nil
+}
+
+// SaveSchedule replaces the caller's availability. Bookings already made are kept even when they
+// no longer fit the new windows, and slots the new windows open up are offered to the waitlist.
+func (b *BookingServiceImpl) SaveSchedule(ctx context.Context, caller *utils.Caller,
+	request ScheduleRequest) (*ScheduleResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	if err := validateAvailability(request); err != nil {
+		return nil, err
+	}
+	schedule := dao.Schedule{
+		ServitorID:      caller.ID,
+		TimeZone:        request.TimeZone,
+		BufferMinutes:   request.BufferMinutes,
+		SlotStepMinutes: request.SlotStepMinutes,
+		Windows:         []dao.AvailabilityWindow{},
+	}
+	for _, window := range request.Windows {
+		schedule.Windows = append(schedule.Windows, dao.AvailabilityWindow{
+			Weekday:   window.Weekday,
+			StartTime: window.StartTime,
+			EndTime:   window.EndTime,
+		})
+	}
+	saved, err := b.BookingRepo.SaveSchedule(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+	b.offerFreedSlots(ctx, caller.ID)
+	res := toScheduleResponse(*saved)
+	return &res, nil
+}
+
+// AvailableServices keeps the published services that have at least one free slot starting within
+// the period, periods longer than maxSlotRange are cut short.
+func (b *BookingServiceImpl) AvailableServices(ctx context.Context, serviceIds []int, from time.Time,
+	to time.Time) ([]int, error) {
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	if to.Sub(from) > maxSlotRange {
+		to = from.Add(maxSlotRange)
+	}
+	available := []int{}
+	if !to.After(from) || len(serviceIds) == 0 {
+		return available, nil
+	}
+	services, err := b.services.GetServicesByIDs(ctx, serviceIds)
+	if err != nil {
+		return nil, err
+	}
+	var servitorIds []int
+	var longest time.Duration
+	for _, svc := range *services {
+		servitorIds = append(servitorIds, svc.UserID)
+		if d := bookingDuration(svc); d > longest {
+			longest = d
+		}
+	}
+	schedules, err := b.BookingRepo.GetSchedules(ctx, servitorIds)
+	if err != nil {
+		return nil, err
+	}
+	schedulesByServitor := map[int]dao.Schedule{}
+	for _, schedule := range *schedules {
+		schedulesByServitor[schedule.ServitorID] = schedule
+	}
+	padding := time.Duration(MaxBufferMinutes) * time.Minute
+	busy, err := b.busyTimes(ctx, servitorIds, from.Add(-padding), to.Add(longest+padding))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range *services {
+		schedule, ok := schedulesByServitor[svc.UserID]
+		if !ok {
+			continue
+		}
+		if len(freeSlots(schedule, bookingDuration(svc), busy[svc.UserID], from, to)) > 0 {
+			available = append(available, svc.ID)
+		}
+	}
+	return available, nil
+}
+
+// changeStatus moves the booking to the status if bookingTransitions allows the caller to, the slot
+// of a cancelled booking is offered to the waitlist.
+func (b *BookingServiceImpl) changeStatus(ctx context.Context, caller *utils.Caller, id int, status string,
+	reason string) (*BookingResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	movers, ok := bookingTransitions[booking.Status][status]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, booking.Status, status)
+	}
+	if !caller.IsAdmin() {
+		mover := customerMove
+		if booking.ServitorID == caller.ID {
+			mover = servitorMove
+		}
+		if movers&mover == 0 {
+			return nil, ErrMoveNotAllowed
+		}
+	}
+	now := time.Now()
+	if status == dao.ConfirmedStatus && !booking.ScheduledStart.After(now) {
+		return nil, ErrBookingStartPassed
+	}
+	if status == dao.NoShowStatus && booking.ScheduledStart.After(now) {
+		return nil, ErrBookingNotStarted
+	}
+
+	fee, refund := cancellationCharges(*booking, status, isCustomer(*booking, caller), now)
+	changed, err := b.BookingRepo.ChangeBookingStatus(ctx, dao.BookingStatusChange{
+		BookingID:  id,
+		FromStatus: booking.Status,
+		ToStatus:   status,
+		Reason:     reason,
+		ChangedBy:  caller.ID,
+		Fee:        fee,
+		Refund:     refund,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == dao.CancelledStatus {
+		b.offerFreedSlots(ctx, changed.ServitorID)
+	}
+	res := toBookingResponse(*changed)
+	return &res, nil
+}
+
+// bookableService loads a published service the caller may book along with its servitor's schedule.
+func (b *BookingServiceImpl) bookableService(ctx context.Context, caller *utils.Caller,
+	serviceId int) (*svcdao.Service, *dao.Schedule, error) {
+	svc, err := b.services.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if svc.Status != svcdao.PublishedStatus {
+		return nil, nil, ErrServiceUnavailable
+	}
+	if svc.UserID == caller.ID {
+		return nil, nil, ErrOwnService
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, svc.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, dao.ErrNoSchedule
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return svc, schedule, nil
+}
+
+// participantBooking loads the booking if the caller is its customer, its servitor or an administrator.
+func (b *BookingServiceImpl) participantBooking(ctx context.Context, caller *utils.Caller, id int) (*dao.Booking, error) {
+	booking, err := b.BookingRepo.GetBookingByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && booking.CustomerID != caller.ID && booking.ServitorID != caller.ID {
+		return nil, ErrNotParticipant
+	}
+	return booking, nil
+}
+
+func toBookingResponse(booking dao.Booking) BookingResponse {
+	return BookingResponse{
+		ID:             booking.ID,
+		ServiceID:      booking.ServiceID,
+		CustomerID:     booking.CustomerID,
+		ServitorID:     booking.ServitorID,
+		SeriesID:       booking.SeriesID,
+		Occurrence:     booking.Occurrence,
+		Status:         booking.Status,
+		ScheduledStart: booking.ScheduledStart,
+		ScheduledEnd:   booking.ScheduledEnd,
+		Address:        booking.Address,
+		Notes:          booking.Notes,
+		Price:          booking.Price,
+		Currency:       booking.Currency,
+		PricingModel:   booking.PricingModel,
+		Units:          booking.Units,
+		Latitude:       booking.Latitude,
+		Longitude:      booking.Longitude,
+		ActualMinutes:  booking.ActualMinutes,
+		FinalPrice:     booking.FinalPrice,
+		Rating:         booking.Rating,
+		CancellationPolicy: CancellationPolicy{
+			FreeCancellationHours:      booking.FreeCancellationHours,
+			LateCancellationFeePercent: booking.LateCancellationFeePercent,
+			NoShowFeePercent:           booking.NoShowFeePercent,
+		},
+		CancellationFee:    booking.CancellationFee,
+		RefundAmount:       booking.RefundAmount,
+		ConfirmedAt:        booking.ConfirmedAt,
+		StartedAt:          booking.StartedAt,
+		CompletedAt:        booking.CompletedAt,
+		CancelledAt:        booking.CancelledAt,
+		NoShowAt:           booking.NoShowAt,
+		CancelledBy:        booking.CancelledBy,
+		CancellationReason: booking.CancellationReason,
+		CreatedOn:          booking.CreatedOn,
+	}
+}
+
+// slotRange resolves the period slots are listed for, it starts no earlier than now.
+func slotRange(from *time.Time, to *time.Time) (time.Time, time.Time, error) {
+	start := time.Now()
+	if from != nil && from.After(start) {
+		start = *from
+	}
+	end := start.Add(defaultSlotRange)
+	if to != nil {
+		end = *to
+	}
+	if !end.After(start) || end.Sub(start) > maxSlotRange {
+		return time.Time{}, time.Time{}, ErrInvalidRange
+	}
+	return start, end, nil
+}
+
+// validateAvailability checks the time zone and that windows on the same weekday do not overlap.
+func validateAvailability(request ScheduleRequest) error {
+	if _, err := time.LoadLocation(request.TimeZone); err != nil {
+		return ErrInvalidAvailability
+	}
+	byWeekday := map[int][]span{}
+	for _, window := range request.Windows {
+		start, err := time.Parse(windowLayout, window.StartTime)
+		if err != nil {
+			return ErrInvalidAvailability
+		}
+		end, err := time.Parse(windowLayout, window.EndTime)
+		if err != nil || !end.After(start) {
+			return ErrInvalidAvailability
+		}
+		for _, other := range byWeekday[window.Weekday] {
+			if start.Before(other.end) && end.After(other.start) {
+				return ErrInvalidAvailability
+			}
+		}
+		byWeekday[window.Weekday] = append(byWeekday[window.Weekday], span{start: start, end: end})
+	}
+	return nil
+}
+
+func toScheduleResponse(schedule dao.Schedule) ScheduleResponse {
+	res := ScheduleResponse{
+		ServitorID:      schedule.ServitorID,
+		TimeZone:        schedule.TimeZone,
+		BufferMinutes:   schedule.BufferMinutes,
+		SlotStepMinutes: schedule.SlotStepMinutes,
+		Windows:         []AvailabilityWindow{},
+		LastUpdatedOn:   schedule.LastUpdatedOn,
+	}
+	for _, window := range schedule.Windows {
+		res.Windows = append(res.Windows, AvailabilityWindow{
+			Weekday:   window.Weekday,
+			StartTime: window.StartTime,
+			EndTime:   window.EndTime,
+		})
+	}
+	return res
+}
@@ -0,0 +1,196 @@
+package booking
+
+import (
+	"context"
+	"regexp"
+	"servhunt/booking/dao"
+	svcdao "servhunt/servitorservices/dao"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowLayout is the wall clock format of availability window bounds.
+const windowLayout = "15:04"
+
+const (
+	// defaultSlotStep is how far apart slots start when the schedule does not say.
+	defaultSlotStep = 30 * time.Minute
+
+	// defaultSlotRange is how far ahead slots are listed when no end is given.
+	defaultSlotRange = 7 * 24 * time.Hour
+
+	// maxSlotRange bounds the period slots are computed for in one go.
+	maxSlotRange = 31 * 24 * time.Hour
+
+	// MaxBufferMinutes bounds the gap a servitor can keep between bookings.
+	MaxBufferMinutes = 240
+)
+
+// durationPart matches an amount and unit in free text durations such as "1 hour 30 minutes".
+var durationPart = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(hours|hour|hrs|hr|h|minutes|minute|mins|min|m)\b`)
+
+// bookingDuration is how long a booking of the service lasts. DurationMinutes wins over the free
+// text ServiceDuration, and services stating neither take defaultBookingDuration.
+func bookingDuration(svc svcdao.Service) time.Duration {
+	if svc.DurationMinutes > 0 {
+		return time.Duration(svc.DurationMinutes) * time.Minute
+	}
+	if d := parseServiceDuration(svc.ServiceDuration); d > 0 {
+		return d
+	}
+	return defaultBookingDuration
+}
+
+// parseServiceDuration reads durations such as "45", "1h30m", "90 minutes" or "2 hours", a bare
+// number is taken as minutes. It returns 0 when nothing could be read.
+func parseServiceDuration(text string) time.Duration {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return 0
+	}
+	if minutes, err := strconv.Atoi(text); err == nil {
+		return time.Duration(minutes) * time.Minute
+	}
+	if d, err := time.ParseDuration(text); err == nil {
+		return d
+	}
+	var total time.Duration
+	for _, part := range durationPart.FindAllStringSubmatch(text, -1) {
+		amount, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			continue
+		}
+		unit := time.Minute
+		if strings.HasPrefix(part[2], "h") {
+			unit = time.Hour
+		}
+		total += time.Duration(amount * float64(unit))
+	}
+	return total
+}
+
+// span is a period of time, end excluded.
+type span struct {
+	start time.Time
+	end   time.Time
+}
+
+// scheduleLocation is the time zone the schedule's windows are read in.
+func scheduleLocation(schedule dao.Schedule) *time.Location {
+	if loc, err := time.LoadLocation(schedule.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+func scheduleBuffer(schedule dao.Schedule) time.Duration {
+	return time.Duration(schedule.BufferMinutes) * time.Minute
+}
+
+func scheduleStep(schedule dao.Schedule) time.Duration {
+	if schedule.SlotStepMinutes > 0 {
+		return time.Duration(schedule.SlotStepMinutes) * time.Minute
+	}
+	return defaultSlotStep
+}
+
+// windowsOn returns the availability windows of the schedule that fall on the day of the given time,
+// in the schedule's time zone.
+func windowsOn(schedule dao.Schedule, day time.Time) []span {
+	loc := scheduleLocation(schedule)
+	day = day.In(loc)
+	var spans []span
+	for _, window := range schedule.Windows {
+		if window.Weekday != int(day.Weekday()) {
+			continue
+		}
+		start, err := time.Parse(windowLayout, window.StartTime)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(windowLayout, window.EndTime)
+		if err != nil {
+			continue
+		}
+		spans = append(spans, span{
+			start: time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc),
+			end:   time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc),
+		})
+	}
+	return spans
+}
+
+// withinWindows reports whether the period fits entirely inside one of the schedule's windows.
+func withinWindows(schedule dao.Schedule, period span) bool {
+	for _, window := range windowsOn(schedule, period.start) {
+		if !period.start.Before(window.start) && !period.end.After(window.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// clashes reports whether the period comes within buffer of one of the busy times.
+func clashes(period span, busy []span, buffer time.Duration) bool {
+	for _, taken := range busy {
+		if period.start.Before(taken.end.Add(buffer)) && period.end.After(taken.start.Add(-buffer)) {
+			return true
+		}
+	}
+	return false
+}
+
+// busyTimes returns the times each servitor is busy within the period, from their active bookings
+// and the calendars they imported.
+func (b *BookingServiceImpl) busyTimes(ctx context.Context, servitorIds []int, from time.Time,
+	to time.Time) (map[int][]span, error) {
+	bookings, err := b.BookingRepo.ActiveBookings(ctx, servitorIds, from, to)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := b.BookingRepo.BusyPeriods(ctx, servitorIds, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy := map[int][]span{}
+	for _, booking := range *bookings {
+		busy[booking.ServitorID] = append(busy[booking.ServitorID],
+			span{start: booking.ScheduledStart, end: booking.ScheduledEnd})
+	}
+	for _, period := range *periods {
+		busy[period.ServitorID] = append(busy[period.ServitorID], span{start: period.StartsAt, end: period.EndsAt})
+	}
+	return busy, nil
+}
+
+// freeSlots lists the slots of the given duration starting between from and to that fit the
+// schedule's windows and keep clear of the busy times, earliest first.
+func freeSlots(schedule dao.Schedule, duration time.Duration, busy []span, from time.Time,
+	to time.Time) []span {
+	loc := scheduleLocation(schedule)
+	buffer := scheduleBuffer(schedule)
+	step := scheduleStep(schedule)
+	seen := map[int64]bool{}
+	slots := []span{}
+
+	local := from.In(loc)
+	for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, window := range windowsOn(schedule, day) {
+			for start := window.start; !start.Add(duration).After(window.end); start = start.Add(step) {
+				if start.Before(from) || !start.Before(to) || seen[start.Unix()] {
+					continue
+				}
+				slot := span{start: start, end: start.Add(duration)}
+				if clashes(slot, busy, buffer) {
+					continue
+				}
+				seen[start.Unix()] = true
+				slots = append(slots, slot)
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].start.Before(slots[j].start) })
+	return slots
+}
@@ -0,0 +1,161 @@
+package booking
+
+import (
+	"reflect"
+	"servhunt/booking/dao"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// monday is a Monday at midnight UTC.
+var monday = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func at(day time.Time, hour int, minute int) time.Time {
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func TestParseServiceDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"", 0},
+		{"45", 45 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"90 minutes", 90 * time.Minute},
+		{"2 Hours", 2 * time.Hour},
+		{"1.5 hrs", 90 * time.Minute},
+		{"1 hour 15 mins", 75 * time.Minute},
+		{"about an hour", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseServiceDuration(tt.text); got != tt.want {
+				t.Errorf("parseServiceDuration(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClashes(t *testing.T) {
+	busy := []span{{start: at(monday, 10, 0), end: at(monday, 11, 0)}}
+	tests := []struct {
+		name   string
+		period span
+		busy   []span
+		buffer time.Duration
+		want   bool
+	}{
+		{"overlapping", span{at(monday, 10, 30), at(monday, 11, 30)}, busy, 0, true},
+		{"inside", span{at(monday, 10, 15), at(monday, 10, 45)}, busy, 0, true},
+		{"right after", span{at(monday, 11, 0), at(monday, 12, 0)}, busy, 0, false},
+		{"right before", span{at(monday, 9, 0), at(monday, 10, 0)}, busy, 0, false},
+		{"inside the buffer after", span{at(monday, 11, 0), at(monday, 12, 0)}, busy, 15 * time.Minute, true},
+		{"inside the buffer before", span{at(monday, 9, 0), at(monday, 9, 50)}, busy, 15 * time.Minute, true},
+		{"right at the buffer", span{at(monday, 11, 15), at(monday, 12, 15)}, busy, 15 * time.Minute, false},
+		{"nothing busy", span{at(monday, 10, 0), at(monday, 11, 0)}, nil, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clashes(tt.period, tt.busy, tt.buffer); got != tt.want {
+				t.Errorf("clashes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithinWindows(t *testing.T) {
+	// Nairobi is three hours ahead of UTC all year, 09:00 there is 06:00 UTC
+	schedule := dao.Schedule{TimeZone: "Africa/Nairobi", Windows: []dao.AvailabilityWindow{
+		{Weekday: int(time.Monday), StartTime: "09:00", EndTime: "12:00"},
+		{Weekday: int(time.Monday), StartTime: "14:00", EndTime: "17:00"},
+	}}
+	tuesday := monday.AddDate(0, 0, 1)
+	tests := []struct {
+		name   string
+		period span
+		want   bool
+	}{
+		{"at the start of a window", span{at(monday, 6, 0), at(monday, 7, 0)}, true},
+		{"filling a window", span{at(monday, 11, 0), at(monday, 14, 0)}, true},
+		{"starting before a window", span{at(monday, 5, 30), at(monday, 6, 30)}, false},
+		{"running past a window", span{at(monday, 8, 30), at(monday, 9, 30)}, false},
+		{"spanning the gap between windows", span{at(monday, 8, 0), at(monday, 12, 0)}, false},
+		{"on a day without windows", span{at(tuesday, 6, 0), at(tuesday, 7, 0)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinWindows(schedule, tt.period); got != tt.want {
+				t.Errorf("withinWindows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	windows := []dao.AvailabilityWindow{{Weekday: int(time.Monday), StartTime: "09:00", EndTime: "12:00"}}
+	busy := []span{{start: at(monday, 10, 0), end: at(monday, 10, 30)}}
+	tests := []struct {
+		name     string
+		schedule dao.Schedule
+		busy     []span
+		from     time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "every step that fits the window",
+			schedule: dao.Schedule{TimeZone: "UTC", Windows: windows},
+			from:     monday,
+			want: []time.Time{at(monday, 9, 0), at(monday, 9, 30), at(monday, 10, 0), at(monday, 10, 30),
+				at(monday, 11, 0)},
+		},
+		{
+			name:     "a longer step",
+			schedule: dao.Schedule{TimeZone: "UTC", SlotStepMinutes: 60, Windows: windows},
+			from:     monday,
+			want:     []time.Time{at(monday, 9, 0), at(monday, 10, 0), at(monday, 11, 0)},
+		},
+		{
+			name:     "around a busy time",
+			schedule: dao.Schedule{TimeZone: "UTC", Windows: windows},
+			busy:     busy,
+			from:     monday,
+			want:     []time.Time{at(monday, 9, 0), at(monday, 10, 30), at(monday, 11, 0)},
+		},
+		{
+			name:     "clear of the buffer around a busy time",
+			schedule: dao.Schedule{TimeZone: "UTC", BufferMinutes: 15, Windows: windows},
+			busy:     busy,
+			from:     monday,
+			want:     []time.Time{at(monday, 11, 0)},
+		},
+		{
+			name:     "starting no earlier than from",
+			schedule: dao.Schedule{TimeZone: "UTC", Windows: windows},
+			from:     at(monday, 10, 10),
+			want:     []time.Time{at(monday, 10, 30), at(monday, 11, 0)},
+		},
+		{
+			name:     "in the schedule's time zone",
+			schedule: dao.Schedule{TimeZone: "Africa/Nairobi", SlotStepMinutes: 60, Windows: windows},
+			from:     monday,
+			want:     []time.Time{at(monday, 6, 0), at(monday, 7, 0), at(monday, 8, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := freeSlots(tt.schedule, time.Hour, tt.busy, tt.from, monday.AddDate(0, 0, 1))
+			got := []time.Time{}
+			for _, slot := range slots {
+				if slot.end.Sub(slot.start) != time.Hour {
+					t.Errorf("slot %v - %v does not last an hour", slot.start, slot.end)
+				}
+				got = append(got, slot.start.UTC())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
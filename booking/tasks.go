@@ -0,0 +1,341 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"servhunt/booking/dao"
+	"servhunt/notification"
+	"servhunt/scheduler"
+	"servhunt/user"
+	"time"
+)
+
+// Defaults used when the booking tasks are set up without their settings.
+const (
+	DefaultRequestTTL       = 24 * time.Hour
+	DefaultStaleAfter       = 12 * time.Hour
+	DefaultTaskPlanInterval = 15 * time.Minute
+)
+
+// Kinds of the booking tasks run by the scheduler.
+const (
+	planTask          = "booking.plan"
+	reminderTask      = "booking.reminder"
+	expireRequestTask = "booking.expire_request"
+	completeStaleTask = "booking.complete_stale"
+	expireHoldTask    = "booking.expire_hold"
+	offerSlotsTask    = "booking.offer_slots"
+)
+
+// planHorizon is how far ahead booking tasks are scheduled, it has to exceed the plan interval.
+const planHorizon = 48 * time.Hour
+
+// ReminderLeads are how long before a confirmed booking starts both participants are reminded of it.
+var ReminderLeads = []time.Duration{24 * time.Hour, time.Hour}
+
+// BookingReminder reminds the participants of a booking that it starts in Lead, the reminder is
+// dropped when the booking moved away from Start meanwhile.
+type BookingReminder struct {
+	BookingID int           `json:"booking_id"`
+	Start     time.Time     `json:"start"`
+	Lead      time.Duration `json:"lead"`
+}
+
+// RegisterTasks lets the scheduler run the booking tasks and plans them every planInterval.
+func RegisterTasks(ctx context.Context, s scheduler.Scheduler, svc BookingService, planInterval time.Duration) error {
+	if planInterval <= 0 {
+		planInterval = DefaultTaskPlanInterval
+	}
+	s.Handle(planTask, func(ctx context.Context, _ []byte) error {
+		return svc.PlanTasks(ctx, s)
+	})
+	s.Handle(reminderTask, func(ctx context.Context, payload []byte) error {
+		var reminder BookingReminder
+		if err := json.Unmarshal(payload, &reminder); err != nil {
+			return err
+		}
+		return svc.RemindBooking(ctx, reminder)
+	})
+	s.Handle(expireRequestTask, func(ctx context.Context, payload []byte) error {
+		var id int
+		if err := json.Unmarshal(payload, &id); err != nil {
+			return err
+		}
+		return svc.ExpireRequest(ctx, id)
+	})
+	s.Handle(completeStaleTask, func(ctx context.Context, payload []byte) error {
+		var id int
+		if err := json.Unmarshal(payload, &id); err != nil {
+			return err
+		}
+		return svc.CompleteStaleBooking(ctx, id)
+	})
+	s.Handle(expireHoldTask, func(ctx context.Context, payload []byte) error {
+		var id int
+		if err := json.Unmarshal(payload, &id); err != nil {
+			return err
+		}
+		return svc.ExpireWaitlistHold(ctx, id)
+	})
+	s.Handle(offerSlotsTask, func(ctx context.Context, payload []byte) error {
+		var servitorId int
+		if err := json.Unmarshal(payload, &servitorId); err != nil {
+			return err
+		}
+		return svc.OfferWaitlistSlots(ctx, servitorId)
+	})
+	return s.Every(ctx, planTask, planInterval)
+}
+
+// PlanTasks schedules the tasks of the bookings falling due within planHorizon: reminders of
+// confirmed bookings, the expiry of requests the servitor did not answer and the completion of
+// bookings left in progress. Tasks are named after the booking and the time they run at, so
+// planning again keeps the tasks already scheduled and a rescheduled booking gets new ones.
+// Waitlists are swept as well: periods that passed are closed, slots that freed up without a
+// booking change, such as a calendar sync, are offered and the lapse of held slots is scheduled.
+func (b *BookingServiceImpl) PlanTasks(ctx context.Context, tasks scheduler.TaskScheduler) error {
+	now := time.Now()
+	horizon := now.Add(planHorizon)
+
+	confirmed, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{Status: dao.ConfirmedStatus, StartsAfter: now,
+		StartsBefore: horizon.Add(ReminderLeads[0])})
+	if err != nil {
+		return err
+	}
+	for _, booking := range *confirmed {
+		for _, lead := range ReminderLeads {
+			runAt := booking.ScheduledStart.Add(-lead)
+			if runAt.After(horizon) {
+				continue
+			}
+			name := fmt.Sprintf("%s:%d:%d:%d", reminderTask, booking.ID, booking.ScheduledStart.Unix(), int(lead.Minutes()))
+			err = tasks.Schedule(ctx, reminderTask, name, runAt,
+				BookingReminder{BookingID: booking.ID, Start: booking.ScheduledStart, Lead: lead})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	requested, err := b.dueRequests(ctx, horizon)
+	if err != nil {
+		return err
+	}
+	for _, booking := range requested {
+		runAt := b.requestDeadline(booking)
+		if runAt.After(horizon) {
+			continue
+		}
+		name := fmt.Sprintf("%s:%d:%d", expireRequestTask, booking.ID, runAt.Unix())
+		if err = tasks.Schedule(ctx, expireRequestTask, name, runAt, booking.ID); err != nil {
+			return err
+		}
+	}
+
+	started, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{Status: dao.InProgressStatus,
+		EndsBefore: horizon.Add(-b.staleAfter)})
+	if err != nil {
+		return err
+	}
+	for _, booking := range *started {
+		runAt := booking.ScheduledEnd.Add(b.staleAfter)
+		if runAt.After(horizon) {
+			continue
+		}
+		name := fmt.Sprintf("%s:%d:%d", completeStaleTask, booking.ID, runAt.Unix())
+		if err = tasks.Schedule(ctx, completeStaleTask, name, runAt, booking.ID); err != nil {
+			return err
+		}
+	}
+
+	if err = b.BookingRepo.LapseEndedWaitlistEntries(ctx, now); err != nil {
+		return err
+	}
+	servitorIds, err := b.BookingRepo.WaitlistServitors(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, servitorId := range servitorIds {
+		b.offerFreedSlots(ctx, servitorId)
+	}
+	offered, err := b.BookingRepo.WaitlistEntries(ctx, dao.WaitlistFilter{Statuses: []string{dao.OfferedEntry}})
+	if err != nil {
+		return err
+	}
+	for _, entry := range *offered {
+		runAt := *entry.HoldExpiresAt
+		if runAt.After(horizon) {
+			continue
+		}
+		name := fmt.Sprintf("%s:%d:%d", expireHoldTask, entry.ID, runAt.Unix())
+		if err = tasks.Schedule(ctx, expireHoldTask, name, runAt, entry.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemindBooking tells both participants the booking starts soon. Reminders are skipped once the
+// booking is no longer confirmed for the same start, and when it was confirmed after the reminder
+// was due since the participants just heard about it.
+func (b *BookingServiceImpl) RemindBooking(ctx context.Context, reminder BookingReminder) error {
+	booking, err := b.BookingRepo.GetBookingByID(ctx, reminder.BookingID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	remindAt := reminder.Start.Add(-reminder.Lead)
+	if booking.Status != dao.ConfirmedStatus || !booking.ScheduledStart.Equal(reminder.Start) ||
+		!booking.ScheduledStart.After(time.Now()) || booking.ConfirmedAt != nil && booking.ConfirmedAt.After(remindAt) {
+		return nil
+	}
+
+	name := "your service"
+	if svc, err := b.services.GetServiceByID(ctx, booking.ServiceID); err == nil {
+		name = svc.ServiceName
+	}
+	start := booking.ScheduledStart
+	if schedule, err := b.BookingRepo.GetSchedule(ctx, booking.ServitorID); err == nil {
+		if loc, err := time.LoadLocation(schedule.TimeZone); err == nil {
+			start = start.In(loc)
+		}
+	}
+	body := fmt.Sprintf("%s at %s starts in %s, on %s.", name, booking.Address, leadText(reminder.Lead),
+		start.Format("Mon 2 Jan at 15:04 MST"))
+	var failed error
+	for _, userId := range []int{booking.CustomerID, booking.ServitorID} {
+		err = b.notifier.Notify(ctx, notification.Message{
+			UserID: userId,
+			Event:  user.BookingReminderEvent,
+			Title:  "Upcoming booking",
+			Body:   body,
+		})
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// ExpireRequest cancels the booking if it is still waiting for the servitor past its deadline, the
+// customer is refunded in full and told about it and the slot is offered to the waitlist.
+func (b *BookingServiceImpl) ExpireRequest(ctx context.Context, id int) error {
+	booking, err := b.BookingRepo.GetBookingByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if booking.Status != dao.RequestedStatus || now.Before(b.requestDeadline(*booking)) {
+		return nil
+	}
+	fee, refund := cancellationCharges(*booking, dao.CancelledStatus, false, now)
+	_, err = b.BookingRepo.ChangeBookingStatus(ctx, dao.BookingStatusChange{
+		BookingID:  id,
+		FromStatus: dao.RequestedStatus,
+		ToStatus:   dao.CancelledStatus,
+		Reason:     "The servitor did not answer the request in time",
+		Fee:        fee,
+		Refund:     refund,
+	})
+	if errors.Is(err, dao.ErrStatusChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = b.notifier.Notify(ctx, notification.Message{
+		UserID: booking.CustomerID,
+		Event:  user.BookingCancelledEvent,
+		Title:  "Booking request expired",
+		Body: fmt.Sprintf("Your booking request for %s was not answered in time and has been cancelled.",
+			booking.ScheduledStart.Format("Mon 2 Jan at 15:04 MST")),
+	})
+	if err != nil {
+		logger.Error("error notifying expired booking request", zap.Int("booking.id", id),
+			zap.NamedError("error.message", err))
+	}
+	b.offerFreedSlots(ctx, booking.ServitorID)
+	return nil
+}
+
+// CompleteStaleBooking completes the booking if it is still in progress long after it was due to
+// end, the servitor never checked out so no actual duration is recorded.
+func (b *BookingServiceImpl) CompleteStaleBooking(ctx context.Context, id int) error {
+	booking, err := b.BookingRepo.GetBookingByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if booking.Status != dao.InProgressStatus || time.Now().Before(booking.ScheduledEnd.Add(b.staleAfter)) {
+		return nil
+	}
+	_, err = b.BookingRepo.ChangeBookingStatus(ctx, dao.BookingStatusChange{
+		BookingID:  id,
+		FromStatus: dao.InProgressStatus,
+		ToStatus:   dao.CompletedStatus,
+		Reason:     "Completed automatically, the booking was not completed in time",
+	})
+	if errors.Is(err, dao.ErrStatusChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.recordCompletion(ctx, booking.CustomerID)
+	return nil
+}
+
+// dueRequests loads the requests whose deadline falls before the horizon: the ones starting by then
+// and the ones made over requestTTL before it.
+func (b *BookingServiceImpl) dueRequests(ctx context.Context, horizon time.Time) ([]dao.Booking, error) {
+	starting, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{Status: dao.RequestedStatus, StartsBefore: horizon})
+	if err != nil {
+		return nil, err
+	}
+	lapsing, err := b.BookingRepo.Bookings(ctx, dao.BookingFilter{Status: dao.RequestedStatus,
+		CreatedBefore: horizon.Add(-b.requestTTL)})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	var due []dao.Booking
+	for _, booking := range append(*starting, *lapsing...) {
+		if !seen[booking.ID] {
+			seen[booking.ID] = true
+			due = append(due, booking)
+		}
+	}
+	return due, nil
+}
+
+// requestDeadline is when an unanswered request expires, requestTTL after it was made but no later
+// than the booking's start.
+func (b *BookingServiceImpl) requestDeadline(booking dao.Booking) time.Time {
+	deadline := booking.CreatedOn.Add(b.requestTTL)
+	if booking.ScheduledStart.Before(deadline) {
+		return booking.ScheduledStart
+	}
+	return deadline
+}
+
+// leadText spells out a reminder lead such as 24 hours or 30 minutes.
+func leadText(lead time.Duration) string {
+	switch {
+	case lead == time.Hour:
+		return "1 hour"
+	case lead%time.Hour == 0:
+		return fmt.Sprintf("%d hours", int(lead.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(lead.Minutes()))
+}
@@ -0,0 +1,257 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"math"
+	"servhunt/booking/dao"
+	"servhunt/infra/geo"
+	"servhunt/infra/utils"
+	svcdao "servhunt/servitorservices/dao"
+	"servhunt/storage"
+	"time"
+)
+
+const (
+	// DefaultCheckInRadius is how close, in meters, a servitor must be to the booking site for their
+	// check in or out to be verified when no radius is configured.
+	DefaultCheckInRadius = 300
+
+	// MaxBookingPhotos bounds the photos attached to one booking.
+	MaxBookingPhotos = 20
+)
+
+var (
+	ErrInvalidSite   = errors.New("latitude and longitude must be given together")
+	ErrPhotosClosed  = errors.New("photos can only be added to confirmed, in progress or completed bookings")
+	ErrTooManyPhotos = fmt.Errorf("a booking can have at most %d photos", MaxBookingPhotos)
+)
+
+// photoStatuses are the statuses of bookings photos can be added to.
+var photoStatuses = map[string]bool{dao.ConfirmedStatus: true, dao.InProgressStatus: true, dao.CompletedStatus: true}
+
+// CheckIn starts the booking as its servitor arrives, recording where their device is and how far
+// that is from the booking site.
+func (b *BookingServiceImpl) CheckIn(ctx context.Context, caller *utils.Caller, id int,
+	request CheckRequest) (*VisitResponse, error) {
+	return b.check(ctx, caller, id, dao.CheckIn, request)
+}
+
+// CheckOut completes the booking as its servitor leaves. The minutes between check in and check
+// out are recorded and hourly bookings are billed for them, part hours pro rata.
+func (b *BookingServiceImpl) CheckOut(ctx context.Context, caller *utils.Caller, id int,
+	request CheckRequest) (*VisitResponse, error) {
+	return b.check(ctx, caller, id, dao.CheckOut, request)
+}
+
+// UploadBookingPhoto adds a photo of the work to the booking, photos are kept as evidence and
+// cannot be removed by the participants.
+func (b *BookingServiceImpl) UploadBookingPhoto(ctx context.Context, caller *utils.Caller, id int,
+	request UploadBookingPhotoRequest, file io.Reader) (*BookingPhotoResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if !photoStatuses[booking.Status] {
+		return nil, ErrPhotosClosed
+	}
+	count, err := b.BookingRepo.CountBookingPhotos(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxBookingPhotos {
+		return nil, ErrTooManyPhotos
+	}
+	stored, err := storage.PutPhoto(ctx, b.blobs, fmt.Sprintf("bookings/%d/photos", id), file)
+	if err != nil {
+		return nil, err
+	}
+	created, err := b.BookingRepo.CreateBookingPhoto(ctx, dao.BookingPhoto{
+		BookingID:  id,
+		Stage:      request.Stage,
+		UploadedBy: caller.ID,
+		StorageKey: stored.Key,
+		Url:        stored.Url,
+		Width:      stored.Width,
+		Height:     stored.Height,
+	})
+	if err != nil {
+		storage.DeletePhoto(ctx, b.blobs, stored.Key)
+		return nil, err
+	}
+	res := toBookingPhotoResponse(*created)
+	return &res, nil
+}
+
+func (b *BookingServiceImpl) BookingVisit(ctx context.Context, caller *utils.Caller, id int) (*VisitResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	return b.visit(ctx, *booking)
+}
+
+// check records the servitor checking in or out of the booking and moves it on. Only the servitor
+// can check in or out since the position is their proof of being there, checks too far from the
+// site are still recorded but not verified.
+func (b *BookingServiceImpl) check(ctx context.Context, caller *utils.Caller, id int, kind string,
+	request CheckRequest) (*VisitResponse, error) {
+	booking, err := b.participantBooking(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if booking.ServitorID != caller.ID {
+		return nil, ErrMoveNotAllowed
+	}
+	status := dao.InProgressStatus
+	if kind == dao.CheckOut {
+		status = dao.CompletedStatus
+	}
+	if _, ok := bookingTransitions[booking.Status][status]; !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, booking.Status, status)
+	}
+
+	position := geo.Point{Latitude: *request.Latitude, Longitude: *request.Longitude}
+	distance, err := b.siteDistance(ctx, *booking, position)
+	if err != nil {
+		return nil, err
+	}
+	check := dao.BookingCheck{
+		BookingID:      id,
+		Kind:           kind,
+		Latitude:       position.Latitude,
+		Longitude:      position.Longitude,
+		AccuracyMeters: request.AccuracyMeters,
+		DistanceMeters: distance,
+		Verified:       distance != nil && *distance <= b.checkInRadius,
+	}
+	var actualMinutes *int
+	var finalPrice *int64
+	if kind == dao.CheckOut {
+		started := booking.ScheduledStart
+		if booking.StartedAt != nil {
+			started = *booking.StartedAt
+		}
+		minutes := workedMinutes(started, time.Now())
+		price := billedPrice(*booking, minutes)
+		actualMinutes, finalPrice = &minutes, &price
+	}
+	changed, err := b.BookingRepo.CheckBooking(ctx, dao.BookingStatusChange{
+		BookingID:  id,
+		FromStatus: booking.Status,
+		ToStatus:   status,
+		ChangedBy:  caller.ID,
+	}, check, actualMinutes, finalPrice)
+	if err != nil {
+		return nil, err
+	}
+	if kind == dao.CheckOut {
+		b.recordCompletion(ctx, changed.CustomerID)
+	}
+	return b.visit(ctx, *changed)
+}
+
+// siteDistance is how far, in meters, the position is from where the booking takes place: the
+// address the customer located or else the nearest location of the service. It is nil when
+// neither is known.
+func (b *BookingServiceImpl) siteDistance(ctx context.Context, booking dao.Booking,
+	position geo.Point) (*float64, error) {
+	if booking.Latitude != nil && booking.Longitude != nil {
+		distance := geo.DistanceKm(position, geo.Point{Latitude: *booking.Latitude, Longitude: *booking.Longitude}) * 1000
+		return &distance, nil
+	}
+	svc, err := b.services.GetServiceByID(ctx, booking.ServiceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nearest *float64
+	for _, location := range svc.LocationInfo {
+		distance := geo.DistanceKm(position, geo.Point{Latitude: location.Latitude, Longitude: location.Longitude}) * 1000
+		if nearest == nil || distance < *nearest {
+			nearest = &distance
+		}
+	}
+	return nearest, nil
+}
+
+func (b *BookingServiceImpl) visit(ctx context.Context, booking dao.Booking) (*VisitResponse, error) {
+	checks, err := b.BookingRepo.BookingChecks(ctx, booking.ID)
+	if err != nil {
+		return nil, err
+	}
+	photos, err := b.BookingRepo.BookingPhotos(ctx, booking.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := VisitResponse{
+		BookingID:      booking.ID,
+		Status:         booking.Status,
+		ScheduledStart: booking.ScheduledStart,
+		ScheduledEnd:   booking.ScheduledEnd,
+		StartedAt:      booking.StartedAt,
+		CompletedAt:    booking.CompletedAt,
+		ActualMinutes:  booking.ActualMinutes,
+		PricingModel:   booking.PricingModel,
+		Price:          booking.Price,
+		FinalPrice:     booking.FinalPrice,
+		Currency:       booking.Currency,
+		Checks:         []CheckResponse{},
+		Photos:         []BookingPhotoResponse{},
+	}
+	for _, check := range *checks {
+		res.Checks = append(res.Checks, CheckResponse{
+			Kind:           check.Kind,
+			Latitude:       check.Latitude,
+			Longitude:      check.Longitude,
+			AccuracyMeters: check.AccuracyMeters,
+			DistanceMeters: check.DistanceMeters,
+			Verified:       check.Verified,
+			CheckedAt:      check.CreatedOn,
+		})
+	}
+	for _, photo := range *photos {
+		res.Photos = append(res.Photos, toBookingPhotoResponse(photo))
+	}
+	return &res, nil
+}
+
+// workedMinutes counts the minutes between check in and check out, part minutes count as whole ones.
+func workedMinutes(start time.Time, end time.Time) int {
+	if !end.After(start) {
+		return 0
+	}
+	return int(math.Ceil(end.Sub(start).Minutes()))
+}
+
+// billedPrice is what the booking comes to for the minutes worked. Hourly bookings are charged pro
+// rata, rounding up to the next minor unit like quotes do, per unit bookings for every unit booked
+// and other bookings cost their price.
+func billedPrice(booking dao.Booking, minutes int) int64 {
+	switch booking.PricingModel {
+	case svcdao.HourlyPricing:
+		return (booking.Price*int64(minutes) + 59) / 60
+	case svcdao.PerUnitPricing:
+		if booking.Units > 1 {
+			return booking.Price * int64(booking.Units)
+		}
+	}
+	return booking.Price
+}
+
+func toBookingPhotoResponse(photo dao.BookingPhoto) BookingPhotoResponse {
+	return BookingPhotoResponse{
+		ID:         photo.ID,
+		Stage:      photo.Stage,
+		UploadedBy: photo.UploadedBy,
+		Url:        photo.Url,
+		Width:      photo.Width,
+		Height:     photo.Height,
+		CreatedOn:  photo.CreatedOn,
+	}
+}
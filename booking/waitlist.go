@@ -0,0 +1,336 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"servhunt/booking/dao"
+	"servhunt/infra/utils"
+	"servhunt/notification"
+	"servhunt/user"
+	"time"
+)
+
+// DefaultWaitlistHold is how long a freed slot is held for a waitlisted customer when no hold is set.
+const DefaultWaitlistHold = 2 * time.Hour
+
+var (
+	ErrNotWaitlisted     = errors.New("waitlist entry belongs to another customer")
+	ErrAlreadyWaitlisted = errors.New("you are already on the waitlist for this service")
+	ErrWaitlistClosed    = errors.New("you are no longer on this waitlist")
+	ErrNoHold            = errors.New("no slot is held for you on this waitlist")
+	ErrHoldExpired       = errors.New("the slot held for you has been released")
+)
+
+// JoinWaitlist puts the caller on the waitlist of a service for a slot starting within the requested
+// period. Free slots are offered straight away, so a customer joining while the servitor still has
+// room gets a hold as soon as the customers ahead of them have theirs.
+func (b *BookingServiceImpl) JoinWaitlist(ctx context.Context, caller *utils.Caller,
+	request JoinWaitlistRequest) (*WaitlistEntryResponse, error) {
+	if (request.Latitude == nil) != (request.Longitude == nil) {
+		return nil, ErrInvalidSite
+	}
+	svc, _, err := b.bookableService(ctx, caller, request.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !request.LatestStart.After(request.EarliestStart) || !request.LatestStart.After(now) ||
+		request.LatestStart.Sub(request.EarliestStart) > maxSlotRange {
+		return nil, ErrInvalidRange
+	}
+	waiting, err := b.BookingRepo.WaitlistEntries(ctx, dao.WaitlistFilter{
+		CustomerID:       caller.ID,
+		ServiceID:        svc.ID,
+		Statuses:         []string{dao.WaitingEntry, dao.OfferedEntry},
+		LatestStartAfter: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(*waiting) > 0 {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	entry, err := b.BookingRepo.CreateWaitlistEntry(ctx, dao.WaitlistEntry{
+		ServiceID:     svc.ID,
+		CustomerID:    caller.ID,
+		ServitorID:    svc.UserID,
+		EarliestStart: request.EarliestStart,
+		LatestStart:   request.LatestStart,
+		Address:       request.Address,
+		Notes:         request.Notes,
+		Latitude:      request.Latitude,
+		Longitude:     request.Longitude,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.offerFreedSlots(ctx, svc.UserID)
+	if entry, err = b.BookingRepo.GetWaitlistEntryByID(ctx, entry.ID); err != nil {
+		return nil, err
+	}
+	return b.waitlistEntryResponse(ctx, *entry)
+}
+
+// UserWaitlist lists the caller's waitlist entries, or the customers waiting for the caller's
+// services when the role is servitor, in the order they joined.
+func (b *BookingServiceImpl) UserWaitlist(ctx context.Context, caller *utils.Caller,
+	request FetchBookingsRequest) (*[]WaitlistEntryResponse, error) {
+	filter := dao.WaitlistFilter{}
+	switch request.Role {
+	case "", utils.CustomerUserType:
+		filter.CustomerID = caller.ID
+	case utils.ServitorUserType:
+		filter.ServitorID = caller.ID
+	default:
+		return nil, ErrUnknownRole
+	}
+	if request.Status != "" {
+		filter.Statuses = []string{request.Status}
+	}
+	entries, err := b.BookingRepo.WaitlistEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	res := []WaitlistEntryResponse{}
+	for _, entry := range *entries {
+		item, err := b.waitlistEntryResponse(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *item)
+	}
+	return &res, nil
+}
+
+// ClaimWaitlistSlot turns the slot held for the caller into a booking request, the servitor accepts
+// or declines it like any other request.
+func (b *BookingServiceImpl) ClaimWaitlistSlot(ctx context.Context, caller *utils.Caller,
+	id int) (*BookingResponse, error) {
+	entry, err := b.ownWaitlistEntry(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status != dao.OfferedEntry || entry.BookingID == nil || entry.HoldExpiresAt == nil {
+		return nil, ErrNoHold
+	}
+	if !time.Now().Before(*entry.HoldExpiresAt) {
+		return nil, ErrHoldExpired
+	}
+	_, err = b.BookingRepo.CloseWaitlistEntry(ctx, id, dao.OfferedEntry, dao.BookedEntry, &dao.BookingStatusChange{
+		BookingID:  *entry.BookingID,
+		FromStatus: dao.HeldStatus,
+		ToStatus:   dao.RequestedStatus,
+		Reason:     "Claimed from the waitlist",
+		ChangedBy:  caller.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	booking, err := b.BookingRepo.GetBookingByID(ctx, *entry.BookingID)
+	if err != nil {
+		return nil, err
+	}
+	res := toBookingResponse(*booking)
+	return &res, nil
+}
+
+// LeaveWaitlist takes the caller off the waitlist, a slot held for them is passed on to the next
+// customer waiting.
+func (b *BookingServiceImpl) LeaveWaitlist(ctx context.Context, caller *utils.Caller, id int) error {
+	entry, err := b.ownWaitlistEntry(ctx, caller, id)
+	if err != nil {
+		return err
+	}
+	switch entry.Status {
+	case dao.WaitingEntry:
+		_, err = b.BookingRepo.CloseWaitlistEntry(ctx, id, dao.WaitingEntry, dao.LeftEntry, nil)
+		return err
+	case dao.OfferedEntry:
+		_, err = b.BookingRepo.CloseWaitlistEntry(ctx, id, dao.OfferedEntry, dao.LeftEntry, &dao.BookingStatusChange{
+			BookingID:  *entry.BookingID,
+			FromStatus: dao.HeldStatus,
+			ToStatus:   dao.CancelledStatus,
+			Reason:     "The customer left the waitlist",
+			ChangedBy:  caller.ID,
+		})
+		if err != nil {
+			return err
+		}
+		b.offerFreedSlots(ctx, entry.ServitorID)
+		return nil
+	}
+	return ErrWaitlistClosed
+}
+
+// ExpireWaitlistHold releases the slot held for the entry once the hold lapsed unclaimed and offers
+// it to the next customer waiting. The entry leaves the waitlist, the customer can join again.
+func (b *BookingServiceImpl) ExpireWaitlistHold(ctx context.Context, id int) error {
+	entry, err := b.BookingRepo.GetWaitlistEntryByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if entry.Status != dao.OfferedEntry || time.Now().Before(*entry.HoldExpiresAt) {
+		return nil
+	}
+	_, err = b.BookingRepo.CloseWaitlistEntry(ctx, id, dao.OfferedEntry, dao.LapsedEntry, &dao.BookingStatusChange{
+		BookingID:  *entry.BookingID,
+		FromStatus: dao.HeldStatus,
+		ToStatus:   dao.CancelledStatus,
+		Reason:     "The waitlist hold lapsed",
+	})
+	if errors.Is(err, dao.ErrWaitlistChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.offerFreedSlots(ctx, entry.ServitorID)
+	return nil
+}
+
+// OfferWaitlistSlots goes through the customers waiting for the servitor's services in the order they
+// joined and holds the earliest free slot within each one's period for them, until the slots run out.
+func (b *BookingServiceImpl) OfferWaitlistSlots(ctx context.Context, servitorId int) error {
+	entries, err := b.BookingRepo.WaitlistEntries(ctx, dao.WaitlistFilter{
+		ServitorID:       servitorId,
+		Statuses:         []string{dao.WaitingEntry},
+		LatestStartAfter: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range *entries {
+		slots, err := b.Slots(ctx, SlotsRequest{ServiceID: entry.ServiceID, From: &entry.EarliestStart,
+			To: &entry.LatestStart})
+		if err != nil {
+			return err
+		}
+		if len(*slots) == 0 {
+			continue
+		}
+		err = b.holdSlot(ctx, entry, (*slots)[0])
+		if errors.Is(err, dao.ErrSlotTaken) || errors.Is(err, dao.ErrWaitlistChanged) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerFreedSlots queues a task offering the servitor's waitlist the slots a change may have freed,
+// so the change does not wait on it. Failures are logged since the change itself went through and
+// the task planner offers slots again later.
+func (b *BookingServiceImpl) offerFreedSlots(ctx context.Context, servitorId int) {
+	now := time.Now()
+	name := fmt.Sprintf("%s:%d:%d", offerSlotsTask, servitorId, now.UnixNano())
+	if err := b.tasks.Schedule(ctx, offerSlotsTask, name, now, servitorId); err != nil {
+		logger.Error("error queueing the offer of freed slots to the waitlist", zap.Int("servitor.id", servitorId),
+			zap.NamedError("error.message", err))
+	}
+}
+
+// holdSlot books the slot as held for the entry's customer at the service's current price and tells
+// them about it. The hold lasts waitlistHold but no longer than until the slot starts.
+func (b *BookingServiceImpl) holdSlot(ctx context.Context, entry dao.WaitlistEntry, slot SlotResponse) error {
+	svc, err := b.services.GetServiceByID(ctx, entry.ServiceID)
+	if err != nil {
+		return err
+	}
+	schedule, err := b.BookingRepo.GetSchedule(ctx, entry.ServitorID)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(b.waitlistHold)
+	if slot.Start.Before(expiresAt) {
+		expiresAt = slot.Start
+	}
+	_, err = b.BookingRepo.HoldWaitlistSlot(ctx, entry.ID, dao.Booking{
+		ServiceID:                  svc.ID,
+		CustomerID:                 entry.CustomerID,
+		ServitorID:                 svc.UserID,
+		ScheduledStart:             slot.Start,
+		ScheduledEnd:               slot.End,
+		Address:                    entry.Address,
+		Notes:                      entry.Notes,
+		Price:                      svc.Price,
+		Currency:                   svc.Currency,
+		PricingModel:               svc.PricingModel,
+		Latitude:                   entry.Latitude,
+		Longitude:                  entry.Longitude,
+		FreeCancellationHours:      svc.FreeCancellationHours,
+		LateCancellationFeePercent: svc.LateCancellationFeePercent,
+		NoShowFeePercent:           svc.NoShowFeePercent,
+	}, scheduleBuffer(*schedule), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	loc := scheduleLocation(*schedule)
+	err = b.notifier.Notify(ctx, notification.Message{
+		UserID: entry.CustomerID,
+		Event:  user.WaitlistOfferEvent,
+		Title:  "A slot opened up",
+		Body: fmt.Sprintf("%s is free on %s and held for you until %s, claim it before then to book it.",
+			svc.ServiceName, slot.Start.In(loc).Format("Mon 2 Jan at 15:04 MST"),
+			expiresAt.In(loc).Format("Mon 2 Jan at 15:04 MST")),
+	})
+	if err != nil {
+		logger.Error("error notifying waitlist offer", zap.Int("waitlist.id", entry.ID),
+			zap.NamedError("error.message", err))
+	}
+	return nil
+}
+
+// ownWaitlistEntry loads the waitlist entry if the caller is its customer or an administrator.
+func (b *BookingServiceImpl) ownWaitlistEntry(ctx context.Context, caller *utils.Caller,
+	id int) (*dao.WaitlistEntry, error) {
+	entry, err := b.BookingRepo.GetWaitlistEntryByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && entry.CustomerID != caller.ID {
+		return nil, ErrNotWaitlisted
+	}
+	return entry, nil
+}
+
+// waitlistEntryResponse describes the entry along with the slot held for it, if any.
+func (b *BookingServiceImpl) waitlistEntryResponse(ctx context.Context,
+	entry dao.WaitlistEntry) (*WaitlistEntryResponse, error) {
+	res := WaitlistEntryResponse{
+		ID:            entry.ID,
+		ServiceID:     entry.ServiceID,
+		CustomerID:    entry.CustomerID,
+		ServitorID:    entry.ServitorID,
+		EarliestStart: entry.EarliestStart,
+		LatestStart:   entry.LatestStart,
+		Address:       entry.Address,
+		Notes:         entry.Notes,
+		Latitude:      entry.Latitude,
+		Longitude:     entry.Longitude,
+		Status:        entry.Status,
+		CreatedOn:     entry.CreatedOn,
+	}
+	if entry.Status == dao.OfferedEntry && entry.BookingID != nil && entry.HoldExpiresAt != nil {
+		booking, err := b.BookingRepo.GetBookingByID(ctx, *entry.BookingID)
+		if err != nil {
+			return nil, err
+		}
+		res.Hold = &WaitlistHoldResponse{
+			BookingID: booking.ID,
+			Start:     booking.ScheduledStart,
+			End:       booking.ScheduledEnd,
+			ExpiresAt: *entry.HoldExpiresAt,
+		}
+	}
+	return &res, nil
+}
@@ -25,6 +25,51 @@ type Config struct {
 		ConnectionUrl string `json:"ConnectionUrl"`
 		Password      string `json:"Password"`
 	} `json:"Cache"`
+	Retention struct {
+		PurgeAfterDays     int `json:"PurgeAfterDays"`
+		PurgeIntervalHours int `json:"PurgeIntervalHours"`
+	} `json:"Retention"`
+	Referral struct {
+		ReferrerReward    int64    `json:"ReferrerReward"`
+		RefereeReward     int64    `json:"RefereeReward"`
+		Currency          string   `json:"Currency"`
+		QualifyingActions []string `json:"QualifyingActions"`
+	} `json:"Referral"`
+	Search struct {
+		Backend string `json:"Backend"`
+	} `json:"Search"`
+	Pricing struct {
+		DefaultCurrency string `json:"DefaultCurrency"`
+	} `json:"Pricing"`
+	Storage struct {
+		Backend string `json:"Backend"`
+		Root    string `json:"Root"`
+		BaseURL string `json:"BaseURL"`
+		// PrivateRoot keeps the files only handed out through the API, such as identity documents
+		PrivateRoot string `json:"PrivateRoot"`
+	} `json:"Storage"`
+	Bookings struct {
+		SeriesHorizonDays   int     `json:"SeriesHorizonDays"`
+		SeriesIntervalHours int     `json:"SeriesIntervalHours"`
+		CalendarFeedURL     string  `json:"CalendarFeedURL"`
+		CalendarSyncMinutes int     `json:"CalendarSyncMinutes"`
+		CheckInRadiusMeters float64 `json:"CheckInRadiusMeters"`
+		RequestTTLHours     int     `json:"RequestTTLHours"`
+		StaleAfterHours     int     `json:"StaleAfterHours"`
+		TaskPlanMinutes     int     `json:"TaskPlanMinutes"`
+		WaitlistHoldMinutes int     `json:"WaitlistHoldMinutes"`
+	} `json:"Bookings"`
+	Dispatch struct {
+		OfferTimeoutSeconds int       `json:"OfferTimeoutSeconds"`
+		RadiiKm             []float64 `json:"RadiiKm"`
+		PresenceTTLMinutes  int       `json:"PresenceTTLMinutes"`
+	} `json:"Dispatch"`
+	Scheduler struct {
+		PollSeconds  int `json:"PollSeconds"`
+		Workers      int `json:"Workers"`
+		LeaseMinutes int `json:"LeaseMinutes"`
+		DrainSeconds int `json:"DrainSeconds"`
+	} `json:"Scheduler"`
 }
 
 func InitViperConfig() (config *Config) {
@@ -0,0 +1,59 @@
+package dispatch
+
+import "time"
+
+// DispatchRequest asks for whoever offering the category is nearest to the point right now.
+type DispatchRequest struct {
+	CategoryID int      `json:"category_id" binding:"required"`
+	Address    string   `json:"address" binding:"required,max=512"`
+	Notes      string   `json:"notes" binding:"max=1024"`
+	Latitude   *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude  *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// PresenceRequest puts a servitor online at their current position or takes them offline, online
+// servitors check in again at least every few minutes to stay online.
+type PresenceRequest struct {
+	Online    bool     `json:"online"`
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+type PresenceResponse struct {
+	Online     bool      `json:"online"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type DispatchResponse struct {
+	ID         int       `json:"id"`
+	CustomerID int       `json:"customer_id"`
+	CategoryID int       `json:"category_id"`
+	Address    string    `json:"address"`
+	Notes      string    `json:"notes,omitempty"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Status     string    `json:"status"`
+	RadiusKm   float64   `json:"radius_km"`
+	Offered    int       `json:"offered"`
+	ServitorID *int      `json:"servitor_id,omitempty"`
+	ServiceID  *int      `json:"service_id,omitempty"`
+	BookingID  *int      `json:"booking_id,omitempty"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+// OfferResponse is a dispatch offered to the servitor, to be answered before ExpiresAt.
+type OfferResponse struct {
+	ID         int       `json:"id"`
+	DispatchID int       `json:"dispatch_id"`
+	ServiceID  int       `json:"service_id"`
+	CategoryID int       `json:"category_id"`
+	Address    string    `json:"address"`
+	Notes      string    `json:"notes,omitempty"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	DistanceKm float64   `json:"distance_km"`
+	Status     string    `json:"status"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,25 @@
+package dispatch
+
+import "time"
+
+// Clock tells the dispatcher the time and when an offer runs out, a fake clock can be swapped in to
+// drive the timing by hand.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+// RealClock is the wall clock.
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,101 @@
+package dispatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when the test advances it.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	calls  int
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock on and fires the timers that ran out.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// waitForAfter waits until After was called n times, so the timer is set before the clock moves.
+func (c *fakeClock) waitForAfter(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		calls := c.calls
+		c.mu.Unlock()
+		if calls >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("After was called %d times, want %d", calls, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+
+	clock.Advance(time.Second)
+	select {
+	case at := <-short:
+		if !at.Equal(start.Add(time.Second)) {
+			t.Errorf("fired at %v, want %v", at, start.Add(time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire once its time came")
+	}
+	select {
+	case <-long:
+		t.Fatal("timer fired early")
+	default:
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-long:
+	default:
+		t.Fatal("timer did not fire once its time came")
+	}
+}
@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"time"
+)
+
+// Statuses a dispatch moves through, assigned, unassigned and cancelled are final. A dispatch ends
+// unassigned when nobody took it within the widest radius.
+const (
+	SearchingStatus  = "searching"
+	AssignedStatus   = "assigned"
+	UnassignedStatus = "unassigned"
+	CancelledStatus  = "cancelled"
+)
+
+// Statuses of an offer, only pending offers can be answered. Offers still pending when their
+// dispatch ends are withdrawn.
+const (
+	PendingOffer   = "pending"
+	AcceptedOffer  = "accepted"
+	DeclinedOffer  = "declined"
+	ExpiredOffer   = "expired"
+	WithdrawnOffer = "withdrawn"
+)
+
+// Presence is where a servitor taking on-demand work is, servitors count as online while Online
+// is set and they checked in recently.
+type Presence struct {
+	ServitorID int       `gorm:"primary_key" json:"servitor_id"`
+	Online     bool      `json:"online"`
+	Latitude   float64   `gorm:"index:idx_presence_position" json:"latitude"`
+	Longitude  float64   `gorm:"index:idx_presence_position" json:"longitude"`
+	LastSeenAt time.Time `gorm:"index" json:"last_seen_at"`
+}
+
+// Dispatch is a customer's request for whoever offering the category is nearest right now.
+// RadiusKm is how far out servitors are currently looked for.
+type Dispatch struct {
+	ID            int       `gorm:"primary_key; auto_increment" json:"id"`
+	CustomerID    int       `gorm:"index" json:"customer_id"`
+	CategoryID    int       `json:"category_id"`
+	Address       string    `gorm:"type:varchar(512)" json:"address"`
+	Notes         string    `gorm:"type:varchar(1024)" json:"notes"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	Status        string    `gorm:"type:varchar(16);index" json:"status"`
+	RadiusKm      float64   `json:"radius_km"`
+	ServitorID    *int      `json:"servitor_id"`
+	ServiceID     *int      `json:"service_id"`
+	BookingID     *int      `json:"booking_id"`
+	Offers        []Offer   `gorm:"foreignKey:DispatchID" json:"offers"`
+	CreatedOn     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// Offer is a dispatch offered to one servitor, to be answered before ExpiresAt.
+type Offer struct {
+	ID          int        `gorm:"primary_key; auto_increment" json:"id"`
+	DispatchID  int        `gorm:"index" json:"dispatch_id"`
+	ServitorID  int        `gorm:"index" json:"servitor_id"`
+	ServiceID   int        `json:"service_id"`
+	DistanceKm  float64    `json:"distance_km"`
+	Status      string     `gorm:"type:varchar(16);index" json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RespondedAt *time.Time `json:"responded_at"`
+	CreatedOn   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
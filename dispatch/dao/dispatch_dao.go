@@ -0,0 +1,271 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"servhunt/infra/geo"
+	"time"
+)
+
+var (
+	// ErrDispatchClosed is returned when changing a dispatch that was assigned or ended in the meantime.
+	ErrDispatchClosed = errors.New("the dispatch is no longer searching for a servitor")
+
+	// ErrOfferClosed is returned when answering an offer that expired or was withdrawn.
+	ErrOfferClosed = errors.New("the offer is no longer open")
+)
+
+type DispatchRepo interface {
+	SavePresence(ctx context.Context, presence Presence) (*Presence, error)
+	OnlineServitors(ctx context.Context, box geo.BoundingBox, seenSince time.Time) (*[]Presence, error)
+	CreateDispatch(ctx context.Context, dispatch Dispatch) (*Dispatch, error)
+	GetDispatchByID(ctx context.Context, id int) (*Dispatch, error)
+	GetDispatchesByIDs(ctx context.Context, ids []int) (*[]Dispatch, error)
+	CustomerDispatches(ctx context.Context, customerId int) (*[]Dispatch, error)
+	SearchingDispatches(ctx context.Context) (*[]Dispatch, error)
+	SetDispatchRadius(ctx context.Context, id int, radiusKm float64) error
+	FinishDispatch(ctx context.Context, id int, status string) error
+	CreateOffer(ctx context.Context, offer Offer) (*Offer, error)
+	GetOfferByID(ctx context.Context, id int) (*Offer, error)
+	PendingOffers(ctx context.Context, servitorId int, at time.Time) (*[]Offer, error)
+	DeclineOffer(ctx context.Context, id int, at time.Time) error
+	ExpireOffer(ctx context.Context, id int) error
+	ExpirePendingOffers(ctx context.Context, dispatchId int) error
+	ClaimOffer(ctx context.Context, offer Offer, at time.Time) (*Dispatch, error)
+	ReleaseOffer(ctx context.Context, offer Offer) error
+	SetDispatchBooking(ctx context.Context, id int, bookingId int) error
+}
+
+type DispatchRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewDispatchRepoImpl(repo *dao.Repository) DispatchRepo {
+	return &DispatchRepoImpl{repo: repo}
+}
+
+func (d *DispatchRepoImpl) SavePresence(ctx context.Context, presence Presence) (*Presence, error) {
+	err := d.repo.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&presence).Error
+	if err != nil {
+		return nil, err
+	}
+	return &presence, nil
+}
+
+// OnlineServitors returns the servitors online inside the box who checked in since the given time.
+func (d *DispatchRepoImpl) OnlineServitors(ctx context.Context, box geo.BoundingBox, seenSince time.Time) (*[]Presence, error) {
+	var presences []Presence
+	err := d.repo.DB.WithContext(ctx).Model(&Presence{}).
+		Where("online = ? AND last_seen_at >= ?", true, seenSince).
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", box.MinLatitude, box.MaxLatitude,
+			box.MinLongitude, box.MaxLongitude).
+		Find(&presences).Error
+	if err != nil {
+		return nil, err
+	}
+	return &presences, nil
+}
+
+func (d *DispatchRepoImpl) CreateDispatch(ctx context.Context, dispatch Dispatch) (*Dispatch, error) {
+	dispatch.Status = SearchingStatus
+	if err := d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Create(&dispatch).Error; err != nil {
+		return nil, err
+	}
+	return &dispatch, nil
+}
+
+func (d *DispatchRepoImpl) GetDispatchByID(ctx context.Context, id int) (*Dispatch, error) {
+	var dispatch Dispatch
+	err := d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Preload("Offers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ?", id).Take(&dispatch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dispatch, nil
+}
+
+func (d *DispatchRepoImpl) GetDispatchesByIDs(ctx context.Context, ids []int) (*[]Dispatch, error) {
+	var dispatches []Dispatch
+	if len(ids) == 0 {
+		return &dispatches, nil
+	}
+	if err := d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Where("id IN ?", ids).Find(&dispatches).Error; err != nil {
+		return nil, err
+	}
+	return &dispatches, nil
+}
+
+// CustomerDispatches lists the customer's dispatches, newest first.
+func (d *DispatchRepoImpl) CustomerDispatches(ctx context.Context, customerId int) (*[]Dispatch, error) {
+	var dispatches []Dispatch
+	err := d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Where("customer_id = ?", customerId).
+		Order("id DESC").Find(&dispatches).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dispatches, nil
+}
+
+// SearchingDispatches returns the dispatches still looking for a servitor along with their offers.
+func (d *DispatchRepoImpl) SearchingDispatches(ctx context.Context) (*[]Dispatch, error) {
+	var dispatches []Dispatch
+	err := d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Preload("Offers").Where("status = ?", SearchingStatus).
+		Order("id").Find(&dispatches).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dispatches, nil
+}
+
+func (d *DispatchRepoImpl) SetDispatchRadius(ctx context.Context, id int, radiusKm float64) error {
+	return d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"radius_km": radiusKm, "last_updated_on": time.Now()}).Error
+}
+
+// FinishDispatch ends a searching dispatch in the status and withdraws its pending offers.
+func (d *DispatchRepoImpl) FinishDispatch(ctx context.Context, id int, status string) error {
+	return d.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Dispatch{}).Where("id = ? AND status = ?", id, SearchingStatus).
+			Updates(map[string]interface{}{"status": status, "last_updated_on": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDispatchClosed
+		}
+		return tx.Model(&Offer{}).Where("dispatch_id = ? AND status = ?", id, PendingOffer).
+			Update("status", WithdrawnOffer).Error
+	})
+}
+
+// CreateOffer stores a pending offer if the dispatch is still searching.
+func (d *DispatchRepoImpl) CreateOffer(ctx context.Context, offer Offer) (*Offer, error) {
+	offer.Status = PendingOffer
+	err := d.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var dispatch Dispatch
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Dispatch{}).Where("id = ?", offer.DispatchID).
+			Take(&dispatch).Error
+		if err != nil {
+			return err
+		}
+		if dispatch.Status != SearchingStatus {
+			return ErrDispatchClosed
+		}
+		return tx.Model(&Offer{}).Create(&offer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+func (d *DispatchRepoImpl) GetOfferByID(ctx context.Context, id int) (*Offer, error) {
+	var offer Offer
+	if err := d.repo.DB.WithContext(ctx).Model(&Offer{}).Where("id = ?", id).Take(&offer).Error; err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// PendingOffers returns the servitor's offers that are still open at the given time, soonest to expire first.
+func (d *DispatchRepoImpl) PendingOffers(ctx context.Context, servitorId int, at time.Time) (*[]Offer, error) {
+	var offers []Offer
+	err := d.repo.DB.WithContext(ctx).Model(&Offer{}).
+		Where("servitor_id = ? AND status = ? AND expires_at > ?", servitorId, PendingOffer, at).
+		Order("expires_at").Find(&offers).Error
+	if err != nil {
+		return nil, err
+	}
+	return &offers, nil
+}
+
+func (d *DispatchRepoImpl) DeclineOffer(ctx context.Context, id int, at time.Time) error {
+	res := d.repo.DB.WithContext(ctx).Model(&Offer{}).Where("id = ? AND status = ? AND expires_at > ?", id, PendingOffer, at).
+		Updates(map[string]interface{}{"status": DeclinedOffer, "responded_at": at})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOfferClosed
+	}
+	return nil
+}
+
+func (d *DispatchRepoImpl) ExpireOffer(ctx context.Context, id int) error {
+	res := d.repo.DB.WithContext(ctx).Model(&Offer{}).Where("id = ? AND status = ?", id, PendingOffer).
+		Update("status", ExpiredOffer)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOfferClosed
+	}
+	return nil
+}
+
+// ExpirePendingOffers expires the offers of the dispatch left pending, such as when the server
+// stopped while they were out.
+func (d *DispatchRepoImpl) ExpirePendingOffers(ctx context.Context, dispatchId int) error {
+	return d.repo.DB.WithContext(ctx).Model(&Offer{}).Where("dispatch_id = ? AND status = ?", dispatchId, PendingOffer).
+		Update("status", ExpiredOffer).Error
+}
+
+// ClaimOffer accepts the open offer and assigns its dispatch to the servitor before the booking is
+// made, so no other offer can be accepted meanwhile. ReleaseOffer undoes the claim when booking fails.
+func (d *DispatchRepoImpl) ClaimOffer(ctx context.Context, offer Offer, at time.Time) (*Dispatch, error) {
+	var dispatch Dispatch
+	err := d.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Offer{}).Where("id = ? AND status = ? AND expires_at > ?", offer.ID, PendingOffer, at).
+			Updates(map[string]interface{}{"status": AcceptedOffer, "responded_at": at})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOfferClosed
+		}
+		res = tx.Model(&Dispatch{}).Where("id = ? AND status = ?", offer.DispatchID, SearchingStatus).
+			Updates(map[string]interface{}{
+				"status":          AssignedStatus,
+				"servitor_id":     offer.ServitorID,
+				"service_id":      offer.ServiceID,
+				"last_updated_on": time.Now(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDispatchClosed
+		}
+		return tx.Model(&Dispatch{}).Where("id = ?", offer.DispatchID).Take(&dispatch).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dispatch, nil
+}
+
+func (d *DispatchRepoImpl) ReleaseOffer(ctx context.Context, offer Offer) error {
+	return d.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Dispatch{}).Where("id = ? AND status = ?", offer.DispatchID, AssignedStatus).
+			Updates(map[string]interface{}{
+				"status":          SearchingStatus,
+				"servitor_id":     nil,
+				"service_id":      nil,
+				"last_updated_on": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Offer{}).Where("id = ? AND status = ?", offer.ID, AcceptedOffer).
+			Update("status", DeclinedOffer).Error
+	})
+}
+
+func (d *DispatchRepoImpl) SetDispatchBooking(ctx context.Context, id int, bookingId int) error {
+	return d.repo.DB.WithContext(ctx).Model(&Dispatch{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"booking_id": bookingId, "last_updated_on": time.Now()}).Error
+}
@@ -0,0 +1,318 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"math"
+	"servhunt/dispatch/dao"
+	"servhunt/infra/geo"
+	svcdao "servhunt/servitorservices/dao"
+	"sort"
+	"time"
+)
+
+const (
+	// busyLookahead is how long a servitor must be free from now on to be offered a job.
+	busyLookahead = time.Hour
+
+	// DistanceBandKm groups servitors by distance when ranking them, within a band the better rated
+	// servitor is offered the job first.
+	DistanceBandKm = 1.0
+)
+
+// candidate is a servitor who could be offered a dispatch with one of their services.
+type candidate struct {
+	servitorId int
+	serviceId  int
+	distanceKm float64
+	rating     float64
+}
+
+// Serve runs new dispatches under ctx, starting the ones requested before it was called, and
+// resumes the ones left searching when the server last stopped. It returns once ctx is done and
+// every running dispatch has stopped.
+func (d *DispatchServiceImpl) Serve(ctx context.Context) error {
+	var resumed []dao.Dispatch
+	dispatches, err := d.DispatchRepo.SearchingDispatches(ctx)
+	if err == nil {
+		for _, dispatch := range *dispatches {
+			// nobody is waiting on offers made before the restart any more
+			if err := d.DispatchRepo.ExpirePendingOffers(ctx, dispatch.ID); err != nil {
+				logger.Error("error expiring dispatch offers", zap.Int("dispatch.id", dispatch.ID),
+					zap.NamedError("error.message", err))
+				continue
+			}
+			resumed = append(resumed, dispatch)
+		}
+	}
+
+	d.mu.Lock()
+	d.base = ctx
+	queued := d.queued
+	d.queued = nil
+	d.mu.Unlock()
+	// a dispatch both queued and resumed is only started once
+	for _, dispatch := range append(queued, resumed...) {
+		d.start(dispatch)
+	}
+	if err != nil {
+		return err
+	}
+	<-ctx.Done()
+	// start adds to wg under mu once it saw ctx alive, taking mu here waits out any such start so
+	// wg.Add never races wg.Wait, later starts see ctx done and return
+	d.mu.Lock()
+	d.mu.Unlock()
+	d.wg.Wait()
+	return nil
+}
+
+// RunDispatcher serves dispatches until the context is cancelled.
+func RunDispatcher(ctx context.Context, svc DispatchService) {
+	if err := svc.Serve(ctx); err != nil {
+		logger.Error("error resuming dispatches", zap.NamedError("error.message", err))
+	}
+}
+
+// start runs the dispatch in its own goroutine, which stops when the dispatch ends, is cancelled or
+// the dispatcher shuts down. Dispatches started before Serve are queued for it, the ones started
+// while shutting down are left searching for the next start to resume.
+func (d *DispatchServiceImpl) start(dispatch dao.Dispatch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.base == nil {
+		d.queued = append(d.queued, dispatch)
+		return
+	}
+	if _, ok := d.running[dispatch.ID]; ok || d.base.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(d.base)
+	d.running[dispatch.ID] = cancel
+	d.answers[dispatch.ID] = make(chan answer, 4)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.stop(dispatch.ID)
+		d.run(ctx, dispatch)
+	}()
+}
+
+// stop cancels the goroutine running the dispatch, if there is one, or drops it from the queue.
+func (d *DispatchServiceImpl) stop(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, dispatch := range d.queued {
+		if dispatch.ID == id {
+			d.queued = append(d.queued[:i], d.queued[i+1:]...)
+			break
+		}
+	}
+	if cancel, ok := d.running[id]; ok {
+		cancel()
+		delete(d.running, id)
+		delete(d.answers, id)
+	}
+}
+
+// answer passes the outcome of an offer to the dispatch waiting on it.
+func (d *DispatchServiceImpl) answer(dispatchId int, a answer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case d.answers[dispatchId] <- a:
+	default:
+	}
+}
+
+func (d *DispatchServiceImpl) answerChannel(dispatchId int) chan answer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.answers[dispatchId]
+}
+
+// run offers the dispatch to the best ranked servitor within the current radius until one accepts,
+// widening the radius whenever nobody is left to ask. The dispatch ends unassigned once nobody
+// within the widest radius took it.
+func (d *DispatchServiceImpl) run(ctx context.Context, dispatch dao.Dispatch) {
+	offered := map[int]bool{}
+	for _, offer := range dispatch.Offers {
+		offered[offer.ServitorID] = true
+	}
+	for _, radius := range d.radiiKm {
+		if radius < dispatch.RadiusKm {
+			continue
+		}
+		if radius != dispatch.RadiusKm {
+			if err := d.DispatchRepo.SetDispatchRadius(ctx, dispatch.ID, radius); err != nil && ctx.Err() == nil {
+				logger.Error("error widening dispatch radius", zap.Int("dispatch.id", dispatch.ID),
+					zap.NamedError("error.message", err))
+			}
+			dispatch.RadiusKm = radius
+		}
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			candidates, err := d.candidates(ctx, dispatch, radius, offered)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Error("error finding servitors for dispatch", zap.Int("dispatch.id", dispatch.ID),
+					zap.NamedError("error.message", err))
+				// try again once the servitors had time to come back
+				select {
+				case <-d.clock.After(d.offerTimeout):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(candidates) == 0 {
+				break
+			}
+			next := candidates[0]
+			offered[next.servitorId] = true
+			status, err := d.offer(ctx, dispatch, next)
+			switch {
+			case status == dao.AcceptedOffer, errors.Is(err, dao.ErrDispatchClosed), ctx.Err() != nil:
+				return
+			case err != nil:
+				logger.Error("error offering dispatch", zap.Int("dispatch.id", dispatch.ID),
+					zap.Int("servitor.id", next.servitorId), zap.NamedError("error.message", err))
+			}
+		}
+	}
+	err := d.DispatchRepo.FinishDispatch(ctx, dispatch.ID, dao.UnassignedStatus)
+	if err != nil && !errors.Is(err, dao.ErrDispatchClosed) && ctx.Err() == nil {
+		logger.Error("error ending unassigned dispatch", zap.Int("dispatch.id", dispatch.ID),
+			zap.NamedError("error.message", err))
+	}
+}
+
+// offer offers the dispatch to the candidate and waits for the offer's outcome: accepted, declined
+// or expired when the servitor did not answer in time.
+func (d *DispatchServiceImpl) offer(ctx context.Context, dispatch dao.Dispatch, next candidate) (string, error) {
+	answers := d.answerChannel(dispatch.ID)
+	offer, err := d.DispatchRepo.CreateOffer(ctx, dao.Offer{
+		DispatchID: dispatch.ID,
+		ServitorID: next.servitorId,
+		ServiceID:  next.serviceId,
+		DistanceKm: next.distanceKm,
+		ExpiresAt:  d.clock.Now().Add(d.offerTimeout),
+	})
+	if err != nil {
+		return "", err
+	}
+	timeout := d.clock.After(d.offerTimeout)
+	for {
+		select {
+		case a := <-answers:
+			if a.offerId == offer.ID {
+				return a.status, nil
+			}
+		case <-timeout:
+			err = d.DispatchRepo.ExpireOffer(ctx, offer.ID)
+			if err == nil {
+				return dao.ExpiredOffer, nil
+			}
+			if !errors.Is(err, dao.ErrOfferClosed) {
+				return "", err
+			}
+			// the servitor answered as the offer ran out, wait for the outcome
+			timeout = nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// candidates ranks the servitors not offered the dispatch yet who are online within the radius,
+// offer a service for its category and are free right now.
+func (d *DispatchServiceImpl) candidates(ctx context.Context, dispatch dao.Dispatch, radius float64,
+	offered map[int]bool) ([]candidate, error) {
+	services, err := d.finder.ServicesForCategory(ctx, dispatch.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	byServitor := map[int][]svcdao.Service{}
+	for _, svc := range *services {
+		if svc.UserID != dispatch.CustomerID {
+			byServitor[svc.UserID] = append(byServitor[svc.UserID], svc)
+		}
+	}
+
+	point := dispatchPoint(dispatch)
+	now := d.clock.Now()
+	presences, err := d.DispatchRepo.OnlineServitors(ctx, geo.RadiusBoundingBox(point, radius), now.Add(-d.presenceTTL))
+	if err != nil {
+		return nil, err
+	}
+	distances := map[int]float64{}
+	var nearby []int
+	for _, presence := range *presences {
+		if offered[presence.ServitorID] || len(byServitor[presence.ServitorID]) == 0 {
+			continue
+		}
+		distance := geo.DistanceKm(point, geo.Point{Latitude: presence.Latitude, Longitude: presence.Longitude})
+		if distance <= radius {
+			distances[presence.ServitorID] = distance
+			nearby = append(nearby, presence.ServitorID)
+		}
+	}
+	if len(nearby) == 0 {
+		return nil, nil
+	}
+	free, err := d.bookings.FreeServitors(ctx, nearby, now, now.Add(busyLookahead))
+	if err != nil || len(free) == 0 {
+		return nil, err
+	}
+
+	var candidates []candidate
+	var serviceIds []int
+	for _, servitorId := range free {
+		// offer the servitor's cheapest service for the category
+		best := byServitor[servitorId][0]
+		for _, svc := range byServitor[servitorId][1:] {
+			if svc.Price < best.Price || svc.Price == best.Price && svc.ID < best.ID {
+				best = svc
+			}
+		}
+		candidates = append(candidates, candidate{servitorId: servitorId, serviceId: best.ID,
+			distanceKm: distances[servitorId]})
+		serviceIds = append(serviceIds, best.ID)
+	}
+	facets, err := d.services.GetServiceFacets(ctx, serviceIds)
+	if err != nil {
+		return nil, err
+	}
+	ratings := map[int]float64{}
+	for _, facet := range *facets {
+		ratings[facet.ServiceID] = facet.Rating
+	}
+	for i := range candidates {
+		candidates[i].rating = ratings[candidates[i].serviceId]
+	}
+	rankCandidates(candidates)
+	return candidates, nil
+}
+
+// rankCandidates orders the candidates nearest first by DistanceBandKm bands, better rated first
+// within a band.
+func rankCandidates(candidates []candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		bandA, bandB := math.Floor(a.distanceKm/DistanceBandKm), math.Floor(b.distanceKm/DistanceBandKm)
+		switch {
+		case bandA != bandB:
+			return bandA < bandB
+		case a.rating != b.rating:
+			return a.rating > b.rating
+		case a.distanceKm != b.distanceKm:
+			return a.distanceKm < b.distanceKm
+		}
+		return a.servitorId < b.servitorId
+	})
+}
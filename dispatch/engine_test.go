@@ -0,0 +1,452 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"servhunt/booking"
+	"servhunt/dispatch/dao"
+	"servhunt/infra/geo"
+	"servhunt/infra/utils"
+	svcdao "servhunt/servitorservices/dao"
+)
+
+const (
+	testCustomer     = 1
+	testOfferTimeout = 30 * time.Second
+)
+
+// fakeDispatchRepo keeps a single dispatch and its offers in memory, every offer made is also sent
+// on offered.
+type fakeDispatchRepo struct {
+	dao.DispatchRepo
+
+	mu        sync.Mutex
+	dispatch  dao.Dispatch
+	offers    map[int]*dao.Offer
+	presences []dao.Presence
+	radii     []float64
+	finished  []string
+	offered   chan dao.Offer
+}
+
+func (r *fakeDispatchRepo) SearchingDispatches(ctx context.Context) (*[]dao.Dispatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dispatch.Status != dao.SearchingStatus {
+		return &[]dao.Dispatch{}, nil
+	}
+	return &[]dao.Dispatch{r.dispatch}, nil
+}
+
+func (r *fakeDispatchRepo) CreateDispatch(ctx context.Context, dispatch dao.Dispatch) (*dao.Dispatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dispatch.ID = 1
+	dispatch.Status = dao.SearchingStatus
+	r.dispatch = dispatch
+	return &dispatch, nil
+}
+
+func (r *fakeDispatchRepo) ExpirePendingOffers(ctx context.Context, dispatchId int) error {
+	return nil
+}
+
+func (r *fakeDispatchRepo) OnlineServitors(ctx context.Context, box geo.BoundingBox,
+	seenSince time.Time) (*[]dao.Presence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	presences := append([]dao.Presence(nil), r.presences...)
+	return &presences, nil
+}
+
+func (r *fakeDispatchRepo) GetDispatchByID(ctx context.Context, id int) (*dao.Dispatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dispatch := r.dispatch
+	return &dispatch, nil
+}
+
+func (r *fakeDispatchRepo) SetDispatchRadius(ctx context.Context, id int, radiusKm float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dispatch.RadiusKm = radiusKm
+	r.radii = append(r.radii, radiusKm)
+	return nil
+}
+
+func (r *fakeDispatchRepo) FinishDispatch(ctx context.Context, id int, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dispatch.Status != dao.SearchingStatus {
+		return dao.ErrDispatchClosed
+	}
+	r.dispatch.Status = status
+	r.finished = append(r.finished, status)
+	return nil
+}
+
+func (r *fakeDispatchRepo) CreateOffer(ctx context.Context, offer dao.Offer) (*dao.Offer, error) {
+	r.mu.Lock()
+	offer.ID = len(r.offers) + 1
+	offer.Status = dao.PendingOffer
+	r.offers[offer.ID] = &offer
+	r.mu.Unlock()
+	r.offered <- offer
+	return &offer, nil
+}
+
+func (r *fakeDispatchRepo) GetOfferByID(ctx context.Context, id int) (*dao.Offer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offer := *r.offers[id]
+	return &offer, nil
+}
+
+func (r *fakeDispatchRepo) closeOffer(id int, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.offers[id].Status != dao.PendingOffer {
+		return dao.ErrOfferClosed
+	}
+	r.offers[id].Status = status
+	return nil
+}
+
+func (r *fakeDispatchRepo) DeclineOffer(ctx context.Context, id int, at time.Time) error {
+	return r.closeOffer(id, dao.DeclinedOffer)
+}
+
+func (r *fakeDispatchRepo) ExpireOffer(ctx context.Context, id int) error {
+	return r.closeOffer(id, dao.ExpiredOffer)
+}
+
+func (r *fakeDispatchRepo) ClaimOffer(ctx context.Context, offer dao.Offer, at time.Time) (*dao.Dispatch, error) {
+	if err := r.closeOffer(offer.ID, dao.AcceptedOffer); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dispatch.Status = dao.AssignedStatus
+	r.dispatch.ServitorID = &offer.ServitorID
+	dispatch := r.dispatch
+	return &dispatch, nil
+}
+
+func (r *fakeDispatchRepo) SetDispatchBooking(ctx context.Context, id int, bookingId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dispatch.BookingID = &bookingId
+	return nil
+}
+
+func (r *fakeDispatchRepo) finishedStatuses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.finished...)
+}
+
+func (r *fakeDispatchRepo) widenedRadii() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.radii...)
+}
+
+type fakeServiceRepo struct {
+	svcdao.ServiceRepo
+}
+
+func (fakeServiceRepo) GetServiceFacets(ctx context.Context, ids []int) (*[]svcdao.ServiceFacets, error) {
+	return &[]svcdao.ServiceFacets{}, nil
+}
+
+// fakeFinder offers one service for each servitor.
+type fakeFinder struct {
+	servitors []int
+}
+
+func (f fakeFinder) ServicesForCategory(ctx context.Context, categoryId int) (*[]svcdao.Service, error) {
+	services := []svcdao.Service{}
+	for _, servitorId := range f.servitors {
+		services = append(services, svcdao.Service{ID: 100 + servitorId, UserID: servitorId})
+	}
+	return &services, nil
+}
+
+// fakeBooker finds every servitor free and books every job.
+type fakeBooker struct{}
+
+func (fakeBooker) FreeServitors(ctx context.Context, servitorIds []int, from time.Time, to time.Time) ([]int, error) {
+	return servitorIds, nil
+}
+
+func (fakeBooker) BookDispatch(ctx context.Context, serviceId int, customerId int, address string, notes string,
+	site geo.Point) (*booking.BookingResponse, error) {
+	return &booking.BookingResponse{ID: 7, ServiceID: serviceId, CustomerID: customerId}, nil
+}
+
+// dispatchTest serves one searching dispatch at (0, 0) with servitors online at the given distances
+// east of it, servitor i+2 at distancesKm[i].
+type dispatchTest struct {
+	svc    *DispatchServiceImpl
+	repo   *fakeDispatchRepo
+	clock  *fakeClock
+	cancel context.CancelFunc
+	// served is closed once Serve returned serveErr
+	served   chan struct{}
+	serveErr error
+}
+
+func newDispatchTest(t *testing.T, radiiKm []float64, distancesKm ...float64) *dispatchTest {
+	t.Helper()
+	test := newUnservedDispatchTest(t, radiiKm, distancesKm...)
+	test.repo.dispatch = dao.Dispatch{ID: 1, CustomerID: testCustomer, CategoryID: 1, Status: dao.SearchingStatus,
+		RadiusKm: radiiKm[0]}
+	test.serve(t)
+	return test
+}
+
+// newUnservedDispatchTest is newDispatchTest without any dispatch and before Serve was called.
+func newUnservedDispatchTest(t *testing.T, radiiKm []float64, distancesKm ...float64) *dispatchTest {
+	t.Helper()
+	repo := &fakeDispatchRepo{
+		offers:  map[int]*dao.Offer{},
+		offered: make(chan dao.Offer, 16),
+	}
+	var servitors []int
+	for i, distance := range distancesKm {
+		servitorId := i + 2
+		servitors = append(servitors, servitorId)
+		// a degree of longitude on the equator is about 111.2km
+		repo.presences = append(repo.presences, dao.Presence{ServitorID: servitorId, Online: true,
+			Longitude: distance / 111.2})
+	}
+	clock := newFakeClock()
+	svc := NewDispatchServiceImpl(repo, fakeServiceRepo{}, fakeFinder{servitors: servitors}, fakeBooker{}, clock,
+		testOfferTimeout, radiiKm, time.Minute).(*DispatchServiceImpl)
+	return &dispatchTest{svc: svc, repo: repo, clock: clock, served: make(chan struct{})}
+}
+
+// serve runs Serve until the test ends.
+func (d *dispatchTest) serve(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	go func() {
+		d.serveErr = d.svc.Serve(ctx)
+		close(d.served)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		d.waitServed(t)
+	})
+}
+
+// nextOffer waits for the dispatch to be offered to someone and for the offer's timer to be set.
+func (d *dispatchTest) nextOffer(t *testing.T, offers int) dao.Offer {
+	t.Helper()
+	select {
+	case offer := <-d.repo.offered:
+		d.clock.waitForAfter(t, offers)
+		return offer
+	case <-time.After(5 * time.Second):
+		t.Fatalf("offer %d was never made", offers)
+	}
+	return dao.Offer{}
+}
+
+func (d *dispatchTest) noMoreOffers(t *testing.T) {
+	t.Helper()
+	select {
+	case offer := <-d.repo.offered:
+		t.Fatalf("unexpected offer to servitor %d", offer.ServitorID)
+	default:
+	}
+}
+
+// waitStopped waits for the goroutine running the dispatch to end.
+func (d *dispatchTest) waitStopped(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d.svc.mu.Lock()
+		running := len(d.svc.running)
+		d.svc.mu.Unlock()
+		if running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dispatch is still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (d *dispatchTest) waitServed(t *testing.T) {
+	t.Helper()
+	select {
+	case <-d.served:
+		if d.serveErr != nil {
+			t.Errorf("Serve: %v", d.serveErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return once cancelled")
+	}
+}
+
+func servitor(id int) *utils.Caller {
+	return &utils.Caller{ID: id, UserType: utils.ServitorUserType}
+}
+
+func TestDispatchOfferTimeoutMovesToNextCandidate(t *testing.T) {
+	test := newDispatchTest(t, []float64{3}, 1, 2)
+
+	first := test.nextOffer(t, 1)
+	if first.ServitorID != 2 {
+		t.Fatalf("first offer went to servitor %d, want the nearest, 2", first.ServitorID)
+	}
+	if want := test.clock.Now().Add(testOfferTimeout); !first.ExpiresAt.Equal(want) {
+		t.Errorf("offer expires at %v, want %v", first.ExpiresAt, want)
+	}
+	test.clock.Advance(testOfferTimeout - time.Second)
+	test.noMoreOffers(t)
+
+	test.clock.Advance(time.Second)
+	second := test.nextOffer(t, 2)
+	if second.ServitorID != 3 {
+		t.Fatalf("second offer went to servitor %d, want 3", second.ServitorID)
+	}
+	if offer, _ := test.repo.GetOfferByID(context.Background(), first.ID); offer.Status != dao.ExpiredOffer {
+		t.Errorf("first offer is %s, want %s", offer.Status, dao.ExpiredOffer)
+	}
+}
+
+func TestDispatchDeclineMovesToNextCandidate(t *testing.T) {
+	test := newDispatchTest(t, []float64{3}, 1, 2)
+
+	first := test.nextOffer(t, 1)
+	if _, err := test.svc.DeclineOffer(context.Background(), servitor(first.ServitorID), first.ID); err != nil {
+		t.Fatal(err)
+	}
+	second := test.nextOffer(t, 2)
+	if second.ServitorID != 3 {
+		t.Fatalf("offer after the decline went to servitor %d, want 3", second.ServitorID)
+	}
+
+	_, err := test.svc.DeclineOffer(context.Background(), servitor(first.ServitorID), second.ID)
+	if !errors.Is(err, ErrNotOfferee) {
+		t.Errorf("declining someone else's offer: got %v, want ErrNotOfferee", err)
+	}
+}
+
+func TestDispatchAcceptEndsSearch(t *testing.T) {
+	test := newDispatchTest(t, []float64{3}, 1, 2)
+
+	first := test.nextOffer(t, 1)
+	booked, err := test.svc.AcceptOffer(context.Background(), servitor(first.ServitorID), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.waitStopped(t)
+
+	dispatch, _ := test.repo.GetDispatchByID(context.Background(), 1)
+	if dispatch.Status != dao.AssignedStatus || *dispatch.ServitorID != first.ServitorID {
+		t.Errorf("dispatch is %s with servitor %v, want %s with %d", dispatch.Status, dispatch.ServitorID,
+			dao.AssignedStatus, first.ServitorID)
+	}
+	if dispatch.BookingID == nil || *dispatch.BookingID != booked.ID {
+		t.Errorf("dispatch booking is %v, want %d", dispatch.BookingID, booked.ID)
+	}
+	// the accepted offer's timer running out must not move the dispatch on
+	test.clock.Advance(testOfferTimeout)
+	test.noMoreOffers(t)
+	if finished := test.repo.finishedStatuses(); len(finished) != 0 {
+		t.Errorf("dispatch was finished as %v after being accepted", finished)
+	}
+}
+
+func TestDispatchWidensRadiusThenEndsUnassigned(t *testing.T) {
+	test := newDispatchTest(t, []float64{3, 10, 25}, 1, 5, 40)
+
+	var offeredTo []int
+	for i := 1; i <= 2; i++ {
+		offer := test.nextOffer(t, i)
+		offeredTo = append(offeredTo, offer.ServitorID)
+		test.clock.Advance(testOfferTimeout)
+	}
+	test.waitStopped(t)
+
+	if want := []int{2, 3}; !reflect.DeepEqual(offeredTo, want) {
+		t.Errorf("offered to %v, want %v", offeredTo, want)
+	}
+	if want := []float64{10, 25}; !reflect.DeepEqual(test.repo.widenedRadii(), want) {
+		t.Errorf("widened to %v, want %v", test.repo.widenedRadii(), want)
+	}
+	if want := []string{dao.UnassignedStatus}; !reflect.DeepEqual(test.repo.finishedStatuses(), want) {
+		t.Errorf("finished as %v, want %v", test.repo.finishedStatuses(), want)
+	}
+	test.noMoreOffers(t)
+}
+
+func TestDispatchCancelStopsGoroutine(t *testing.T) {
+	test := newDispatchTest(t, []float64{3}, 1, 2)
+
+	test.nextOffer(t, 1)
+	customer := &utils.Caller{ID: testCustomer, UserType: utils.CustomerUserType}
+	res, err := test.svc.CancelDispatch(context.Background(), customer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != dao.CancelledStatus {
+		t.Errorf("dispatch is %s, want %s", res.Status, dao.CancelledStatus)
+	}
+	test.waitStopped(t)
+
+	test.clock.Advance(testOfferTimeout)
+	test.noMoreOffers(t)
+	if want := []string{dao.CancelledStatus}; !reflect.DeepEqual(test.repo.finishedStatuses(), want) {
+		t.Errorf("finished as %v, want %v", test.repo.finishedStatuses(), want)
+	}
+}
+
+func TestDispatchServeStopsOnShutdown(t *testing.T) {
+	test := newDispatchTest(t, []float64{3}, 1)
+
+	test.nextOffer(t, 1)
+	test.cancel()
+	test.waitServed(t)
+	test.waitStopped(t)
+	if finished := test.repo.finishedStatuses(); len(finished) != 0 {
+		t.Errorf("dispatch was finished as %v, want it left searching for the next start", finished)
+	}
+}
+
+func TestDispatchRequestedBeforeServeWaitsForIt(t *testing.T) {
+	test := newUnservedDispatchTest(t, []float64{3}, 1)
+
+	customer := &utils.Caller{ID: testCustomer, UserType: utils.CustomerUserType}
+	zero := 0.0
+	_, err := test.svc.RequestDispatch(context.Background(), customer,
+		DispatchRequest{CategoryID: 1, Latitude: &zero, Longitude: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.svc.mu.Lock()
+	running := len(test.svc.running)
+	test.svc.mu.Unlock()
+	if running != 0 {
+		t.Fatal("dispatch started before Serve")
+	}
+
+	test.serve(t)
+	if offer := test.nextOffer(t, 1); offer.ServitorID != 2 {
+		t.Errorf("offer went to servitor %d, want 2", offer.ServitorID)
+	}
+	test.cancel()
+	test.waitServed(t)
+	test.waitStopped(t)
+}
@@ -0,0 +1,163 @@
+package dispatch
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"servhunt/booking"
+	bookingdao "servhunt/booking/dao"
+	"servhunt/dispatch/dao"
+	"servhunt/infra/utils"
+	"servhunt/servitorservices"
+	"strconv"
+)
+
+type DispatchHandler interface {
+	RequestDispatch(ctx *gin.Context)
+	MyDispatches(ctx *gin.Context)
+	GetDispatch(ctx *gin.Context)
+	CancelDispatch(ctx *gin.Context)
+	SetPresence(ctx *gin.Context)
+	PendingOffers(ctx *gin.Context)
+	AcceptOffer(ctx *gin.Context)
+	DeclineOffer(ctx *gin.Context)
+}
+
+type DispatchHandlerImpl struct {
+	DispatchService
+}
+
+func NewDispatchHandlerImpl(svc DispatchService) DispatchHandler {
+	return &DispatchHandlerImpl{DispatchService: svc}
+}
+
+// dispatchError writes the response for a failed dispatch call and reports whether there was one.
+func dispatchError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotDispatchOwner), errors.Is(err, ErrNotOfferee), errors.Is(err, ErrNotServitor):
+		utils.APIResponse(ctx, "You cannot make that change to the dispatch", http.StatusForbidden, false, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	case errors.Is(err, dao.ErrDispatchClosed), errors.Is(err, dao.ErrOfferClosed),
+		errors.Is(err, bookingdao.ErrSlotTaken), errors.Is(err, bookingdao.ErrNoSchedule),
+		errors.Is(err, booking.ErrServiceUnavailable):
+		utils.APIResponse(ctx, "Failed to update dispatch", http.StatusConflict, false, err.Error())
+	case errors.Is(err, servitorservices.ErrUnknownCategory), errors.Is(err, booking.ErrOwnService):
+		utils.APIResponse(ctx, "Failed to update dispatch", http.StatusBadRequest, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (d *DispatchHandlerImpl) RequestDispatch(ctx *gin.Context) {
+	req := DispatchRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	dispatch, err := d.DispatchService.RequestDispatch(ctx, caller, req)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Looking for a servitor", http.StatusCreated, true, dispatch)
+}
+
+func (d *DispatchHandlerImpl) MyDispatches(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	dispatches, err := d.DispatchService.MyDispatches(ctx, caller)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Dispatches successfully returned", http.StatusOK, true, dispatches)
+}
+
+func (d *DispatchHandlerImpl) GetDispatch(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	dispatch, err := d.DispatchService.GetDispatch(ctx, caller, id)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Dispatch successfully returned", http.StatusOK, true, dispatch)
+}
+
+func (d *DispatchHandlerImpl) CancelDispatch(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	dispatch, err := d.DispatchService.CancelDispatch(ctx, caller, id)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Dispatch cancelled", http.StatusOK, true, dispatch)
+}
+
+func (d *DispatchHandlerImpl) SetPresence(ctx *gin.Context) {
+	req := PresenceRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	presence, err := d.DispatchService.SetPresence(ctx, caller, req)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Presence updated successfully", http.StatusOK, true, presence)
+}
+
+func (d *DispatchHandlerImpl) PendingOffers(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	offers, err := d.DispatchService.PendingOffers(ctx, caller)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Offers successfully returned", http.StatusOK, true, offers)
+}
+
+func (d *DispatchHandlerImpl) AcceptOffer(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	booked, err := d.DispatchService.AcceptOffer(ctx, caller, id)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Offer accepted and booked", http.StatusOK, true, booked)
+}
+
+func (d *DispatchHandlerImpl) DeclineOffer(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	offer, err := d.DispatchService.DeclineOffer(ctx, caller, id)
+	if dispatchError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Offer declined", http.StatusOK, true, offer)
+}
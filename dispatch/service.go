@@ -0,0 +1,324 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"servhunt/booking"
+	"servhunt/dispatch/dao"
+	"servhunt/infra/geo"
+	"servhunt/infra/utils"
+	svcdao "servhunt/servitorservices/dao"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults used when the dispatcher is created without its settings.
+const (
+	DefaultOfferTimeout = 45 * time.Second
+	DefaultPresenceTTL  = 5 * time.Minute
+)
+
+// DefaultRadiiKm are the radii servitors are looked for in, widening once nobody nearer takes the job.
+var DefaultRadiiKm = []float64{3, 10, 25}
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrNotDispatchOwner = errors.New("the dispatch was requested by another customer")
+	ErrNotOfferee       = errors.New("the offer was made to another servitor")
+	ErrNotServitor      = errors.New("only servitors can go online for dispatched jobs")
+)
+
+// ServiceFinder finds the published services that could take on work in a category.
+type ServiceFinder interface {
+	ServicesForCategory(ctx context.Context, categoryId int) (*[]svcdao.Service, error)
+}
+
+// DispatchBooker checks which servitors are free and books dispatched jobs.
+type DispatchBooker interface {
+	FreeServitors(ctx context.Context, servitorIds []int, from time.Time, to time.Time) ([]int, error)
+	BookDispatch(ctx context.Context, serviceId int, customerId int, address string, notes string,
+		site geo.Point) (*booking.BookingResponse, error)
+}
+
+type DispatchService interface {
+	SetPresence(ctx context.Context, caller *utils.Caller, request PresenceRequest) (*PresenceResponse, error)
+	RequestDispatch(ctx context.Context, caller *utils.Caller, request DispatchRequest) (*DispatchResponse, error)
+	GetDispatch(ctx context.Context, caller *utils.Caller, id int) (*DispatchResponse, error)
+	MyDispatches(ctx context.Context, caller *utils.Caller) (*[]DispatchResponse, error)
+	CancelDispatch(ctx context.Context, caller *utils.Caller, id int) (*DispatchResponse, error)
+	PendingOffers(ctx context.Context, caller *utils.Caller) (*[]OfferResponse, error)
+	AcceptOffer(ctx context.Context, caller *utils.Caller, id int) (*booking.BookingResponse, error)
+	DeclineOffer(ctx context.Context, caller *utils.Caller, id int) (*OfferResponse, error)
+	Serve(ctx context.Context) error
+}
+
+// answer is the final outcome of an offer, passed from the servitor's request to the dispatch
+// waiting on it.
+type answer struct {
+	offerId int
+	status  string
+}
+
+type DispatchServiceImpl struct {
+	dao.DispatchRepo
+	services     svcdao.ServiceRepo
+	finder       ServiceFinder
+	bookings     DispatchBooker
+	clock        Clock
+	offerTimeout time.Duration
+	radiiKm      []float64
+	presenceTTL  time.Duration
+
+	mu sync.Mutex
+	// base is the context dispatches run under, set by Serve. Dispatches requested before then wait
+	// in queued for Serve to start them.
+	base    context.Context
+	queued  []dao.Dispatch
+	running map[int]context.CancelFunc
+	answers map[int]chan answer
+	wg      sync.WaitGroup
+}
+
+// NewDispatchServiceImpl creates the dispatcher. Each servitor gets offerTimeout to answer an offer,
+// servitors are looked for within each of radiiKm in turn and stay online for presenceTTL after
+// they last checked in. Settings left at zero take their defaults.
+func NewDispatchServiceImpl(repo dao.DispatchRepo, services svcdao.ServiceRepo, finder ServiceFinder,
+	bookings DispatchBooker, clock Clock, offerTimeout time.Duration, radiiKm []float64,
+	presenceTTL time.Duration) DispatchService {
+	if offerTimeout <= 0 {
+		offerTimeout = DefaultOfferTimeout
+	}
+	if len(radiiKm) == 0 {
+		radiiKm = DefaultRadiiKm
+	}
+	radiiKm = append([]float64(nil), radiiKm...)
+	sort.Float64s(radiiKm)
+	if presenceTTL <= 0 {
+		presenceTTL = DefaultPresenceTTL
+	}
+	return &DispatchServiceImpl{DispatchRepo: repo, services: services, finder: finder, bookings: bookings,
+		clock: clock, offerTimeout: offerTimeout, radiiKm: radiiKm, presenceTTL: presenceTTL,
+		running: map[int]context.CancelFunc{}, answers: map[int]chan answer{}}
+}
+
+// SetPresence records where the servitor is and whether they take dispatched jobs.
+func (d *DispatchServiceImpl) SetPresence(ctx context.Context, caller *utils.Caller,
+	request PresenceRequest) (*PresenceResponse, error) {
+	if caller.UserType != utils.ServitorUserType {
+		return nil, ErrNotServitor
+	}
+	presence, err := d.DispatchRepo.SavePresence(ctx, dao.Presence{
+		ServitorID: caller.ID,
+		Online:     request.Online,
+		Latitude:   *request.Latitude,
+		Longitude:  *request.Longitude,
+		LastSeenAt: d.clock.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PresenceResponse{Online: presence.Online, Latitude: presence.Latitude, Longitude: presence.Longitude,
+		LastSeenAt: presence.LastSeenAt}, nil
+}
+
+// RequestDispatch starts looking for a servitor to take the job right away.
+func (d *DispatchServiceImpl) RequestDispatch(ctx context.Context, caller *utils.Caller,
+	request DispatchRequest) (*DispatchResponse, error) {
+	// look the category up now so an unknown one fails the request rather than the dispatch
+	if _, err := d.finder.ServicesForCategory(ctx, request.CategoryID); err != nil {
+		return nil, err
+	}
+	dispatch, err := d.DispatchRepo.CreateDispatch(ctx, dao.Dispatch{
+		CustomerID: caller.ID,
+		CategoryID: request.CategoryID,
+		Address:    request.Address,
+		Notes:      request.Notes,
+		Latitude:   *request.Latitude,
+		Longitude:  *request.Longitude,
+		RadiusKm:   d.radiiKm[0],
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.start(*dispatch)
+	res := toDispatchResponse(*dispatch)
+	return &res, nil
+}
+
+func (d *DispatchServiceImpl) GetDispatch(ctx context.Context, caller *utils.Caller, id int) (*DispatchResponse, error) {
+	dispatch, err := d.ownedDispatch(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toDispatchResponse(*dispatch)
+	return &res, nil
+}
+
+func (d *DispatchServiceImpl) MyDispatches(ctx context.Context, caller *utils.Caller) (*[]DispatchResponse, error) {
+	dispatches, err := d.DispatchRepo.CustomerDispatches(ctx, caller.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := []DispatchResponse{}
+	for _, dispatch := range *dispatches {
+		res = append(res, toDispatchResponse(dispatch))
+	}
+	return &res, nil
+}
+
+// CancelDispatch stops looking for a servitor, dispatches already assigned are cancelled through
+// their booking instead.
+func (d *DispatchServiceImpl) CancelDispatch(ctx context.Context, caller *utils.Caller, id int) (*DispatchResponse, error) {
+	if _, err := d.ownedDispatch(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	if err := d.DispatchRepo.FinishDispatch(ctx, id, dao.CancelledStatus); err != nil {
+		return nil, err
+	}
+	d.stop(id)
+	dispatch, err := d.DispatchRepo.GetDispatchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toDispatchResponse(*dispatch)
+	return &res, nil
+}
+
+// PendingOffers lists the offers waiting on the servitor's answer.
+func (d *DispatchServiceImpl) PendingOffers(ctx context.Context, caller *utils.Caller) (*[]OfferResponse, error) {
+	offers, err := d.DispatchRepo.PendingOffers(ctx, caller.ID, d.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, offer := range *offers {
+		ids = append(ids, offer.DispatchID)
+	}
+	dispatches, err := d.DispatchRepo.GetDispatchesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]dao.Dispatch{}
+	for _, dispatch := range *dispatches {
+		byID[dispatch.ID] = dispatch
+	}
+	res := []OfferResponse{}
+	for _, offer := range *offers {
+		res = append(res, toOfferResponse(offer, byID[offer.DispatchID]))
+	}
+	return &res, nil
+}
+
+// AcceptOffer assigns the dispatch to the servitor and books the job for right away. When the
+// booking fails, for instance because the servitor took another job meanwhile, the offer counts as
+// declined and the dispatch moves on.
+func (d *DispatchServiceImpl) AcceptOffer(ctx context.Context, caller *utils.Caller, id int) (*booking.BookingResponse, error) {
+	offer, err := d.ownedOffer(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	dispatch, err := d.DispatchRepo.ClaimOffer(ctx, *offer, d.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	booked, err := d.bookings.BookDispatch(ctx, offer.ServiceID, dispatch.CustomerID, dispatch.Address, dispatch.Notes,
+		dispatchPoint(*dispatch))
+	if err != nil {
+		if releaseErr := d.DispatchRepo.ReleaseOffer(ctx, *offer); releaseErr != nil {
+			logger.Error("error releasing dispatch offer after failed booking", zap.Int("offer.id", offer.ID),
+				zap.NamedError("error.message", releaseErr))
+		}
+		d.answer(offer.DispatchID, answer{offerId: offer.ID, status: dao.DeclinedOffer})
+		return nil, err
+	}
+	if err = d.DispatchRepo.SetDispatchBooking(ctx, dispatch.ID, booked.ID); err != nil {
+		logger.Error("error linking booking to dispatch", zap.Int("dispatch.id", dispatch.ID),
+			zap.Int("booking.id", booked.ID), zap.NamedError("error.message", err))
+	}
+	d.answer(offer.DispatchID, answer{offerId: offer.ID, status: dao.AcceptedOffer})
+	return booked, nil
+}
+
+func (d *DispatchServiceImpl) DeclineOffer(ctx context.Context, caller *utils.Caller, id int) (*OfferResponse, error) {
+	offer, err := d.ownedOffer(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.DispatchRepo.DeclineOffer(ctx, id, d.clock.Now()); err != nil {
+		return nil, err
+	}
+	d.answer(offer.DispatchID, answer{offerId: offer.ID, status: dao.DeclinedOffer})
+	dispatch, err := d.DispatchRepo.GetDispatchByID(ctx, offer.DispatchID)
+	if err != nil {
+		return nil, err
+	}
+	offer.Status = dao.DeclinedOffer
+	res := toOfferResponse(*offer, *dispatch)
+	return &res, nil
+}
+
+// ownedDispatch loads the dispatch if the caller requested it or is an administrator.
+func (d *DispatchServiceImpl) ownedDispatch(ctx context.Context, caller *utils.Caller, id int) (*dao.Dispatch, error) {
+	dispatch, err := d.DispatchRepo.GetDispatchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if dispatch.CustomerID != caller.ID && !caller.IsAdmin() {
+		return nil, ErrNotDispatchOwner
+	}
+	return dispatch, nil
+}
+
+func (d *DispatchServiceImpl) ownedOffer(ctx context.Context, caller *utils.Caller, id int) (*dao.Offer, error) {
+	offer, err := d.DispatchRepo.GetOfferByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offer.ServitorID != caller.ID {
+		return nil, ErrNotOfferee
+	}
+	return offer, nil
+}
+
+func toDispatchResponse(dispatch dao.Dispatch) DispatchResponse {
+	return DispatchResponse{
+		ID:         dispatch.ID,
+		CustomerID: dispatch.CustomerID,
+		CategoryID: dispatch.CategoryID,
+		Address:    dispatch.Address,
+		Notes:      dispatch.Notes,
+		Latitude:   dispatch.Latitude,
+		Longitude:  dispatch.Longitude,
+		Status:     dispatch.Status,
+		RadiusKm:   dispatch.RadiusKm,
+		Offered:    len(dispatch.Offers),
+		ServitorID: dispatch.ServitorID,
+		ServiceID:  dispatch.ServiceID,
+		BookingID:  dispatch.BookingID,
+		CreatedOn:  dispatch.CreatedOn,
+	}
+}
+
+func toOfferResponse(offer dao.Offer, dispatch dao.Dispatch) OfferResponse {
+	return OfferResponse{
+		ID:         offer.ID,
+		DispatchID: offer.DispatchID,
+		ServiceID:  offer.ServiceID,
+		CategoryID: dispatch.CategoryID,
+		Address:    dispatch.Address,
+		Notes:      dispatch.Notes,
+		Latitude:   dispatch.Latitude,
+		Longitude:  dispatch.Longitude,
+		DistanceKm: offer.DistanceKm,
+		Status:     offer.Status,
+		ExpiresAt:  offer.ExpiresAt,
+	}
+}
+
+// dispatchPoint is where the job is.
+func dispatchPoint(dispatch dao.Dispatch) geo.Point {
+	return geo.Point{Latitude: dispatch.Latitude, Longitude: dispatch.Longitude}
+}
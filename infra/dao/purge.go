@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Purger permanently removes rows that were soft deleted before a given time.
+type Purger interface {
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RunPurgeJob purges soft deleted rows older than the retention window on every tick of the
+// interval, it blocks until the context is cancelled.
+func RunPurgeJob(ctx context.Context, interval, retention time.Duration, purgers ...Purger) {
+	if interval <= 0 {
+		logger.Warn("purge job disabled, no purge interval configured")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-retention)
+			for _, purger := range purgers {
+				purged, err := purger.PurgeDeleted(ctx, before)
+				if err != nil {
+					logger.Error("error purging deleted rows", zap.NamedError("error.message", err))
+					continue
+				}
+				logger.Info("purged deleted rows", zap.Int64("purged", purged), zap.Time("before", before))
+			}
+		}
+	}
+}
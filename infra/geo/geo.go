@@ -0,0 +1,169 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// EarthRadiusKm is the mean radius of the earth used by the haversine formula.
+	EarthRadiusKm = 6371.0
+
+	// GeohashPrecision is the precision stored for every location, roughly a 1.2m x 0.6m cell.
+	GeohashPrecision = 9
+
+	// maxCoverCells bounds the number of geohash prefixes used to cover a search area.
+	maxCoverCells = 32
+
+	base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// Point is a WGS84 coordinate in degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// BoundingBox is an axis aligned area in degrees, boxes crossing the antimeridian are not supported.
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Valid reports whether the point lies within the coordinate ranges of the earth.
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// Contains reports whether the point lies inside the box, edges included.
+func (b BoundingBox) Contains(p Point) bool {
+	return p.Latitude >= b.MinLatitude && p.Latitude <= b.MaxLatitude &&
+		p.Longitude >= b.MinLongitude && p.Longitude <= b.MaxLongitude
+}
+
+// Valid reports whether the box has its corners in order and within the coordinate ranges.
+func (b BoundingBox) Valid() bool {
+	return Point{b.MinLatitude, b.MinLongitude}.Valid() && Point{b.MaxLatitude, b.MaxLongitude}.Valid() &&
+		b.MinLatitude <= b.MaxLatitude && b.MinLongitude <= b.MaxLongitude
+}
+
+// DistanceKm returns the great circle distance between two points using the haversine formula.
+func DistanceKm(a Point, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLng := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// RadiusBoundingBox returns the smallest box containing every point within radiusKm of the center.
+func RadiusBoundingBox(center Point, radiusKm float64) BoundingBox {
+	dLat := degrees(radiusKm / EarthRadiusKm)
+	dLng := 180.0
+	if cos := math.Cos(radians(center.Latitude)); cos > 1e-9 {
+		dLng = math.Min(180, dLat/cos)
+	}
+	return BoundingBox{
+		MinLatitude:  math.Max(-90, center.Latitude-dLat),
+		MinLongitude: math.Max(-180, center.Longitude-dLng),
+		MaxLatitude:  math.Min(90, center.Latitude+dLat),
+		MaxLongitude: math.Min(180, center.Longitude+dLng),
+	}
+}
+
+// Geohash encodes the point as a geohash of the given precision.
+func Geohash(p Point, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+	var sb strings.Builder
+	bit, ch, even := 0, 0, true
+	for sb.Len() < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if p.Longitude >= mid {
+				ch |= 1 << (4 - bit)
+				minLng = mid
+			} else {
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Latitude >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+			continue
+		}
+		sb.WriteByte(base32[ch])
+		bit, ch = 0, 0
+	}
+	return sb.String()
+}
+
+// CoveringPrefixes returns geohash prefixes whose cells together cover the box, using the finest
+// precision that needs no more than maxCoverCells cells. Any point in the box has a geohash that
+// starts with one of the prefixes.
+func CoveringPrefixes(box BoundingBox) []string {
+	for precision := GeohashPrecision; precision > 1; precision-- {
+		if cells := coverCells(box, precision); cells != nil {
+			return cells
+		}
+	}
+	return coverCells(box, 1)
+}
+
+// coverCells returns the cells of the given precision covering the box, or nil if more than
+// maxCoverCells would be needed. Precision 1 is never rejected.
+func coverCells(box BoundingBox, precision int) []string {
+	width, height := cellSize(precision)
+	columns := math.Floor(box.MaxLongitude/width) - math.Floor(box.MinLongitude/width) + 1
+	rows := math.Floor(box.MaxLatitude/height) - math.Floor(box.MinLatitude/height) + 1
+	if precision > 1 && columns*rows > maxCoverCells {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var cells []string
+	for lat := box.MinLatitude; ; lat += height {
+		lat = math.Min(lat, box.MaxLatitude)
+		for lng := box.MinLongitude; ; lng += width {
+			lng = math.Min(lng, box.MaxLongitude)
+			cell := Geohash(Point{lat, lng}, precision)
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+			if lng >= box.MaxLongitude {
+				break
+			}
+		}
+		if lat >= box.MaxLatitude {
+			break
+		}
+	}
+	return cells
+}
+
+// cellSize returns the width and height in degrees of a geohash cell of the given precision.
+func cellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 360 / math.Pow(2, float64(lngBits)), 180 / math.Pow(2, float64(latBits))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
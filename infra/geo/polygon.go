@@ -0,0 +1,228 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MaxPolygonVertices bounds the size of a coverage geometry so validation and matching stay cheap.
+const MaxPolygonVertices = 1000
+
+var (
+	ErrUnsupportedGeometry = errors.New("geometry must be a GeoJSON Polygon or MultiPolygon")
+	ErrInvalidGeometry     = errors.New("geometry is not a valid polygon")
+)
+
+// Ring is a closed linear ring, the first and last points are equal.
+type Ring []Point
+
+// Polygon is an outer ring followed by any number of holes.
+type Polygon []Ring
+
+// MultiPolygon is a set of polygons, a point is inside if it is inside any of them.
+type MultiPolygon []Polygon
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    json.RawMessage `json:"geometry"`
+}
+
+// ParseGeoJSON parses and validates a GeoJSON Polygon or MultiPolygon geometry, a Feature wrapping
+// one is accepted too. GeoJSON positions are [longitude, latitude].
+func ParseGeoJSON(data []byte) (MultiPolygon, error) {
+	var geometry geoJSONGeometry
+	if err := json.Unmarshal(data, &geometry); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGeometry, err.Error())
+	}
+	if geometry.Type == "Feature" {
+		return ParseGeoJSON(geometry.Geometry)
+	}
+
+	var multi MultiPolygon
+	switch geometry.Type {
+	case "Polygon":
+		var coordinates [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidGeometry, err.Error())
+		}
+		polygon, err := toPolygon(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		multi = MultiPolygon{polygon}
+	case "MultiPolygon":
+		var coordinates [][][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidGeometry, err.Error())
+		}
+		for _, polygonCoordinates := range coordinates {
+			polygon, err := toPolygon(polygonCoordinates)
+			if err != nil {
+				return nil, err
+			}
+			multi = append(multi, polygon)
+		}
+	default:
+		return nil, ErrUnsupportedGeometry
+	}
+	if err := multi.Validate(); err != nil {
+		return nil, err
+	}
+	return multi, nil
+}
+
+func toPolygon(coordinates [][][]float64) (Polygon, error) {
+	var polygon Polygon
+	for _, ringCoordinates := range coordinates {
+		var ring Ring
+		for _, position := range ringCoordinates {
+			if len(position) < 2 {
+				return nil, fmt.Errorf("%w: positions need a longitude and a latitude", ErrInvalidGeometry)
+			}
+			ring = append(ring, Point{Latitude: position[1], Longitude: position[0]})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
+
+// Validate checks that every ring is closed, has at least three distinct corners, encloses an area
+// and does not cross itself, and that the whole geometry stays under MaxPolygonVertices.
+func (m MultiPolygon) Validate() error {
+	if len(m) == 0 {
+		return fmt.Errorf("%w: no polygons", ErrInvalidGeometry)
+	}
+	vertices := 0
+	for _, polygon := range m {
+		if len(polygon) == 0 {
+			return fmt.Errorf("%w: polygon has no outer ring", ErrInvalidGeometry)
+		}
+		for _, ring := range polygon {
+			vertices += len(ring)
+			if vertices > MaxPolygonVertices {
+				return fmt.Errorf("%w: more than %d vertices", ErrInvalidGeometry, MaxPolygonVertices)
+			}
+			if err := ring.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r Ring) validate() error {
+	if len(r) < 4 {
+		return fmt.Errorf("%w: rings need at least four positions", ErrInvalidGeometry)
+	}
+	if r[0] != r[len(r)-1] {
+		return fmt.Errorf("%w: rings must be closed", ErrInvalidGeometry)
+	}
+	for _, p := range r {
+		if !p.Valid() {
+			return fmt.Errorf("%w: position out of range", ErrInvalidGeometry)
+		}
+	}
+	if math.Abs(r.signedArea()) < 1e-12 {
+		return fmt.Errorf("%w: ring has no area", ErrInvalidGeometry)
+	}
+	edges := len(r) - 1
+	for i := 0; i < edges; i++ {
+		for j := i + 1; j < edges; j++ {
+			// adjacent edges share a vertex, including the closing edge and the first edge
+			if j == i+1 || (i == 0 && j == edges-1) {
+				continue
+			}
+			if segmentsIntersect(r[i], r[i+1], r[j], r[j+1]) {
+				return fmt.Errorf("%w: ring intersects itself", ErrInvalidGeometry)
+			}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the point is inside any polygon of the geometry.
+func (m MultiPolygon) Contains(p Point) bool {
+	for _, polygon := range m {
+		if polygon.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the point is inside the outer ring and outside every hole.
+func (p Polygon) Contains(point Point) bool {
+	if len(p) == 0 || !p[0].contains(point) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(point) {
+			return false
+		}
+	}
+	return true
+}
+
+// BoundingBox returns the smallest box containing every polygon.
+func (m MultiPolygon) BoundingBox() BoundingBox {
+	box := BoundingBox{MinLatitude: 90, MinLongitude: 180, MaxLatitude: -90, MaxLongitude: -180}
+	for _, polygon := range m {
+		if len(polygon) == 0 {
+			continue
+		}
+		for _, p := range polygon[0] {
+			box.MinLatitude = math.Min(box.MinLatitude, p.Latitude)
+			box.MinLongitude = math.Min(box.MinLongitude, p.Longitude)
+			box.MaxLatitude = math.Max(box.MaxLatitude, p.Latitude)
+			box.MaxLongitude = math.Max(box.MaxLongitude, p.Longitude)
+		}
+	}
+	return box
+}
+
+// contains implements the even-odd ray casting test.
+func (r Ring) contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) {
+			crossing := (b.Longitude-a.Longitude)*(p.Latitude-a.Latitude)/(b.Latitude-a.Latitude) + a.Longitude
+			if p.Longitude < crossing {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func (r Ring) signedArea() float64 {
+	area := 0.0
+	for i := 0; i < len(r)-1; i++ {
+		area += r[i].Longitude*r[i+1].Latitude - r[i+1].Longitude*r[i].Latitude
+	}
+	return area / 2
+}
+
+func segmentsIntersect(p1 Point, p2 Point, q1 Point, q2 Point) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(q1, q2, p1)) || (d2 == 0 && onSegment(q1, q2, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, q1)) || (d4 == 0 && onSegment(p1, p2, q2))
+}
+
+func orientation(a Point, b Point, c Point) float64 {
+	return (b.Longitude-a.Longitude)*(c.Latitude-a.Latitude) - (b.Latitude-a.Latitude)*(c.Longitude-a.Longitude)
+}
+
+func onSegment(a Point, b Point, p Point) bool {
+	return math.Min(a.Longitude, b.Longitude) <= p.Longitude && p.Longitude <= math.Max(a.Longitude, b.Longitude) &&
+		math.Min(a.Latitude, b.Latitude) <= p.Latitude && p.Latitude <= math.Max(a.Latitude, b.Latitude)
+}
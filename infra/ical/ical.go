@@ -0,0 +1,121 @@
+// Package ical reads and writes iCalendar (RFC 5545) data, covering the events of a calendar and
+// the common forms of their recurrence rules.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// utcLayout is the form date times are written in, always in UTC.
+const utcLayout = "20060102T150405Z"
+
+// maxLineOctets is the longest a content line may be before it is folded.
+const maxLineOctets = 75
+
+// Event statuses.
+const (
+	TentativeStatus = "TENTATIVE"
+	ConfirmedStatus = "CONFIRMED"
+	CancelledStatus = "CANCELLED"
+)
+
+// Event is a VEVENT. Rule holds the RRULE of a recurring event, ExDates the dates excluded from it
+// and RecurrenceID marks an event that overrides one date of another event with the same UID.
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Status       string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Transparent  bool
+	Rule         string
+	ExDates      []time.Time
+	RecurrenceID *time.Time
+	LastModified time.Time
+}
+
+// Calendar is a VCALENDAR published under Name.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write writes the calendar with every date time in UTC.
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	now := time.Now()
+	line := func(name string, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//servhunt//bookings//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(event.UID))
+		line("DTSTAMP", now.UTC().Format(utcLayout))
+		line("DTSTART", event.Start.UTC().Format(utcLayout))
+		line("DTEND", event.End.UTC().Format(utcLayout))
+		if event.Summary != "" {
+			line("SUMMARY", escapeText(event.Summary))
+		}
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Status != "" {
+			line("STATUS", event.Status)
+		}
+		if !event.LastModified.IsZero() {
+			line("LAST-MODIFIED", event.LastModified.UTC().Format(utcLayout))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// writeFolded writes a content line, folding it onto continuation lines that start with a space
+// so no line is longer than maxLineOctets. Lines are only folded between characters.
+func writeFolded(w *bufio.Writer, content string) {
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.WriteString(content[:cut])
+		w.WriteString("\r\n ")
+		content = content[cut:]
+		// the leading space of a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(content)
+	w.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+func unescapeText(text string) string {
+	return textUnescaper.Replace(text)
+}
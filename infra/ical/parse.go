@@ -0,0 +1,239 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("not an iCalendar file")
+
+// property is a content line split into its name, parameters and value.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of a calendar. Floating times and dates, which carry no time zone, are
+// read in loc, as are times whose TZID is not a known IANA zone. Events overriding one date of a
+// recurring event are returned on their own and their date is added to the ExDates of the
+// recurring event.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	var current *Event
+	found := false
+	// depth counts the components nested in the current event, such as alarms
+	depth := 0
+	for _, line := range lines {
+		prop, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCALENDAR"):
+			found = true
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT") && current == nil:
+			current = &Event{}
+			depth = 0
+		case prop.name == "BEGIN" && current != nil:
+			depth++
+		case prop.name == "END" && current != nil && depth > 0:
+			depth--
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT") && current != nil:
+			if !current.Start.IsZero() {
+				if current.End.IsZero() || current.End.Before(current.Start) {
+					current.End = current.Start
+					if current.AllDay {
+						current.End = current.Start.AddDate(0, 0, 1)
+					}
+				}
+				events = append(events, *current)
+			}
+			current = nil
+		case current != nil && depth == 0:
+			readProperty(current, prop, loc)
+		}
+	}
+	if !found {
+		return nil, ErrInvalidCalendar
+	}
+
+	// leave the dates that were overridden out of the recurring events they belong to
+	for _, event := range events {
+		if event.RecurrenceID == nil {
+			continue
+		}
+		for i := range events {
+			if events[i].UID == event.UID && events[i].RecurrenceID == nil {
+				events[i].ExDates = append(events[i].ExDates, *event.RecurrenceID)
+			}
+		}
+	}
+	return events, nil
+}
+
+func readProperty(event *Event, prop property, loc *time.Location) {
+	switch prop.name {
+	case "UID":
+		event.UID = prop.value
+	case "SUMMARY":
+		event.Summary = unescapeText(prop.value)
+	case "DESCRIPTION":
+		event.Description = unescapeText(prop.value)
+	case "LOCATION":
+		event.Location = unescapeText(prop.value)
+	case "STATUS":
+		event.Status = strings.ToUpper(prop.value)
+	case "TRANSP":
+		event.Transparent = strings.EqualFold(prop.value, "TRANSPARENT")
+	case "RRULE":
+		event.Rule = prop.value
+	case "DTSTART":
+		if start, allDay, err := parseDateTime(prop, loc); err == nil {
+			event.Start, event.AllDay = start, allDay
+		}
+	case "DTEND":
+		if end, _, err := parseDateTime(prop, loc); err == nil {
+			event.End = end
+		}
+	case "DURATION":
+		if d, err := parseDuration(prop.value); err == nil && !event.Start.IsZero() {
+			event.End = event.Start.Add(d)
+		}
+	case "EXDATE":
+		for _, value := range strings.Split(prop.value, ",") {
+			if date, _, err := parseDateTime(property{params: prop.params, value: value}, loc); err == nil {
+				event.ExDates = append(event.ExDates, date)
+			}
+		}
+	case "RECURRENCE-ID":
+		if id, _, err := parseDateTime(prop, loc); err == nil {
+			event.RecurrenceID = &id
+		}
+	case "LAST-MODIFIED":
+		if modified, _, err := parseDateTime(prop, loc); err == nil {
+			event.LastModified = modified
+		}
+	}
+}
+
+// unfold reads the content lines, joining folded lines back together.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrInvalidCalendar
+	}
+	return lines, nil
+}
+
+// parseLine splits a content line such as DTSTART;TZID=Europe/Berlin:20260101T090000, colons
+// inside quoted parameter values do not end the parameters.
+func parseLine(line string) (property, bool) {
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ':' && !quoted:
+			prop := property{params: map[string]string{}, value: line[i+1:]}
+			parts := strings.Split(line[:i], ";")
+			prop.name = strings.ToUpper(strings.TrimSpace(parts[0]))
+			for _, param := range parts[1:] {
+				if key, value, ok := strings.Cut(param, "="); ok {
+					prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+				}
+			}
+			return prop, prop.name != ""
+		}
+	}
+	return property{}, false
+}
+
+// parseDateTime reads a DATE or DATE-TIME value, reporting whether it was a date.
+func parseDateTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+	if prop.params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		date, err := time.ParseInLocation("20060102", value, loc)
+		return date, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcLayout, value)
+		return t, false, err
+	}
+	in := loc
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			in = zone
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, in)
+	return t, false, err
+}
+
+var errInvalidDuration = errors.New("invalid duration")
+
+// parseDuration reads durations such as PT1H30M, P1D or -PT15M.
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign, value = -1, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") {
+		return 0, errInvalidDuration
+	}
+	var total time.Duration
+	amount := 0
+	digits := false
+	inTime := false
+	for _, c := range value[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			amount = amount*10 + int(c-'0')
+			digits = true
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, errInvalidDuration
+		}
+		switch {
+		case c == 'W':
+			total += time.Duration(amount) * 7 * 24 * time.Hour
+		case c == 'D':
+			total += time.Duration(amount) * 24 * time.Hour
+		case c == 'H' && inTime:
+			total += time.Duration(amount) * time.Hour
+		case c == 'M' && inTime:
+			total += time.Duration(amount) * time.Minute
+		case c == 'S' && inTime:
+			total += time.Duration(amount) * time.Second
+		default:
+			return 0, errInvalidDuration
+		}
+		amount, digits = 0, false
+	}
+	return sign * total, nil
+}
@@ -0,0 +1,189 @@
+package ical
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxInstances bounds how many dates of a recurring event are looked at.
+const maxInstances = 5000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Period is a span of time taken by an event, End excluded.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// rule is the part of an RRULE that is expanded: FREQ, INTERVAL, COUNT, UNTIL and, for weekly
+// rules, BYDAY without ordinals.
+type rule struct {
+	frequency string
+	interval  int
+	count     int
+	until     *time.Time
+	byDay     []time.Weekday
+}
+
+// parseRRule reads the rule, reporting false when it uses parts that are not expanded.
+func parseRRule(value string, loc *time.Location) (rule, bool) {
+	r := rule{interval: 1}
+	for _, part := range strings.Split(strings.ToUpper(value), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, false
+		}
+		switch key {
+		case "FREQ":
+			r.frequency = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return r, false
+			}
+			r.interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return r, false
+			}
+			r.count = count
+		case "UNTIL":
+			until, _, err := parseDateTime(property{value: value}, loc)
+			if err != nil {
+				return r, false
+			}
+			r.until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return r, false
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "WKST":
+		default:
+			return r, false
+		}
+	}
+	switch r.frequency {
+	case "DAILY", "MONTHLY", "YEARLY":
+		return r, len(r.byDay) == 0
+	case "WEEKLY":
+		return r, true
+	}
+	return r, false
+}
+
+// Occurrences returns the periods the event takes up that overlap from to to. Recurring events are
+// expanded, rules using parts that are not expanded only take up their first date.
+func (e Event) Occurrences(from time.Time, to time.Time) []Period {
+	duration := e.End.Sub(e.Start)
+	var periods []Period
+	add := func(start time.Time) {
+		for _, excluded := range e.ExDates {
+			if excluded.Equal(start) {
+				return
+			}
+		}
+		if start.Before(to) && start.Add(duration).After(from) {
+			periods = append(periods, Period{Start: start, End: start.Add(duration)})
+		}
+	}
+
+	r, ok := parseRRule(e.Rule, e.Start.Location())
+	if e.Rule == "" || !ok {
+		add(e.Start)
+		return periods
+	}
+	produced := 0
+	first := 0
+	if r.count == 0 {
+		first = r.stepsBefore(e.Start, from.Add(-duration))
+	}
+	for step := first; step < first+maxInstances; step++ {
+		for _, start := range r.datesAt(e.Start, step) {
+			if start.Before(e.Start) {
+				continue
+			}
+			if (r.count > 0 && produced >= r.count) || (r.until != nil && start.After(*r.until)) || !start.Before(to) {
+				return periods
+			}
+			produced++
+			add(start)
+		}
+	}
+	return periods
+}
+
+// stepsBefore is a number of repeats of the rule that end before the given time, so expanding can
+// start there rather than from the first date. It errs on the low side.
+func (r rule) stepsBefore(first time.Time, t time.Time) int {
+	if !t.After(first) {
+		return 0
+	}
+	var steps int
+	switch r.frequency {
+	case "DAILY":
+		steps = int(t.Sub(first)/(24*time.Hour)) / r.interval
+	case "WEEKLY":
+		steps = int(t.Sub(first)/(7*24*time.Hour)) / r.interval
+	case "MONTHLY":
+		steps = ((t.Year()-first.Year())*12 + int(t.Month()) - int(first.Month())) / r.interval
+	case "YEARLY":
+		steps = (t.Year() - first.Year()) / r.interval
+	}
+	if steps -= 2; steps < 0 {
+		return 0
+	}
+	return steps
+}
+
+// datesAt returns the dates produced by the step'th repeat of the rule, in order. Dates that do
+// not exist, such as the 30th of February, are left out.
+func (r rule) datesAt(first time.Time, step int) []time.Time {
+	n := step * r.interval
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, first.Hour(), first.Minute(), first.Second(), 0, first.Location())
+	}
+	switch r.frequency {
+	case "DAILY":
+		return []time.Time{at(first.Year(), first.Month(), first.Day()+n)}
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			return []time.Time{at(first.Year(), first.Month(), first.Day()+7*n)}
+		}
+		// weeks start on Monday
+		monday := first.Day() - (int(first.Weekday())+6)%7 + 7*n
+		var dates []time.Time
+		for offset := 0; offset < 7; offset++ {
+			date := at(first.Year(), first.Month(), monday+offset)
+			for _, weekday := range r.byDay {
+				if date.Weekday() == weekday {
+					dates = append(dates, date)
+					break
+				}
+			}
+		}
+		return dates
+	case "MONTHLY":
+		date := at(first.Year(), first.Month()+time.Month(n), first.Day())
+		if date.Day() != first.Day() {
+			return nil
+		}
+		return []time.Time{date}
+	case "YEARLY":
+		date := at(first.Year()+n, first.Month(), first.Day())
+		if date.Day() != first.Day() {
+			return nil
+		}
+		return []time.Time{date}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+const (
+	// jpegQuality is used for every generated rendition.
+	jpegQuality = 85
+
+	// MaxPixels bounds the pixels of a decoded image, a small file can describe a huge image that
+	// would take gigabytes to decode.
+	MaxPixels = 40 << 20
+)
+
+var ErrTooManyPixels = fmt.Errorf("images can be at most %d megapixels", MaxPixels>>20)
+
+// Rendition is a resized copy of an uploaded image that fits within MaxSize pixels on its longest side.
+type Rendition struct {
+	Name    string
+	MaxSize int
+}
+
+// Renditions are generated for every uploaded image, smallest first.
+var Renditions = []Rendition{
+	{Name: "thumbnail", MaxSize: 320},
+	{Name: "medium", MaxSize: 1024},
+	{Name: "large", MaxSize: 2048},
+}
+
+// Decode reads a JPEG, PNG or GIF image, failing with ErrTooManyPixels before decoding images larger
+// than MaxPixels.
+func Decode(r io.Reader) (image.Image, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, errors.New("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	return img, err
+}
+
+// Fit scales the image down so its longest side is at most maxSize, averaging the source pixels
+// that fall into each target pixel. Images that already fit are returned as they are.
+func Fit(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+	targetWidth, targetHeight := maxSize, height*maxSize/width
+	if height > width {
+		targetWidth, targetHeight = width*maxSize/height, maxSize
+	}
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0 := bounds.Min.Y + y*height/targetHeight
+		y1 := bounds.Min.Y + (y+1)*height/targetHeight
+		for x := 0; x < targetWidth; x++ {
+			x0 := bounds.Min.X + x*width/targetWidth
+			x1 := bounds.Min.X + (x+1)*width/targetWidth
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG encodes the image as a JPEG, transparent areas are flattened onto white.
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			flat.Set(x, y, color.RGBA64{
+				R: uint16(r + white), G: uint16(g + white), B: uint16(b + white), A: 0xffff,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package money
+
+import (
+	"math"
+	"strings"
+)
+
+// exponents maps the ISO 4217 codes we accept to the number of minor unit digits of the currency.
+var exponents = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BIF": 0, "BWP": 2, "CAD": 2, "CDF": 2, "CHF": 2, "CNY": 2,
+	"DJF": 0, "EGP": 2, "ETB": 2, "EUR": 2, "GBP": 2, "GHS": 2, "INR": 2, "JOD": 3, "JPY": 0,
+	"KES": 2, "KRW": 0, "KWD": 3, "MAD": 2, "MUR": 2, "MWK": 2, "MZN": 2, "NGN": 2, "OMR": 3,
+	"RWF": 0, "SAR": 2, "SEK": 2, "SOS": 2, "SSP": 2, "TND": 3, "TZS": 2, "UGX": 0, "USD": 2,
+	"XAF": 0, "XOF": 0, "ZAR": 2, "ZMW": 2,
+}
+
+// Normalize upper cases a currency code.
+func Normalize(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// Valid reports whether the currency is a supported ISO 4217 code.
+func Valid(currency string) bool {
+	_, ok := exponents[Normalize(currency)]
+	return ok
+}
+
+// Exponent returns the number of minor unit digits of the currency, two for unknown codes.
+func Exponent(currency string) int {
+	if exp, ok := exponents[Normalize(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// FromMajor converts an amount in major units, such as 12.50, to minor units of the currency.
+func FromMajor(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(Exponent(currency))))
+}
+
+// ToMajor converts minor units of the currency back to major units.
+func ToMajor(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(Exponent(currency))
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -10,8 +11,31 @@ import (
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationPayloadKey = "authorization_payload"
+	authorizationCallerKey  = "authorization_caller"
 )
 
+// User types recognised by the role checks.
+const (
+	ServitorUserType = "servitor"
+	CustomerUserType = "customer"
+)
+
+// Caller is the authenticated user behind the current request, Admin is the administrator role
+// operators grant apart from the user type.
+type Caller struct {
+	ID       int
+	UserType string
+	Admin    bool
+}
+
+// IsAdmin reports whether the caller is an administrator.
+func (c *Caller) IsAdmin() bool {
+	return c != nil && c.Admin
+}
+
+// CallerResolver looks up the caller for the username carried in the token payload.
+type CallerResolver func(ctx context.Context, username string) (*Caller, error)
+
 // CORSMiddleware it sets the CORS properties.
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -40,3 +64,56 @@ func AuthMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// CallerMiddleware resolves the user behind the token, it must run after AuthMiddleware
+func CallerMiddleware(resolve CallerResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, ok := GetAuthPayload(ctx)
+		if !ok {
+			err := errors.New("authorization payload is not provided")
+			APIResponse(ctx, "", http.StatusUnauthorized, false, err.Error())
+			return
+		}
+		caller, err := resolve(ctx, payload.Username)
+		if err != nil {
+			APIResponse(ctx, "", http.StatusUnauthorized, false, err.Error())
+			return
+		}
+
+		ctx.Set(authorizationCallerKey, caller)
+		ctx.Next()
+	}
+}
+
+// AdminMiddleware only lets administrators through, it must run after CallerMiddleware
+func AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		caller, ok := GetCaller(ctx)
+		if !ok || !caller.IsAdmin() {
+			err := errors.New("administrator rights are required")
+			APIResponse(ctx, "", http.StatusForbidden, false, err.Error())
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// GetAuthPayload returns the token payload set by AuthMiddleware
+func GetAuthPayload(ctx *gin.Context) (*token.Payload, bool) {
+	value, exists := ctx.Get(authorizationPayloadKey)
+	if !exists {
+		return nil, false
+	}
+	payload, ok := value.(*token.Payload)
+	return payload, ok
+}
+
+// GetCaller returns the caller set by CallerMiddleware
+func GetCaller(ctx *gin.Context) (*Caller, bool) {
+	value, exists := ctx.Get(authorizationCallerKey)
+	if !exists {
+		return nil, false
+	}
+	caller, ok := value.(*Caller)
+	return caller, ok
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"servhunt/booking"
+	"time"
+)
+
+// CreateJobRequest posts a job for servitors to quote on. Budgets are in minor units of Currency,
+// which defaults to the platform currency, and BudgetMax is left at 0 for no upper bound.
+type CreateJobRequest struct {
+	CategoryID     int        `json:"category_id" binding:"required"`
+	Title          string     `json:"title" binding:"required,max=256"`
+	Description    string     `json:"description" binding:"required,max=4096"`
+	Address        string     `json:"address" binding:"required,max=512"`
+	Latitude       *float64   `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude      *float64   `json:"longitude" binding:"required,min=-180,max=180"`
+	BudgetMin      int64      `json:"budget_min" binding:"min=0"`
+	BudgetMax      int64      `json:"budget_max" binding:"min=0"`
+	Currency       string     `json:"currency" binding:"omitempty,len=3"`
+	PreferredStart *time.Time `json:"preferred_start"`
+}
+
+type FetchJobsRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=open awarded closed"`
+}
+
+type JobPhotoResponse struct {
+	ID     int    `json:"id"`
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// JobResponse describes a job post, MatchedServices lists the caller's services that may quote on it.
+type JobResponse struct {
+	ID              int                `json:"id"`
+	CustomerID      int                `json:"customer_id"`
+	CategoryID      int                `json:"category_id"`
+	Title           string             `json:"title"`
+	Description     string             `json:"description"`
+	Address         string             `json:"address"`
+	Latitude        float64            `json:"latitude"`
+	Longitude       float64            `json:"longitude"`
+	BudgetMin       int64              `json:"budget_min"`
+	BudgetMax       int64              `json:"budget_max,omitempty"`
+	Currency        string             `json:"currency"`
+	PreferredStart  *time.Time         `json:"preferred_start,omitempty"`
+	Status          string             `json:"status"`
+	Photos          []JobPhotoResponse `json:"photos"`
+	MatchedServices []int              `json:"matched_services,omitempty"`
+	CreatedOn       time.Time          `json:"created_on"`
+}
+
+// QuoteRequest offers to do a job with one of the servitor's matched services. Price is in minor
+// units of Currency, which defaults to the job's currency.
+type QuoteRequest struct {
+	ServiceID int       `json:"service_id" binding:"required"`
+	Price     int64     `json:"price" binding:"min=0"`
+	Currency  string    `json:"currency" binding:"omitempty,len=3"`
+	Message   string    `json:"message" binding:"max=2048"`
+	StartsAt  time.Time `json:"starts_at" binding:"required"`
+	EndsAt    time.Time `json:"ends_at" binding:"required"`
+}
+
+type FetchQuotesRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending accepted declined withdrawn"`
+}
+
+// CompareQuotesRequest orders the quotes on a job by price, start time or when they were made.
+type CompareQuotesRequest struct {
+	Sort string `form:"sort" binding:"omitempty,oneof=price start created"`
+}
+
+type AcceptQuoteRequest struct {
+	Notes string `json:"notes" binding:"max=1024"`
+}
+
+type QuoteResponse struct {
+	ID         int       `json:"id"`
+	JobID      int       `json:"job_id"`
+	ServitorID int       `json:"servitor_id"`
+	ServiceID  int       `json:"service_id"`
+	Price      int64     `json:"price"`
+	Currency   string    `json:"currency"`
+	Message    string    `json:"message,omitempty"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Status     string    `json:"status"`
+	BookingID  *int      `json:"booking_id,omitempty"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+// ComparedQuote is a quote next to the others on the job. WithinBudget is false for quotes above
+// the job's maximum budget or in another currency.
+type ComparedQuote struct {
+	QuoteResponse
+	ServiceName  string `json:"service_name"`
+	WithinBudget bool   `json:"within_budget"`
+	Cheapest     bool   `json:"cheapest"`
+	Earliest     bool   `json:"earliest"`
+}
+
+// QuoteComparisonResponse lists the quotes on a job, the price summary covers the pending quotes
+// in the job's currency.
+type QuoteComparisonResponse struct {
+	JobID        int             `json:"job_id"`
+	Currency     string          `json:"currency"`
+	Pending      int             `json:"pending"`
+	LowestPrice  int64           `json:"lowest_price"`
+	HighestPrice int64           `json:"highest_price"`
+	AveragePrice int64           `json:"average_price"`
+	Quotes       []ComparedQuote `json:"quotes"`
+}
+
+// AcceptedQuoteResponse is the accepted quote and the booking made for it.
+type AcceptedQuoteResponse struct {
+	Quote   QuoteResponse           `json:"quote"`
+	Booking booking.BookingResponse `json:"booking"`
+}
@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"time"
+)
+
+// Statuses a job post moves through, awarded and closed are final.
+const (
+	OpenStatus    = "open"
+	AwardedStatus = "awarded"
+	ClosedStatus  = "closed"
+)
+
+// Statuses of a quote, only pending quotes can be changed.
+const (
+	PendingQuote   = "pending"
+	AcceptedQuote  = "accepted"
+	DeclinedQuote  = "declined"
+	WithdrawnQuote = "withdrawn"
+)
+
+// JobPost is a job a customer described for servitors to quote on. The budget is in minor units of
+// Currency, BudgetMax is 0 when the customer gave no upper bound.
+type JobPost struct {
+	ID             int        `gorm:"primary_key; auto_increment" json:"id"`
+	CustomerID     int        `gorm:"index" json:"customer_id"`
+	CategoryID     int        `gorm:"index" json:"category_id"`
+	Title          string     `gorm:"type:varchar(256)" json:"title"`
+	Description    string     `gorm:"type:varchar(4096)" json:"description"`
+	Address        string     `gorm:"type:varchar(512)" json:"address"`
+	Latitude       float64    `json:"latitude"`
+	Longitude      float64    `json:"longitude"`
+	BudgetMin      int64      `json:"budget_min"`
+	BudgetMax      int64      `json:"budget_max"`
+	Currency       string     `gorm:"type:varchar(3)" json:"currency"`
+	PreferredStart *time.Time `json:"preferred_start"`
+	Status         string     `gorm:"type:varchar(16);index" json:"status"`
+	Photos         []JobPhoto `gorm:"foreignKey:JobID" json:"photos"`
+	CreatedOn      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// JobPhoto is a photo attached to a job post.
+type JobPhoto struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	JobID      int       `gorm:"index" json:"job_id"`
+	StorageKey string    `gorm:"type:varchar(256)" json:"storage_key"`
+	Url        string    `gorm:"type:varchar(512)" json:"url"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// JobMatch links a job to a service that matched it when the job was posted, the servitors
+// offering matched services may quote on the job.
+type JobMatch struct {
+	ID         int `gorm:"primary_key; auto_increment" json:"id"`
+	JobID      int `gorm:"uniqueIndex:idx_job_match_service" json:"job_id"`
+	ServiceID  int `gorm:"uniqueIndex:idx_job_match_service" json:"service_id"`
+	ServitorID int `gorm:"index" json:"servitor_id"`
+}
+
+// Quote is a servitor's offer to do a job with one of their services for Price, in minor units of
+// Currency, between StartsAt and EndsAt. BookingID is set once the customer accepted the quote.
+type Quote struct {
+	ID            int       `gorm:"primary_key; auto_increment" json:"id"`
+	JobID         int       `gorm:"index" json:"job_id"`
+	ServitorID    int       `gorm:"index" json:"servitor_id"`
+	ServiceID     int       `json:"service_id"`
+	Price         int64     `json:"price"`
+	Currency      string    `gorm:"type:varchar(3)" json:"currency"`
+	Message       string    `gorm:"type:varchar(2048)" json:"message"`
+	StartsAt      time.Time `json:"starts_at"`
+	EndsAt        time.Time `json:"ends_at"`
+	Status        string    `gorm:"type:varchar(16);index" json:"status"`
+	BookingID     *int      `json:"booking_id"`
+	CreatedOn     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+// JobFilter narrows down the job posts listed, empty fields are ignored. ServitorID lists the jobs
+// the servitor was matched to.
+type JobFilter struct {
+	CustomerID int
+	ServitorID int
+	Status     string
+}
+
+// QuoteFilter narrows down the quotes listed, empty fields are ignored.
+type QuoteFilter struct {
+	JobID      int
+	ServitorID int
+	Status     string
+}
@@ -0,0 +1,304 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"time"
+)
+
+var (
+	// ErrJobNotOpen is returned when changing a job that was awarded or closed in the meantime.
+	ErrJobNotOpen = errors.New("the job is no longer open for quotes")
+
+	// ErrQuoteChanged is returned when a quote was accepted, declined or withdrawn in the meantime.
+	ErrQuoteChanged = errors.New("the quote is no longer pending")
+
+	// ErrQuoteExists is returned when a servitor quotes again on a job they have a pending quote on.
+	ErrQuoteExists = errors.New("you already have a pending quote on this job, update it instead")
+)
+
+type JobRepo interface {
+	CreateJob(ctx context.Context, job JobPost, matches []JobMatch) (*JobPost, error)
+	GetJobByID(ctx context.Context, id int) (*JobPost, error)
+	Jobs(ctx context.Context, filter JobFilter) (*[]JobPost, error)
+	CloseJob(ctx context.Context, id int) error
+	ServitorMatches(ctx context.Context, jobId int, servitorId int) (*[]JobMatch, error)
+	CountJobPhotos(ctx context.Context, jobId int) (int64, error)
+	CreateJobPhoto(ctx context.Context, photo JobPhoto) (*JobPhoto, error)
+	GetJobPhotoByID(ctx context.Context, id int) (*JobPhoto, error)
+	DeleteJobPhoto(ctx context.Context, id int) error
+	CreateQuote(ctx context.Context, quote Quote) (*Quote, error)
+	GetQuoteByID(ctx context.Context, id int) (*Quote, error)
+	Quotes(ctx context.Context, filter QuoteFilter) (*[]Quote, error)
+	UpdateQuote(ctx context.Context, quote Quote) (*Quote, error)
+	WithdrawQuote(ctx context.Context, id int) error
+	ClaimQuote(ctx context.Context, quote Quote) error
+	ReleaseQuote(ctx context.Context, quote Quote) error
+	AwardQuote(ctx context.Context, quote Quote, bookingId int) (*Quote, error)
+}
+
+type JobRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewJobRepoImpl(repo *dao.Repository) JobRepo {
+	return &JobRepoImpl{repo: repo}
+}
+
+// CreateJob stores the job along with the services it matched.
+func (j *JobRepoImpl) CreateJob(ctx context.Context, job JobPost, matches []JobMatch) (*JobPost, error) {
+	job.Status = OpenStatus
+	err := j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&JobPost{}).Create(&job).Error; err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return nil
+		}
+		for i := range matches {
+			matches[i].JobID = job.ID
+		}
+		return tx.Model(&JobMatch{}).Create(&matches).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (j *JobRepoImpl) GetJobByID(ctx context.Context, id int) (*JobPost, error) {
+	var job JobPost
+	err := j.repo.DB.WithContext(ctx).Model(&JobPost{}).Preload("Photos", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ?", id).Take(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Jobs lists the job posts matching the filter, newest first.
+func (j *JobRepoImpl) Jobs(ctx context.Context, filter JobFilter) (*[]JobPost, error) {
+	var jobs []JobPost
+	query := j.repo.DB.WithContext(ctx).Model(&JobPost{}).Preload("Photos", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	})
+	if filter.CustomerID != 0 {
+		query = query.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.ServitorID != 0 {
+		matched := j.repo.DB.Model(&JobMatch{}).Select("job_id").Where("servitor_id = ?", filter.ServitorID)
+		query = query.Where("id IN (?)", matched)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if err := query.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return &jobs, nil
+}
+
+// CloseJob closes an open job and declines its pending quotes.
+func (j *JobRepoImpl) CloseJob(ctx context.Context, id int) error {
+	return j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&JobPost{}).Where("id = ? AND status = ?", id, OpenStatus).
+			Updates(map[string]interface{}{"status": ClosedStatus, "last_updated_on": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrJobNotOpen
+		}
+		return tx.Model(&Quote{}).Where("job_id = ? AND status = ?", id, PendingQuote).
+			Updates(map[string]interface{}{"status": DeclinedQuote, "last_updated_on": now}).Error
+	})
+}
+
+// ServitorMatches returns the services of the servitor that matched the job.
+func (j *JobRepoImpl) ServitorMatches(ctx context.Context, jobId int, servitorId int) (*[]JobMatch, error) {
+	var matches []JobMatch
+	err := j.repo.DB.WithContext(ctx).Model(&JobMatch{}).Where("job_id = ? AND servitor_id = ?", jobId, servitorId).
+		Order("service_id").Find(&matches).Error
+	if err != nil {
+		return nil, err
+	}
+	return &matches, nil
+}
+
+func (j *JobRepoImpl) CountJobPhotos(ctx context.Context, jobId int) (int64, error) {
+	var count int64
+	err := j.repo.DB.WithContext(ctx).Model(&JobPhoto{}).Where("job_id = ?", jobId).Count(&count).Error
+	return count, err
+}
+
+func (j *JobRepoImpl) CreateJobPhoto(ctx context.Context, photo JobPhoto) (*JobPhoto, error) {
+	if err := j.repo.DB.WithContext(ctx).Model(&JobPhoto{}).Create(&photo).Error; err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func (j *JobRepoImpl) GetJobPhotoByID(ctx context.Context, id int) (*JobPhoto, error) {
+	var photo JobPhoto
+	if err := j.repo.DB.WithContext(ctx).Model(&JobPhoto{}).Where("id = ?", id).Take(&photo).Error; err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func (j *JobRepoImpl) DeleteJobPhoto(ctx context.Context, id int) error {
+	return j.repo.DB.WithContext(ctx).Where("id = ?", id).Delete(&JobPhoto{}).Error
+}
+
+// CreateQuote stores a pending quote if the job is still open and the servitor has no other pending
+// quote on it, the job row is locked so the checks hold until the quote is stored.
+func (j *JobRepoImpl) CreateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	quote.Status = PendingQuote
+	err := j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var job JobPost
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&JobPost{}).Where("id = ?", quote.JobID).
+			Take(&job).Error
+		if err != nil {
+			return err
+		}
+		if job.Status != OpenStatus {
+			return ErrJobNotOpen
+		}
+		var pending int64
+		err = tx.Model(&Quote{}).Where("job_id = ? AND servitor_id = ? AND status = ?", quote.JobID,
+			quote.ServitorID, PendingQuote).Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrQuoteExists
+		}
+		return tx.Model(&Quote{}).Create(&quote).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+func (j *JobRepoImpl) GetQuoteByID(ctx context.Context, id int) (*Quote, error) {
+	var quote Quote
+	if err := j.repo.DB.WithContext(ctx).Model(&Quote{}).Where("id = ?", id).Take(&quote).Error; err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// Quotes lists the quotes matching the filter, oldest first.
+func (j *JobRepoImpl) Quotes(ctx context.Context, filter QuoteFilter) (*[]Quote, error) {
+	var quotes []Quote
+	query := j.repo.DB.WithContext(ctx).Model(&Quote{})
+	if filter.JobID != 0 {
+		query = query.Where("job_id = ?", filter.JobID)
+	}
+	if filter.ServitorID != 0 {
+		query = query.Where("servitor_id = ?", filter.ServitorID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if err := query.Order("id").Find(&quotes).Error; err != nil {
+		return nil, err
+	}
+	return &quotes, nil
+}
+
+// UpdateQuote replaces the offer of a pending quote.
+func (j *JobRepoImpl) UpdateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	res := j.repo.DB.WithContext(ctx).Model(&Quote{}).Where("id = ? AND status = ?", quote.ID, PendingQuote).
+		Updates(map[string]interface{}{
+			"service_id":      quote.ServiceID,
+			"price":           quote.Price,
+			"currency":        quote.Currency,
+			"message":         quote.Message,
+			"starts_at":       quote.StartsAt,
+			"ends_at":         quote.EndsAt,
+			"last_updated_on": time.Now(),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrQuoteChanged
+	}
+	return j.GetQuoteByID(ctx, quote.ID)
+}
+
+func (j *JobRepoImpl) WithdrawQuote(ctx context.Context, id int) error {
+	res := j.repo.DB.WithContext(ctx).Model(&Quote{}).Where("id = ? AND status = ?", id, PendingQuote).
+		Updates(map[string]interface{}{"status": WithdrawnQuote, "last_updated_on": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrQuoteChanged
+	}
+	return nil
+}
+
+// ClaimQuote awards the open job to the pending quote before it is booked, so no other quote can
+// be accepted meanwhile. ReleaseQuote undoes the claim when booking fails.
+func (j *JobRepoImpl) ClaimQuote(ctx context.Context, quote Quote) error {
+	return j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&JobPost{}).Where("id = ? AND status = ?", quote.JobID, OpenStatus).
+			Updates(map[string]interface{}{"status": AwardedStatus, "last_updated_on": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrJobNotOpen
+		}
+		res = tx.Model(&Quote{}).Where("id = ? AND status = ?", quote.ID, PendingQuote).
+			Updates(map[string]interface{}{"status": AcceptedQuote, "last_updated_on": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrQuoteChanged
+		}
+		return nil
+	})
+}
+
+func (j *JobRepoImpl) ReleaseQuote(ctx context.Context, quote Quote) error {
+	return j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&JobPost{}).Where("id = ? AND status = ?", quote.JobID, AwardedStatus).
+			Updates(map[string]interface{}{"status": OpenStatus, "last_updated_on": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Quote{}).Where("id = ? AND status = ?", quote.ID, AcceptedQuote).
+			Updates(map[string]interface{}{"status": PendingQuote, "last_updated_on": now}).Error
+	})
+}
+
+// AwardQuote records the booking made for a claimed quote and declines the other pending quotes
+// on the job.
+func (j *JobRepoImpl) AwardQuote(ctx context.Context, quote Quote, bookingId int) (*Quote, error) {
+	err := j.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&Quote{}).Where("id = ?", quote.ID).
+			Updates(map[string]interface{}{"booking_id": bookingId, "last_updated_on": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Quote{}).Where("job_id = ? AND id <> ? AND status = ?", quote.JobID, quote.ID, PendingQuote).
+			Updates(map[string]interface{}{"status": DeclinedQuote, "last_updated_on": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return j.GetQuoteByID(ctx, quote.ID)
+}
@@ -0,0 +1,302 @@
+package jobs
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"servhunt/booking"
+	bookingdao "servhunt/booking/dao"
+	"servhunt/infra/imaging"
+	"servhunt/infra/utils"
+	"servhunt/jobs/dao"
+	"servhunt/servitorservices"
+	"servhunt/storage"
+	"strconv"
+)
+
+type JobHandler interface {
+	CreateJob(ctx *gin.Context)
+	MyJobs(ctx *gin.Context)
+	MatchingJobs(ctx *gin.Context)
+	GetJob(ctx *gin.Context)
+	CloseJob(ctx *gin.Context)
+	UploadJobPhoto(ctx *gin.Context)
+	DeleteJobPhoto(ctx *gin.Context)
+	SubmitQuote(ctx *gin.Context)
+	CompareQuotes(ctx *gin.Context)
+	MyQuotes(ctx *gin.Context)
+	UpdateQuote(ctx *gin.Context)
+	WithdrawQuote(ctx *gin.Context)
+	AcceptQuote(ctx *gin.Context)
+}
+
+type JobHandlerImpl struct {
+	JobService
+}
+
+func NewJobHandlerImpl(svc JobService) JobHandler {
+	return &JobHandlerImpl{JobService: svc}
+}
+
+// jobError writes the response for a failed job call and reports whether there was one.
+func jobError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotJobOwner), errors.Is(err, ErrNotMatched), errors.Is(err, ErrNotQuoteOwner):
+		utils.APIResponse(ctx, "You cannot make that change to the job", http.StatusForbidden, false, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	case errors.Is(err, dao.ErrJobNotOpen), errors.Is(err, dao.ErrQuoteChanged), errors.Is(err, dao.ErrQuoteExists),
+		errors.Is(err, bookingdao.ErrSlotTaken), errors.Is(err, bookingdao.ErrNoSchedule),
+		errors.Is(err, booking.ErrServiceUnavailable):
+		utils.APIResponse(ctx, "Failed to update job", http.StatusConflict, false, err.Error())
+	case errors.Is(err, ErrServiceNotMatched), errors.Is(err, ErrInvalidBudget), errors.Is(err, ErrInvalidQuoteTime),
+		errors.Is(err, ErrTooManyPhotos), errors.Is(err, storage.ErrUnsupportedPhoto),
+		errors.Is(err, servitorservices.ErrUnknownCategory), errors.Is(err, booking.ErrInvalidSchedule),
+		errors.Is(err, booking.ErrOwnService):
+		utils.APIResponse(ctx, "Failed to update job", http.StatusBadRequest, false, err.Error())
+	case errors.Is(err, storage.ErrPhotoTooLarge), errors.Is(err, imaging.ErrTooManyPixels):
+		utils.APIResponse(ctx, "Photo is too large", http.StatusRequestEntityTooLarge, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (j *JobHandlerImpl) CreateJob(ctx *gin.Context) {
+	req := CreateJobRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	job, err := j.JobService.CreateJob(ctx, caller, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Job posted successfully", http.StatusCreated, true, job)
+}
+
+func (j *JobHandlerImpl) MyJobs(ctx *gin.Context) {
+	req := FetchJobsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	jobs, err := j.JobService.MyJobs(ctx, caller, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Jobs successfully returned", http.StatusOK, true, jobs)
+}
+
+func (j *JobHandlerImpl) MatchingJobs(ctx *gin.Context) {
+	req := FetchJobsRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	jobs, err := j.JobService.MatchingJobs(ctx, caller, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Jobs successfully returned", http.StatusOK, true, jobs)
+}
+
+func (j *JobHandlerImpl) GetJob(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	job, err := j.JobService.GetJob(ctx, caller, id)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Job successfully returned", http.StatusOK, true, job)
+}
+
+func (j *JobHandlerImpl) CloseJob(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	job, err := j.JobService.CloseJob(ctx, caller, id)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Job closed", http.StatusOK, true, job)
+}
+
+func (j *JobHandlerImpl) UploadJobPhoto(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// Leave room for the multipart framing around the largest accepted photo
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, storage.MaxPhotoBytes+1<<20)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		utils.APIResponse(ctx, "A file is required", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	defer file.Close()
+	caller, _ := utils.GetCaller(ctx)
+	photo, err := j.JobService.UploadJobPhoto(ctx, caller, id, file)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Photo uploaded successfully", http.StatusCreated, true, photo)
+}
+
+func (j *JobHandlerImpl) DeleteJobPhoto(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if jobError(ctx, j.JobService.DeleteJobPhoto(ctx, caller, id)) {
+		return
+	}
+	utils.APIResponse(ctx, "Photo deleted successfully", http.StatusOK, true, nil)
+}
+
+func (j *JobHandlerImpl) SubmitQuote(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := QuoteRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quote, err := j.JobService.SubmitQuote(ctx, caller, id, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quote submitted successfully", http.StatusCreated, true, quote)
+}
+
+func (j *JobHandlerImpl) CompareQuotes(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := CompareQuotesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quotes, err := j.JobService.CompareQuotes(ctx, caller, id, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quotes successfully returned", http.StatusOK, true, quotes)
+}
+
+func (j *JobHandlerImpl) MyQuotes(ctx *gin.Context) {
+	req := FetchQuotesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quotes, err := j.JobService.MyQuotes(ctx, caller, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quotes successfully returned", http.StatusOK, true, quotes)
+}
+
+func (j *JobHandlerImpl) UpdateQuote(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := QuoteRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quote, err := j.JobService.UpdateQuote(ctx, caller, id, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quote updated successfully", http.StatusOK, true, quote)
+}
+
+func (j *JobHandlerImpl) WithdrawQuote(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quote, err := j.JobService.WithdrawQuote(ctx, caller, id)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quote withdrawn", http.StatusOK, true, quote)
+}
+
+func (j *JobHandlerImpl) AcceptQuote(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// the notes are optional so an empty body is allowed
+	req := AcceptQuoteRequest{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+				false, err.Error())
+			return
+		}
+	}
+	caller, _ := utils.GetCaller(ctx)
+	accepted, err := j.JobService.AcceptQuote(ctx, caller, id, req)
+	if jobError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Quote accepted and booked", http.StatusOK, true, accepted)
+}
@@ -0,0 +1,546 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"servhunt/booking"
+	"servhunt/infra/geo"
+	"servhunt/infra/utils"
+	"servhunt/jobs/dao"
+	svcdao "servhunt/servitorservices/dao"
+	"servhunt/storage"
+	"sort"
+	"time"
+)
+
+// MaxJobPhotos bounds the photos attached to one job post.
+const MaxJobPhotos = 10
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrNotJobOwner       = errors.New("the job was posted by another customer")
+	ErrNotMatched        = errors.New("only servitors whose services matched the job can see and quote on it")
+	ErrNotQuoteOwner     = errors.New("the quote belongs to another servitor")
+	ErrServiceNotMatched = errors.New("quotes must be for one of your services that matched the job")
+	ErrInvalidBudget     = errors.New("the maximum budget cannot be below the minimum budget")
+	ErrInvalidQuoteTime  = errors.New("a quote must start in the future and end after it starts")
+	ErrTooManyPhotos     = fmt.Errorf("a job can have at most %d photos", MaxJobPhotos)
+)
+
+// ServiceMatcher finds the published services that could take on a job in the category at the point.
+type ServiceMatcher interface {
+	MatchingServices(ctx context.Context, categoryId int, point geo.Point) (*[]svcdao.Service, error)
+}
+
+// QuoteBooker checks quoted times against the servitor's bookings and books accepted quotes.
+type QuoteBooker interface {
+	CheckQuotedTime(ctx context.Context, servitorId int, start time.Time, end time.Time) error
+	BookQuote(ctx context.Context, request booking.QuotedBooking) (*booking.BookingResponse, error)
+}
+
+type JobService interface {
+	CreateJob(ctx context.Context, caller *utils.Caller, request CreateJobRequest) (*JobResponse, error)
+	GetJob(ctx context.Context, caller *utils.Caller, id int) (*JobResponse, error)
+	MyJobs(ctx context.Context, caller *utils.Caller, request FetchJobsRequest) (*[]JobResponse, error)
+	MatchingJobs(ctx context.Context, caller *utils.Caller, request FetchJobsRequest) (*[]JobResponse, error)
+	CloseJob(ctx context.Context, caller *utils.Caller, id int) (*JobResponse, error)
+	UploadJobPhoto(ctx context.Context, caller *utils.Caller, id int, file io.Reader) (*JobPhotoResponse, error)
+	DeleteJobPhoto(ctx context.Context, caller *utils.Caller, id int) error
+	SubmitQuote(ctx context.Context, caller *utils.Caller, jobId int, request QuoteRequest) (*QuoteResponse, error)
+	UpdateQuote(ctx context.Context, caller *utils.Caller, id int, request QuoteRequest) (*QuoteResponse, error)
+	WithdrawQuote(ctx context.Context, caller *utils.Caller, id int) (*QuoteResponse, error)
+	MyQuotes(ctx context.Context, caller *utils.Caller, request FetchQuotesRequest) (*[]QuoteResponse, error)
+	CompareQuotes(ctx context.Context, caller *utils.Caller, jobId int, request CompareQuotesRequest) (*QuoteComparisonResponse, error)
+	AcceptQuote(ctx context.Context, caller *utils.Caller, id int, request AcceptQuoteRequest) (*AcceptedQuoteResponse, error)
+}
+
+type JobServiceImpl struct {
+	dao.JobRepo
+	services        svcdao.ServiceRepo
+	matcher         ServiceMatcher
+	bookings        QuoteBooker
+	blobs           storage.BlobStore
+	defaultCurrency string
+}
+
+// NewJobServiceImpl creates the job service, blobs keeps the job photos and jobs posted without a
+// currency take defaultCurrency.
+func NewJobServiceImpl(repo dao.JobRepo, services svcdao.ServiceRepo, matcher ServiceMatcher, bookings QuoteBooker,
+	blobs storage.BlobStore, defaultCurrency string) JobService {
+	return &JobServiceImpl{JobRepo: repo, services: services, matcher: matcher, bookings: bookings, blobs: blobs,
+		defaultCurrency: defaultCurrency}
+}
+
+// CreateJob posts the job and matches it to the services that could take it on, other than the
+// caller's own.
+func (j *JobServiceImpl) CreateJob(ctx context.Context, caller *utils.Caller, request CreateJobRequest) (*JobResponse, error) {
+	if request.BudgetMax > 0 && request.BudgetMax < request.BudgetMin {
+		return nil, ErrInvalidBudget
+	}
+	currency := request.Currency
+	if currency == "" {
+		currency = j.defaultCurrency
+	}
+	point := geo.Point{Latitude: *request.Latitude, Longitude: *request.Longitude}
+	services, err := j.matcher.MatchingServices(ctx, request.CategoryID, point)
+	if err != nil {
+		return nil, err
+	}
+	var matches []dao.JobMatch
+	for _, svc := range *services {
+		if svc.UserID != caller.ID {
+			matches = append(matches, dao.JobMatch{ServiceID: svc.ID, ServitorID: svc.UserID})
+		}
+	}
+
+	job, err := j.JobRepo.CreateJob(ctx, dao.JobPost{
+		CustomerID:     caller.ID,
+		CategoryID:     request.CategoryID,
+		Title:          request.Title,
+		Description:    request.Description,
+		Address:        request.Address,
+		Latitude:       point.Latitude,
+		Longitude:      point.Longitude,
+		BudgetMin:      request.BudgetMin,
+		BudgetMax:      request.BudgetMax,
+		Currency:       currency,
+		PreferredStart: request.PreferredStart,
+	}, matches)
+	if err != nil {
+		return nil, err
+	}
+	res := toJobResponse(*job, nil)
+	return &res, nil
+}
+
+// GetJob shows the job to its customer, administrators and the servitors it matched.
+func (j *JobServiceImpl) GetJob(ctx context.Context, caller *utils.Caller, id int) (*JobResponse, error) {
+	job, matched, err := j.visibleJob(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toJobResponse(*job, matched)
+	return &res, nil
+}
+
+func (j *JobServiceImpl) MyJobs(ctx context.Context, caller *utils.Caller, request FetchJobsRequest) (*[]JobResponse, error) {
+	jobs, err := j.JobRepo.Jobs(ctx, dao.JobFilter{CustomerID: caller.ID, Status: request.Status})
+	if err != nil {
+		return nil, err
+	}
+	res := []JobResponse{}
+	for _, job := range *jobs {
+		res = append(res, toJobResponse(job, nil))
+	}
+	return &res, nil
+}
+
+// MatchingJobs lists the jobs the servitor's services matched, open jobs unless another status is asked for.
+func (j *JobServiceImpl) MatchingJobs(ctx context.Context, caller *utils.Caller, request FetchJobsRequest) (*[]JobResponse, error) {
+	status := request.Status
+	if status == "" {
+		status = dao.OpenStatus
+	}
+	jobs, err := j.JobRepo.Jobs(ctx, dao.JobFilter{ServitorID: caller.ID, Status: status})
+	if err != nil {
+		return nil, err
+	}
+	res := []JobResponse{}
+	for _, job := range *jobs {
+		res = append(res, toJobResponse(job, nil))
+	}
+	return &res, nil
+}
+
+// CloseJob stops an open job from taking quotes, the pending quotes on it are declined.
+func (j *JobServiceImpl) CloseJob(ctx context.Context, caller *utils.Caller, id int) (*JobResponse, error) {
+	if _, err := j.ownedJob(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	if err := j.JobRepo.CloseJob(ctx, id); err != nil {
+		return nil, err
+	}
+	job, err := j.JobRepo.GetJobByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toJobResponse(*job, nil)
+	return &res, nil
+}
+
+func (j *JobServiceImpl) UploadJobPhoto(ctx context.Context, caller *utils.Caller, id int,
+	file io.Reader) (*JobPhotoResponse, error) {
+	job, err := j.ownedJob(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != dao.OpenStatus {
+		return nil, dao.ErrJobNotOpen
+	}
+	count, err := j.JobRepo.CountJobPhotos(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxJobPhotos {
+		return nil, ErrTooManyPhotos
+	}
+	stored, err := storage.PutPhoto(ctx, j.blobs, fmt.Sprintf("jobs/%d/photos", id), file)
+	if err != nil {
+		return nil, err
+	}
+	created, err := j.JobRepo.CreateJobPhoto(ctx, dao.JobPhoto{
+		JobID:      id,
+		StorageKey: stored.Key,
+		Url:        stored.Url,
+		Width:      stored.Width,
+		Height:     stored.Height,
+	})
+	if err != nil {
+		storage.DeletePhoto(ctx, j.blobs, stored.Key)
+		return nil, err
+	}
+	res := toJobPhotoResponse(*created)
+	return &res, nil
+}
+
+func (j *JobServiceImpl) DeleteJobPhoto(ctx context.Context, caller *utils.Caller, id int) error {
+	photo, err := j.JobRepo.GetJobPhotoByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err = j.ownedJob(ctx, caller, photo.JobID); err != nil {
+		return err
+	}
+	if err = j.JobRepo.DeleteJobPhoto(ctx, id); err != nil {
+		return err
+	}
+	storage.DeletePhoto(ctx, j.blobs, photo.StorageKey)
+	return nil
+}
+
+// SubmitQuote offers to do an open job with one of the servitor's matched services.
+func (j *JobServiceImpl) SubmitQuote(ctx context.Context, caller *utils.Caller, jobId int,
+	request QuoteRequest) (*QuoteResponse, error) {
+	job, err := j.JobRepo.GetJobByID(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := j.checkQuote(ctx, caller, *job, request)
+	if err != nil {
+		return nil, err
+	}
+	created, err := j.JobRepo.CreateQuote(ctx, *quote)
+	if err != nil {
+		return nil, err
+	}
+	res := toQuoteResponse(*created)
+	return &res, nil
+}
+
+// UpdateQuote changes the offer of a pending quote while its job is open.
+func (j *JobServiceImpl) UpdateQuote(ctx context.Context, caller *utils.Caller, id int,
+	request QuoteRequest) (*QuoteResponse, error) {
+	current, err := j.ownedQuote(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := j.JobRepo.GetJobByID(ctx, current.JobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != dao.OpenStatus {
+		return nil, dao.ErrJobNotOpen
+	}
+	quote, err := j.checkQuote(ctx, caller, *job, request)
+	if err != nil {
+		return nil, err
+	}
+	quote.ID = id
+	updated, err := j.JobRepo.UpdateQuote(ctx, *quote)
+	if err != nil {
+		return nil, err
+	}
+	res := toQuoteResponse(*updated)
+	return &res, nil
+}
+
+func (j *JobServiceImpl) WithdrawQuote(ctx context.Context, caller *utils.Caller, id int) (*QuoteResponse, error) {
+	if _, err := j.ownedQuote(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	if err := j.JobRepo.WithdrawQuote(ctx, id); err != nil {
+		return nil, err
+	}
+	quote, err := j.JobRepo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := toQuoteResponse(*quote)
+	return &res, nil
+}
+
+func (j *JobServiceImpl) MyQuotes(ctx context.Context, caller *utils.Caller, request FetchQuotesRequest) (*[]QuoteResponse, error) {
+	quotes, err := j.JobRepo.Quotes(ctx, dao.QuoteFilter{ServitorID: caller.ID, Status: request.Status})
+	if err != nil {
+		return nil, err
+	}
+	res := []QuoteResponse{}
+	for _, quote := range *quotes {
+		res = append(res, toQuoteResponse(quote))
+	}
+	return &res, nil
+}
+
+// CompareQuotes lays the quotes on the job side by side for its customer, cheapest first unless
+// another order is asked for. Withdrawn quotes are left out.
+func (j *JobServiceImpl) CompareQuotes(ctx context.Context, caller *utils.Caller, jobId int,
+	request CompareQuotesRequest) (*QuoteComparisonResponse, error) {
+	job, err := j.ownedJob(ctx, caller, jobId)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := j.JobRepo.Quotes(ctx, dao.QuoteFilter{JobID: jobId})
+	if err != nil {
+		return nil, err
+	}
+	var offered []dao.Quote
+	var serviceIds []int
+	for _, quote := range *quotes {
+		if quote.Status != dao.WithdrawnQuote {
+			offered = append(offered, quote)
+			serviceIds = append(serviceIds, quote.ServiceID)
+		}
+	}
+	services, err := j.services.GetServicesByIDs(ctx, serviceIds)
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{}
+	for _, svc := range *services {
+		names[svc.ID] = svc.ServiceName
+	}
+	res := compareQuotes(*job, offered, names, request.Sort)
+	return &res, nil
+}
+
+// AcceptQuote books the quoted service for the job's customer at the quoted time and price. The job
+// is awarded to the quote and the other pending quotes on it are declined.
+func (j *JobServiceImpl) AcceptQuote(ctx context.Context, caller *utils.Caller, id int,
+	request AcceptQuoteRequest) (*AcceptedQuoteResponse, error) {
+	quote, err := j.JobRepo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := j.ownedJob(ctx, caller, quote.JobID)
+	if err != nil {
+		return nil, err
+	}
+	if err = j.JobRepo.ClaimQuote(ctx, *quote); err != nil {
+		return nil, err
+	}
+	booked, err := j.bookings.BookQuote(ctx, booking.QuotedBooking{
+		ServiceID:      quote.ServiceID,
+		CustomerID:     job.CustomerID,
+		ScheduledStart: quote.StartsAt,
+		ScheduledEnd:   quote.EndsAt,
+		Address:        job.Address,
+		Notes:          request.Notes,
+		Price:          quote.Price,
+		Currency:       quote.Currency,
+		Latitude:       &job.Latitude,
+		Longitude:      &job.Longitude,
+	})
+	if err != nil {
+		if releaseErr := j.JobRepo.ReleaseQuote(ctx, *quote); releaseErr != nil {
+			logger.Error("error releasing quote after failed booking", zap.Int("quote.id", quote.ID),
+				zap.NamedError("error.message", releaseErr))
+		}
+		return nil, err
+	}
+	awarded, err := j.JobRepo.AwardQuote(ctx, *quote, booked.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &AcceptedQuoteResponse{Quote: toQuoteResponse(*awarded), Booking: *booked}, nil
+}
+
+// checkQuote validates a quote on the job and fills it in for the caller.
+func (j *JobServiceImpl) checkQuote(ctx context.Context, caller *utils.Caller, job dao.JobPost,
+	request QuoteRequest) (*dao.Quote, error) {
+	matches, err := j.JobRepo.ServitorMatches(ctx, job.ID, caller.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(*matches) == 0 {
+		return nil, ErrNotMatched
+	}
+	matched := false
+	for _, match := range *matches {
+		matched = matched || match.ServiceID == request.ServiceID
+	}
+	if !matched {
+		return nil, ErrServiceNotMatched
+	}
+	if !request.StartsAt.After(time.Now()) || !request.EndsAt.After(request.StartsAt) {
+		return nil, ErrInvalidQuoteTime
+	}
+	if err = j.bookings.CheckQuotedTime(ctx, caller.ID, request.StartsAt, request.EndsAt); err != nil {
+		return nil, err
+	}
+	currency := request.Currency
+	if currency == "" {
+		currency = job.Currency
+	}
+	return &dao.Quote{
+		JobID:      job.ID,
+		ServitorID: caller.ID,
+		ServiceID:  request.ServiceID,
+		Price:      request.Price,
+		Currency:   currency,
+		Message:    request.Message,
+		StartsAt:   request.StartsAt,
+		EndsAt:     request.EndsAt,
+	}, nil
+}
+
+// visibleJob loads the job if the caller posted it, administers the platform or was matched to
+// it, along with the caller's matched services.
+func (j *JobServiceImpl) visibleJob(ctx context.Context, caller *utils.Caller, id int) (*dao.JobPost, []int, error) {
+	job, err := j.JobRepo.GetJobByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	matches, err := j.JobRepo.ServitorMatches(ctx, id, caller.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var matched []int
+	for _, match := range *matches {
+		matched = append(matched, match.ServiceID)
+	}
+	if job.CustomerID != caller.ID && !caller.IsAdmin() && len(matched) == 0 {
+		return nil, nil, ErrNotMatched
+	}
+	return job, matched, nil
+}
+
+// ownedJob loads the job if the caller posted it or is an administrator.
+func (j *JobServiceImpl) ownedJob(ctx context.Context, caller *utils.Caller, id int) (*dao.JobPost, error) {
+	job, err := j.JobRepo.GetJobByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.CustomerID != caller.ID && !caller.IsAdmin() {
+		return nil, ErrNotJobOwner
+	}
+	return job, nil
+}
+
+func (j *JobServiceImpl) ownedQuote(ctx context.Context, caller *utils.Caller, id int) (*dao.Quote, error) {
+	quote, err := j.JobRepo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if quote.ServitorID != caller.ID {
+		return nil, ErrNotQuoteOwner
+	}
+	return quote, nil
+}
+
+// compareQuotes orders the quotes and marks the cheapest and earliest pending ones in the job's
+// currency.
+func compareQuotes(job dao.JobPost, quotes []dao.Quote, names map[int]string, order string) QuoteComparisonResponse {
+	res := QuoteComparisonResponse{JobID: job.ID, Currency: job.Currency, Quotes: []ComparedQuote{}}
+	var total int64
+	var earliest time.Time
+	for _, quote := range quotes {
+		if quote.Status != dao.PendingQuote || quote.Currency != job.Currency {
+			continue
+		}
+		if res.Pending == 0 || quote.Price < res.LowestPrice {
+			res.LowestPrice = quote.Price
+		}
+		if quote.Price > res.HighestPrice {
+			res.HighestPrice = quote.Price
+		}
+		if earliest.IsZero() || quote.StartsAt.Before(earliest) {
+			earliest = quote.StartsAt
+		}
+		total += quote.Price
+		res.Pending++
+	}
+	if res.Pending > 0 {
+		res.AveragePrice = total / int64(res.Pending)
+	}
+
+	sort.SliceStable(quotes, func(a, b int) bool {
+		switch order {
+		case "start":
+			return quotes[a].StartsAt.Before(quotes[b].StartsAt)
+		case "created":
+			return quotes[a].ID < quotes[b].ID
+		}
+		return quotes[a].Price < quotes[b].Price
+	})
+	for _, quote := range quotes {
+		comparable := quote.Status == dao.PendingQuote && quote.Currency == job.Currency
+		res.Quotes = append(res.Quotes, ComparedQuote{
+			QuoteResponse: toQuoteResponse(quote),
+			ServiceName:   names[quote.ServiceID],
+			WithinBudget:  quote.Currency == job.Currency && (job.BudgetMax == 0 || quote.Price <= job.BudgetMax),
+			Cheapest:      comparable && quote.Price == res.LowestPrice,
+			Earliest:      comparable && quote.StartsAt.Equal(earliest),
+		})
+	}
+	return res
+}
+
+func toJobResponse(job dao.JobPost, matched []int) JobResponse {
+	res := JobResponse{
+		ID:              job.ID,
+		CustomerID:      job.CustomerID,
+		CategoryID:      job.CategoryID,
+		Title:           job.Title,
+		Description:     job.Description,
+		Address:         job.Address,
+		Latitude:        job.Latitude,
+		Longitude:       job.Longitude,
+		BudgetMin:       job.BudgetMin,
+		BudgetMax:       job.BudgetMax,
+		Currency:        job.Currency,
+		PreferredStart:  job.PreferredStart,
+		Status:          job.Status,
+		Photos:          []JobPhotoResponse{},
+		MatchedServices: matched,
+		CreatedOn:       job.CreatedOn,
+	}
+	for _, photo := range job.Photos {
+		res.Photos = append(res.Photos, toJobPhotoResponse(photo))
+	}
+	return res
+}
+
+func toJobPhotoResponse(photo dao.JobPhoto) JobPhotoResponse {
+	return JobPhotoResponse{ID: photo.ID, Url: photo.Url, Width: photo.Width, Height: photo.Height}
+}
+
+func toQuoteResponse(quote dao.Quote) QuoteResponse {
+	return QuoteResponse{
+		ID:         quote.ID,
+		JobID:      quote.JobID,
+		ServitorID: quote.ServitorID,
+		ServiceID:  quote.ServiceID,
+		Price:      quote.Price,
+		Currency:   quote.Currency,
+		Message:    quote.Message,
+		StartsAt:   quote.StartsAt,
+		EndsAt:     quote.EndsAt,
+		Status:     quote.Status,
+		BookingID:  quote.BookingID,
+		CreatedOn:  quote.CreatedOn,
+	}
+}
@@ -7,15 +7,30 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"os/signal"
+	"servhunt/booking"
+	bookingdao "servhunt/booking/dao"
 	"servhunt/config"
+	"servhunt/dispatch"
+	dispatchdao "servhunt/dispatch/dao"
 	httpdao "servhunt/infra/dao"
 	"servhunt/infra/token"
 	"servhunt/infra/utils"
+	"servhunt/jobs"
+	jobdao "servhunt/jobs/dao"
+	"servhunt/notification"
+	"servhunt/referral"
+	refdao "servhunt/referral/dao"
 	"servhunt/routing"
+	"servhunt/scheduler"
+	schedulerdao "servhunt/scheduler/dao"
+	"servhunt/search"
 	"servhunt/servitorservices"
 	svcdao "servhunt/servitorservices/dao"
+	"servhunt/storage"
 	"servhunt/user"
 	"servhunt/user/dao"
+	"servhunt/verification"
+	verdao "servhunt/verification/dao"
 	"syscall"
 	"time"
 )
@@ -41,21 +56,128 @@ func main() {
 	initRepo := httpdao.InitRepository(initDB)
 	userDao := dao.NewUserRepoImpl(initRepo)
 
-	userService := user.NewUserServiceImpl(userDao, tokenMaker)
+	callerResolver := user.NewCallerResolver(userDao)
+
+	referralDao := refdao.NewReferralRepoImpl(initRepo)
+	referralSvc := referral.NewReferralServiceImpl(referralDao, userDao, conf)
+	referralHandler := referral.NewReferralHandlerImpl(referralSvc)
+	referralRouter := routing.NewReferralRouter(router, referralHandler, tokenMaker, callerResolver)
+	referralRouter.InitReferralRoutes()
+
+	userService := user.NewUserServiceImpl(userDao, tokenMaker, referralSvc)
 	userHandler := user.NewUsersHandlerImpl(userService)
-	userRouter := routing.NewUserRouter(router, userHandler, tokenMaker)
+	userRouter := routing.NewUserRouter(router, userHandler, tokenMaker, callerResolver)
 	userRouter.InitUserRoutes()
 
 	servDao := svcdao.NewServiceRepoImpl(initRepo)
-	servitorSvc := servitorservices.NewServitorSvc(servDao)
+	var searchIndex search.SearchIndex
+	if conf.Search.Backend == "memory" {
+		searchIndex = search.NewMemoryIndex()
+	} else {
+		searchIndex = search.NewMySQLIndex(initRepo)
+	}
+	var blobStore, documentStore storage.BlobStore
+	if conf.Storage.Backend == "memory" {
+		blobStore = storage.NewMemoryStore(conf.Storage.BaseURL)
+		documentStore = storage.NewMemoryStore("")
+	} else {
+		blobStore = storage.NewFileSystemStore(conf.Storage.Root, conf.Storage.BaseURL)
+		router.Static("/media", conf.Storage.Root)
+		// identity documents are never served statically
+		documentStore = storage.NewFileSystemStore(conf.Storage.PrivateRoot, "")
+	}
+	bookingDao := bookingdao.NewBookingRepoImpl(initRepo)
+	notifier := notification.NewNotifierImpl(userService, notification.NewLogSender())
+	// Scheduled tasks such as booking reminders are stored so they survive restarts
+	taskScheduler := scheduler.NewSchedulerImpl(schedulerdao.NewTaskRepoImpl(initRepo),
+		time.Duration(conf.Scheduler.PollSeconds)*time.Second, conf.Scheduler.Workers,
+		time.Duration(conf.Scheduler.LeaseMinutes)*time.Minute)
+	bookingSvc := booking.NewBookingServiceImpl(bookingDao, servDao, referralSvc, notifier, taskScheduler,
+		time.Duration(conf.Bookings.SeriesHorizonDays)*24*time.Hour, conf.Bookings.CalendarFeedURL, blobStore,
+		conf.Bookings.CheckInRadiusMeters, time.Duration(conf.Bookings.RequestTTLHours)*time.Hour,
+		time.Duration(conf.Bookings.StaleAfterHours)*time.Hour,
+		time.Duration(conf.Bookings.WaitlistHoldMinutes)*time.Minute)
+	servitorSvc := servitorservices.NewServitorSvc(servDao, referralSvc, userDao, searchIndex, blobStore, bookingSvc,
+		bookingSvc, conf.Pricing.DefaultCurrency)
 	servitorHandler := servitorservices.NewServitorServicesHandlerImpl(servitorSvc)
-	servitorRouter := routing.NewServitorServicesRouter(router, servitorHandler, tokenMaker)
+	servitorRouter := routing.NewServitorServicesRouter(router, servitorHandler, tokenMaker, callerResolver)
 	servitorRouter.InitServitorServicesRoutes()
 
-	errA := initDB.AutoMigrate(&dao.User{}, &dao.Language{}, &svcdao.Service{}, &svcdao.Location{}, &svcdao.Category{})
+	bookingHandler := booking.NewBookingHandlerImpl(bookingSvc)
+	bookingRouter := routing.NewBookingRouter(router, bookingHandler, tokenMaker, callerResolver)
+	bookingRouter.InitBookingRoutes()
+
+	jobDao := jobdao.NewJobRepoImpl(initRepo)
+	jobSvc := jobs.NewJobServiceImpl(jobDao, servDao, servitorSvc, bookingSvc, blobStore, conf.Pricing.DefaultCurrency)
+	jobHandler := jobs.NewJobHandlerImpl(jobSvc)
+	jobRouter := routing.NewJobRouter(router, jobHandler, tokenMaker, callerResolver)
+	jobRouter.InitJobRoutes()
+
+	dispatchDao := dispatchdao.NewDispatchRepoImpl(initRepo)
+	dispatchSvc := dispatch.NewDispatchServiceImpl(dispatchDao, servDao, servitorSvc, bookingSvc, dispatch.RealClock(),
+		time.Duration(conf.Dispatch.OfferTimeoutSeconds)*time.Second, conf.Dispatch.RadiiKm,
+		time.Duration(conf.Dispatch.PresenceTTLMinutes)*time.Minute)
+	dispatchHandler := dispatch.NewDispatchHandlerImpl(dispatchSvc)
+	dispatchRouter := routing.NewDispatchRouter(router, dispatchHandler, tokenMaker, callerResolver)
+	dispatchRouter.InitDispatchRoutes()
+
+	verificationDao := verdao.NewVerificationRepoImpl(initRepo)
+	verificationSvc := verification.NewVerificationServiceImpl(verificationDao, documentStore)
+	verificationHandler := verification.NewVerificationHandlerImpl(verificationSvc)
+	verificationRouter := routing.NewVerificationRouter(router, verificationHandler, tokenMaker, callerResolver)
+	verificationRouter.InitVerificationRoutes()
+
+	errA := initDB.AutoMigrate(&dao.User{}, &dao.Language{}, &svcdao.Service{}, &svcdao.Location{}, &svcdao.Category{}, &svcdao.CoverageArea{},
+		&svcdao.Package{}, &svcdao.AddOn{}, &svcdao.StatusChange{}, &svcdao.Media{}, &svcdao.MediaRendition{},
+		&svcdao.ServiceVersion{}, &verdao.Document{}, &verdao.StatusHistory{}, &refdao.Referral{}, &refdao.Reward{},
+		&dao.Preference{}, &dao.NotificationPreference{}, &search.ServiceDocument{}, &search.SearchTerm{},
+		&bookingdao.Booking{}, &bookingdao.BookingStatusChange{}, &bookingdao.Schedule{}, &bookingdao.AvailabilityWindow{},
+		&bookingdao.BookingSeries{}, &bookingdao.SeriesConflict{}, &bookingdao.CalendarFeed{},
+		&bookingdao.CalendarSource{}, &bookingdao.BusyPeriod{}, &jobdao.JobPost{}, &jobdao.JobPhoto{},
+		&jobdao.JobMatch{}, &jobdao.Quote{}, &dispatchdao.Presence{}, &dispatchdao.Dispatch{}, &dispatchdao.Offer{},
+		&bookingdao.BookingCheck{}, &bookingdao.BookingPhoto{}, &schedulerdao.Task{},
+		&bookingdao.WaitlistEntry{})
 	if errA != nil {
 		rootLogger.Fatal("An error occurred when running db migrations")
 	}
+	if _, err := servDao.MigrateCategoryTaxonomy(ctx); err != nil {
+		rootLogger.Error("An error occurred when migrating service categories", zap.NamedError("error", err))
+	}
+	if _, err := servDao.BackfillPricing(ctx, conf.Pricing.DefaultCurrency); err != nil {
+		rootLogger.Error("An error occurred when backfilling service prices", zap.NamedError("error", err))
+	}
+	if _, err := servDao.BackfillGeohashes(ctx); err != nil {
+		rootLogger.Error("An error occurred when backfilling location geohashes", zap.NamedError("error", err))
+	}
+	if err := servitorSvc.RebuildSearchIndex(ctx); err != nil {
+		rootLogger.Error("An error occurred when rebuilding the search index", zap.NamedError("error", err))
+	}
+
+	// Permanently remove soft deleted rows once they fall outside the retention window, media goes
+	// first so its blobs are removed before the rows that point at them
+	go httpdao.RunPurgeJob(ctx, time.Duration(conf.Retention.PurgeIntervalHours)*time.Hour,
+		time.Duration(conf.Retention.PurgeAfterDays)*24*time.Hour, userDao,
+		servitorservices.NewMediaPurger(servDao, blobStore), servDao)
+
+	// Book the occurrences of recurring bookings as they come within the series horizon
+	go booking.RunSeriesJob(ctx, bookingSvc, time.Duration(conf.Bookings.SeriesIntervalHours)*time.Hour)
+
+	// Refresh the busy times of calendars servitors subscribed to
+	go booking.RunCalendarSyncJob(ctx, bookingSvc, time.Duration(conf.Bookings.CalendarSyncMinutes)*time.Minute)
+
+	// Offer on-demand jobs to nearby servitors, resuming the dispatches still searching
+	go dispatch.RunDispatcher(ctx, dispatchSvc)
+
+	// Run the scheduled tasks
+	if err := booking.RegisterTasks(ctx, taskScheduler, bookingSvc,
+		time.Duration(conf.Bookings.TaskPlanMinutes)*time.Minute); err != nil {
+		rootLogger.Error("An error occurred when registering the booking tasks", zap.NamedError("error", err))
+	}
+	schedulerDone := make(chan struct{})
+	go func() {
+		taskScheduler.Run(ctx)
+		close(schedulerDone)
+	}()
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", defaultPort),
@@ -83,6 +205,13 @@ func main() {
 		rootLogger.Fatal("Server forced to shutdown: ", zap.NamedError("error", err))
 	}
 
+	// Let the running tasks finish, tasks cut short are run again after the restart
+	select {
+	case <-schedulerDone:
+	case <-time.After(time.Duration(conf.Scheduler.DrainSeconds) * time.Second):
+		rootLogger.Warn("Scheduled tasks did not finish in time")
+	}
+
 	rootLogger.Info("Server exiting")
 }
 
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"servhunt/infra/utils"
+	"servhunt/user"
+	"time"
+)
+
+var logger = utils.GetRootLogger()
+
+// channels are the channels every notification is offered on, users opt out per event and channel.
+var channels = []string{user.EmailChannel, user.SMSChannel, user.PushChannel}
+
+// Message is a notification of an event to a user.
+type Message struct {
+	UserID int
+	Event  string
+	Title  string
+	Body   string
+}
+
+// PreferenceChecker tells whether a user wants an event on a channel at a given time.
+type PreferenceChecker interface {
+	ShouldNotify(ctx context.Context, userId int, eventType string, channel string, at time.Time) (bool, error)
+}
+
+// Sender delivers messages on a channel.
+type Sender interface {
+	Send(ctx context.Context, channel string, message Message) error
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+type NotifierImpl struct {
+	preferences PreferenceChecker
+	sender      Sender
+}
+
+func NewNotifierImpl(preferences PreferenceChecker, sender Sender) Notifier {
+	return &NotifierImpl{preferences: preferences, sender: sender}
+}
+
+// Notify sends the message on every channel the user wants the event on right now. Failing
+// channels are logged, an error is only returned when the message could not be sent on any of
+// them so retrying does not repeat it on the channels that worked.
+func (n *NotifierImpl) Notify(ctx context.Context, message Message) error {
+	var failed error
+	sent := false
+	now := time.Now()
+	for _, channel := range channels {
+		wanted, err := n.preferences.ShouldNotify(ctx, message.UserID, message.Event, channel, now)
+		if err == nil && wanted {
+			if err = n.sender.Send(ctx, channel, message); err == nil {
+				sent = true
+			}
+		}
+		if err != nil {
+			logger.Error("error sending notification", zap.Int("user.id", message.UserID),
+				zap.String("notification.event", message.Event), zap.String("notification.channel", channel),
+				zap.NamedError("error.message", err))
+			if failed == nil {
+				failed = err
+			}
+		}
+	}
+	if sent {
+		return nil
+	}
+	return failed
+}
+
+type logSender struct{}
+
+// NewLogSender writes messages to the log instead of delivering them, for environments without
+// email, SMS or push providers.
+func NewLogSender() Sender {
+	return logSender{}
+}
+
+func (logSender) Send(ctx context.Context, channel string, message Message) error {
+	logger.Info("notification", zap.Int("user.id", message.UserID), zap.String("notification.event", message.Event),
+		zap.String("notification.channel", channel), zap.String("notification.title", message.Title),
+		zap.String("notification.body", message.Body))
+	return nil
+}
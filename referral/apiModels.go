@@ -0,0 +1,31 @@
+package referral
+
+import "time"
+
+type ReferralCodeResponse struct {
+	ReferralCode string `json:"referral_code"`
+}
+
+type ReferralResponse struct {
+	ID               int        `json:"id"`
+	ReferredID       int        `json:"referred_id"`
+	Status           string     `json:"status"`
+	RejectReason     string     `json:"reject_reason,omitempty"`
+	QualifyingAction string     `json:"qualifying_action,omitempty"`
+	QualifiedOn      *time.Time `json:"qualified_on,omitempty"`
+	CreatedOn        time.Time  `json:"created_on"`
+}
+
+type RewardResponse struct {
+	ID         int       `json:"id"`
+	ReferralID int       `json:"referral_id"`
+	Amount     int64     `json:"amount"`
+	Currency   string    `json:"currency"`
+	Reason     string    `json:"reason"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+type RewardsResponse struct {
+	Total   map[string]int64 `json:"total"`
+	Rewards []RewardResponse `json:"rewards"`
+}
@@ -0,0 +1,33 @@
+package dao
+
+import "time"
+
+// Referral statuses, a referral is rewarded once the referred user completes a qualifying action.
+const (
+	PendingStatus  = "pending"
+	RewardedStatus = "rewarded"
+	RejectedStatus = "rejected"
+)
+
+type Referral struct {
+	ID               int        `gorm:"primary_key; auto_increment" json:"id"`
+	ReferrerID       int        `gorm:"index" json:"referrer_id"`
+	ReferredID       int        `gorm:"uniqueIndex" json:"referred_id"`
+	DeviceID         string     `gorm:"type:varchar(256);index" json:"device_id"`
+	Status           string     `gorm:"type:varchar(64)" json:"status"`
+	RejectReason     string     `gorm:"type:varchar(256)" json:"reject_reason"`
+	QualifyingAction string     `gorm:"type:varchar(64)" json:"qualifying_action"`
+	QualifiedOn      *time.Time `json:"qualified_on"`
+	CreatedOn        time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// Reward is a credit owed to a user, Amount is in minor units of Currency.
+type Reward struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	UserID     int       `gorm:"index" json:"user_id"`
+	ReferralID int       `gorm:"index" json:"referral_id"`
+	Amount     int64     `json:"amount"`
+	Currency   string    `gorm:"type:varchar(3)" json:"currency"`
+	Reason     string    `gorm:"type:varchar(256)" json:"reason"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
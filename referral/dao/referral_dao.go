@@ -0,0 +1,101 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"time"
+)
+
+type ReferralRepo interface {
+	SaveReferral(ctx context.Context, referral Referral) (*Referral, error)
+	ReferrerReferrals(ctx context.Context, referrerId int) (*[]Referral, error)
+	CountReferralsFromDevice(ctx context.Context, deviceId string) (int64, error)
+	QualifyReferral(ctx context.Context, referredId int, action string, rewards []Reward) (*Referral, error)
+	UserRewards(ctx context.Context, userId int) (*[]Reward, error)
+}
+
+type ReferralRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewReferralRepoImpl(repo *dao.Repository) ReferralRepo {
+	return &ReferralRepoImpl{repo: repo}
+}
+
+func (r *ReferralRepoImpl) SaveReferral(ctx context.Context, referral Referral) (*Referral, error) {
+	err := r.repo.DB.WithContext(ctx).Model(&Referral{}).Create(&referral).Error
+	if err != nil {
+		return nil, err
+	}
+	return &referral, nil
+}
+
+func (r *ReferralRepoImpl) ReferrerReferrals(ctx context.Context, referrerId int) (*[]Referral, error) {
+	var referrals []Referral
+	err := r.repo.DB.WithContext(ctx).Model(&Referral{}).Where("referrer_id = ?", referrerId).Order("id").Find(&referrals).Error
+	if err != nil {
+		return nil, err
+	}
+	return &referrals, nil
+}
+
+// CountReferralsFromDevice counts the referrals signed up from the device, whoever the referrer was.
+func (r *ReferralRepoImpl) CountReferralsFromDevice(ctx context.Context, deviceId string) (int64, error) {
+	var count int64
+	err := r.repo.DB.WithContext(ctx).Model(&Referral{}).Where("device_id = ?", deviceId).Count(&count).Error
+	return count, err
+}
+
+// QualifyReferral marks the pending referral of the referred user as rewarded and credits the given
+// rewards, rewards without a user are credited to the referrer. It returns gorm.ErrRecordNotFound
+// when there is no pending referral to qualify.
+func (r *ReferralRepoImpl) QualifyReferral(ctx context.Context, referredId int, action string,
+	rewards []Reward) (*Referral, error) {
+	var referral Referral
+	err := r.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Referral{}).
+			Where("referred_id = ? AND status = ?", referredId, PendingStatus).Take(&referral).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		err = tx.Model(&Referral{}).Where("id = ?", referral.ID).Updates(map[string]interface{}{
+			"status":            RewardedStatus,
+			"qualifying_action": action,
+			"qualified_on":      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		for i := range rewards {
+			rewards[i].ReferralID = referral.ID
+			if rewards[i].UserID == 0 {
+				rewards[i].UserID = referral.ReferrerID
+			}
+		}
+		if len(rewards) > 0 {
+			if err = tx.Model(&Reward{}).Create(&rewards).Error; err != nil {
+				return err
+			}
+		}
+		referral.Status = RewardedStatus
+		referral.QualifyingAction = action
+		referral.QualifiedOn = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &referral, nil
+}
+
+func (r *ReferralRepoImpl) UserRewards(ctx context.Context, userId int) (*[]Reward, error) {
+	var rewards []Reward
+	err := r.repo.DB.WithContext(ctx).Model(&Reward{}).Where("user_id = ?", userId).Order("id").Find(&rewards).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rewards, nil
+}
@@ -0,0 +1,54 @@
+package referral
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"servhunt/infra/utils"
+)
+
+type ReferralHandler interface {
+	ReferralCode(ctx *gin.Context)
+	UserReferrals(ctx *gin.Context)
+	UserRewards(ctx *gin.Context)
+}
+
+type ReferralHandlerImpl struct {
+	ReferralService
+}
+
+func NewReferralHandlerImpl(svc ReferralService) ReferralHandler {
+	return &ReferralHandlerImpl{ReferralService: svc}
+}
+
+func (r *ReferralHandlerImpl) ReferralCode(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	code, err := r.ReferralService.ReferralCode(ctx, caller.ID)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Referral code successfully returned", http.StatusOK, true, code)
+}
+
+func (r *ReferralHandlerImpl) UserReferrals(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	referrals, err := r.ReferralService.UserReferrals(ctx, caller.ID)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Referrals successfully returned", http.StatusOK, true, referrals)
+}
+
+func (r *ReferralHandlerImpl) UserRewards(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	rewards, err := r.ReferralService.UserRewards(ctx, caller.ID)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Rewards successfully returned", http.StatusOK, true, rewards)
+}
@@ -0,0 +1,203 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"servhunt/config"
+	"servhunt/infra/utils"
+	"servhunt/referral/dao"
+	userdao "servhunt/user/dao"
+	"unicode"
+)
+
+// Qualifying actions that can trigger a referral reward.
+const (
+	ServiceCreatedAction   = "service_created"
+	BookingCompletedAction = "booking_completed"
+)
+
+// significantPhoneDigits is the number of trailing digits compared when matching phone numbers so
+// that local and international formats of the same number are treated as equal.
+const significantPhoneDigits = 9
+
+var (
+	logger = utils.GetRootLogger()
+)
+
+type ReferralService interface {
+	RegisterSignup(ctx context.Context, referrerId int, referredId int, deviceId string) error
+	RecordQualifyingAction(ctx context.Context, userId int, action string) error
+	ReferralCode(ctx context.Context, userId int) (*ReferralCodeResponse, error)
+	UserReferrals(ctx context.Context, userId int) (*[]ReferralResponse, error)
+	UserRewards(ctx context.Context, userId int) (*RewardsResponse, error)
+}
+
+type ReferralServiceImpl struct {
+	dao.ReferralRepo
+	users  userdao.UserRepo
+	config *config.Config
+}
+
+func NewReferralServiceImpl(repo dao.ReferralRepo, users userdao.UserRepo, conf *config.Config) ReferralService {
+	return &ReferralServiceImpl{
+		ReferralRepo: repo,
+		users:        users,
+		config:       conf,
+	}
+}
+
+// RegisterSignup records the referral of a new account, signups that look like the referrer
+// referring themselves are kept for auditing but rejected so they never earn a reward. A device may
+// only sign up one referral across all referrers, signups without a device id cannot be checked and
+// are rejected too.
+func (r *ReferralServiceImpl) RegisterSignup(ctx context.Context, referrerId int, referredId int,
+	deviceId string) error {
+	referrer, err := r.users.GetUserById(ctx, referrerId)
+	if err != nil {
+		return err
+	}
+	referred, err := r.users.GetUserById(ctx, referredId)
+	if err != nil {
+		return err
+	}
+
+	referral := dao.Referral{
+		ReferrerID: referrerId,
+		ReferredID: referredId,
+		DeviceID:   deviceId,
+		Status:     dao.PendingStatus,
+	}
+	switch {
+	case referrerId == referredId || samePhone(referrer.PhoneNo, referred.PhoneNo):
+		referral.RejectReason = "signed up with the referrer's phone number"
+	case deviceId == "":
+		referral.RejectReason = "signed up without a device id"
+	case deviceId == referrer.DeviceID:
+		referral.RejectReason = "signed up from the referrer's device"
+	default:
+		used, err := r.ReferralRepo.CountReferralsFromDevice(ctx, deviceId)
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			referral.RejectReason = "device already used for another referral"
+		}
+	}
+	if referral.RejectReason != "" {
+		referral.Status = dao.RejectedStatus
+		logger.Warn("referral rejected", zap.Int("referrer.id", referrerId), zap.Int("referred.id", referredId),
+			zap.String("reason", referral.RejectReason))
+	}
+
+	_, err = r.ReferralRepo.SaveReferral(ctx, referral)
+	return err
+}
+
+// RecordQualifyingAction rewards the referral of the user if the action is one of the configured
+// qualifying actions, users without a pending referral are ignored.
+func (r *ReferralServiceImpl) RecordQualifyingAction(ctx context.Context, userId int, action string) error {
+	if !r.isQualifyingAction(action) {
+		return nil
+	}
+	conf := r.config.Referral
+	var rewards []dao.Reward
+	if conf.ReferrerReward > 0 {
+		rewards = append(rewards, dao.Reward{Amount: conf.ReferrerReward, Currency: conf.Currency,
+			Reason: "referred user completed " + action})
+	}
+	if conf.RefereeReward > 0 {
+		rewards = append(rewards, dao.Reward{UserID: userId, Amount: conf.RefereeReward, Currency: conf.Currency,
+			Reason: "completed " + action + " after signing up with a referral"})
+	}
+
+	referral, err := r.ReferralRepo.QualifyReferral(ctx, userId, action, rewards)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("referral rewarded", zap.Int("referral.id", referral.ID), zap.String("action", action))
+	return nil
+}
+
+func (r *ReferralServiceImpl) ReferralCode(ctx context.Context, userId int) (*ReferralCodeResponse, error) {
+	code, err := r.users.AssignReferralCode(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	res := ReferralCodeResponse{ReferralCode: code}
+	return &res, nil
+}
+
+func (r *ReferralServiceImpl) UserReferrals(ctx context.Context, userId int) (*[]ReferralResponse, error) {
+	referrals, err := r.ReferralRepo.ReferrerReferrals(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	var res []ReferralResponse
+	for _, referral := range *referrals {
+		res = append(res, ReferralResponse{
+			ID:               referral.ID,
+			ReferredID:       referral.ReferredID,
+			Status:           referral.Status,
+			RejectReason:     referral.RejectReason,
+			QualifyingAction: referral.QualifyingAction,
+			QualifiedOn:      referral.QualifiedOn,
+			CreatedOn:        referral.CreatedOn,
+		})
+	}
+	return &res, nil
+}
+
+func (r *ReferralServiceImpl) UserRewards(ctx context.Context, userId int) (*RewardsResponse, error) {
+	rewards, err := r.ReferralRepo.UserRewards(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	res := RewardsResponse{Total: map[string]int64{}}
+	for _, reward := range *rewards {
+		res.Total[reward.Currency] += reward.Amount
+		res.Rewards = append(res.Rewards, RewardResponse{
+			ID:         reward.ID,
+			ReferralID: reward.ReferralID,
+			Amount:     reward.Amount,
+			Currency:   reward.Currency,
+			Reason:     reward.Reason,
+			CreatedOn:  reward.CreatedOn,
+		})
+	}
+	return &res, nil
+}
+
+func (r *ReferralServiceImpl) isQualifyingAction(action string) bool {
+	for _, qualifying := range r.config.Referral.QualifyingActions {
+		if qualifying == action {
+			return true
+		}
+	}
+	return false
+}
+
+func samePhone(a string, b string) bool {
+	a, b = phoneDigits(a), phoneDigits(b)
+	if len(a) > significantPhoneDigits {
+		a = a[len(a)-significantPhoneDigits:]
+	}
+	if len(b) > significantPhoneDigits {
+		b = b[len(b)-significantPhoneDigits:]
+	}
+	return a != "" && a == b
+}
+
+func phoneDigits(phone string) string {
+	digits := make([]rune, 0, len(phone))
+	for _, c := range phone {
+		if unicode.IsDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	return string(digits)
+}
@@ -2,23 +2,31 @@ package routing
 
 import (
 	"github.com/gin-gonic/gin"
+	"servhunt/booking"
+	"servhunt/dispatch"
 	"servhunt/infra/token"
 	"servhunt/infra/utils"
+	"servhunt/jobs"
+	"servhunt/referral"
 	"servhunt/servitorservices"
 	"servhunt/user"
+	"servhunt/verification"
 )
 
 type UsersRouter struct {
 	engine *gin.Engine
 	user.UsersHandler
 	token.Maker
+	resolver utils.CallerResolver
 }
 
-func NewUserRouter(engine *gin.Engine, handler user.UsersHandler, tm token.Maker) *UsersRouter {
+func NewUserRouter(engine *gin.Engine, handler user.UsersHandler, tm token.Maker,
+	resolver utils.CallerResolver) *UsersRouter {
 	return &UsersRouter{
 		engine:       engine,
 		UsersHandler: handler,
 		Maker:        tm,
+		resolver:     resolver,
 	}
 }
 
@@ -32,13 +40,22 @@ func (router UsersRouter) InitUserRoutes() {
 		unauthenticated.POST("change-password", router.ChangePassword)
 	}
 
-	v1 := router.engine.Group("/users").Use(utils.AuthMiddleware(router.Maker))
+	v1 := router.engine.Group("/users").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
 	{
 		v1.PUT("/:user_id/update", router.UpdateUserAccount)
 		v1.GET("", router.GetAllUsers)
 		v1.GET("/:user_id", router.GetUserById)
 		v1.GET("/phone/:phone_no", router.GetUserByPhoneNo)
 		v1.GET("/email/:email", router.GetUserByEmail)
+		v1.DELETE("/:user_id", router.DeleteUserAccount)
+		v1.GET("/:user_id/preferences", router.GetPreferences)
+		v1.PUT("/:user_id/preferences", router.UpdatePreferences)
+	}
+
+	admin := router.engine.Group("/admin/users").Use(utils.AuthMiddleware(router.Maker),
+		utils.CallerMiddleware(router.resolver), utils.AdminMiddleware())
+	{
+		admin.PUT("/:user_id/restore", router.RestoreUserAccount)
 	}
 }
 
@@ -46,32 +63,265 @@ type ServitorServicesRouter struct {
 	engine *gin.Engine
 	servitorservices.ServitorServicesHandler
 	token.Maker
+	resolver utils.CallerResolver
 }
 
 func NewServitorServicesRouter(engine *gin.Engine, handler servitorservices.ServitorServicesHandler,
-	tm token.Maker) *ServitorServicesRouter {
+	tm token.Maker, resolver utils.CallerResolver) *ServitorServicesRouter {
 	return &ServitorServicesRouter{
 		engine:                  engine,
 		ServitorServicesHandler: handler,
 		Maker:                   tm,
+		resolver:                resolver,
 	}
 }
 
 func (router ServitorServicesRouter) InitServitorServicesRoutes() {
-	v1 := router.engine.Group("/services").Use(utils.AuthMiddleware(router.Maker))
+	v1 := router.engine.Group("/services").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
 	{
 		v1.POST("", router.CreateService)
 		v1.PUT("/:service_id/update", router.UpdateService)
 		v1.GET("", router.GetAllServices)
+		v1.GET("/search", router.SearchServices)
+		v1.GET("/nearby", router.NearbyServices)
+		v1.GET("/within", router.ServicesWithin)
+		v1.GET("/covering", router.ServicesCovering)
+		v1.POST("/import", router.ImportServices)
+		v1.GET("/export", router.ExportServices)
+		v1.POST("/:service_id/coverage", router.CreateCoverageArea)
+		v1.GET("/:service_id/coverage", router.GetCoverageAreas)
+		v1.DELETE("/coverage/:id", router.DeleteCoverageArea)
+		v1.POST("/:service_id/media", router.UploadMedia)
+		v1.GET("/:service_id/media", router.GetGallery)
+		v1.PUT("/:service_id/media/order", router.ReorderGallery)
+		v1.PUT("/media/:id", router.UpdateMedia)
+		v1.PUT("/media/:id/cover", router.SetCoverMedia)
+		v1.DELETE("/media/:id", router.DeleteMedia)
 		v1.GET("/:service_id", router.GetServiceByID)
+		v1.DELETE("/:service_id", router.DeleteService)
 		v1.GET("/servitors/:user_id", router.ServitorsService)
 		v1.POST("/locations", router.CreateLocationInfo)
 		v1.PUT("/locations/:id", router.UpdateLocationInfo)
+		v1.DELETE("/locations/:id", router.DeleteLocationInfo)
 		v1.GET("/locations", router.GetAllLocations)
 		v1.GET("/locations/:service_id", router.GetServiceLocations)
-		v1.POST("/categories", router.CreateCategory)
-		v1.PUT("/categories/:id/update", router.UpdateCategory)
+		v1.PUT("/:service_id/categories", router.SetServiceCategories)
+		v1.PUT("/:service_id/pricing", router.SetPricing)
+		v1.PUT("/:service_id/cancellation-policy", router.SetCancellationPolicy)
+		v1.POST("/:service_id/quote", router.QuoteService)
+		v1.PUT("/:service_id/status", router.ChangeServiceStatus)
+		v1.GET("/:service_id/status-history", router.GetStatusHistory)
+		v1.GET("/:service_id/history", router.GetServiceHistory)
+		v1.POST("/:service_id/revert", router.RevertService)
 		v1.GET("/categories", router.GetAllCategories)
+		v1.GET("/taxonomy", router.GetCategoryTree)
+		v1.GET("/taxonomy/:id", router.GetCategoryServices)
 		v1.GET("/categories/:service_id", router.GetServiceCategories)
 	}
+
+	admin := router.engine.Group("/admin/services").Use(utils.AuthMiddleware(router.Maker),
+		utils.CallerMiddleware(router.resolver), utils.AdminMiddleware())
+	{
+		admin.GET("/moderation", router.GetModerationQueue)
+		admin.PUT("/:service_id/approve", router.ApproveService)
+		admin.PUT("/:service_id/reject", router.RejectService)
+		admin.PUT("/:service_id/restore", router.RestoreService)
+		admin.PUT("/locations/:id/restore", router.RestoreLocationInfo)
+		admin.POST("/categories", router.CreateCategory)
+		admin.PUT("/categories/:id", router.UpdateCategory)
+		admin.DELETE("/categories/:id", router.DeleteCategory)
+		admin.PUT("/categories/:id/restore", router.RestoreCategory)
+	}
+}
+
+type BookingRouter struct {
+	engine *gin.Engine
+	booking.BookingHandler
+	token.Maker
+	resolver utils.CallerResolver
+}
+
+func NewBookingRouter(engine *gin.Engine, handler booking.BookingHandler, tm token.Maker,
+	resolver utils.CallerResolver) *BookingRouter {
+	return &BookingRouter{
+		engine:         engine,
+		BookingHandler: handler,
+		Maker:          tm,
+		resolver:       resolver,
+	}
+}
+
+func (router BookingRouter) InitBookingRoutes() {
+	// calendar apps cannot log in, the secret token in the feed address authenticates them
+	unauthenticated := router.engine.Group("/calendar")
+	{
+		unauthenticated.GET("/:token", router.CalendarFeed)
+	}
+
+	v1 := router.engine.Group("/bookings").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
+	{
+		v1.POST("", router.RequestBooking)
+		v1.GET("", router.MyBookings)
+		v1.GET("/slots", router.Slots)
+		v1.GET("/schedule", router.GetSchedule)
+		v1.PUT("/schedule", router.SaveSchedule)
+		v1.POST("/series", router.CreateSeries)
+		v1.GET("/series", router.MySeries)
+		v1.GET("/series/:id", router.GetSeries)
+		v1.PUT("/series/:id", router.UpdateSeries)
+		v1.PUT("/series/:id/cancel", router.CancelSeries)
+		v1.GET("/calendar/feed", router.GetCalendarFeed)
+		v1.PUT("/calendar/feed/rotate", router.RotateCalendarFeed)
+		v1.GET("/calendar/sources", router.CalendarSources)
+		v1.POST("/calendar/sources", router.SubscribeCalendar)
+		v1.POST("/calendar/sources/upload", router.UploadCalendar)
+		v1.PUT("/calendar/sources/:id/sync", router.SyncCalendarSource)
+		v1.DELETE("/calendar/sources/:id", router.DeleteCalendarSource)
+		v1.POST("/waitlist", router.JoinWaitlist)
+		v1.GET("/waitlist", router.MyWaitlist)
+		v1.PUT("/waitlist/:id/claim", router.ClaimWaitlistSlot)
+		v1.DELETE("/waitlist/:id", router.LeaveWaitlist)
+		v1.GET("/:id", router.GetBooking)
+		v1.GET("/:id/history", router.BookingHistory)
+		v1.PUT("/:id", router.RescheduleBooking)
+		v1.PUT("/:id/accept", router.AcceptBooking)
+		v1.PUT("/:id/decline", router.DeclineBooking)
+		v1.PUT("/:id/start", router.StartBooking)
+		v1.PUT("/:id/complete", router.CompleteBooking)
+		v1.PUT("/:id/cancel", router.CancelBooking)
+		v1.PUT("/:id/no-show", router.ReportNoShow)
+		v1.PUT("/:id/rating", router.RateBooking)
+		v1.PUT("/:id/check-in", router.CheckIn)
+		v1.PUT("/:id/check-out", router.CheckOut)
+		v1.POST("/:id/photos", router.UploadBookingPhoto)
+		v1.GET("/:id/visit", router.BookingVisit)
+	}
+}
+
+type JobRouter struct {
+	engine *gin.Engine
+	jobs.JobHandler
+	token.Maker
+	resolver utils.CallerResolver
+}
+
+func NewJobRouter(engine *gin.Engine, handler jobs.JobHandler, tm token.Maker,
+	resolver utils.CallerResolver) *JobRouter {
+	return &JobRouter{
+		engine:     engine,
+		JobHandler: handler,
+		Maker:      tm,
+		resolver:   resolver,
+	}
+}
+
+func (router JobRouter) InitJobRoutes() {
+	v1 := router.engine.Group("/jobs").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
+	{
+		v1.POST("", router.CreateJob)
+		v1.GET("", router.MyJobs)
+		v1.GET("/matching", router.MatchingJobs)
+		v1.GET("/quotes", router.MyQuotes)
+		v1.PUT("/quotes/:id", router.UpdateQuote)
+		v1.PUT("/quotes/:id/withdraw", router.WithdrawQuote)
+		v1.PUT("/quotes/:id/accept", router.AcceptQuote)
+		v1.DELETE("/photos/:id", router.DeleteJobPhoto)
+		v1.GET("/:id", router.GetJob)
+		v1.PUT("/:id/close", router.CloseJob)
+		v1.POST("/:id/photos", router.UploadJobPhoto)
+		v1.POST("/:id/quotes", router.SubmitQuote)
+		v1.GET("/:id/quotes", router.CompareQuotes)
+	}
+}
+
+type DispatchRouter struct {
+	engine *gin.Engine
+	dispatch.DispatchHandler
+	token.Maker
+	resolver utils.CallerResolver
+}
+
+func NewDispatchRouter(engine *gin.Engine, handler dispatch.DispatchHandler, tm token.Maker,
+	resolver utils.CallerResolver) *DispatchRouter {
+	return &DispatchRouter{
+		engine:          engine,
+		DispatchHandler: handler,
+		Maker:           tm,
+		resolver:        resolver,
+	}
+}
+
+func (router DispatchRouter) InitDispatchRoutes() {
+	v1 := router.engine.Group("/dispatch").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
+	{
+		v1.POST("", router.RequestDispatch)
+		v1.GET("", router.MyDispatches)
+		v1.PUT("/presence", router.SetPresence)
+		v1.GET("/offers", router.PendingOffers)
+		v1.PUT("/offers/:id/accept", router.AcceptOffer)
+		v1.PUT("/offers/:id/decline", router.DeclineOffer)
+		v1.GET("/:id", router.GetDispatch)
+		v1.PUT("/:id/cancel", router.CancelDispatch)
+	}
+}
+
+type VerificationRouter struct {
+	engine *gin.Engine
+	verification.VerificationHandler
+	token.Maker
+	resolver utils.CallerResolver
+}
+
+func NewVerificationRouter(engine *gin.Engine, handler verification.VerificationHandler, tm token.Maker,
+	resolver utils.CallerResolver) *VerificationRouter {
+	return &VerificationRouter{
+		engine:              engine,
+		VerificationHandler: handler,
+		Maker:               tm,
+		resolver:            resolver,
+	}
+}
+
+func (router VerificationRouter) InitVerificationRoutes() {
+	v1 := router.engine.Group("/verifications").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
+	{
+		v1.POST("/documents", router.SubmitDocument)
+		v1.GET("/documents", router.MyDocuments)
+		v1.GET("/documents/:id/file", router.DocumentFile)
+		v1.GET("/documents/:id/history", router.DocumentHistory)
+	}
+
+	admin := router.engine.Group("/admin/verifications").Use(utils.AuthMiddleware(router.Maker),
+		utils.CallerMiddleware(router.resolver), utils.AdminMiddleware())
+	{
+		admin.GET("", router.ReviewQueue)
+		admin.PUT("/:id/approve", router.ApproveDocument)
+		admin.PUT("/:id/reject", router.RejectDocument)
+	}
+}
+
+type ReferralRouter struct {
+	engine *gin.Engine
+	referral.ReferralHandler
+	token.Maker
+	resolver utils.CallerResolver
+}
+
+func NewReferralRouter(engine *gin.Engine, handler referral.ReferralHandler, tm token.Maker,
+	resolver utils.CallerResolver) *ReferralRouter {
+	return &ReferralRouter{
+		engine:          engine,
+		ReferralHandler: handler,
+		Maker:           tm,
+		resolver:        resolver,
+	}
+}
+
+func (router ReferralRouter) InitReferralRoutes() {
+	v1 := router.engine.Group("/referrals").Use(utils.AuthMiddleware(router.Maker), utils.CallerMiddleware(router.resolver))
+	{
+		v1.GET("", router.UserReferrals)
+		v1.GET("/code", router.ReferralCode)
+		v1.GET("/rewards", router.UserRewards)
+	}
 }
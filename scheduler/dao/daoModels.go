@@ -0,0 +1,32 @@
+package dao
+
+import "time"
+
+// Statuses of a task, done and failed are final. Recurring tasks go back to pending after each run.
+const (
+	PendingStatus = "pending"
+	RunningStatus = "running"
+	DoneStatus    = "done"
+	FailedStatus  = "failed"
+)
+
+// Task is a unit of background work due at RunAt. Name identifies the task so scheduling the same
+// work twice keeps a single task, Payload is the JSON encoded input of its handler. A running task
+// is leased until LockedUntil, after which another worker may pick it up again.
+type Task struct {
+	ID          int       `gorm:"primary_key; auto_increment" json:"id"`
+	Kind        string    `gorm:"type:varchar(64);index" json:"kind"`
+	Name        string    `gorm:"type:varchar(191);uniqueIndex" json:"name"`
+	Payload     string    `gorm:"type:text" json:"payload"`
+	Status      string    `gorm:"type:varchar(16);index:idx_task_due" json:"status"`
+	RunAt       time.Time `gorm:"index:idx_task_due" json:"run_at"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	// IntervalSeconds makes the task recurring, it is run again that long after each run
+	IntervalSeconds int        `json:"interval_seconds"`
+	LockedUntil     *time.Time `json:"locked_until"`
+	LastError       string     `gorm:"type:varchar(512)" json:"last_error"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	CreatedOn       time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
@@ -0,0 +1,116 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"time"
+)
+
+// ErrLeaseLost is returned when finishing a task whose lease ran out and which was claimed again.
+var ErrLeaseLost = errors.New("the task was claimed again after its lease ran out")
+
+type TaskRepo interface {
+	CreateTask(ctx context.Context, task Task) (bool, error)
+	SaveRecurringTask(ctx context.Context, task Task) error
+	ClaimDueTasks(ctx context.Context, now time.Time, lease time.Duration, limit int) (*[]Task, error)
+	FinishTask(ctx context.Context, task Task, attempt int) error
+	DeleteFinishedTasks(ctx context.Context, before time.Time) (int64, error)
+}
+
+type TaskRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewTaskRepoImpl(repo *dao.Repository) TaskRepo {
+	return &TaskRepoImpl{repo: repo}
+}
+
+// CreateTask stores the task unless a task with the same name exists already, reporting whether it
+// was created.
+func (t *TaskRepoImpl) CreateTask(ctx context.Context, task Task) (bool, error) {
+	res := t.repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Model(&Task{}).Create(&task)
+	return res.RowsAffected > 0, res.Error
+}
+
+// SaveRecurringTask stores the recurring task or updates the interval of the stored one, leaving
+// when it runs next alone.
+func (t *TaskRepoImpl) SaveRecurringTask(ctx context.Context, task Task) error {
+	return t.repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"interval_seconds", "max_attempts"}),
+	}).Model(&Task{}).Create(&task).Error
+}
+
+// ClaimDueTasks leases up to limit tasks that are due, along with running tasks whose lease ran
+// out, and counts the attempt. Rows locked by other workers are skipped so concurrent workers never
+// claim the same task.
+func (t *TaskRepoImpl) ClaimDueTasks(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) (*[]Task, error) {
+	var tasks []Task
+	err := t.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Model(&Task{}).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)",
+				PendingStatus, now, RunningStatus, now).
+			Order("run_at").Limit(limit).Find(&tasks).Error
+		if err != nil || len(tasks) == 0 {
+			return err
+		}
+		lockedUntil := now.Add(lease)
+		for i := range tasks {
+			tasks[i].Status = RunningStatus
+			tasks[i].Attempts++
+			tasks[i].LockedUntil = &lockedUntil
+			err = tx.Model(&Task{}).Where("id = ?", tasks[i].ID).Updates(map[string]interface{}{
+				"status":          RunningStatus,
+				"attempts":        tasks[i].Attempts,
+				"locked_until":    lockedUntil,
+				"last_updated_on": now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tasks, nil
+}
+
+// FinishTask stores the outcome of a run, the status, next run, attempts and error of the task,
+// and releases its lease. attempt is the attempt the task was claimed for, the outcome is dropped
+// with ErrLeaseLost when the task was claimed again since.
+func (t *TaskRepoImpl) FinishTask(ctx context.Context, task Task, attempt int) error {
+	res := t.repo.DB.WithContext(ctx).Model(&Task{}).
+		Where("id = ? AND status = ? AND attempts = ?", task.ID, RunningStatus, attempt).
+		Updates(map[string]interface{}{
+			"status":          task.Status,
+			"run_at":          task.RunAt,
+			"attempts":        task.Attempts,
+			"last_error":      task.LastError,
+			"completed_at":    task.CompletedAt,
+			"locked_until":    nil,
+			"last_updated_on": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// DeleteFinishedTasks removes the done and failed tasks last updated before the given time.
+func (t *TaskRepoImpl) DeleteFinishedTasks(ctx context.Context, before time.Time) (int64, error) {
+	res := t.repo.DB.WithContext(ctx).Where("status IN ? AND last_updated_on < ?",
+		[]string{DoneStatus, FailedStatus}, before).Delete(&Task{})
+	return res.RowsAffected, res.Error
+}
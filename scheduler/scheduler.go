@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"servhunt/infra/utils"
+	"servhunt/scheduler/dao"
+	"sync"
+	"time"
+)
+
+// Defaults used when the scheduler is created without its settings.
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultWorkers      = 4
+	DefaultLease        = 5 * time.Minute
+	DefaultMaxAttempts  = 5
+)
+
+const (
+	// maxBackoff bounds the wait before a failed task is tried again.
+	maxBackoff = time.Hour
+
+	// purgeTask removes finished tasks once they are older than finishedRetention.
+	purgeTask         = "scheduler.purge"
+	purgeInterval     = 24 * time.Hour
+	finishedRetention = 7 * 24 * time.Hour
+)
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrUnknownTask = errors.New("no handler is registered for the task")
+)
+
+// Handler runs a task given its JSON encoded payload. Returning an error tries the task again later
+// until it runs out of attempts, so handlers must cope with running more than once.
+type Handler func(ctx context.Context, payload []byte) error
+
+// TaskScheduler schedules background work to run at a given time.
+type TaskScheduler interface {
+	Schedule(ctx context.Context, kind string, name string, runAt time.Time, payload interface{}) error
+}
+
+type Scheduler interface {
+	TaskScheduler
+	Handle(kind string, handler Handler)
+	Every(ctx context.Context, kind string, interval time.Duration) error
+	Run(ctx context.Context)
+}
+
+type SchedulerImpl struct {
+	dao.TaskRepo
+	pollInterval time.Duration
+	workers      int
+	lease        time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewSchedulerImpl creates the scheduler. Due tasks are looked for every pollInterval and run by up
+// to workers at a time, each may run for at most lease before another worker picks it up again.
+// Settings left at zero take their defaults.
+func NewSchedulerImpl(repo dao.TaskRepo, pollInterval time.Duration, workers int, lease time.Duration) Scheduler {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	s := &SchedulerImpl{TaskRepo: repo, pollInterval: pollInterval, workers: workers, lease: lease,
+		handlers: map[string]Handler{}}
+	s.Handle(purgeTask, s.purge)
+	return s
+}
+
+// Handle registers the handler running tasks of the kind.
+func (s *SchedulerImpl) Handle(kind string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[kind] = handler
+}
+
+// Schedule stores a task to run at runAt with the payload, encoded as JSON. Scheduling a task under
+// a name that is taken already keeps the existing task.
+func (s *SchedulerImpl) Schedule(ctx context.Context, kind string, name string, runAt time.Time,
+	payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.TaskRepo.CreateTask(ctx, dao.Task{
+		Kind:        kind,
+		Name:        name,
+		Payload:     string(data),
+		Status:      dao.PendingStatus,
+		RunAt:       runAt,
+		MaxAttempts: DefaultMaxAttempts,
+	})
+	return err
+}
+
+// Every runs tasks of the kind once every interval, starting right away the first time. Failed runs
+// are not retried, the task simply runs again at its next interval.
+func (s *SchedulerImpl) Every(ctx context.Context, kind string, interval time.Duration) error {
+	return s.TaskRepo.SaveRecurringTask(ctx, dao.Task{
+		Kind:            kind,
+		Name:            kind,
+		Payload:         "null",
+		Status:          dao.PendingStatus,
+		RunAt:           time.Now(),
+		MaxAttempts:     1,
+		IntervalSeconds: int(interval / time.Second),
+	})
+}
+
+// Run runs due tasks until the context is cancelled, then stops picking up tasks and waits for the
+// running ones to finish. Tasks left unfinished, for instance when the process is killed, are run
+// again once their lease runs out.
+func (s *SchedulerImpl) Run(ctx context.Context) {
+	if err := s.Every(ctx, purgeTask, purgeInterval); err != nil {
+		logger.Error("error scheduling task purge", zap.NamedError("error.message", err))
+	}
+	slots := make(chan struct{}, s.workers)
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+		free := s.workers - len(slots)
+		if free == 0 {
+			continue
+		}
+		tasks, err := s.TaskRepo.ClaimDueTasks(ctx, time.Now(), s.lease, free)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("error claiming due tasks", zap.NamedError("error.message", err))
+			}
+			continue
+		}
+		for _, task := range *tasks {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(task dao.Task) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.run(task)
+			}(task)
+		}
+	}
+}
+
+// run runs the task and stores the outcome. Tasks run under their own context rather than the
+// scheduler's so shutting down lets them finish, their lease bounds how long they may take.
+func (s *SchedulerImpl) run(task dao.Task) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.lease)
+	defer cancel()
+	err := s.handle(ctx, task)
+
+	attempt := task.Attempts
+	now := time.Now()
+	task.LastError = ""
+	switch {
+	case task.IntervalSeconds > 0:
+		task.Status = dao.PendingStatus
+		task.RunAt = now.Add(time.Duration(task.IntervalSeconds) * time.Second)
+		task.Attempts = 0
+		task.CompletedAt = &now
+	case err == nil:
+		task.Status = dao.DoneStatus
+		task.CompletedAt = &now
+	case errors.Is(err, ErrUnknownTask) || task.Attempts >= task.MaxAttempts:
+		task.Status = dao.FailedStatus
+	default:
+		task.Status = dao.PendingStatus
+		task.RunAt = now.Add(backoff(task.Attempts))
+	}
+	if err != nil {
+		logger.Error("error running task", zap.String("task.kind", task.Kind), zap.String("task.name", task.Name),
+			zap.Int("task.attempt", attempt), zap.NamedError("error.message", err))
+		task.LastError = truncate(err.Error(), 512)
+	}
+	if err = s.TaskRepo.FinishTask(context.Background(), task, attempt); err != nil {
+		logger.Error("error saving task outcome", zap.String("task.name", task.Name),
+			zap.NamedError("error.message", err))
+	}
+}
+
+// handle passes the task to its handler, turning a panic into an error so one bad task does not
+// take the process down.
+func (s *SchedulerImpl) handle(ctx context.Context, task dao.Task) (err error) {
+	s.mu.RLock()
+	handler, ok := s.handlers[task.Kind]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTask, task.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return handler(ctx, []byte(task.Payload))
+}
+
+// purge removes finished tasks past their retention.
+func (s *SchedulerImpl) purge(ctx context.Context, _ []byte) error {
+	count, err := s.TaskRepo.DeleteFinishedTasks(ctx, time.Now().Add(-finishedRetention))
+	if err != nil {
+		return err
+	}
+	logger.Info("purged finished tasks", zap.Int64("task.count", count))
+	return nil
+}
+
+// backoff is the wait before the next attempt of a task that failed attempts times, doubling from a
+// minute up to maxBackoff.
+func backoff(attempts int) time.Duration {
+	wait := time.Minute
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,240 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Field weights used when ranking hits, a match in the service name counts more than a match in
+// the servitor's description.
+const (
+	ServiceNameWeight = 3.0
+	CategoryWeight    = 2.0
+	LocationWeight    = 1.5
+	DescriptionWeight = 1.0
+
+	// fuzzyPenalty scales the score of terms that only matched through typo correction.
+	fuzzyPenalty = 0.7
+
+	// MinTokenLength is the shortest word indexed, it matches InnoDB's default innodb_ft_min_token_size
+	// so the MySQL and in-memory indexes see the same words.
+	MinTokenLength = 3
+)
+
+// Highlighted fields, matched terms are wrapped in HighlightPre and HighlightPost.
+const (
+	ServiceNameField = "service_name"
+	CategoriesField  = "categories"
+	LocationsField   = "locations"
+	DescriptionField = "description"
+
+	HighlightPre  = "<em>"
+	HighlightPost = "</em>"
+)
+
+// Document is the searchable projection of a service.
+type Document struct {
+	ServiceID   int
+	ServiceName string
+	Categories  []string
+	Locations   []string
+	Description string
+}
+
+// Hit is a service matching a query, Highlights holds the matching fields with the matched terms marked.
+type Hit struct {
+	ServiceID  int
+	Score      float64
+	Highlights map[string]string
+}
+
+// SearchIndex indexes services and answers ranked, typo tolerant full text queries over them.
+type SearchIndex interface {
+	Index(ctx context.Context, document Document) error
+	Remove(ctx context.Context, serviceId int) error
+	Search(ctx context.Context, query string, limit int) ([]Hit, error)
+}
+
+// fields returns the text of the document keyed by highlighted field name.
+func (d Document) fields() map[string]string {
+	return map[string]string{
+		ServiceNameField: d.ServiceName,
+		CategoriesField:  strings.Join(d.Categories, ", "),
+		LocationsField:   strings.Join(d.Locations, ", "),
+		DescriptionField: d.Description,
+	}
+}
+
+// Tokenize lower cases the text and splits it into words of at least MinTokenLength letters or digits.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) >= MinTokenLength {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// maxEdits is the number of typos tolerated for a term, short terms must match exactly.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// vocabulary tracks every term of an in-process index so query terms can be corrected to terms that exist.
+type vocabulary struct {
+	mu    sync.RWMutex
+	terms map[string]int
+}
+
+func newVocabulary() *vocabulary {
+	return &vocabulary{terms: map[string]int{}}
+}
+
+func (v *vocabulary) add(terms []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, term := range terms {
+		v.terms[term]++
+	}
+}
+
+func (v *vocabulary) remove(terms []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, term := range terms {
+		if v.terms[term]--; v.terms[term] <= 0 {
+			delete(v.terms, term)
+		}
+	}
+}
+
+// expand returns the indexed terms that match the query term exactly or within its typo budget,
+// mapped to true for exact matches and false for corrected ones.
+func (v *vocabulary) expand(term string) map[string]bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	candidates := make([]string, 0, len(v.terms))
+	for candidate := range v.terms {
+		candidates = append(candidates, candidate)
+	}
+	return matchTerms(term, candidates)
+}
+
+// matchTerms keeps the candidates that match the term exactly or within its typo budget, mapped to
+// true for the exact match and false for corrected ones. Corrections keep the first letter of the
+// term, so the vocabulary can be narrowed down by initial before comparing.
+func matchTerms(term string, candidates []string) map[string]bool {
+	matches := map[string]bool{}
+	edits := maxEdits(term)
+	for _, candidate := range candidates {
+		if candidate == term {
+			matches[candidate] = true
+		} else if edits > 0 && initial(candidate) == initial(term) && withinDistance(term, candidate, edits) {
+			matches[candidate] = false
+		}
+	}
+	return matches
+}
+
+// initial returns the first letter of the term.
+func initial(term string) string {
+	for _, r := range term {
+		return string(r)
+	}
+	return ""
+}
+
+// withinDistance reports whether the Levenshtein distance between a and b is at most max.
+func withinDistance(a string, b string, max int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return false
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > max {
+			return false
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)] <= max
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// highlight marks every word of the text whose token is one of the matched terms.
+func highlight(text string, matched map[string]bool) (string, bool) {
+	var sb strings.Builder
+	found := false
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if matched[strings.ToLower(string(word))] {
+			sb.WriteString(HighlightPre + string(word) + HighlightPost)
+			found = true
+		} else {
+			sb.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		sb.WriteRune(r)
+	}
+	flush()
+	return sb.String(), found
+}
+
+// highlights returns the fields of the document that contain any of the matched terms.
+func highlights(document Document, matched map[string]bool) map[string]string {
+	res := map[string]string{}
+	for field, text := range document.fields() {
+		if marked, ok := highlight(text, matched); ok {
+			res[field] = marked
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+// MemoryIndex is an in-process inverted index, it is meant for tests and local development.
+type MemoryIndex struct {
+	mu        sync.RWMutex
+	documents map[int]Document
+	postings  map[string]map[int]float64
+	vocab     *vocabulary
+}
+
+func NewMemoryIndex() SearchIndex {
+	return &MemoryIndex{
+		documents: map[int]Document{},
+		postings:  map[string]map[int]float64{},
+		vocab:     newVocabulary(),
+	}
+}
+
+func (m *MemoryIndex) Index(ctx context.Context, document Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(document.ServiceID)
+
+	weighted := map[string]float64{}
+	addField := func(text string, weight float64) {
+		for _, term := range Tokenize(text) {
+			weighted[term] += weight
+		}
+	}
+	addField(document.ServiceName, ServiceNameWeight)
+	for _, category := range document.Categories {
+		addField(category, CategoryWeight)
+	}
+	for _, location := range document.Locations {
+		addField(location, LocationWeight)
+	}
+	addField(document.Description, DescriptionWeight)
+
+	terms := make([]string, 0, len(weighted))
+	for term, weight := range weighted {
+		if m.postings[term] == nil {
+			m.postings[term] = map[int]float64{}
+		}
+		m.postings[term][document.ServiceID] = weight
+		terms = append(terms, term)
+	}
+	m.vocab.add(terms)
+	m.documents[document.ServiceID] = document
+	return nil
+}
+
+func (m *MemoryIndex) Remove(ctx context.Context, serviceId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(serviceId)
+	return nil
+}
+
+// Search ranks documents with a weighted tf-idf score, every query term contributes the score of
+// its best matching indexed term.
+func (m *MemoryIndex) Search(ctx context.Context, query string, limit int) ([]Hit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := map[int]float64{}
+	matched := map[int]map[string]bool{}
+	total := float64(len(m.documents))
+	for _, term := range Tokenize(query) {
+		best := map[int]float64{}
+		for candidate, exact := range m.vocab.expand(term) {
+			postings := m.postings[candidate]
+			idf := math.Log(1 + total/float64(len(postings)))
+			for id, weight := range postings {
+				score := idf * weight / (weight + 1.2)
+				if !exact {
+					score *= fuzzyPenalty
+				}
+				if score > best[id] {
+					best[id] = score
+				}
+				if matched[id] == nil {
+					matched[id] = map[string]bool{}
+				}
+				matched[id][candidate] = true
+			}
+		}
+		for id, score := range best {
+			scores[id] += score
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{
+			ServiceID:  id,
+			Score:      score,
+			Highlights: highlights(m.documents[id], matched[id]),
+		})
+	}
+	sortHits(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (m *MemoryIndex) remove(serviceId int) {
+	if _, ok := m.documents[serviceId]; !ok {
+		return
+	}
+	var terms []string
+	for term, postings := range m.postings {
+		if _, ok := postings[serviceId]; !ok {
+			continue
+		}
+		terms = append(terms, term)
+		delete(postings, serviceId)
+		if len(postings) == 0 {
+			delete(m.postings, term)
+		}
+	}
+	m.vocab.remove(terms)
+	delete(m.documents, serviceId)
+}
+
+// sortHits orders hits by descending score, ties are broken by service id for stable pagination.
+func sortHits(hits []Hit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ServiceID < hits[j].ServiceID
+	})
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func testIndex(t *testing.T) SearchIndex {
+	t.Helper()
+	index := NewMemoryIndex()
+	documents := []Document{
+		{ServiceID: 1, ServiceName: "Emergency Plumber", Categories: []string{"Plumbing"},
+			Locations: []string{"Nairobi"}, Description: "Leaking pipes and blocked drains fixed fast."},
+		{ServiceID: 2, ServiceName: "House Cleaning", Categories: []string{"Cleaning"},
+			Locations: []string{"Mombasa"}, Description: "Weekly cleaning, we also refer you to a plumber."},
+		{ServiceID: 3, ServiceName: "Certified Electrician", Categories: []string{"Electrical"},
+			Locations: []string{"Nairobi"}, Description: "Wiring, sockets and lighting."},
+		{ServiceID: 4, ServiceName: "Garden Care", Categories: []string{"Gardening"},
+			Locations: []string{"Kisumu"}, Description: "Lawn mowing and hedge trimming."},
+	}
+	for _, document := range documents {
+		if err := index.Index(context.Background(), document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func hitIDs(hits []Hit) []int {
+	ids := []int{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ServiceID)
+	}
+	return ids
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []int
+	}{
+		{name: "name match outranks description match", query: "plumber", want: []int{1, 2}},
+		{name: "location matches", query: "nairobi", want: []int{1, 3}},
+		{name: "more matched terms rank higher", query: "nairobi electrician", want: []int{3, 1}},
+		{name: "limit cuts the ranking", query: "plumber", limit: 1, want: []int{1}},
+		{name: "one typo in a medium term", query: "plumbr", want: []int{1, 2}},
+		{name: "two typos in a long term", query: "electricain", want: []int{3}},
+		{name: "short terms must match exactly", query: "lwn", want: []int{}},
+		{name: "too many typos", query: "plmbr", want: []int{}},
+		{name: "typos in the first letter are not corrected", query: "qlumber", want: []int{}},
+		{name: "case and punctuation are ignored", query: "GARDEN-care!", want: []int{4}},
+		{name: "no terms", query: "a ?", want: []int{}},
+	}
+	index := testIndex(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := index.Search(context.Background(), tt.query, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hitIDs(hits); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexCorrectedTermsScoreLower(t *testing.T) {
+	index := NewMemoryIndex()
+	ctx := context.Background()
+	for _, document := range []Document{
+		{ServiceID: 1, ServiceName: "Painter"},
+		{ServiceID: 2, ServiceName: "Printer repair"},
+	} {
+		if err := index.Index(ctx, document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hits, err := index.Search(ctx, "painter", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(hits); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("Search(painter) = %v, want the exact match first", got)
+	}
+	if hits[1].Score >= hits[0].Score {
+		t.Errorf("corrected match scored %v, not below exact match %v", hits[1].Score, hits[0].Score)
+	}
+}
+
+func TestMemoryIndexHighlights(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		id    int
+		want  map[string]string
+	}{
+		{
+			name:  "exact match keeps the original case",
+			query: "plumber",
+			id:    1,
+			want:  map[string]string{ServiceNameField: "Emergency <em>Plumber</em>"},
+		},
+		{
+			name:  "corrected match highlights the indexed word",
+			query: "drans",
+			id:    1,
+			want:  map[string]string{DescriptionField: "Leaking pipes and blocked <em>drains</em> fixed fast."},
+		},
+		{
+			name:  "every matching field is highlighted",
+			query: "cleaning",
+			id:    2,
+			want: map[string]string{
+				ServiceNameField: "House <em>Cleaning</em>",
+				CategoriesField:  "<em>Cleaning</em>",
+				DescriptionField: "Weekly <em>cleaning</em>, we also refer you to a plumber.",
+			},
+		},
+	}
+	index := testIndex(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := index.Search(context.Background(), tt.query, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, hit := range hits {
+				if hit.ServiceID == tt.id {
+					if !reflect.DeepEqual(hit.Highlights, tt.want) {
+						t.Errorf("highlights = %v, want %v", hit.Highlights, tt.want)
+					}
+					return
+				}
+			}
+			t.Fatalf("service %d not found for %q", tt.id, tt.query)
+		})
+	}
+}
+
+func TestMemoryIndexUpdatesAndRemovals(t *testing.T) {
+	index := testIndex(t)
+	ctx := context.Background()
+	if err := index.Index(ctx, Document{ServiceID: 4, ServiceName: "Pool Cleaning"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Remove(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{query: "garden", want: []int{}},
+		{query: "pool", want: []int{4}},
+		{query: "emergency", want: []int{}},
+		// the removed service's terms no longer correct typos
+		{query: "emergncy", want: []int{}},
+		{query: "plumber", want: []int{2}},
+	}
+	for _, tt := range tests {
+		hits, err := index.Search(ctx, tt.query, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(hits); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Emergency Plumber", []string{"emergency", "plumber"}},
+		{"Fix my AC in 2 hrs", []string{"fix", "hrs"}},
+		{"24/7 call-out", []string{"call", "out"}},
+		{"Café à Paris", []string{"café", "paris"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWithinDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want bool
+	}{
+		{"plumber", "plumber", 0, true},
+		{"plumbr", "plumber", 1, true},
+		{"plmbr", "plumber", 1, false},
+		{"electricain", "electrician", 2, true},
+		{"kitten", "sitting", 2, false},
+		{"kitten", "sitting", 3, true},
+		{"café", "cafe", 1, true},
+	}
+	for _, tt := range tests {
+		if got := withinDistance(tt.a, tt.b, tt.max); got != tt.want {
+			t.Errorf("withinDistance(%q, %q, %d) = %v, want %v", tt.a, tt.b, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	"strings"
+)
+
+// ServiceDocument is the denormalised row the MySQL index matches against, every searchable
+// column carries its own FULLTEXT index so matches can be weighted per field.
+type ServiceDocument struct {
+	ServiceID   int    `gorm:"primary_key" json:"service_id"`
+	ServiceName string `gorm:"type:text;index:idx_search_service_name,class:FULLTEXT" json:"service_name"`
+	Categories  string `gorm:"type:text;index:idx_search_categories,class:FULLTEXT" json:"categories"`
+	Locations   string `gorm:"type:text;index:idx_search_locations,class:FULLTEXT" json:"locations"`
+	Description string `gorm:"type:text;index:idx_search_description,class:FULLTEXT" json:"description"`
+}
+
+// SearchTerm counts the indexed documents containing a term. The terms are the vocabulary query
+// terms are corrected against, kept in the database so every instance corrects against the same one.
+type SearchTerm struct {
+	Term      string `gorm:"primary_key;type:varchar(191) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin" json:"term"`
+	Initial   string `gorm:"type:varchar(1) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;index:idx_search_term_initial" json:"initial"`
+	Length    int    `gorm:"index;index:idx_search_term_initial" json:"length"`
+	Documents int    `json:"documents"`
+}
+
+type scoredDocument struct {
+	ServiceDocument
+	Score float64
+}
+
+// MySQLIndex answers queries with MySQL FULLTEXT boolean mode searches, query terms are corrected
+// against the indexed vocabulary first because FULLTEXT matching has no typo tolerance of its own.
+type MySQLIndex struct {
+	repo *dao.Repository
+}
+
+func NewMySQLIndex(repo *dao.Repository) SearchIndex {
+	return &MySQLIndex{repo: repo}
+}
+
+// Index stores the document and moves the term counts from its previous version to the new one,
+// the document row stays locked meanwhile so concurrent indexing of a service counts it once.
+func (m *MySQLIndex) Index(ctx context.Context, document Document) error {
+	row := ServiceDocument{
+		ServiceID:   document.ServiceID,
+		ServiceName: document.ServiceName,
+		Categories:  strings.Join(document.Categories, ", "),
+		Locations:   strings.Join(document.Locations, ", "),
+		Description: document.Description,
+	}
+	return m.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		previous, err := lockDocument(tx, document.ServiceID)
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Model(&ServiceDocument{}).Create(&row).Error
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			if err = countTerms(tx, uniqueTerms(*previous), -1); err != nil {
+				return err
+			}
+		}
+		return countTerms(tx, uniqueTerms(row), 1)
+	})
+}
+
+func (m *MySQLIndex) Remove(ctx context.Context, serviceId int) error {
+	return m.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		previous, err := lockDocument(tx, serviceId)
+		if err != nil || previous == nil {
+			return err
+		}
+		if err = tx.Where("service_id = ?", serviceId).Delete(&ServiceDocument{}).Error; err != nil {
+			return err
+		}
+		return countTerms(tx, uniqueTerms(*previous), -1)
+	})
+}
+
+func (m *MySQLIndex) Search(ctx context.Context, query string, limit int) ([]Hit, error) {
+	var terms []string
+	matched := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		candidates, err := m.expand(ctx, term)
+		if err != nil {
+			return nil, err
+		}
+		for candidate, exact := range candidates {
+			matched[candidate] = true
+			if exact {
+				terms = append(terms, ">"+candidate)
+			} else {
+				terms = append(terms, "<"+candidate)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return []Hit{}, nil
+	}
+
+	against := strings.Join(terms, " ")
+	score := fmt.Sprintf("%g * MATCH(service_name) AGAINST(@q IN BOOLEAN MODE) + "+
+		"%g * MATCH(categories) AGAINST(@q IN BOOLEAN MODE) + "+
+		"%g * MATCH(locations) AGAINST(@q IN BOOLEAN MODE) + "+
+		"%g * MATCH(description) AGAINST(@q IN BOOLEAN MODE)",
+		ServiceNameWeight, CategoryWeight, LocationWeight, DescriptionWeight)
+	var rows []scoredDocument
+	err := m.repo.DB.WithContext(ctx).Model(&ServiceDocument{}).
+		Select("*, ("+score+") AS score", map[string]interface{}{"q": against}).
+		Where("MATCH(service_name) AGAINST(@q IN BOOLEAN MODE) OR MATCH(categories) AGAINST(@q IN BOOLEAN MODE) OR "+
+			"MATCH(locations) AGAINST(@q IN BOOLEAN MODE) OR MATCH(description) AGAINST(@q IN BOOLEAN MODE)",
+			map[string]interface{}{"q": against}).
+		Order("score DESC, service_id").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, Hit{
+			ServiceID:  row.ServiceID,
+			Score:      row.Score,
+			Highlights: highlights(row.document(), matched),
+		})
+	}
+	return hits, nil
+}
+
+// expand returns the indexed terms that match the query term exactly or within its typo budget,
+// only terms sharing its initial with a length that could be within budget are loaded.
+func (m *MySQLIndex) expand(ctx context.Context, term string) (map[string]bool, error) {
+	edits := maxEdits(term)
+	length := len([]rune(term))
+	var candidates []string
+	err := m.repo.DB.WithContext(ctx).Model(&SearchTerm{}).
+		Where("initial = ? AND length BETWEEN ? AND ? AND documents > 0", initial(term), length-edits, length+edits).
+		Pluck("term", &candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	return matchTerms(term, candidates), nil
+}
+
+// lockDocument loads the indexed document of the service for update, nil when it is not indexed.
+func lockDocument(tx *gorm.DB, serviceId int) (*ServiceDocument, error) {
+	var row ServiceDocument
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&ServiceDocument{}).
+		Where("service_id = ?", serviceId).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (d ServiceDocument) document() Document {
+	return Document{
+		ServiceID:   d.ServiceID,
+		ServiceName: d.ServiceName,
+		Categories:  []string{d.Categories},
+		Locations:   []string{d.Locations},
+		Description: d.Description,
+	}
+}
+
+// countTerms adds delta to the document count of each term, terms no document contains any more are dropped.
+func countTerms(tx *gorm.DB, terms []string, delta int) error {
+	if len(terms) == 0 {
+		return nil
+	}
+	if delta < 0 {
+		err := tx.Model(&SearchTerm{}).Where("term IN ?", terms).
+			Update("documents", gorm.Expr("documents + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("term IN ? AND documents <= 0", terms).Delete(&SearchTerm{}).Error
+	}
+	rows := make([]SearchTerm, 0, len(terms))
+	for _, term := range terms {
+		rows = append(rows, SearchTerm{Term: term, Initial: initial(term), Length: len([]rune(term)), Documents: delta})
+	}
+	// the initial is rewritten too so terms counted before it was stored get one on the next rebuild
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"documents": gorm.Expr("documents + ?", delta),
+			"initial":   gorm.Expr("VALUES(initial)"),
+		}),
+	}).Model(&SearchTerm{}).Create(&rows).Error
+}
+
+// uniqueTerms returns each term of the row once, matching how the vocabulary counts documents.
+func uniqueTerms(d ServiceDocument) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, text := range []string{d.ServiceName, d.Categories, d.Locations, d.Description} {
+		for _, term := range Tokenize(text) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
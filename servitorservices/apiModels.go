@@ -1,35 +1,48 @@
 package servitorservices
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// ServiceRequest creates a service, UserID is the authenticated caller and never read from the body.
 type ServiceRequest struct {
-	UserID          int         `json:"user_id"`
-	ServiceImage    string      `json:"service_image"`
-	ServiceName     string      `json:"service_name"`
-	ServiceDuration string      `json:"service_duration"`
-	ServiceCost     float64     `json:"service_cost"`
-	Locations       []Locations `json:"locations"`
-	Category        []Category  `json:"categories"`
+	UserID          int             `json:"-"`
+	ServiceImage    string          `json:"service_image"`
+	ServiceName     string          `json:"service_name"`
+	ServiceDuration string          `json:"service_duration"`
+	ServiceCost     float64         `json:"service_cost"`
+	Pricing         *PricingRequest `json:"pricing"`
+	Locations       []Locations     `json:"locations"`
+	CategoryIDs     []int           `json:"category_ids"`
+	Submit          bool            `json:"submit"`
 }
 
 type ServicesResponse struct {
-	ID              int         `json:"id"`
-	UserID          int         `json:"user_id"`
-	ServiceImage    string      `json:"service_image"`
-	ServiceName     string      `json:"service_name"`
-	ServiceDuration string      `json:"service_duration"`
-	ServiceCost     float64     `json:"service_cost"`
-	Locations       []Locations `json:"locations"`
-	Category        []Category  `json:"categories"`
+	ID              int                `json:"id"`
+	UserID          int                `json:"user_id"`
+	ServiceImage    string             `json:"service_image"`
+	ServiceName     string             `json:"service_name"`
+	ServiceDuration string             `json:"service_duration"`
+	ServiceCost     float64            `json:"service_cost"`
+	Pricing         Pricing            `json:"pricing"`
+	Cancellation    CancellationPolicy `json:"cancellation_policy"`
+	Status          string             `json:"status"`
+	Locations       []Locations        `json:"locations"`
+	Category        []Category         `json:"categories"`
 }
 
+// UpdateServiceRequest edits the details of a service, its price is changed through the pricing
+// endpoint so the price, currency and pricing model stay consistent.
 type UpdateServiceRequest struct {
-	ID              int     `json:"id"`
-	ServiceImage    string  `json:"service_image"`
-	ServiceName     string  `json:"service_name"`
-	ServiceDuration string  `json:"service_duration"`
-	ServiceCost     float64 `json:"service_cost"`
+	ID              int    `json:"id"`
+	ServiceImage    string `json:"service_image"`
+	ServiceName     string `json:"service_name"`
+	ServiceDuration string `json:"service_duration"`
 }
 
 type Locations struct {
+	ID            int     `json:"id,omitempty"`
 	LocationImage string  `json:"location_image"`
 	LocationName  string  `json:"location_name"`
 	Latitude      float64 `json:"latitude"`
@@ -38,8 +51,11 @@ type Locations struct {
 }
 
 type Category struct {
+	ID            int    `json:"id"`
+	Slug          string `json:"slug"`
 	CategoryImage string `json:"category_image"`
 	CategoryName  string `json:"category_name"`
+	Icon          string `json:"icon"`
 }
 
 type ServiceResponse struct {
@@ -82,15 +98,26 @@ type FetchLocByIdRequest struct {
 }
 
 type CategoryRequest struct {
+	ParentID      *int   `json:"parent_id"`
+	Slug          string `json:"slug"`
 	CategoryImage string `json:"category_image"`
-	CategoryName  string `json:"category_name"`
-	ServiceID     int    `json:"service_id"`
+	CategoryName  string `json:"category_name" binding:"required"`
+	Icon          string `json:"icon"`
+	SortOrder     int    `json:"sort_order"`
 }
 
 type UpdateCategoryRequest struct {
+	ID            int    `json:"id"`
+	ParentID      *int   `json:"parent_id"`
+	Slug          string `json:"slug"`
 	CategoryImage string `json:"category_image"`
-	CategoryName  string `json:"category_name"`
-	ServiceID     int    `json:"service_id"`
+	CategoryName  string `json:"category_name" binding:"required"`
+	Icon          string `json:"icon"`
+	SortOrder     int    `json:"sort_order"`
+}
+
+type ServiceCategoriesRequest struct {
+	CategoryIDs []int `json:"category_ids" binding:"required"`
 }
 
 type CategoryResponse struct {
@@ -112,9 +139,17 @@ type LocationResponse struct {
 }
 type CategoriesResponse struct {
 	ID            int    `json:"id"`
-	ServiceID     int    `json:"service_id"`
+	ParentID      *int   `json:"parent_id"`
+	Slug          string `json:"slug"`
 	CategoryImage string `json:"category_image"`
 	CategoryName  string `json:"category_name"`
+	Icon          string `json:"icon"`
+	SortOrder     int    `json:"sort_order"`
+}
+
+type CategoryNodeResponse struct {
+	CategoriesResponse
+	Children []CategoryNodeResponse `json:"children"`
 }
 
 type ChanResponse struct {
@@ -123,3 +158,331 @@ type ChanResponse struct {
 }
 
 type ServHuntChan chan ChanResponse
+
+type SearchServicesRequest struct {
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ListServicesRequest filters the service listing, prices are in minor units and durations in
+// minutes. The availability window needs both ends.
+type ListServicesRequest struct {
+	CategoryIDs   []int      `form:"category_id"`
+	MinPrice      *int64     `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice      *int64     `form:"max_price" binding:"omitempty,min=0"`
+	MinDuration   *int       `form:"min_duration" binding:"omitempty,min=0"`
+	MaxDuration   *int       `form:"max_duration" binding:"omitempty,min=0"`
+	Currency      string     `form:"currency"`
+	Verified      *bool      `form:"verified"`
+	MinRating     *float64   `form:"min_rating" binding:"omitempty,min=0,max=5"`
+	Language      string     `form:"language"`
+	Location      string     `form:"location"`
+	AvailableFrom *time.Time `form:"available_from"`
+	AvailableTo   *time.Time `form:"available_to"`
+	Page          int        `form:"page" binding:"omitempty,min=1"`
+	PageSize      int        `form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+type CategoryFacet struct {
+	ID           int    `json:"id"`
+	Slug         string `json:"slug"`
+	CategoryName string `json:"category_name"`
+	Count        int    `json:"count"`
+}
+
+type CurrencyFacet struct {
+	Currency string `json:"currency"`
+	Count    int    `json:"count"`
+	MinPrice int64  `json:"min_price"`
+	MaxPrice int64  `json:"max_price"`
+}
+
+type ValueFacet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type RatingFacet struct {
+	MinRating float64 `json:"min_rating"`
+	Count     int     `json:"count"`
+}
+
+// Facets counts the services matching every filter but the facet's own, so the other values of a
+// filter stay visible once one is picked. Category counts include services in subcategories.
+type Facets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Currencies []CurrencyFacet `json:"currencies"`
+	Languages  []ValueFacet    `json:"languages"`
+	Verified   []ValueFacet    `json:"verified"`
+	Ratings    []RatingFacet   `json:"ratings"`
+}
+
+type ServiceListResponse struct {
+	Services []ServicesResponse `json:"services"`
+	Total    int                `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+	Facets   Facets             `json:"facets"`
+}
+
+type SearchResultResponse struct {
+	Service    ServicesResponse  `json:"service"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type NearbyServicesRequest struct {
+	Latitude  *float64 `form:"lat" binding:"required,min=-90,max=90"`
+	Longitude *float64 `form:"lng" binding:"required,min=-180,max=180"`
+	RadiusKm  float64  `form:"radius_km" binding:"required,gt=0,max=500"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type BoundingBoxRequest struct {
+	MinLatitude  *float64 `form:"min_lat" binding:"required,min=-90,max=90"`
+	MinLongitude *float64 `form:"min_lng" binding:"required,min=-180,max=180"`
+	MaxLatitude  *float64 `form:"max_lat" binding:"required,min=-90,max=90"`
+	MaxLongitude *float64 `form:"max_lng" binding:"required,min=-180,max=180"`
+	Limit        int      `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type NearbyServiceResponse struct {
+	Service      ServicesResponse `json:"service"`
+	DistanceKm   float64          `json:"distance_km"`
+	LocationName string           `json:"location_name"`
+}
+
+type CoverageAreaRequest struct {
+	AreaType  string          `json:"area_type" binding:"required,oneof=polygon radius"`
+	Geometry  json.RawMessage `json:"geometry"`
+	Latitude  *float64        `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64        `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	RadiusKm  float64         `json:"radius_km" binding:"omitempty,gt=0,max=500"`
+}
+
+type CoverageAreaResponse struct {
+	ID        int             `json:"id"`
+	ServiceID int             `json:"service_id"`
+	AreaType  string          `json:"area_type"`
+	Geometry  json.RawMessage `json:"geometry,omitempty"`
+	Latitude  float64         `json:"latitude,omitempty"`
+	Longitude float64         `json:"longitude,omitempty"`
+	RadiusKm  float64         `json:"radius_km,omitempty"`
+}
+
+type CoveringServicesRequest struct {
+	Latitude  *float64 `form:"lat" binding:"required,min=-90,max=90"`
+	Longitude *float64 `form:"lng" binding:"required,min=-180,max=180"`
+}
+
+type PricingRequest struct {
+	PricingModel    string           `json:"pricing_model" binding:"required,oneof=fixed hourly per_unit tiered"`
+	Price           int64            `json:"price" binding:"min=0"`
+	Currency        string           `json:"currency" binding:"required,len=3"`
+	UnitName        string           `json:"unit_name" binding:"max=32"`
+	DurationMinutes int              `json:"duration_minutes" binding:"min=0"`
+	Packages        []PackageRequest `json:"packages" binding:"dive"`
+	AddOns          []AddOnRequest   `json:"add_ons" binding:"dive"`
+}
+
+type PackageRequest struct {
+	ID              int    `json:"id,omitempty"`
+	Tier            string `json:"tier" binding:"required,oneof=basic standard premium"`
+	Name            string `json:"name" binding:"required,max=128"`
+	Description     string `json:"description" binding:"max=512"`
+	Price           int64  `json:"price" binding:"min=0"`
+	DurationMinutes int    `json:"duration_minutes" binding:"min=0"`
+}
+
+type AddOnRequest struct {
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name" binding:"required,max=128"`
+	Price int64  `json:"price" binding:"min=0"`
+}
+
+// CancellationPolicyRequest sets what customers pay for late cancellations and no shows of confirmed
+// bookings, fees are percentages of the booking price.
+type CancellationPolicyRequest struct {
+	FreeCancellationHours      int `json:"free_cancellation_hours" binding:"min=0,max=720"`
+	LateCancellationFeePercent int `json:"late_cancellation_fee_percent" binding:"min=0,max=100"`
+	NoShowFeePercent           int `json:"no_show_fee_percent" binding:"min=0,max=100"`
+}
+
+type CancellationPolicy struct {
+	FreeCancellationHours      int `json:"free_cancellation_hours"`
+	LateCancellationFeePercent int `json:"late_cancellation_fee_percent"`
+	NoShowFeePercent           int `json:"no_show_fee_percent"`
+}
+
+// Pricing amounts are in minor units of the currency, e.g. cents.
+type Pricing struct {
+	PricingModel    string            `json:"pricing_model"`
+	Price           int64             `json:"price"`
+	Currency        string            `json:"currency"`
+	UnitName        string            `json:"unit_name,omitempty"`
+	DurationMinutes int               `json:"duration_minutes"`
+	Packages        []PackageResponse `json:"packages"`
+	AddOns          []AddOnResponse   `json:"add_ons"`
+}
+
+type PackageResponse struct {
+	ID              int    `json:"id"`
+	Tier            string `json:"tier"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Price           int64  `json:"price"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type AddOnResponse struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+type QuoteRequest struct {
+	Package         string           `json:"package" binding:"omitempty,oneof=basic standard premium"`
+	DurationMinutes int              `json:"duration_minutes" binding:"min=0,max=100000"`
+	Units           int              `json:"units" binding:"min=0,max=100000"`
+	AddOns          []QuoteAddOnItem `json:"add_ons" binding:"dive"`
+}
+
+type QuoteAddOnItem struct {
+	ID       int `json:"id" binding:"required"`
+	Quantity int `json:"quantity" binding:"min=0,max=1000"`
+}
+
+type QuoteLine struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int64  `json:"unit_amount"`
+	Amount      int64  `json:"amount"`
+}
+
+type QuoteResponse struct {
+	ServiceID int         `json:"service_id"`
+	Currency  string      `json:"currency"`
+	Lines     []QuoteLine `json:"lines"`
+	Total     int64       `json:"total"`
+}
+
+type StatusChangeRequest struct {
+	Status string `json:"status" binding:"required,oneof=draft pending_review published paused rejected archived"`
+	Reason string `json:"reason" binding:"max=512"`
+}
+
+type RejectServiceRequest struct {
+	Reason string `json:"reason" binding:"required,max=512"`
+}
+
+type StatusChangeResponse struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ChangedBy  int       `json:"changed_by"`
+	ChangedOn  time.Time `json:"changed_on"`
+}
+
+type RevertServiceRequest struct {
+	Version int `json:"version" binding:"required,min=1"`
+}
+
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+type ServiceVersionResponse struct {
+	Version   int           `json:"version"`
+	Summary   string        `json:"summary"`
+	ChangedBy int           `json:"changed_by"`
+	ChangedOn time.Time     `json:"changed_on"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// ServiceRecord is a service in an import or export file, prices are in minor units. Records
+// with an id update that service, the others create a new one.
+type ServiceRecord struct {
+	Row             int              `json:"-"`
+	ID              int              `json:"id,omitempty"`
+	ServiceName     string           `json:"service_name"`
+	ServiceImage    string           `json:"service_image"`
+	ServiceDuration string           `json:"service_duration"`
+	PricingModel    string           `json:"pricing_model"`
+	Price           int64            `json:"price"`
+	Currency        string           `json:"currency"`
+	UnitName        string           `json:"unit_name"`
+	DurationMinutes int              `json:"duration_minutes"`
+	CategoryIDs     []int            `json:"category_ids"`
+	Locations       []Locations      `json:"locations"`
+	Packages        []PackageRequest `json:"packages"`
+	AddOns          []AddOnRequest   `json:"add_ons"`
+}
+
+type ImportServicesRequest struct {
+	Format string `form:"format" binding:"required,oneof=csv ndjson"`
+	DryRun bool   `form:"dry_run"`
+}
+
+type ExportServicesRequest struct {
+	Format string `form:"format" binding:"required,oneof=csv ndjson"`
+	UserID int    `form:"user_id"`
+}
+
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun     bool       `json:"dry_run"`
+	Total      int        `json:"total"`
+	Created    int        `json:"created"`
+	Updated    int        `json:"updated"`
+	Unchanged  int        `json:"unchanged"`
+	ServiceIDs []int      `json:"service_ids"`
+	Errors     []RowError `json:"errors"`
+}
+
+type UploadMediaRequest struct {
+	LocationID *int   `form:"location_id"`
+	Caption    string `form:"caption" binding:"max=512"`
+}
+
+type GalleryRequest struct {
+	LocationID *int `form:"location_id"`
+}
+
+type UpdateMediaRequest struct {
+	Caption string `json:"caption" binding:"max=512"`
+}
+
+type ReorderMediaRequest struct {
+	LocationID *int  `json:"location_id"`
+	MediaIDs   []int `json:"media_ids" binding:"required"`
+}
+
+type RenditionResponse struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type MediaResponse struct {
+	ID          int                          `json:"id"`
+	ServiceID   int                          `json:"service_id"`
+	LocationID  *int                         `json:"location_id,omitempty"`
+	Kind        string                       `json:"kind"`
+	ContentType string                       `json:"content_type"`
+	Url         string                       `json:"url"`
+	Caption     string                       `json:"caption,omitempty"`
+	Position    int                          `json:"position"`
+	IsCover     bool                         `json:"is_cover"`
+	Size        int64                        `json:"size"`
+	Width       int                          `json:"width,omitempty"`
+	Height      int                          `json:"height,omitempty"`
+	Renditions  map[string]RenditionResponse `json:"renditions,omitempty"`
+	CreatedOn   time.Time                    `json:"created_on"`
+}
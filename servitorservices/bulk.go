@@ -0,0 +1,283 @@
+package servitorservices
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"servhunt/servitorservices/dao"
+	"strconv"
+	"strings"
+)
+
+// Bulk file formats, CSV keeps locations, packages and add-ons as JSON arrays in their cells.
+const (
+	CSVFormat    = "csv"
+	NDJSONFormat = "ndjson"
+
+	// MaxImportBytes and MaxImportRows bound the size of a single import.
+	MaxImportBytes = 5 << 20
+	MaxImportRows  = 500
+)
+
+var (
+	ErrInvalidImport     = errors.New("the import file could not be read")
+	ErrUnsupportedFormat = errors.New("unsupported format, use csv or ndjson")
+	ErrTooManyRows       = fmt.Errorf("an import can hold at most %d services", MaxImportRows)
+)
+
+var csvHeader = []string{
+	"id", "service_name", "service_image", "service_duration", "pricing_model", "price", "currency",
+	"unit_name", "duration_minutes", "category_ids", "locations", "packages", "add_ons",
+}
+
+// readRecords parses an import file. Rows that cannot be parsed are reported and left out, the
+// returned records carry their row number.
+func readRecords(format string, r io.Reader) ([]ServiceRecord, []RowError, error) {
+	switch format {
+	case CSVFormat:
+		return readCSV(r)
+	case NDJSONFormat:
+		return readNDJSON(r)
+	}
+	return nil, nil, ErrUnsupportedFormat
+}
+
+func readCSV(r io.Reader) ([]ServiceRecord, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := columns["service_name"]; !ok {
+		return nil, nil, errors.New("the header row must name a service_name column")
+	}
+
+	var records []ServiceRecord
+	var rowErrors []RowError
+	for row := 1; ; row++ {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if row > MaxImportRows {
+			return nil, nil, ErrTooManyRows
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Message: err.Error()})
+			continue
+		}
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(cells) {
+				return unescapeCell(strings.TrimSpace(cells[i]))
+			}
+			return ""
+		}
+
+		record := ServiceRecord{
+			Row:             row,
+			ServiceName:     cell("service_name"),
+			ServiceImage:    cell("service_image"),
+			ServiceDuration: cell("service_duration"),
+			PricingModel:    cell("pricing_model"),
+			Currency:        cell("currency"),
+			UnitName:        cell("unit_name"),
+		}
+		var fieldErrors []RowError
+		parseInt := func(name string, target *int) {
+			if value := cell(name); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					fieldErrors = append(fieldErrors, RowError{Row: row, Field: name, Message: "must be a whole number"})
+				}
+				*target = n
+			}
+		}
+		parseJSON := func(name string, target interface{}) {
+			if value := cell(name); value != "" {
+				if err := json.Unmarshal([]byte(value), target); err != nil {
+					fieldErrors = append(fieldErrors, RowError{Row: row, Field: name, Message: "must be a JSON array"})
+				}
+			}
+		}
+		parseInt("id", &record.ID)
+		parseInt("duration_minutes", &record.DurationMinutes)
+		if value := cell("price"); value != "" {
+			price, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				fieldErrors = append(fieldErrors, RowError{Row: row, Field: "price", Message: "must be a whole number of minor units"})
+			}
+			record.Price = price
+		}
+		for _, value := range strings.Split(cell("category_ids"), ";") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				fieldErrors = append(fieldErrors, RowError{Row: row, Field: "category_ids", Message: "must be ids separated by ;"})
+				break
+			}
+			record.CategoryIDs = append(record.CategoryIDs, id)
+		}
+		parseJSON("locations", &record.Locations)
+		parseJSON("packages", &record.Packages)
+		parseJSON("add_ons", &record.AddOns)
+
+		if len(fieldErrors) > 0 {
+			rowErrors = append(rowErrors, fieldErrors...)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rowErrors, nil
+}
+
+func readNDJSON(r io.Reader) ([]ServiceRecord, []RowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxImportBytes)
+	var records []ServiceRecord
+	var rowErrors []RowError
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+		if row > MaxImportRows {
+			return nil, nil, ErrTooManyRows
+		}
+		record := ServiceRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		record.Row = row
+		records = append(records, record)
+	}
+	return records, rowErrors, scanner.Err()
+}
+
+// writeRecords writes the records in the format they are imported in.
+func writeRecords(format string, w io.Writer, records []ServiceRecord) error {
+	switch format {
+	case CSVFormat:
+		return writeCSV(w, records)
+	case NDJSONFormat:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrUnsupportedFormat
+}
+
+func writeCSV(w io.Writer, records []ServiceRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, record := range records {
+		categories := make([]string, len(record.CategoryIDs))
+		for i, id := range record.CategoryIDs {
+			categories[i] = strconv.Itoa(id)
+		}
+		locations, err := json.Marshal(record.Locations)
+		if err != nil {
+			return err
+		}
+		packages, err := json.Marshal(record.Packages)
+		if err != nil {
+			return err
+		}
+		addOns, err := json.Marshal(record.AddOns)
+		if err != nil {
+			return err
+		}
+		cells := []string{
+			strconv.Itoa(record.ID),
+			record.ServiceName,
+			record.ServiceImage,
+			record.ServiceDuration,
+			record.PricingModel,
+			strconv.FormatInt(record.Price, 10),
+			record.Currency,
+			record.UnitName,
+			strconv.Itoa(record.DurationMinutes),
+			strings.Join(categories, ";"),
+			string(locations),
+			string(packages),
+			string(addOns),
+		}
+		for i := range cells {
+			cells[i] = escapeCell(cells[i])
+		}
+		if err = writer.Write(cells); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formulaPrefixes start a cell that spreadsheets evaluate as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCell keeps spreadsheets from running a cell as a formula by prefixing it with a quote.
+func escapeCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCell drops the quote escapeCell put in front of a cell.
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func toServiceRecord(svc dao.Service) ServiceRecord {
+	snapshot := svc.Snapshot()
+	record := ServiceRecord{
+		ID:              svc.ID,
+		ServiceName:     snapshot.ServiceName,
+		ServiceImage:    snapshot.ServiceImage,
+		ServiceDuration: snapshot.ServiceDuration,
+		PricingModel:    snapshot.PricingModel,
+		Price:           snapshot.Price,
+		Currency:        snapshot.Currency,
+		UnitName:        snapshot.UnitName,
+		DurationMinutes: snapshot.DurationMinutes,
+		CategoryIDs:     snapshot.CategoryIDs,
+		Locations:       []Locations{},
+		Packages:        []PackageRequest{},
+		AddOns:          []AddOnRequest{},
+	}
+	for _, loc := range snapshot.Locations {
+		record.Locations = append(record.Locations, Locations(loc))
+	}
+	for _, pkg := range snapshot.Packages {
+		record.Packages = append(record.Packages, PackageRequest(pkg))
+	}
+	for _, addOn := range snapshot.AddOns {
+		record.AddOns = append(record.AddOns, AddOnRequest(addOn))
+	}
+	return record
+}
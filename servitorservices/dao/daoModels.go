@@ -1,37 +1,390 @@
 package dao
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"servhunt/infra/geo"
+	"sort"
+	"time"
+)
 
 type Service struct {
-	ID              int        `gorm:"primary_key; auto_increment" json:"id"`
-	UserID          int        `json:"user_id"`
-	ServiceImage    string     `gorm:"type:varchar(256)" json:"service_image"`
-	ServiceName     string     `gorm:"type:varchar(256)" json:"service_name"`
-	ServiceDuration string     `gorm:"type:varchar(256)" json:"service_duration"`
-	ServiceCost     float64    `json:"service_cost"`
-	CreatedOn       time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
-	LastUpdatedOn   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
-	Category        []Category `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	LocationInfo    []Location `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ID              int     `gorm:"primary_key; auto_increment" json:"id"`
+	UserID          int     `json:"user_id"`
+	ServiceImage    string  `gorm:"type:varchar(256)" json:"service_image"`
+	ServiceName     string  `gorm:"type:varchar(256)" json:"service_name"`
+	ServiceDuration string  `gorm:"type:varchar(256)" json:"service_duration"`
+	ServiceCost     float64 `json:"service_cost"`
+	PricingModel    string  `gorm:"type:varchar(16)" json:"pricing_model"`
+	Price           int64   `json:"price"`
+	Currency        string  `gorm:"type:varchar(3)" json:"currency"`
+	UnitName        string  `gorm:"type:varchar(32)" json:"unit_name"`
+	DurationMinutes int     `json:"duration_minutes"`
+	// Customers cancelling a confirmed booking less than FreeCancellationHours before it starts pay
+	// LateCancellationFeePercent of the price, and NoShowFeePercent when they do not show up.
+	FreeCancellationHours      int            `json:"free_cancellation_hours"`
+	LateCancellationFeePercent int            `json:"late_cancellation_fee_percent"`
+	NoShowFeePercent           int            `json:"no_show_fee_percent"`
+	Status                     string         `gorm:"type:varchar(16);default:published;index" json:"status"`
+	CreatedOn                  time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn              time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt                  gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Category                   []Category     `gorm:"many2many:service_categories;"`
+	LocationInfo               []Location     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Packages                   []Package      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	AddOns                     []AddOn        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// Listing statuses of a service, only published services are shown to customers.
+const (
+	DraftStatus         = "draft"
+	PendingReviewStatus = "pending_review"
+	PublishedStatus     = "published"
+	PausedStatus        = "paused"
+	RejectedStatus      = "rejected"
+	ArchivedStatus      = "archived"
+)
+
+// StatusChange records a move of a service between listing statuses.
+type StatusChange struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID  int       `gorm:"index" json:"service_id"`
+	FromStatus string    `gorm:"type:varchar(16)" json:"from_status"`
+	ToStatus   string    `gorm:"type:varchar(16)" json:"to_status"`
+	Reason     string    `gorm:"type:varchar(512)" json:"reason"`
+	ChangedBy  int       `json:"changed_by"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// Pricing models, Price is the whole price of a fixed service, the rate per hour of an hourly
+// service and the rate per unit of a per unit service. Tiered services are priced by their packages.
+const (
+	FixedPricing   = "fixed"
+	HourlyPricing  = "hourly"
+	PerUnitPricing = "per_unit"
+	TieredPricing  = "tiered"
+)
+
+// Package tiers of a tiered service.
+const (
+	BasicTier    = "basic"
+	StandardTier = "standard"
+	PremiumTier  = "premium"
+)
+
+// Package is a tier of a tiered service, Price is in minor units of the service currency.
+type Package struct {
+	ID              int            `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID       int            `gorm:"index" json:"service_id"`
+	Tier            string         `gorm:"type:varchar(16)" json:"tier"`
+	Name            string         `gorm:"type:varchar(128)" json:"name"`
+	Description     string         `gorm:"type:varchar(512)" json:"description"`
+	Price           int64          `json:"price"`
+	DurationMinutes int            `json:"duration_minutes"`
+	CreatedOn       time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn   time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// AddOn is an optional extra charged on top of the service price.
+type AddOn struct {
+	ID            int            `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID     int            `gorm:"index" json:"service_id"`
+	Name          string         `gorm:"type:varchar(128)" json:"name"`
+	Price         int64          `json:"price"`
+	CreatedOn     time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
 type Location struct {
-	ID            int       `gorm:"primary_key; auto_increment" json:"id"`
-	ServiceID     int       `json:"service_id"`
-	LocationImage string    `gorm:"type:varchar(256)" json:"location_image"`
-	LocationName  string    `gorm:"type:varchar(256)" json:"location_name"`
-	Latitude      float64   `json:"latitude"`
-	Longitude     float64   `json:"longitude"`
-	Address       string    `gorm:"type:varchar(256)" json:"address"`
-	CreatedOn     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
-	LastUpdatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	ID            int            `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID     int            `json:"service_id"`
+	LocationImage string         `gorm:"type:varchar(256)" json:"location_image"`
+	LocationName  string         `gorm:"type:varchar(256)" json:"location_name"`
+	Latitude      float64        `json:"latitude"`
+	Longitude     float64        `json:"longitude"`
+	Geohash       string         `gorm:"type:varchar(12);index" json:"geohash"`
+	Address       string         `gorm:"type:varchar(256)" json:"address"`
+	CreatedOn     time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
+// Category is a node of the shared taxonomy, services are linked to it through service_categories.
 type Category struct {
-	ID            int       `gorm:"primary_key; auto_increment" json:"id"`
-	ServiceID     int       `json:"service_id"`
-	CategoryImage string    `gorm:"type:varchar(256)" json:"category_image"`
-	CategoryName  string    `gorm:"type:varchar(256)" json:"category_name"`
-	CreatedOn     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
-	LastUpdatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	ID            int            `gorm:"primary_key; auto_increment" json:"id"`
+	ParentID      *int           `gorm:"index" json:"parent_id"`
+	Slug          string         `gorm:"type:varchar(128);uniqueIndex" json:"slug"`
+	CategoryImage string         `gorm:"type:varchar(256)" json:"category_image"`
+	CategoryName  string         `gorm:"type:varchar(256)" json:"category_name"`
+	Icon          string         `gorm:"type:varchar(128)" json:"icon"`
+	SortOrder     int            `json:"sort_order"`
+	CreatedOn     time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// Coverage area types, a polygon area stores GeoJSON while a radius area stores a base point and radius.
+const (
+	PolygonCoverage = "polygon"
+	RadiusCoverage  = "radius"
+)
+
+// CoverageArea is a region a mobile service is offered in, the bounding box columns let queries
+// discard areas that cannot contain a point before the exact geometry check.
+type CoverageArea struct {
+	ID              int            `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID       int            `gorm:"index" json:"service_id"`
+	AreaType        string         `gorm:"type:varchar(32)" json:"area_type"`
+	GeoJSON         string         `gorm:"type:mediumtext" json:"geojson"`
+	CenterLatitude  float64        `json:"center_latitude"`
+	CenterLongitude float64        `json:"center_longitude"`
+	RadiusKm        float64        `json:"radius_km"`
+	MinLatitude     float64        `gorm:"index:idx_coverage_bbox" json:"min_latitude"`
+	MaxLatitude     float64        `gorm:"index:idx_coverage_bbox" json:"max_latitude"`
+	MinLongitude    float64        `json:"min_longitude"`
+	MaxLongitude    float64        `json:"max_longitude"`
+	CreatedOn       time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn   time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// ServiceFilter narrows down the published services listed, zero values are ignored. CategoryIDs
+// matches services in any of the categories and Location matches the name or address of a location.
+// ServiceIDs restricts the services to the ids when it is not nil.
+type ServiceFilter struct {
+	CategoryIDs []int
+	MinPrice    *int64
+	MaxPrice    *int64
+	MinDuration *int
+	MaxDuration *int
+	Currency    string
+	Verified    *bool
+	MinRating   *float64
+	Language    string
+	Location    string
+	ServiceIDs  []int
+}
+
+// FacetFilters holds the filter each facet is counted over, a facet ignores its own filter so the
+// other values stay visible once one is picked.
+type FacetFilters struct {
+	Categories ServiceFilter
+	Currencies ServiceFilter
+	Languages  ServiceFilter
+	Verified   ServiceFilter
+	Ratings    ServiceFilter
+}
+
+// CategorySetCount counts the services filed under exactly the categories.
+type CategorySetCount struct {
+	CategoryIDs []int
+	Count       int
+}
+
+type CurrencyCount struct {
+	Currency string
+	Count    int
+	MinPrice int64
+	MaxPrice int64
+}
+
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// FacetCounts holds the facet counts of the listed services. Ratings counts the services at or
+// above each of the requested minimum ratings, in order.
+type FacetCounts struct {
+	CategorySets []CategorySetCount
+	Currencies   []CurrencyCount
+	Languages    []ValueCount
+	Verified     map[bool]int
+	Ratings      []int
+}
+
+// ServiceFacets holds the attributes of a listed service that facet counts are computed over.
+type ServiceFacets struct {
+	ServiceID   int
+	Currency    string
+	Price       int64
+	Verified    bool
+	Rating      float64
+	CategoryIDs []int
+	Languages   []string
+}
+
+// Kinds of gallery media.
+const (
+	ImageMedia = "image"
+	VideoMedia = "video"
+
+	// CoverRendition is the rendition copied to the service or location image.
+	CoverRendition = "medium"
+)
+
+// Media is an image or short video in the gallery of a service, or of one of its locations when
+// LocationID is set. Position orders the gallery and one item per gallery is the cover.
+type Media struct {
+	ID            int              `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID     int              `gorm:"index:idx_media_gallery" json:"service_id"`
+	LocationID    *int             `gorm:"index:idx_media_gallery" json:"location_id"`
+	Kind          string           `gorm:"type:varchar(16)" json:"kind"`
+	ContentType   string           `gorm:"type:varchar(64)" json:"content_type"`
+	StorageKey    string           `gorm:"type:varchar(255)" json:"storage_key"`
+	Url           string           `gorm:"type:varchar(512)" json:"url"`
+	Caption       string           `gorm:"type:varchar(512)" json:"caption"`
+	Position      int              `json:"position"`
+	IsCover       bool             `json:"is_cover"`
+	Size          int64            `json:"size"`
+	Width         int              `json:"width"`
+	Height        int              `json:"height"`
+	Renditions    []MediaRendition `json:"renditions"`
+	CreatedOn     time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt     gorm.DeletedAt   `gorm:"index" json:"deleted_at"`
+}
+
+// MediaRendition is a resized copy of a gallery image.
+type MediaRendition struct {
+	ID         int    `gorm:"primary_key; auto_increment" json:"id"`
+	MediaID    int    `gorm:"index" json:"media_id"`
+	Name       string `gorm:"type:varchar(32)" json:"name"`
+	StorageKey string `gorm:"type:varchar(255)" json:"storage_key"`
+	Url        string `gorm:"type:varchar(512)" json:"url"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+// CoverURL is the image shown when the item is the cover of its gallery, the medium rendition when
+// there is one.
+func (m Media) CoverURL() string {
+	for _, rendition := range m.Renditions {
+		if rendition.Name == CoverRendition {
+			return rendition.Url
+		}
+	}
+	return m.Url
+}
+
+// StorageKeys lists the blobs of the media item, the original and its renditions.
+func (m Media) StorageKeys() []string {
+	keys := []string{m.StorageKey}
+	for _, rendition := range m.Renditions {
+		keys = append(keys, rendition.StorageKey)
+	}
+	return keys
+}
+
+// Point returns the coordinates of the location.
+func (l Location) Point() geo.Point {
+	return geo.Point{Latitude: l.Latitude, Longitude: l.Longitude}
+}
+
+// ServiceVersion is a snapshot of a service taken after every change to it, Snapshot holds a
+// ServiceSnapshot as JSON.
+type ServiceVersion struct {
+	ID        int       `gorm:"primary_key; auto_increment" json:"id"`
+	ServiceID int       `gorm:"uniqueIndex:idx_service_version" json:"service_id"`
+	Version   int       `gorm:"uniqueIndex:idx_service_version" json:"version"`
+	Snapshot  string    `gorm:"type:mediumtext" json:"snapshot"`
+	Summary   string    `gorm:"type:varchar(256)" json:"summary"`
+	ChangedBy int       `json:"changed_by"`
+	CreatedOn time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
+
+// ServiceSnapshot is the editable state of a service with its locations, categories and prices.
+// Locations, packages and add-ons keep their IDs so restoring a snapshot updates the same rows.
+type ServiceSnapshot struct {
+	ServiceName                string             `json:"service_name"`
+	ServiceImage               string             `json:"service_image"`
+	ServiceDuration            string             `json:"service_duration"`
+	ServiceCost                float64            `json:"service_cost"`
+	PricingModel               string             `json:"pricing_model"`
+	Price                      int64              `json:"price"`
+	Currency                   string             `json:"currency"`
+	UnitName                   string             `json:"unit_name"`
+	DurationMinutes            int                `json:"duration_minutes"`
+	FreeCancellationHours      int                `json:"free_cancellation_hours"`
+	LateCancellationFeePercent int                `json:"late_cancellation_fee_percent"`
+	NoShowFeePercent           int                `json:"no_show_fee_percent"`
+	Packages                   []PackageSnapshot  `json:"packages"`
+	AddOns                     []AddOnSnapshot    `json:"add_ons"`
+	Locations                  []LocationSnapshot `json:"locations"`
+	CategoryIDs                []int              `json:"category_ids"`
+}
+
+type PackageSnapshot struct {
+	ID              int    `json:"id,omitempty"`
+	Tier            string `json:"tier"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Price           int64  `json:"price"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type AddOnSnapshot struct {
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+type LocationSnapshot struct {
+	ID            int     `json:"id,omitempty"`
+	LocationImage string  `json:"location_image"`
+	LocationName  string  `json:"location_name"`
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	Address       string  `json:"address"`
+}
+
+// Snapshot captures the editable state of a service loaded with its associations.
+func (s Service) Snapshot() ServiceSnapshot {
+	snapshot := ServiceSnapshot{
+		ServiceName:                s.ServiceName,
+		ServiceImage:               s.ServiceImage,
+		ServiceDuration:            s.ServiceDuration,
+		ServiceCost:                s.ServiceCost,
+		PricingModel:               s.PricingModel,
+		Price:                      s.Price,
+		Currency:                   s.Currency,
+		UnitName:                   s.UnitName,
+		DurationMinutes:            s.DurationMinutes,
+		FreeCancellationHours:      s.FreeCancellationHours,
+		LateCancellationFeePercent: s.LateCancellationFeePercent,
+		NoShowFeePercent:           s.NoShowFeePercent,
+		Packages:                   []PackageSnapshot{},
+		AddOns:                     []AddOnSnapshot{},
+		Locations:                  []LocationSnapshot{},
+		CategoryIDs:                []int{},
+	}
+	for _, pkg := range s.Packages {
+		snapshot.Packages = append(snapshot.Packages, PackageSnapshot{
+			ID:              pkg.ID,
+			Tier:            pkg.Tier,
+			Name:            pkg.Name,
+			Description:     pkg.Description,
+			Price:           pkg.Price,
+			DurationMinutes: pkg.DurationMinutes,
+		})
+	}
+	for _, addOn := range s.AddOns {
+		snapshot.AddOns = append(snapshot.AddOns, AddOnSnapshot{ID: addOn.ID, Name: addOn.Name, Price: addOn.Price})
+	}
+	for _, loc := range s.LocationInfo {
+		snapshot.Locations = append(snapshot.Locations, LocationSnapshot{
+			ID:            loc.ID,
+			LocationImage: loc.LocationImage,
+			LocationName:  loc.LocationName,
+			Latitude:      loc.Latitude,
+			Longitude:     loc.Longitude,
+			Address:       loc.Address,
+		})
+	}
+	for _, cat := range s.Category {
+		snapshot.CategoryIDs = append(snapshot.CategoryIDs, cat.ID)
+	}
+	sort.Ints(snapshot.CategoryIDs)
+	return snapshot
 }
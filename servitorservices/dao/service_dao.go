@@ -2,25 +2,87 @@ package dao
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"servhunt/infra/dao"
+	"servhunt/infra/geo"
+	"servhunt/infra/money"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+)
+
+var (
+	// ErrStatusChanged is returned when a service moved to another status while a change was being made.
+	ErrStatusChanged = errors.New("service status has changed, please retry")
+
+	// ErrGalleryChanged is returned when a new gallery order does not list exactly the items of the gallery.
+	ErrGalleryChanged = errors.New("the order must list every item of the gallery exactly once")
 )
 
 type ServiceRepo interface {
 	CreateService(ctx context.Context, service Service) (*Service, error)
 	UpdateService(ctx context.Context, service Service) (*Service, error)
 	GetAllServices(ctx context.Context) (*[]Service, error)
-	ServitorServices(ctx context.Context, userId int) (*[]Service, error)
+	ServitorServices(ctx context.Context, userId int, includeUnpublished bool) (*[]Service, error)
 	GetServiceByID(ctx context.Context, id int) (*Service, error)
+	GetServicesByIDs(ctx context.Context, ids []int) (*[]Service, error)
 	CreateCategory(ctx context.Context, category Category) (*Category, error)
 	UpdateCategory(ctx context.Context, category Category) (*Category, error)
 	ServiceCategories(ctx context.Context, serviceId int) (*[]Category, error)
 	GetAllCategories(ctx context.Context) (*[]Category, error)
+	GetCategoryByID(ctx context.Context, id int) (*Category, error)
+	CountChildCategories(ctx context.Context, id int) (int64, error)
+	GetCategoriesByIDs(ctx context.Context, ids []int) (*[]Category, error)
+	SetServiceCategories(ctx context.Context, serviceId int, categories []Category) error
+	ServicesInCategories(ctx context.Context, categoryIds []int) (*[]Service, error)
+	MigrateCategoryTaxonomy(ctx context.Context) (int64, error)
+	SetPricing(ctx context.Context, service Service) error
+	SetCancellationPolicy(ctx context.Context, service Service) error
+	BackfillPricing(ctx context.Context, currency string) (int64, error)
 	CreateLocationInfo(ctx context.Context, location Location) (*Location, error)
 	UpdateLocationInfo(ctx context.Context, location Location) (*Location, error)
 	ServiceLocations(ctx context.Context, serviceId int) (*[]Location, error)
+	GetLocationByID(ctx context.Context, id int) (*Location, error)
 	GetAllLocations(ctx context.Context) (*[]Location, error)
+	LocationsWithin(ctx context.Context, box geo.BoundingBox) (*[]Location, error)
+	BackfillGeohashes(ctx context.Context) (int64, error)
+	CreateCoverageArea(ctx context.Context, area CoverageArea) (*CoverageArea, error)
+	ServiceCoverageAreas(ctx context.Context, serviceId int) (*[]CoverageArea, error)
+	GetCoverageAreaByID(ctx context.Context, id int) (*CoverageArea, error)
+	DeleteCoverageArea(ctx context.Context, id int) error
+	CoverageAreasAround(ctx context.Context, point geo.Point) (*[]CoverageArea, error)
+	DeleteService(ctx context.Context, id int) error
+	RestoreService(ctx context.Context, id int) error
+	DeleteLocation(ctx context.Context, id int) error
+	RestoreLocation(ctx context.Context, id int) error
+	DeleteCategory(ctx context.Context, id int) error
+	RestoreCategory(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	ServicesByStatus(ctx context.Context, status string) (*[]Service, error)
+	ChangeServiceStatus(ctx context.Context, change StatusChange) (*Service, error)
+	ServiceStatusHistory(ctx context.Context, serviceId int) (*[]StatusChange, error)
+	RecordVersion(ctx context.Context, serviceId int, changedBy int, summary string) (*ServiceVersion, error)
+	ServiceVersions(ctx context.Context, serviceId int) (*[]ServiceVersion, error)
+	GetServiceVersion(ctx context.Context, serviceId int, version int) (*ServiceVersion, error)
+	RestoreSnapshot(ctx context.Context, serviceId int, snapshot ServiceSnapshot) error
+	ImportServices(ctx context.Context, creates []Service, updates map[int]ServiceSnapshot) ([]int, error)
+	FilterServiceIDs(ctx context.Context, filter ServiceFilter, offset int, limit int) ([]int, int64, error)
+	CountServiceFacets(ctx context.Context, filters FacetFilters, minRatings []float64) (*FacetCounts, error)
+	GetServiceFacets(ctx context.Context, ids []int) (*[]ServiceFacets, error)
+	CreateMedia(ctx context.Context, media Media) (*Media, error)
+	GalleryMedia(ctx context.Context, serviceId int, locationId *int) (*[]Media, error)
+	GetMediaByID(ctx context.Context, id int) (*Media, error)
+	UpdateMediaCaption(ctx context.Context, id int, caption string) error
+	SetCoverMedia(ctx context.Context, id int) error
+	ReorderMedia(ctx context.Context, serviceId int, locationId *int, ids []int) error
+	DeleteMedia(ctx context.Context, id int) error
+	DeletedMediaBefore(ctx context.Context, before time.Time) (*[]Media, error)
+	PurgeMedia(ctx context.Context, ids []int) error
 }
 
 type ServiceRepoImpl struct {
@@ -32,8 +94,19 @@ func NewServiceRepoImpl(repo *dao.Repository) ServiceRepo {
 }
 
 func (s *ServiceRepoImpl) CreateService(ctx context.Context, service Service) (*Service, error) {
-	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Create(&service).Error
-	s.repo.DB.Save(&service)
+	for i := range service.LocationInfo {
+		service.LocationInfo[i].Geohash = geo.Geohash(service.LocationInfo[i].Point(), geo.GeohashPrecision)
+	}
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Service{}).Omit("Category.*").Create(&service).Error; err != nil {
+			return err
+		}
+		return tx.Model(&StatusChange{}).Create(&StatusChange{
+			ServiceID: service.ID,
+			ToStatus:  service.Status,
+			ChangedBy: service.UserID,
+		}).Error
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +118,6 @@ func (s *ServiceRepoImpl) UpdateService(ctx context.Context, service Service) (*
 		ServiceImage:    service.ServiceImage,
 		ServiceName:     service.ServiceName,
 		ServiceDuration: service.ServiceDuration,
-		ServiceCost:     service.ServiceCost,
 		LastUpdatedOn:   time.Now(),
 	}).Error
 
@@ -64,10 +136,14 @@ func (s *ServiceRepoImpl) CreateCategory(ctx context.Context, category Category)
 }
 
 func (s *ServiceRepoImpl) UpdateCategory(ctx context.Context, category Category) (*Category, error) {
-	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id = ?", category.ID).Updates(Category{
-		CategoryImage: category.CategoryImage,
-		CategoryName:  category.CategoryName,
-		LastUpdatedOn: time.Time{},
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Where("id = ?", category.ID).Updates(map[string]interface{}{
+		"parent_id":       category.ParentID,
+		"slug":            category.Slug,
+		"category_image":  category.CategoryImage,
+		"category_name":   category.CategoryName,
+		"icon":            category.Icon,
+		"sort_order":      category.SortOrder,
+		"last_updated_on": time.Now(),
 	}).Error
 
 	if err != nil {
@@ -77,6 +153,7 @@ func (s *ServiceRepoImpl) UpdateCategory(ctx context.Context, category Category)
 }
 
 func (s *ServiceRepoImpl) CreateLocationInfo(ctx context.Context, location Location) (*Location, error) {
+	location.Geohash = geo.Geohash(location.Point(), geo.GeohashPrecision)
 	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Create(&location).Error
 	if err != nil {
 		return nil, err
@@ -85,11 +162,12 @@ func (s *ServiceRepoImpl) CreateLocationInfo(ctx context.Context, location Locat
 }
 
 func (s *ServiceRepoImpl) UpdateLocationInfo(ctx context.Context, location Location) (*Location, error) {
-	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id = ?", location.ID).Updates(Location{
+	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Where("id = ?", location.ID).Updates(Location{
 		LocationImage: location.LocationImage,
 		LocationName:  location.LocationName,
 		Latitude:      location.Latitude,
 		Longitude:     location.Longitude,
+		Geohash:       geo.Geohash(location.Point(), geo.GeohashPrecision),
 		Address:       location.Address,
 		LastUpdatedOn: time.Now(),
 	}).Error
@@ -102,16 +180,22 @@ func (s *ServiceRepoImpl) UpdateLocationInfo(ctx context.Context, location Locat
 
 func (s *ServiceRepoImpl) GetAllServices(ctx context.Context) (*[]Service, error) {
 	var services []Service
-	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Preload(clause.Associations).Find(&services).Error
+	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Scopes(Published).Preload(clause.Associations).Find(&services).Error
 	if err != nil {
 		return nil, err
 	}
 	return &services, nil
 }
 
-func (s *ServiceRepoImpl) ServitorServices(ctx context.Context, userId int) (*[]Service, error) {
+// ServitorServices returns the services of a servitor, drafts and other unpublished services are
+// only included for the servitor and administrators.
+func (s *ServiceRepoImpl) ServitorServices(ctx context.Context, userId int, includeUnpublished bool) (*[]Service, error) {
 	var services []Service
-	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("user_id = ?", userId).Preload(clause.Associations).Find(&services).Error
+	db := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("user_id = ?", userId)
+	if !includeUnpublished {
+		db = db.Scopes(Published)
+	}
+	err := db.Preload(clause.Associations).Find(&services).Error
 	if err != nil {
 		return nil, err
 	}
@@ -127,9 +211,258 @@ func (s *ServiceRepoImpl) GetServiceByID(ctx context.Context, id int) (*Service,
 	return &services, nil
 }
 
+// FilterServiceIDs returns a page of the ids of the published services matching the filter, newest
+// first, along with the number of matching services.
+func (s *ServiceRepoImpl) FilterServiceIDs(ctx context.Context, filter ServiceFilter, offset int,
+	limit int) ([]int, int64, error) {
+	var total int64
+	if err := s.filteredServices(filter).WithContext(ctx).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	ids := []int{}
+	if total == 0 || int64(offset) >= total {
+		return ids, total, nil
+	}
+	err := s.filteredServices(filter).WithContext(ctx).Order("services.created_on DESC, services.id DESC").
+		Offset(offset).Limit(limit).Pluck("services.id", &ids).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return ids, total, nil
+}
+
+// CountServiceFacets counts every facet over the services matching its filter. Services are grouped
+// by their set of categories so the caller can roll the counts up the category tree without
+// counting a service twice.
+func (s *ServiceRepoImpl) CountServiceFacets(ctx context.Context, filters FacetFilters,
+	minRatings []float64) (*FacetCounts, error) {
+	db := s.repo.DB.WithContext(ctx)
+	counts := FacetCounts{Verified: map[bool]int{}}
+
+	var sets []struct {
+		CategoryIDs string
+		Count       int
+	}
+	perService := s.repo.DB.Table("service_categories").
+		Select("service_id, GROUP_CONCAT(DISTINCT category_id ORDER BY category_id) AS category_ids").
+		Where("service_id IN (?)", s.filteredServiceIDs(filters.Categories)).Group("service_id")
+	err := db.Table("(?) AS category_sets", perService).Select("category_ids, COUNT(*) AS count").
+		Group("category_ids").Scan(&sets).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		categorySet := CategorySetCount{Count: set.Count}
+		for _, id := range strings.Split(set.CategoryIDs, ",") {
+			if categoryId, err := strconv.Atoi(id); err == nil {
+				categorySet.CategoryIDs = append(categorySet.CategoryIDs, categoryId)
+			}
+		}
+		counts.CategorySets = append(counts.CategorySets, categorySet)
+	}
+
+	err = db.Table("services").
+		Select("currency, COUNT(*) AS count, MIN(price) AS min_price, MAX(price) AS max_price").
+		Where("services.id IN (?)", s.filteredServiceIDs(filters.Currencies)).Group("currency").
+		Scan(&counts.Currencies).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table("languages").
+		Select("LOWER(TRIM(languages.language)) AS value, COUNT(DISTINCT services.id) AS count").
+		Joins("JOIN services ON services.user_id = languages.user_id").
+		Where("services.id IN (?)", s.filteredServiceIDs(filters.Languages)).
+		Where("TRIM(languages.language) <> ''").Group("value").Scan(&counts.Languages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var verified []struct {
+		Verified bool
+		Count    int
+	}
+	err = db.Table("services").Select("users.verified, COUNT(*) AS count").
+		Joins("JOIN users ON users.id = services.user_id").
+		Where("services.id IN (?)", s.filteredServiceIDs(filters.Verified)).Group("users.verified").
+		Scan(&verified).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range verified {
+		counts.Verified[row.Verified] += row.Count
+	}
+
+	if len(minRatings) > 0 {
+		columns := make([]string, len(minRatings))
+		args := make([]interface{}, len(minRatings))
+		for i, minRating := range minRatings {
+			columns[i] = "COALESCE(SUM(ratings.rating >= ?), 0)"
+			args[i] = minRating
+		}
+		row := db.Table("services").Select(strings.Join(columns, ", "), args...).
+			Joins("JOIN (?) AS ratings ON ratings.servitor_id = services.user_id", s.servitorRatings()).
+			Where("services.id IN (?)", s.filteredServiceIDs(filters.Ratings)).Row()
+		counts.Ratings = make([]int, len(minRatings))
+		dest := make([]interface{}, len(minRatings))
+		for i := range counts.Ratings {
+			dest[i] = &counts.Ratings[i]
+		}
+		if err := row.Scan(dest...); err != nil {
+			return nil, err
+		}
+	}
+	return &counts, nil
+}
+
+// filteredServiceIDs selects the ids of the published services matching the filter, for use as a
+// subquery.
+func (s *ServiceRepoImpl) filteredServiceIDs(filter ServiceFilter) *gorm.DB {
+	return s.filteredServices(filter).Select("services.id")
+}
+
+// filteredServices queries the published services matching the filter.
+func (s *ServiceRepoImpl) filteredServices(filter ServiceFilter) *gorm.DB {
+	db := s.repo.DB.Model(&Service{}).Scopes(Published)
+	if filter.ServiceIDs != nil {
+		db = db.Where("services.id IN ?", filter.ServiceIDs)
+	}
+	if len(filter.CategoryIDs) > 0 {
+		db = db.Where("services.id IN (?)", s.repo.DB.Table("service_categories").Select("service_id").
+			Where("category_id IN ?", filter.CategoryIDs))
+	}
+	if filter.MinPrice != nil {
+		db = db.Where("services.price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		db = db.Where("services.price <= ?", *filter.MaxPrice)
+	}
+	if filter.MinDuration != nil {
+		db = db.Where("services.duration_minutes >= ?", *filter.MinDuration)
+	}
+	if filter.MaxDuration != nil {
+		db = db.Where("services.duration_minutes <= ?", *filter.MaxDuration)
+	}
+	if filter.Currency != "" {
+		db = db.Where("services.currency = ?", filter.Currency)
+	}
+	if filter.Verified != nil {
+		db = db.Where("services.user_id IN (?)", s.repo.DB.Table("users").Select("id").
+			Where("deleted_at IS NULL AND verified = ?", *filter.Verified))
+	}
+	if filter.MinRating != nil {
+		db = db.Where("services.user_id IN (?)", s.servitorRatings().Select("servitor_id").
+			Having("AVG(rating) >= ?", *filter.MinRating))
+	}
+	if filter.Language != "" {
+		db = db.Where("services.user_id IN (?)", s.repo.DB.Table("languages").Select("user_id").
+			Where("LOWER(language) = ?", strings.ToLower(filter.Language)))
+	}
+	if filter.Location != "" {
+		pattern := "%" + escapeLike(filter.Location) + "%"
+		db = db.Where("services.id IN (?)", s.repo.DB.Model(&Location{}).Select("service_id").
+			Where("location_name LIKE ? OR address LIKE ?", pattern, pattern))
+	}
+	return db
+}
+
+// servitorRatings selects the average rating of every rated servitor, for use as a subquery.
+// Ratings are given by customers to their completed bookings, servitors cannot rate themselves.
+func (s *ServiceRepoImpl) servitorRatings() *gorm.DB {
+	return s.repo.DB.Table("bookings").Select("servitor_id, AVG(rating) AS rating").
+		Where("rating IS NOT NULL").Group("servitor_id")
+}
+
+// GetServiceFacets loads the facet attributes of the services, the rating of a servitor who has
+// none is 0.
+func (s *ServiceRepoImpl) GetServiceFacets(ctx context.Context, ids []int) (*[]ServiceFacets, error) {
+	facets := []ServiceFacets{}
+	if len(ids) == 0 {
+		return &facets, nil
+	}
+	db := s.repo.DB.WithContext(ctx)
+	var rows []struct {
+		ServiceID int
+		Currency  string
+		Price     int64
+		Verified  bool
+		Rating    float64
+		UserID    int
+	}
+	err := db.Table("services").Select("services.id AS service_id, services.currency, services.price, "+
+		"services.user_id, users.verified, COALESCE(ratings.rating, 0) AS rating").
+		Joins("JOIN users ON users.id = services.user_id").
+		Joins("LEFT JOIN (?) AS ratings ON ratings.servitor_id = services.user_id", s.servitorRatings()).
+		Where("services.id IN ?", ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var categories []struct {
+		ServiceID  int
+		CategoryID int
+	}
+	err = db.Table("service_categories").Select("service_id, category_id").Where("service_id IN ?", ids).
+		Scan(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	var languages []struct {
+		UserID   int
+		Language string
+	}
+	err = db.Table("languages").Select("DISTINCT languages.user_id, languages.language").
+		Joins("JOIN services ON services.user_id = languages.user_id").Where("services.id IN ?", ids).
+		Scan(&languages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	categoriesByService := map[int][]int{}
+	for _, row := range categories {
+		categoriesByService[row.ServiceID] = append(categoriesByService[row.ServiceID], row.CategoryID)
+	}
+	languagesByUser := map[int][]string{}
+	for _, row := range languages {
+		languagesByUser[row.UserID] = append(languagesByUser[row.UserID], row.Language)
+	}
+	for _, row := range rows {
+		facets = append(facets, ServiceFacets{
+			ServiceID:   row.ServiceID,
+			Currency:    row.Currency,
+			Price:       row.Price,
+			Verified:    row.Verified,
+			Rating:      row.Rating,
+			CategoryIDs: categoriesByService[row.ServiceID],
+			Languages:   languagesByUser[row.UserID],
+		})
+	}
+	return &facets, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input.
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+func (s *ServiceRepoImpl) GetServicesByIDs(ctx context.Context, ids []int) (*[]Service, error) {
+	var services []Service
+	if len(ids) == 0 {
+		return &services, nil
+	}
+	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id IN ?", ids).Scopes(Published).
+		Preload(clause.Associations).Find(&services).Error
+	if err != nil {
+		return nil, err
+	}
+	return &services, nil
+}
+
 func (s *ServiceRepoImpl) ServiceCategories(ctx context.Context, serviceId int) (*[]Category, error) {
 	var cats []Category
-	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Where("service_id = ?", serviceId).Preload(clause.Associations).Take(&cats).Error
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).
+		Joins("JOIN service_categories ON service_categories.category_id = categories.id").
+		Where("service_categories.service_id = ?", serviceId).
+		Order("sort_order, category_name").Find(&cats).Error
 	if err != nil {
 		return nil, err
 	}
@@ -138,13 +471,608 @@ func (s *ServiceRepoImpl) ServiceCategories(ctx context.Context, serviceId int)
 
 func (s *ServiceRepoImpl) GetAllCategories(ctx context.Context) (*[]Category, error) {
 	var cats []Category
-	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Preload(clause.Associations).Find(&cats).Error
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Order("sort_order, category_name").Find(&cats).Error
 	if err != nil {
 		return nil, err
 	}
 	return &cats, nil
 }
 
+func (s *ServiceRepoImpl) GetCategoryByID(ctx context.Context, id int) (*Category, error) {
+	var cat Category
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Where("id = ?", id).Take(&cat).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cat, nil
+}
+
+func (s *ServiceRepoImpl) CountChildCategories(ctx context.Context, id int) (int64, error) {
+	var children int64
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Where("parent_id = ?", id).Count(&children).Error
+	return children, err
+}
+
+func (s *ServiceRepoImpl) GetCategoriesByIDs(ctx context.Context, ids []int) (*[]Category, error) {
+	var cats []Category
+	if len(ids) == 0 {
+		return &cats, nil
+	}
+	err := s.repo.DB.WithContext(ctx).Model(&Category{}).Where("id IN ?", ids).Find(&cats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cats, nil
+}
+
+// SetServiceCategories replaces the taxonomy nodes a service is listed under.
+func (s *ServiceRepoImpl) SetServiceCategories(ctx context.Context, serviceId int, categories []Category) error {
+	service := Service{ID: serviceId}
+	return s.repo.DB.WithContext(ctx).Model(&service).Omit("Category.*").Association("Category").Replace(categories)
+}
+
+// ServicesInCategories returns the services listed under any of the categories.
+func (s *ServiceRepoImpl) ServicesInCategories(ctx context.Context, categoryIds []int) (*[]Service, error) {
+	var services []Service
+	if len(categoryIds) == 0 {
+		return &services, nil
+	}
+	linked := s.repo.DB.Table("service_categories").Select("service_id").Where("category_id IN ?", categoryIds)
+	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id IN (?)", linked).Scopes(Published).
+		Preload(clause.Associations).Find(&services).Error
+	if err != nil {
+		return nil, err
+	}
+	return &services, nil
+}
+
+// ServicesByStatus returns services in the given status, least recently updated first so the
+// moderation queue is fair.
+func (s *ServiceRepoImpl) ServicesByStatus(ctx context.Context, status string) (*[]Service, error) {
+	var services []Service
+	err := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("status = ?", status).Order("last_updated_on").
+		Preload(clause.Associations).Find(&services).Error
+	if err != nil {
+		return nil, err
+	}
+	return &services, nil
+}
+
+// ChangeServiceStatus moves a service from change.FromStatus to change.ToStatus and records the
+// change, failing with ErrStatusChanged if the service is no longer in change.FromStatus.
+func (s *ServiceRepoImpl) ChangeServiceStatus(ctx context.Context, change StatusChange) (*Service, error) {
+	var service Service
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Service{}).Where("id = ?", change.ServiceID).
+			Take(&service).Error
+		if err != nil {
+			return err
+		}
+		if service.Status != change.FromStatus {
+			return ErrStatusChanged
+		}
+		now := time.Now()
+		err = tx.Model(&Service{}).Where("id = ?", change.ServiceID).Updates(map[string]interface{}{
+			"status":          change.ToStatus,
+			"last_updated_on": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		service.Status = change.ToStatus
+		service.LastUpdatedOn = now
+		return tx.Model(&StatusChange{}).Create(&change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+func (s *ServiceRepoImpl) ServiceStatusHistory(ctx context.Context, serviceId int) (*[]StatusChange, error) {
+	var history []StatusChange
+	err := s.repo.DB.WithContext(ctx).Model(&StatusChange{}).Where("service_id = ?", serviceId).Order("id").
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// SetCancellationPolicy replaces the cancellation policy of a service.
+func (s *ServiceRepoImpl) SetCancellationPolicy(ctx context.Context, service Service) error {
+	res := s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id = ?", service.ID).Updates(map[string]interface{}{
+		"free_cancellation_hours":       service.FreeCancellationHours,
+		"late_cancellation_fee_percent": service.LateCancellationFeePercent,
+		"no_show_fee_percent":           service.NoShowFeePercent,
+		"last_updated_on":               time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Published limits a service query to listings customers can see.
+func Published(db *gorm.DB) *gorm.DB {
+	return db.Where("services.status = ?", PublishedStatus)
+}
+
+// SetPricing replaces the pricing model, packages and add-ons of a service.
+func (s *ServiceRepoImpl) SetPricing(ctx context.Context, service Service) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Service{}).Where("id = ?", service.ID).Updates(map[string]interface{}{
+			"pricing_model":    service.PricingModel,
+			"price":            service.Price,
+			"currency":         service.Currency,
+			"unit_name":        service.UnitName,
+			"duration_minutes": service.DurationMinutes,
+			"service_cost":     service.ServiceCost,
+			"last_updated_on":  time.Now(),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return replacePrices(tx, service.ID, service.Packages, service.AddOns)
+	})
+}
+
+// replacePrices updates the packages and add-ons of a service to the given ones. Each is matched to
+// a row of the service by its ID, or else to the live package of its tier or add-on of its name,
+// and updated in place so the IDs quotes and bookings refer to stay valid. Rows left out are soft
+// deleted and come back with their IDs when a later change lists them again.
+func replacePrices(tx *gorm.DB, serviceId int, packages []Package, addOns []AddOn) error {
+	now := time.Now()
+	var currentPackages []Package
+	if err := tx.Unscoped().Model(&Package{}).Where("service_id = ?", serviceId).Find(&currentPackages).Error; err != nil {
+		return err
+	}
+	owned := map[int]bool{}
+	byTier := map[string]int{}
+	for _, pkg := range currentPackages {
+		owned[pkg.ID] = true
+		if !pkg.DeletedAt.Valid {
+			byTier[pkg.Tier] = pkg.ID
+		}
+	}
+	kept := map[int]bool{}
+	for _, pkg := range packages {
+		pkg.ID = matchRow(pkg.ID, byTier[pkg.Tier], owned, kept)
+		pkg.ServiceID = serviceId
+		if pkg.ID == 0 {
+			if err := tx.Model(&Package{}).Create(&pkg).Error; err != nil {
+				return err
+			}
+			kept[pkg.ID] = true
+			continue
+		}
+		err := tx.Unscoped().Model(&Package{}).Where("id = ?", pkg.ID).Updates(map[string]interface{}{
+			"tier":             pkg.Tier,
+			"name":             pkg.Name,
+			"description":      pkg.Description,
+			"price":            pkg.Price,
+			"duration_minutes": pkg.DurationMinutes,
+			"last_updated_on":  now,
+			"deleted_at":       nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := deleteOtherRows(tx, &Package{}, serviceId, kept, now); err != nil {
+		return err
+	}
+
+	var currentAddOns []AddOn
+	if err := tx.Unscoped().Model(&AddOn{}).Where("service_id = ?", serviceId).Find(&currentAddOns).Error; err != nil {
+		return err
+	}
+	owned = map[int]bool{}
+	byName := map[string]int{}
+	for _, addOn := range currentAddOns {
+		owned[addOn.ID] = true
+		if !addOn.DeletedAt.Valid {
+			byName[strings.ToLower(addOn.Name)] = addOn.ID
+		}
+	}
+	kept = map[int]bool{}
+	for _, addOn := range addOns {
+		addOn.ID = matchRow(addOn.ID, byName[strings.ToLower(addOn.Name)], owned, kept)
+		addOn.ServiceID = serviceId
+		if addOn.ID == 0 {
+			if err := tx.Model(&AddOn{}).Create(&addOn).Error; err != nil {
+				return err
+			}
+			kept[addOn.ID] = true
+			continue
+		}
+		err := tx.Unscoped().Model(&AddOn{}).Where("id = ?", addOn.ID).Updates(map[string]interface{}{
+			"name":            addOn.Name,
+			"price":           addOn.Price,
+			"last_updated_on": now,
+			"deleted_at":      nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return deleteOtherRows(tx, &AddOn{}, serviceId, kept, now)
+}
+
+// matchRow picks the row a new child of a service replaces: the row with its ID when the service
+// owns it, or else the row with the same key. It returns 0 when a new row is needed and marks the
+// row picked as kept, so two children never share a row.
+func matchRow(id int, sameKey int, owned map[int]bool, kept map[int]bool) int {
+	switch {
+	case id > 0 && owned[id] && !kept[id]:
+	case sameKey > 0 && !kept[sameKey]:
+		id = sameKey
+	default:
+		return 0
+	}
+	kept[id] = true
+	return id
+}
+
+// deleteOtherRows soft deletes the live rows of the service's model that were not kept.
+func deleteOtherRows(tx *gorm.DB, model interface{}, serviceId int, kept map[int]bool, deletedAt time.Time) error {
+	query := tx.Model(model).Where("service_id = ?", serviceId)
+	if len(kept) > 0 {
+		ids := make([]int, 0, len(kept))
+		for id := range kept {
+			ids = append(ids, id)
+		}
+		query = query.Where("id NOT IN ?", ids)
+	}
+	return query.Update("deleted_at", deletedAt).Error
+}
+
+// RecordVersion snapshots the current state of a service as its next version. Nothing is recorded
+// when the service is unchanged since the latest version, which is returned instead.
+func (s *ServiceRepoImpl) RecordVersion(ctx context.Context, serviceId int, changedBy int,
+	summary string) (*ServiceVersion, error) {
+	var version ServiceVersion
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the service so concurrent changes get consecutive version numbers
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Service{}).Select("id").
+			Where("id = ?", serviceId).Take(&Service{}).Error
+		if err != nil {
+			return err
+		}
+		var service Service
+		err = tx.Model(&Service{}).Where("id = ?", serviceId).Preload(clause.Associations).Take(&service).Error
+		if err != nil {
+			return err
+		}
+		snapshot, err := json.Marshal(service.Snapshot())
+		if err != nil {
+			return err
+		}
+
+		var latest []ServiceVersion
+		err = tx.Model(&ServiceVersion{}).Where("service_id = ?", serviceId).Order("version DESC").Limit(1).
+			Find(&latest).Error
+		if err != nil {
+			return err
+		}
+		if len(latest) > 0 && latest[0].Snapshot == string(snapshot) {
+			version = latest[0]
+			return nil
+		}
+		version = ServiceVersion{
+			ServiceID: serviceId,
+			Version:   1,
+			Snapshot:  string(snapshot),
+			Summary:   summary,
+			ChangedBy: changedBy,
+		}
+		if len(latest) > 0 {
+			version.Version = latest[0].Version + 1
+		}
+		return tx.Model(&ServiceVersion{}).Create(&version).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (s *ServiceRepoImpl) ServiceVersions(ctx context.Context, serviceId int) (*[]ServiceVersion, error) {
+	var versions []ServiceVersion
+	err := s.repo.DB.WithContext(ctx).Model(&ServiceVersion{}).Where("service_id = ?", serviceId).Order("version").
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &versions, nil
+}
+
+func (s *ServiceRepoImpl) GetServiceVersion(ctx context.Context, serviceId int, version int) (*ServiceVersion, error) {
+	var serviceVersion ServiceVersion
+	err := s.repo.DB.WithContext(ctx).Model(&ServiceVersion{}).Where("service_id = ? AND version = ?", serviceId, version).
+		Take(&serviceVersion).Error
+	if err != nil {
+		return nil, err
+	}
+	return &serviceVersion, nil
+}
+
+// RestoreSnapshot puts a service back in the state captured by the snapshot. Locations, packages
+// and add-ons are updated in place, and categories removed from the taxonomy since are left out.
+func (s *ServiceRepoImpl) RestoreSnapshot(ctx context.Context, serviceId int, snapshot ServiceSnapshot) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return applySnapshot(tx, serviceId, snapshot)
+	})
+}
+
+// ImportServices creates and updates services in a single transaction so an import is applied
+// completely or not at all. It returns the ids of the created services in order.
+func (s *ServiceRepoImpl) ImportServices(ctx context.Context, creates []Service, updates map[int]ServiceSnapshot) ([]int, error) {
+	var ids []int
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for id, snapshot := range updates {
+			if err := applySnapshot(tx, id, snapshot); err != nil {
+				return err
+			}
+		}
+		for _, service := range creates {
+			for i := range service.LocationInfo {
+				service.LocationInfo[i].Geohash = geo.Geohash(service.LocationInfo[i].Point(), geo.GeohashPrecision)
+			}
+			if err := tx.Model(&Service{}).Omit("Category.*").Create(&service).Error; err != nil {
+				return err
+			}
+			err := tx.Model(&StatusChange{}).Create(&StatusChange{
+				ServiceID: service.ID,
+				ToStatus:  service.Status,
+				ChangedBy: service.UserID,
+			}).Error
+			if err != nil {
+				return err
+			}
+			ids = append(ids, service.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// applySnapshot puts a service in the state captured by the snapshot.
+func applySnapshot(tx *gorm.DB, serviceId int, snapshot ServiceSnapshot) error {
+	now := time.Now()
+	res := tx.Model(&Service{}).Where("id = ?", serviceId).Updates(map[string]interface{}{
+		"service_name":                  snapshot.ServiceName,
+		"service_image":                 snapshot.ServiceImage,
+		"service_duration":              snapshot.ServiceDuration,
+		"service_cost":                  snapshot.ServiceCost,
+		"pricing_model":                 snapshot.PricingModel,
+		"price":                         snapshot.Price,
+		"currency":                      snapshot.Currency,
+		"unit_name":                     snapshot.UnitName,
+		"duration_minutes":              snapshot.DurationMinutes,
+		"free_cancellation_hours":       snapshot.FreeCancellationHours,
+		"late_cancellation_fee_percent": snapshot.LateCancellationFeePercent,
+		"no_show_fee_percent":           snapshot.NoShowFeePercent,
+		"last_updated_on":               now,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	var packages []Package
+	for _, pkg := range snapshot.Packages {
+		packages = append(packages, Package{
+			Tier:            pkg.Tier,
+			Name:            pkg.Name,
+			Description:     pkg.Description,
+			Price:           pkg.Price,
+			DurationMinutes: pkg.DurationMinutes,
+		})
+	}
+	var addOns []AddOn
+	for _, addOn := range snapshot.AddOns {
+		addOns = append(addOns, AddOn{Name: addOn.Name, Price: addOn.Price})
+	}
+	if err := replacePrices(tx, serviceId, packages, addOns); err != nil {
+		return err
+	}
+
+	if err := restoreLocations(tx, serviceId, snapshot.Locations, now); err != nil {
+		return err
+	}
+
+	var categories []Category
+	if len(snapshot.CategoryIDs) > 0 {
+		if err := tx.Model(&Category{}).Where("id IN ?", snapshot.CategoryIDs).Find(&categories).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&Service{ID: serviceId}).Omit("Category.*").Association("Category").Replace(categories)
+}
+
+// restoreLocations updates the locations of a service to the snapshot's. Locations are matched by
+// ID and updated in place, deleted ones coming back with the gallery items deleted with them, so
+// galleries stay attached. Locations left out are soft deleted along with their galleries.
+func restoreLocations(tx *gorm.DB, serviceId int, locations []LocationSnapshot, now time.Time) error {
+	var current []Location
+	if err := tx.Unscoped().Model(&Location{}).Where("service_id = ?", serviceId).Find(&current).Error; err != nil {
+		return err
+	}
+	owned := map[int]bool{}
+	deletedAt := map[int]gorm.DeletedAt{}
+	for _, loc := range current {
+		owned[loc.ID] = true
+		deletedAt[loc.ID] = loc.DeletedAt
+	}
+	kept := map[int]bool{}
+	for _, snapshot := range locations {
+		location := Location{
+			ID:            matchRow(snapshot.ID, 0, owned, kept),
+			ServiceID:     serviceId,
+			LocationImage: snapshot.LocationImage,
+			LocationName:  snapshot.LocationName,
+			Latitude:      snapshot.Latitude,
+			Longitude:     snapshot.Longitude,
+			Address:       snapshot.Address,
+		}
+		location.Geohash = geo.Geohash(location.Point(), geo.GeohashPrecision)
+		if location.ID == 0 {
+			if err := tx.Model(&Location{}).Create(&location).Error; err != nil {
+				return err
+			}
+			kept[location.ID] = true
+			continue
+		}
+		if deleted := deletedAt[location.ID]; deleted.Valid {
+			err := tx.Unscoped().Model(&Media{}).Where("location_id = ? AND deleted_at = ?", location.ID, deleted).
+				Update("deleted_at", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Unscoped().Model(&Location{}).Where("id = ?", location.ID).Updates(map[string]interface{}{
+			"location_image":  location.LocationImage,
+			"location_name":   location.LocationName,
+			"latitude":        location.Latitude,
+			"longitude":       location.Longitude,
+			"geohash":         location.Geohash,
+			"address":         location.Address,
+			"last_updated_on": now,
+			"deleted_at":      nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	var removed []int
+	for _, loc := range current {
+		if !loc.DeletedAt.Valid && !kept[loc.ID] {
+			removed = append(removed, loc.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Model(&Location{}).Where("id IN ?", removed).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Media{}).Where("location_id IN ?", removed).Update("deleted_at", now).Error
+}
+
+// BackfillPricing gives services created before pricing models a fixed price in the currency,
+// converted from their service cost, and parses durations such as "1h30m" into minutes.
+func (s *ServiceRepoImpl) BackfillPricing(ctx context.Context, currency string) (int64, error) {
+	var services []Service
+	err := s.repo.DB.WithContext(ctx).Model(&Service{}).
+		Where("pricing_model = '' OR pricing_model IS NULL").Find(&services).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, svc := range services {
+		updates := map[string]interface{}{
+			"pricing_model": FixedPricing,
+			"price":         money.FromMajor(svc.ServiceCost, currency),
+			"currency":      currency,
+		}
+		if duration, err := time.ParseDuration(svc.ServiceDuration); err == nil && svc.DurationMinutes == 0 {
+			updates["duration_minutes"] = int(duration.Minutes())
+		}
+		err = s.repo.DB.WithContext(ctx).Model(&Service{}).Where("id = ?", svc.ID).Updates(updates).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(services)), nil
+}
+
+// legacyCategory is a category row from before the shared taxonomy, when every service kept its
+// own copy of each category.
+type legacyCategory struct {
+	ID            int
+	ServiceID     *int
+	CategoryImage string
+	CategoryName  string
+	DeletedAt     gorm.DeletedAt
+}
+
+// MigrateCategoryTaxonomy folds the per service category copies into shared taxonomy nodes. Rows
+// are merged by slug, the oldest row of each group is kept and every service that had a copy is
+// linked to it. It does nothing once the legacy service_id column has been dropped.
+func (s *ServiceRepoImpl) MigrateCategoryTaxonomy(ctx context.Context) (int64, error) {
+	db := s.repo.DB.WithContext(ctx)
+	if !db.Migrator().HasColumn(&Category{}, "service_id") {
+		return 0, nil
+	}
+	var merged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rows []legacyCategory
+		err := tx.Table("categories").Select("id, service_id, category_image, category_name, deleted_at").
+			Order("id").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		kept := map[string]int{}
+		for _, row := range rows {
+			slug := Slugify(row.CategoryName)
+			if slug == "" {
+				slug = fmt.Sprintf("category-%d", row.ID)
+			}
+			keptID, ok := kept[slug]
+			if !ok {
+				keptID = row.ID
+				kept[slug] = row.ID
+				if err = tx.Table("categories").Where("id = ?", row.ID).Update("slug", slug).Error; err != nil {
+					return err
+				}
+			}
+			if row.ServiceID != nil && *row.ServiceID > 0 && !row.DeletedAt.Valid {
+				err = tx.Exec("INSERT IGNORE INTO service_categories (service_id, category_id) VALUES (?, ?)",
+					*row.ServiceID, keptID).Error
+				if err != nil {
+					return err
+				}
+			}
+			if keptID != row.ID {
+				if err = tx.Exec("DELETE FROM categories WHERE id = ?", row.ID).Error; err != nil {
+					return err
+				}
+				merged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if db.Migrator().HasConstraint(&Category{}, "fk_services_category") {
+		if err = db.Migrator().DropConstraint(&Category{}, "fk_services_category"); err != nil {
+			return merged, err
+		}
+	}
+	return merged, db.Migrator().DropColumn(&Category{}, "service_id")
+}
+
+// Slugify lowercases the name and joins its words with hyphens.
+func Slugify(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
 func (s *ServiceRepoImpl) ServiceLocations(ctx context.Context, serviceId int) (*[]Location, error) {
 	var locs []Location
 	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Where("service_id = ?", serviceId).Preload(clause.Associations).Take(&locs).Error
@@ -154,6 +1082,15 @@ func (s *ServiceRepoImpl) ServiceLocations(ctx context.Context, serviceId int) (
 	return &locs, nil
 }
 
+func (s *ServiceRepoImpl) GetLocationByID(ctx context.Context, id int) (*Location, error) {
+	var loc Location
+	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Where("id = ?", id).Take(&loc).Error
+	if err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
+
 func (s *ServiceRepoImpl) GetAllLocations(ctx context.Context) (*[]Location, error) {
 	var locs []Location
 	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Preload(clause.Associations).Find(&locs).Error
@@ -162,3 +1099,446 @@ func (s *ServiceRepoImpl) GetAllLocations(ctx context.Context) (*[]Location, err
 	}
 	return &locs, nil
 }
+
+// LocationsWithin returns the locations inside the box, the geohash prefixes covering the box narrow
+// the scan down through the geohash index before the exact coordinate filter is applied.
+func (s *ServiceRepoImpl) LocationsWithin(ctx context.Context, box geo.BoundingBox) (*[]Location, error) {
+	var locs []Location
+	prefixes := geo.CoveringPrefixes(box)
+	conditions := make([]string, len(prefixes))
+	args := make([]interface{}, len(prefixes))
+	for i, prefix := range prefixes {
+		conditions[i] = "geohash LIKE ?"
+		args[i] = prefix + "%"
+	}
+	err := s.repo.DB.WithContext(ctx).Model(&Location{}).
+		Where(strings.Join(conditions, " OR "), args...).
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+			box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude).
+		Find(&locs).Error
+	if err != nil {
+		return nil, err
+	}
+	return &locs, nil
+}
+
+// BackfillGeohashes computes the geohash of locations saved before geohashes were stored.
+func (s *ServiceRepoImpl) BackfillGeohashes(ctx context.Context) (int64, error) {
+	var locs []Location
+	err := s.repo.DB.WithContext(ctx).Model(&Location{}).Where("geohash = '' OR geohash IS NULL").Find(&locs).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, loc := range locs {
+		err = s.repo.DB.WithContext(ctx).Model(&Location{}).Where("id = ?", loc.ID).
+			Update("geohash", geo.Geohash(loc.Point(), geo.GeohashPrecision)).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(locs)), nil
+}
+
+func (s *ServiceRepoImpl) CreateCoverageArea(ctx context.Context, area CoverageArea) (*CoverageArea, error) {
+	err := s.repo.DB.WithContext(ctx).Model(&CoverageArea{}).Create(&area).Error
+	if err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
+
+func (s *ServiceRepoImpl) ServiceCoverageAreas(ctx context.Context, serviceId int) (*[]CoverageArea, error) {
+	var areas []CoverageArea
+	err := s.repo.DB.WithContext(ctx).Model(&CoverageArea{}).Where("service_id = ?", serviceId).Find(&areas).Error
+	if err != nil {
+		return nil, err
+	}
+	return &areas, nil
+}
+
+func (s *ServiceRepoImpl) GetCoverageAreaByID(ctx context.Context, id int) (*CoverageArea, error) {
+	var area CoverageArea
+	err := s.repo.DB.WithContext(ctx).Model(&CoverageArea{}).Where("id = ?", id).Take(&area).Error
+	if err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
+
+func (s *ServiceRepoImpl) DeleteCoverageArea(ctx context.Context, id int) error {
+	res := s.repo.DB.WithContext(ctx).Where("id = ?", id).Delete(&CoverageArea{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CoverageAreasAround returns the areas whose bounding box contains the point, callers still have
+// to check the exact geometry.
+func (s *ServiceRepoImpl) CoverageAreasAround(ctx context.Context, point geo.Point) (*[]CoverageArea, error) {
+	var areas []CoverageArea
+	err := s.repo.DB.WithContext(ctx).Model(&CoverageArea{}).
+		Where("min_latitude <= ? AND max_latitude >= ?", point.Latitude, point.Latitude).
+		Where("min_longitude <= ? AND max_longitude >= ?", point.Longitude, point.Longitude).
+		Find(&areas).Error
+	if err != nil {
+		return nil, err
+	}
+	return &areas, nil
+}
+
+// DeleteService soft deletes a service together with its locations, coverage areas and prices.
+func (s *ServiceRepoImpl) DeleteService(ctx context.Context, id int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var service Service
+		if err := tx.Model(&Service{}).Where("id = ?", id).Take(&service).Error; err != nil {
+			return err
+		}
+		return DeleteServicesWhere(tx, time.Now(), "id = ?", id)
+	})
+}
+
+// RestoreService restores a service and the children that were deleted along with it.
+func (s *ServiceRepoImpl) RestoreService(ctx context.Context, id int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var service Service
+		err := tx.Unscoped().Model(&Service{}).Where("id = ? AND deleted_at IS NOT NULL", id).Take(&service).Error
+		if err != nil {
+			return err
+		}
+		return RestoreServicesWhere(tx, service.DeletedAt.Time, "id = ?", id)
+	})
+}
+
+// DeleteLocation soft deletes the location along with its gallery.
+func (s *ServiceRepoImpl) DeleteLocation(ctx context.Context, id int) error {
+	deletedAt := time.Now()
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Location{}).Where("id = ?", id).Update("deleted_at", deletedAt)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&Media{}).Where("location_id = ?", id).Update("deleted_at", deletedAt).Error
+	})
+}
+
+// RestoreLocation restores the location and the gallery items deleted with it.
+func (s *ServiceRepoImpl) RestoreLocation(ctx context.Context, id int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var loc Location
+		err := tx.Unscoped().Model(&Location{}).Where("id = ? AND deleted_at IS NOT NULL", id).Take(&loc).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&Media{}).Where("location_id = ? AND deleted_at = ?", id, loc.DeletedAt).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&Location{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	})
+}
+
+// DeleteCategory soft deletes a taxonomy node, its links to services are kept so restoring the
+// category lists the services under it again.
+func (s *ServiceRepoImpl) DeleteCategory(ctx context.Context, id int) error {
+	res := s.repo.DB.WithContext(ctx).Where("id = ?", id).Delete(&Category{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *ServiceRepoImpl) RestoreCategory(ctx context.Context, id int) error {
+	res := s.repo.DB.WithContext(ctx).Unscoped().Model(&Category{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes services and their children deleted before the given time.
+func (s *ServiceRepoImpl) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM service_categories WHERE service_id IN (?) OR category_id IN (?)",
+			tx.Unscoped().Model(&Service{}).Select("id").Where("deleted_at < ?", before),
+			tx.Unscoped().Model(&Category{}).Select("id").Where("deleted_at < ?", before)).Error
+		if err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&StatusChange{}, &ServiceVersion{}} {
+			err = tx.Where("service_id IN (?)", tx.Unscoped().Model(&Service{}).Select("id").Where("deleted_at < ?", before)).
+				Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, model := range append(serviceChildren(), &Category{}, &Service{}) {
+			if _, ok := model.(*Media); ok {
+				// Media rows are purged with PurgeMedia once their blobs are gone
+				continue
+			}
+			res := tx.Unscoped().Where("deleted_at < ?", before).Delete(model)
+			if res.Error != nil {
+				return res.Error
+			}
+			purged += res.RowsAffected
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// DeleteServicesWhere soft deletes the matching services and cascades to their children, stamping
+// every row with the same deletion time so they can be restored together.
+func DeleteServicesWhere(tx *gorm.DB, deletedAt time.Time, query string, args ...interface{}) error {
+	var ids []int
+	err := tx.Model(&Service{}).Where(query, args...).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	for _, child := range serviceChildren() {
+		err = tx.Model(child).Where("service_id IN ?", ids).Update("deleted_at", deletedAt).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Model(&Service{}).Where("id IN ?", ids).Update("deleted_at", deletedAt).Error
+}
+
+// RestoreServicesWhere restores the matching services deleted at the given time along with the
+// children that were cascaded by the same deletion.
+func RestoreServicesWhere(tx *gorm.DB, deletedAt time.Time, query string, args ...interface{}) error {
+	var ids []int
+	err := tx.Unscoped().Model(&Service{}).Where(query, args...).Where("deleted_at = ?", deletedAt).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	for _, child := range serviceChildren() {
+		err = tx.Unscoped().Model(child).Where("service_id IN ? AND deleted_at = ?", ids, deletedAt).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Model(&Service{}).Where("id IN ?", ids).Update("deleted_at", nil).Error
+}
+
+// serviceChildren lists the models owned by a service, they are deleted and restored with it.
+func serviceChildren() []interface{} {
+	return []interface{}{&Location{}, &CoverageArea{}, &Package{}, &AddOn{}, &Media{}}
+}
+
+// CreateMedia appends the item to the end of its gallery, the first image of a gallery becomes its cover.
+func (s *ServiceRepoImpl) CreateMedia(ctx context.Context, media Media) (*Media, error) {
+	err := s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the service so concurrent uploads get distinct positions
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Service{}).Select("id").
+			Where("id = ?", media.ServiceID).Take(&Service{}).Error
+		if err != nil {
+			return err
+		}
+		var last struct {
+			Position int
+			Covers   int
+		}
+		err = tx.Model(&Media{}).Scopes(gallery(media.ServiceID, media.LocationID)).
+			Select("COALESCE(MAX(position), 0) AS position, COALESCE(SUM(is_cover), 0) AS covers").Take(&last).Error
+		if err != nil {
+			return err
+		}
+		media.Position = last.Position + 1
+		media.IsCover = last.Covers == 0 && media.Kind == ImageMedia
+		if err = tx.Create(&media).Error; err != nil {
+			return err
+		}
+		if media.IsCover {
+			return syncCoverImage(tx, media)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (s *ServiceRepoImpl) GalleryMedia(ctx context.Context, serviceId int, locationId *int) (*[]Media, error) {
+	var media []Media
+	err := s.repo.DB.WithContext(ctx).Model(&Media{}).Scopes(gallery(serviceId, locationId)).
+		Preload("Renditions").Order("position, id").Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (s *ServiceRepoImpl) GetMediaByID(ctx context.Context, id int) (*Media, error) {
+	var media Media
+	err := s.repo.DB.WithContext(ctx).Model(&Media{}).Where("id = ?", id).Preload("Renditions").Take(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (s *ServiceRepoImpl) UpdateMediaCaption(ctx context.Context, id int, caption string) error {
+	res := s.repo.DB.WithContext(ctx).Model(&Media{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"caption":         caption,
+		"last_updated_on": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetCoverMedia makes the item the cover of its gallery and copies its image to the service or
+// location it belongs to.
+func (s *ServiceRepoImpl) SetCoverMedia(ctx context.Context, id int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var media Media
+		err := tx.Model(&Media{}).Where("id = ?", id).Preload("Renditions").Take(&media).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Media{}).Scopes(gallery(media.ServiceID, media.LocationID)).
+			Update("is_cover", gorm.Expr("id = ?", id)).Error
+		if err != nil {
+			return err
+		}
+		return syncCoverImage(tx, media)
+	})
+}
+
+// ReorderMedia renumbers the gallery in the order of ids, which must hold every item of the gallery.
+func (s *ServiceRepoImpl) ReorderMedia(ctx context.Context, serviceId int, locationId *int, ids []int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current []int
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Media{}).
+			Scopes(gallery(serviceId, locationId)).Pluck("id", &current).Error
+		if err != nil {
+			return err
+		}
+		if len(current) != len(ids) {
+			return ErrGalleryChanged
+		}
+		positions := map[int]int{}
+		for i, id := range ids {
+			positions[id] = i + 1
+		}
+		for _, id := range current {
+			if _, ok := positions[id]; !ok {
+				return ErrGalleryChanged
+			}
+		}
+		for id, position := range positions {
+			err = tx.Model(&Media{}).Where("id = ?", id).Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMedia soft deletes the item, when it was the cover the next image of the gallery takes over.
+func (s *ServiceRepoImpl) DeleteMedia(ctx context.Context, id int) error {
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var media Media
+		err := tx.Model(&Media{}).Where("id = ?", id).Preload("Renditions").Take(&media).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Media{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"is_cover":   false,
+			"deleted_at": time.Now(),
+		}).Error
+		if err != nil || !media.IsCover {
+			return err
+		}
+		var next Media
+		err = tx.Model(&Media{}).Scopes(gallery(media.ServiceID, media.LocationID)).
+			Where("kind = ?", ImageMedia).Preload("Renditions").Order("position, id").Take(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return clearCoverImage(tx, media)
+		}
+		if err != nil {
+			return err
+		}
+		if err = tx.Model(&Media{}).Where("id = ?", next.ID).Update("is_cover", true).Error; err != nil {
+			return err
+		}
+		return syncCoverImage(tx, next)
+	})
+}
+
+func (s *ServiceRepoImpl) DeletedMediaBefore(ctx context.Context, before time.Time) (*[]Media, error) {
+	var media []Media
+	err := s.repo.DB.WithContext(ctx).Unscoped().Model(&Media{}).Where("deleted_at < ?", before).
+		Preload("Renditions").Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// PurgeMedia permanently removes the media rows and their renditions.
+func (s *ServiceRepoImpl) PurgeMedia(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id IN ?", ids).Delete(&MediaRendition{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&Media{}).Error
+	})
+}
+
+// gallery narrows a media query to the gallery of a service, or of one of its locations.
+func gallery(serviceId int, locationId *int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("service_id = ?", serviceId)
+		if locationId == nil {
+			return db.Where("location_id IS NULL")
+		}
+		return db.Where("location_id = ?", *locationId)
+	}
+}
+
+// syncCoverImage copies the cover to the image column of the service or location of its gallery.
+func syncCoverImage(tx *gorm.DB, cover Media) error {
+	if cover.LocationID != nil {
+		return tx.Model(&Location{}).Where("id = ?", *cover.LocationID).Update("location_image", cover.CoverURL()).Error
+	}
+	return tx.Model(&Service{}).Where("id = ?", cover.ServiceID).Update("service_image", cover.CoverURL()).Error
+}
+
+// clearCoverImage empties the image column when it still shows a cover that was removed.
+func clearCoverImage(tx *gorm.DB, cover Media) error {
+	if cover.LocationID != nil {
+		return tx.Model(&Location{}).Where("id = ? AND location_image = ?", *cover.LocationID, cover.CoverURL()).
+			Update("location_image", "").Error
+	}
+	return tx.Model(&Service{}).Where("id = ? AND service_image = ?", cover.ServiceID, cover.CoverURL()).
+		Update("service_image", "").Error
+}
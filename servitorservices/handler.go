@@ -1,9 +1,16 @@
 package servitorservices
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"net/http"
+	"servhunt/infra/geo"
+	"servhunt/infra/imaging"
 	"servhunt/infra/utils"
+	"servhunt/servitorservices/dao"
 	"strconv"
 )
 
@@ -17,10 +24,44 @@ type ServitorServicesHandler interface {
 	GetAllServices(ctx *gin.Context)
 	GetAllLocations(ctx *gin.Context)
 	GetAllCategories(ctx *gin.Context)
+	GetCategoryTree(ctx *gin.Context)
+	GetCategoryServices(ctx *gin.Context)
+	SetServiceCategories(ctx *gin.Context)
+	SetPricing(ctx *gin.Context)
+	SetCancellationPolicy(ctx *gin.Context)
+	QuoteService(ctx *gin.Context)
+	ChangeServiceStatus(ctx *gin.Context)
+	GetStatusHistory(ctx *gin.Context)
+	GetServiceHistory(ctx *gin.Context)
+	RevertService(ctx *gin.Context)
+	ImportServices(ctx *gin.Context)
+	ExportServices(ctx *gin.Context)
+	UploadMedia(ctx *gin.Context)
+	GetGallery(ctx *gin.Context)
+	UpdateMedia(ctx *gin.Context)
+	SetCoverMedia(ctx *gin.Context)
+	ReorderGallery(ctx *gin.Context)
+	DeleteMedia(ctx *gin.Context)
+	GetModerationQueue(ctx *gin.Context)
+	ApproveService(ctx *gin.Context)
+	RejectService(ctx *gin.Context)
 	GetServiceLocations(ctx *gin.Context)
 	GetServiceCategories(ctx *gin.Context)
 	GetServiceByID(ctx *gin.Context)
 	ServitorsService(ctx *gin.Context)
+	SearchServices(ctx *gin.Context)
+	NearbyServices(ctx *gin.Context)
+	ServicesWithin(ctx *gin.Context)
+	CreateCoverageArea(ctx *gin.Context)
+	GetCoverageAreas(ctx *gin.Context)
+	DeleteCoverageArea(ctx *gin.Context)
+	ServicesCovering(ctx *gin.Context)
+	DeleteService(ctx *gin.Context)
+	DeleteLocationInfo(ctx *gin.Context)
+	DeleteCategory(ctx *gin.Context)
+	RestoreService(ctx *gin.Context)
+	RestoreLocationInfo(ctx *gin.Context)
+	RestoreCategory(ctx *gin.Context)
 }
 
 type ServitorServicesHandlerImpl struct {
@@ -38,8 +79,14 @@ func (s *ServitorServicesHandlerImpl) CreateService(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
+	caller, _ := utils.GetCaller(ctx)
+	req.UserID = caller.ID
 
 	service, err := s.ServitorServices.CreateService(ctx, req)
+	if errors.Is(err, ErrUnknownCategory) || errors.Is(err, ErrInvalidPricing) {
+		utils.APIResponse(ctx, "Failed to create service", http.StatusBadRequest, false, err.Error())
+		return
+	}
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -53,20 +100,12 @@ func (s *ServitorServicesHandlerImpl) CreateService(ctx *gin.Context) {
 }
 
 func (s *ServitorServicesHandlerImpl) UpdateService(ctx *gin.Context) {
-
-	fetchReq := FetchByIdRequest{}
 	id, err := strconv.Atoi(ctx.Param("service_id"))
 	if err != nil {
 		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
 			false, err.Error())
 		return
 	}
-	fetchReq.ServiceId = id
-	if err := ctx.ShouldBindJSON(&fetchReq); err != nil {
-		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
-			false, err.Error())
-		return
-	}
 
 	req := UpdateServiceRequest{}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -74,11 +113,10 @@ func (s *ServitorServicesHandlerImpl) UpdateService(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	req.ID = fetchReq.ServiceId
-	service, err := s.ServitorServices.UpdateService(ctx, req)
-	if err != nil {
-		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
-			false, err.Error())
+	req.ID = id
+	caller, _ := utils.GetCaller(ctx)
+	service, err := s.ServitorServices.UpdateService(ctx, caller, req)
+	if ownershipError(ctx, err) {
 		return
 	}
 	if service.ServiceId > 0 {
@@ -96,10 +134,9 @@ func (s *ServitorServicesHandlerImpl) CreateLocationInfo(ctx *gin.Context) {
 		return
 	}
 
-	location, err := s.ServitorServices.CreateLocationInfo(ctx, req)
-	if err != nil {
-		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
-			false, err.Error())
+	caller, _ := utils.GetCaller(ctx)
+	location, err := s.ServitorServices.CreateLocationInfo(ctx, caller, req)
+	if ownershipError(ctx, err) {
 		return
 	}
 	if location.LocationID > 0 {
@@ -110,20 +147,12 @@ func (s *ServitorServicesHandlerImpl) CreateLocationInfo(ctx *gin.Context) {
 }
 
 func (s *ServitorServicesHandlerImpl) UpdateLocationInfo(ctx *gin.Context) {
-
-	fetchReq := FetchLocByIdRequest{}
 	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
 			false, err.Error())
 		return
 	}
-	fetchReq.LocationID = id
-	if err := ctx.ShouldBindJSON(&fetchReq); err != nil {
-		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
-			false, err.Error())
-		return
-	}
 
 	req := UpdateLocationInfoRequest{}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -131,11 +160,10 @@ func (s *ServitorServicesHandlerImpl) UpdateLocationInfo(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	req.ID = fetchReq.LocationID
-	location, err := s.ServitorServices.UpdateLocationInfo(ctx, req)
-	if err != nil {
-		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
-			false, err.Error())
+	req.ID = id
+	caller, _ := utils.GetCaller(ctx)
+	location, err := s.ServitorServices.UpdateLocationInfo(ctx, caller, req)
+	if ownershipError(ctx, err) {
 		return
 	}
 	if location.LocationID > 0 {
@@ -145,6 +173,22 @@ func (s *ServitorServicesHandlerImpl) UpdateLocationInfo(ctx *gin.Context) {
 	utils.APIResponse(ctx, "Failed to update location", http.StatusBadRequest, false, nil)
 }
 
+// ownershipError writes the response for a failed change to a service and reports whether it did.
+func ownershipError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotServiceOwner):
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
 func (s *ServitorServicesHandlerImpl) CreateCategory(ctx *gin.Context) {
 	req := CategoryRequest{}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -154,9 +198,7 @@ func (s *ServitorServicesHandlerImpl) CreateCategory(ctx *gin.Context) {
 	}
 
 	category, err := s.ServitorServices.CreateCategory(ctx, req)
-	if err != nil {
-		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
-			false, err.Error())
+	if categoryError(ctx, err) {
 		return
 	}
 	if category.CategoryId > 0 {
@@ -167,20 +209,12 @@ func (s *ServitorServicesHandlerImpl) CreateCategory(ctx *gin.Context) {
 }
 
 func (s *ServitorServicesHandlerImpl) UpdateCategory(ctx *gin.Context) {
-
-	fetchReq := FetchCatByIdRequest{}
 	id, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
 			false, err.Error())
 		return
 	}
-	fetchReq.CategoryId = id
-	if err := ctx.ShouldBindJSON(&fetchReq); err != nil {
-		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
-			false, err.Error())
-		return
-	}
 
 	req := UpdateCategoryRequest{}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -188,11 +222,10 @@ func (s *ServitorServicesHandlerImpl) UpdateCategory(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
+	req.ID = id
 
 	category, err := s.ServitorServices.UpdateCategory(ctx, req)
-	if err != nil {
-		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
-			false, err.Error())
+	if categoryError(ctx, err) {
 		return
 	}
 	if category.CategoryId > 0 {
@@ -202,18 +235,91 @@ func (s *ServitorServicesHandlerImpl) UpdateCategory(ctx *gin.Context) {
 	utils.APIResponse(ctx, "Failed to update  category", http.StatusBadRequest, false, nil)
 }
 
-func (s *ServitorServicesHandlerImpl) GetAllServices(ctx *gin.Context) {
-	users, err := s.ServitorServices.GetAllServices(ctx)
+func (s *ServitorServicesHandlerImpl) GetCategoryTree(ctx *gin.Context) {
+	tree, err := s.ServitorServices.CategoryTree(ctx)
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
 		return
 	}
-	if len(*users) > 0 {
-		utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, users)
+	utils.APIResponse(ctx, "Categories successfully returned", http.StatusOK, true, tree)
+}
+
+func (s *ServitorServicesHandlerImpl) GetCategoryServices(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	services, err := s.ServitorServices.CategoryServices(ctx, id)
+	if categoryError(ctx, err) {
 		return
 	}
-	utils.APIResponse(ctx, "Failed to return services", http.StatusBadRequest, false, nil)
+	utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, services)
+}
+
+func (s *ServitorServicesHandlerImpl) SetServiceCategories(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := ServiceCategoriesRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	categories, err := s.ServitorServices.SetServiceCategories(ctx, caller, id, req)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if categoryError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Service categories updated successfully", http.StatusOK, true, categories)
+}
+
+// categoryError writes the response for a failed taxonomy call and reports whether it did.
+func categoryError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrUnknownCategory), errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Category not found", http.StatusNotFound, false, err.Error())
+	case errors.Is(err, ErrDuplicateCategory):
+		utils.APIResponse(ctx, "Category already exists", http.StatusConflict, false, err.Error())
+	case errors.Is(err, ErrCategoryCycle):
+		utils.APIResponse(ctx, "Invalid category parent", http.StatusBadRequest, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (s *ServitorServicesHandlerImpl) GetAllServices(ctx *gin.Context) {
+	req := ListServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	services, err := s.ServitorServices.ListServices(ctx, req)
+	if errors.Is(err, ErrInvalidFilter) || errors.Is(err, ErrUnknownCategory) {
+		utils.APIResponse(ctx, "Failed to return services", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, services)
 }
 
 func (s *ServitorServicesHandlerImpl) GetAllLocations(ctx *gin.Context) {
@@ -316,7 +422,12 @@ func (s *ServitorServicesHandlerImpl) GetServiceByID(ctx *gin.Context) {
 		return
 	}
 
-	category, err := s.ServitorServices.GetServiceByID(ctx, fetchReq.ServiceId)
+	caller, _ := utils.GetCaller(ctx)
+	category, err := s.ServitorServices.GetServiceByID(ctx, caller, fetchReq.ServiceId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "Service not found", http.StatusNotFound, false, nil)
+		return
+	}
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -343,7 +454,8 @@ func (s *ServitorServicesHandlerImpl) ServitorsService(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	svc, err := s.ServitorServices.ServitorServices(ctx, fetchReq.UserId)
+	caller, _ := utils.GetCaller(ctx)
+	svc, err := s.ServitorServices.ServitorServices(ctx, caller, fetchReq.UserId)
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -355,3 +467,675 @@ func (s *ServitorServicesHandlerImpl) ServitorsService(ctx *gin.Context) {
 	}
 	utils.APIResponse(ctx, "Failed to return services", http.StatusBadRequest, false, nil)
 }
+
+func (s *ServitorServicesHandlerImpl) DeleteService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	service, err := s.ServitorServices.DeleteService(ctx, caller, id)
+	if deleteError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Service deleted successfully", http.StatusOK, true, service)
+}
+
+func (s *ServitorServicesHandlerImpl) DeleteLocationInfo(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	location, err := s.ServitorServices.DeleteLocationInfo(ctx, caller, id)
+	if deleteError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Location deleted successfully", http.StatusOK, true, location)
+}
+
+func (s *ServitorServicesHandlerImpl) DeleteCategory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	category, err := s.ServitorServices.DeleteCategory(ctx, id)
+	if deleteError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Category deleted successfully", http.StatusOK, true, category)
+}
+
+// deleteError writes the response for a failed delete and reports whether it did.
+func deleteError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotServiceOwner):
+		utils.APIResponse(ctx, "You can only delete your own services", http.StatusForbidden, false, nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	case errors.Is(err, ErrUpcomingBookings), errors.Is(err, ErrCategoryHasChildren):
+		utils.APIResponse(ctx, "Failed to delete", http.StatusConflict, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (s *ServitorServicesHandlerImpl) RestoreService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	service, err := s.ServitorServices.RestoreService(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Service restored successfully", http.StatusOK, true, service)
+}
+
+func (s *ServitorServicesHandlerImpl) RestoreLocationInfo(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	location, err := s.ServitorServices.RestoreLocationInfo(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Location restored successfully", http.StatusOK, true, location)
+}
+
+func (s *ServitorServicesHandlerImpl) RestoreCategory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	category, err := s.ServitorServices.RestoreCategory(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Category restored successfully", http.StatusOK, true, category)
+}
+
+func (s *ServitorServicesHandlerImpl) SearchServices(ctx *gin.Context) {
+	req := SearchServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	results, err := s.ServitorServices.SearchServices(ctx, req)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Search results successfully returned", http.StatusOK, true, results)
+}
+
+func (s *ServitorServicesHandlerImpl) NearbyServices(ctx *gin.Context) {
+	req := NearbyServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	services, err := s.ServitorServices.NearbyServices(ctx, req)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Nearby services successfully returned", http.StatusOK, true, services)
+}
+
+func (s *ServitorServicesHandlerImpl) ServicesWithin(ctx *gin.Context) {
+	req := BoundingBoxRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	services, err := s.ServitorServices.ServicesWithin(ctx, req)
+	if errors.Is(err, ErrInvalidBoundingBox) {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, services)
+}
+
+func (s *ServitorServicesHandlerImpl) CreateCoverageArea(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := CoverageAreaRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	area, err := s.ServitorServices.CreateCoverageArea(ctx, caller, id, req)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if errors.Is(err, geo.ErrInvalidGeometry) || errors.Is(err, geo.ErrUnsupportedGeometry) ||
+		errors.Is(err, ErrInvalidCoverage) {
+		utils.APIResponse(ctx, "Failed to create coverage area", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Coverage area created successfully", http.StatusOK, true, area)
+}
+
+func (s *ServitorServicesHandlerImpl) GetCoverageAreas(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	areas, err := s.ServitorServices.ServiceCoverageAreas(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Coverage areas successfully returned", http.StatusOK, true, areas)
+}
+
+func (s *ServitorServicesHandlerImpl) DeleteCoverageArea(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	area, err := s.ServitorServices.DeleteCoverageArea(ctx, caller, id)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Coverage area deleted successfully", http.StatusOK, true, area)
+}
+
+func (s *ServitorServicesHandlerImpl) ServicesCovering(ctx *gin.Context) {
+	req := CoveringServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	services, err := s.ServitorServices.ServicesCovering(ctx, req)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, services)
+}
+
+func (s *ServitorServicesHandlerImpl) SetPricing(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := PricingRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	pricing, err := s.ServitorServices.SetPricing(ctx, caller, id, req)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if errors.Is(err, ErrInvalidPricing) {
+		utils.APIResponse(ctx, "Failed to update pricing", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Pricing updated successfully", http.StatusOK, true, pricing)
+}
+
+func (s *ServitorServicesHandlerImpl) SetCancellationPolicy(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := CancellationPolicyRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	policy, err := s.ServitorServices.SetCancellationPolicy(ctx, caller, id, req)
+	if ownershipError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Cancellation policy updated successfully", http.StatusOK, true, policy)
+}
+
+func (s *ServitorServicesHandlerImpl) QuoteService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := QuoteRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	quote, err := s.ServitorServices.Quote(ctx, caller, id, req)
+	if errors.Is(err, ErrInvalidQuote) {
+		utils.APIResponse(ctx, "Failed to quote service", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "Service not found", http.StatusNotFound, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Quote successfully returned", http.StatusOK, true, quote)
+}
+
+func (s *ServitorServicesHandlerImpl) ChangeServiceStatus(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := StatusChangeRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	s.changeStatus(ctx, id, req)
+}
+
+func (s *ServitorServicesHandlerImpl) ApproveService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	s.changeStatus(ctx, id, StatusChangeRequest{Status: dao.PublishedStatus})
+}
+
+func (s *ServitorServicesHandlerImpl) RejectService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := RejectServiceRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	s.changeStatus(ctx, id, StatusChangeRequest{Status: dao.RejectedStatus, Reason: req.Reason})
+}
+
+func (s *ServitorServicesHandlerImpl) changeStatus(ctx *gin.Context, id int, req StatusChangeRequest) {
+	caller, _ := utils.GetCaller(ctx)
+	service, err := s.ServitorServices.ChangeStatus(ctx, caller, id, req)
+	switch {
+	case errors.Is(err, ErrNotServiceOwner):
+		utils.APIResponse(ctx, "You are not allowed to make this change", http.StatusForbidden, false, nil)
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, dao.ErrStatusChanged):
+		utils.APIResponse(ctx, "Failed to change service status", http.StatusConflict, false, err.Error())
+	case errors.Is(err, ErrReasonRequired):
+		utils.APIResponse(ctx, "Failed to change service status", http.StatusBadRequest, false, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Service not found", http.StatusNotFound, false, nil)
+	case err != nil:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Service status changed successfully", http.StatusOK, true, service)
+	}
+}
+
+func (s *ServitorServicesHandlerImpl) GetStatusHistory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	history, err := s.ServitorServices.StatusHistory(ctx, caller, id)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only view your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Status history successfully returned", http.StatusOK, true, history)
+}
+
+func (s *ServitorServicesHandlerImpl) GetModerationQueue(ctx *gin.Context) {
+	services, err := s.ServitorServices.ModerationQueue(ctx)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Services successfully returned", http.StatusOK, true, services)
+}
+
+func (s *ServitorServicesHandlerImpl) GetServiceHistory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	history, err := s.ServitorServices.ServiceHistory(ctx, caller, id)
+	if ownershipError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Service history successfully returned", http.StatusOK, true, history)
+}
+
+func (s *ServitorServicesHandlerImpl) RevertService(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := RevertServiceRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	service, err := s.ServitorServices.RevertService(ctx, caller, id, req)
+	if ownershipError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Service reverted successfully", http.StatusOK, true, service)
+}
+
+func (s *ServitorServicesHandlerImpl) ImportServices(ctx *gin.Context) {
+	req := ImportServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	file := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxImportBytes)
+	report, err := s.ServitorServices.ImportServices(ctx, caller, req, file)
+	if errors.Is(err, ErrInvalidImport) {
+		utils.APIResponse(ctx, "Failed to read import file", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	if len(report.Errors) > 0 {
+		utils.APIResponse(ctx, "Import has invalid rows, nothing was imported", http.StatusUnprocessableEntity,
+			false, report)
+		return
+	}
+	if report.DryRun {
+		utils.APIResponse(ctx, "Import is valid, nothing was imported in a dry run", http.StatusOK, true, report)
+		return
+	}
+	utils.APIResponse(ctx, "Services imported successfully", http.StatusOK, true, report)
+}
+
+func (s *ServitorServicesHandlerImpl) ExportServices(ctx *gin.Context) {
+	req := ExportServicesRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	var file bytes.Buffer
+	err := s.ServitorServices.ExportServices(ctx, caller, req, &file)
+	if errors.Is(err, ErrNotServiceOwner) {
+		utils.APIResponse(ctx, "You can only export your own services", http.StatusForbidden, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	contentType := "text/csv"
+	if req.Format == NDJSONFormat {
+		contentType = "application/x-ndjson"
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=services.%s", req.Format))
+	ctx.Data(http.StatusOK, contentType, file.Bytes())
+}
+
+// mediaError writes the response for a failed gallery change and reports whether there was one.
+func mediaError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotServiceOwner):
+		utils.APIResponse(ctx, "You can only change your own services", http.StatusForbidden, false, nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+	case errors.Is(err, ErrUnsupportedMedia), errors.Is(err, ErrCoverNotImage):
+		utils.APIResponse(ctx, "Failed to update gallery", http.StatusBadRequest, false, err.Error())
+	case errors.Is(err, ErrMediaTooLarge), errors.Is(err, imaging.ErrTooManyPixels):
+		utils.APIResponse(ctx, "Failed to update gallery", http.StatusRequestEntityTooLarge, false, err.Error())
+	case errors.Is(err, dao.ErrGalleryChanged):
+		utils.APIResponse(ctx, "Failed to update gallery", http.StatusConflict, false, err.Error())
+	default:
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+	}
+	return true
+}
+
+func (s *ServitorServicesHandlerImpl) UploadMedia(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// Leave room for the other form fields next to the largest accepted file
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxVideoBytes+1<<20)
+	req := UploadMediaRequest{}
+	if err := ctx.ShouldBind(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read form", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		utils.APIResponse(ctx, "A file is required", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	defer file.Close()
+	caller, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.UploadMedia(ctx, caller, id, req, file)
+	if mediaError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Media uploaded successfully", http.StatusCreated, true, media)
+}
+
+func (s *ServitorServicesHandlerImpl) GetGallery(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := GalleryRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	viewer, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.ServiceGallery(ctx, viewer, id, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "Record not found", http.StatusNotFound, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Gallery successfully returned", http.StatusOK, true, media)
+}
+
+func (s *ServitorServicesHandlerImpl) UpdateMedia(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := UpdateMediaRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.UpdateMedia(ctx, caller, id, req)
+	if mediaError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Media updated successfully", http.StatusOK, true, media)
+}
+
+func (s *ServitorServicesHandlerImpl) SetCoverMedia(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.SetCoverMedia(ctx, caller, id)
+	if mediaError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Cover updated successfully", http.StatusOK, true, media)
+}
+
+func (s *ServitorServicesHandlerImpl) ReorderGallery(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("service_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	req := ReorderMediaRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.ReorderGallery(ctx, caller, id, req)
+	if mediaError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Gallery reordered successfully", http.StatusOK, true, media)
+}
+
+func (s *ServitorServicesHandlerImpl) DeleteMedia(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	media, err := s.ServitorServices.DeleteMedia(ctx, caller, id)
+	if mediaError(ctx, err) {
+		return
+	}
+	utils.APIResponse(ctx, "Media deleted successfully", http.StatusOK, true, media)
+}
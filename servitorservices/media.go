@@ -0,0 +1,175 @@
+package servitorservices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	httpdao "servhunt/infra/dao"
+	"servhunt/infra/imaging"
+	"servhunt/servitorservices/dao"
+	"servhunt/storage"
+	"time"
+)
+
+// Upload limits, videos are meant to be short clips.
+const (
+	MaxImageBytes = 10 << 20
+	MaxVideoBytes = 50 << 20
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("only JPEG, PNG and GIF images and MP4 and WebM videos can be uploaded")
+	ErrMediaTooLarge    = fmt.Errorf("images can be at most %d MB and videos at most %d MB",
+		MaxImageBytes>>20, MaxVideoBytes>>20)
+	ErrCoverNotImage = errors.New("only an image can be the cover of a gallery")
+)
+
+// mediaTypes maps the sniffed content types we accept to their media kind and file extension.
+var mediaTypes = map[string]struct {
+	kind      string
+	extension string
+}{
+	"image/jpeg": {dao.ImageMedia, "jpg"},
+	"image/png":  {dao.ImageMedia, "png"},
+	"image/gif":  {dao.ImageMedia, "gif"},
+	"video/mp4":  {dao.VideoMedia, "mp4"},
+	"video/webm": {dao.VideoMedia, "webm"},
+}
+
+// storeMedia sniffs the upload, stores the original and, for images, its renditions. The blobs
+// already written are removed again when a later step fails.
+func storeMedia(ctx context.Context, blobs storage.BlobStore, serviceId int, file io.Reader) (*dao.Media, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxVideoBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	contentType := http.DetectContentType(data)
+	mediaType, ok := mediaTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+	if len(data) > MaxVideoBytes || (mediaType.kind == dao.ImageMedia && len(data) > MaxImageBytes) {
+		return nil, ErrMediaTooLarge
+	}
+
+	prefix := fmt.Sprintf("services/%d/media/%s", serviceId, uuid.NewString())
+	media := dao.Media{
+		ServiceID:   serviceId,
+		Kind:        mediaType.kind,
+		ContentType: contentType,
+		StorageKey:  fmt.Sprintf("%s/original.%s", prefix, mediaType.extension),
+		Size:        int64(len(data)),
+	}
+	if mediaType.kind == dao.ImageMedia {
+		img, err := imaging.Decode(bytes.NewReader(data))
+		if errors.Is(err, imaging.ErrTooManyPixels) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, ErrUnsupportedMedia
+		}
+		media.Width, media.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		for _, rendition := range imaging.Renditions {
+			resized := imaging.Fit(img, rendition.MaxSize)
+			encoded, err := imaging.EncodeJPEG(resized)
+			if err != nil {
+				deleteBlobs(ctx, blobs, media)
+				return nil, err
+			}
+			key := fmt.Sprintf("%s/%s.jpg", prefix, rendition.Name)
+			url, err := blobs.Put(ctx, key, bytes.NewReader(encoded), "image/jpeg")
+			if err != nil {
+				deleteBlobs(ctx, blobs, media)
+				return nil, err
+			}
+			media.Renditions = append(media.Renditions, dao.MediaRendition{
+				Name:       rendition.Name,
+				StorageKey: key,
+				Url:        url,
+				Width:      resized.Bounds().Dx(),
+				Height:     resized.Bounds().Dy(),
+			})
+		}
+	}
+	media.Url, err = blobs.Put(ctx, media.StorageKey, bytes.NewReader(data), contentType)
+	if err != nil {
+		deleteBlobs(ctx, blobs, media)
+		return nil, err
+	}
+	return &media, nil
+}
+
+// deleteBlobs removes every blob of the media item, failures are logged and reported.
+func deleteBlobs(ctx context.Context, blobs storage.BlobStore, media dao.Media) bool {
+	removed := true
+	for _, key := range media.StorageKeys() {
+		if err := blobs.Delete(ctx, key); err != nil {
+			logger.Error("error deleting media blob", zap.String("blob.key", key),
+				zap.NamedError("error.message", err))
+			removed = false
+		}
+	}
+	return removed
+}
+
+// MediaPurger permanently removes gallery items soft deleted before the retention window, the rows
+// are only purged once their blobs are gone so failed deletions are retried on the next run.
+type MediaPurger struct {
+	repo  dao.ServiceRepo
+	blobs storage.BlobStore
+}
+
+func NewMediaPurger(repo dao.ServiceRepo, blobs storage.BlobStore) httpdao.Purger {
+	return &MediaPurger{repo: repo, blobs: blobs}
+}
+
+func (p *MediaPurger) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	media, err := p.repo.DeletedMediaBefore(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for _, item := range *media {
+		if deleteBlobs(ctx, p.blobs, item) {
+			ids = append(ids, item.ID)
+		}
+	}
+	if err = p.repo.PurgeMedia(ctx, ids); err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+func toMediaResponse(media dao.Media) MediaResponse {
+	res := MediaResponse{
+		ID:          media.ID,
+		ServiceID:   media.ServiceID,
+		LocationID:  media.LocationID,
+		Kind:        media.Kind,
+		ContentType: media.ContentType,
+		Url:         media.Url,
+		Caption:     media.Caption,
+		Position:    media.Position,
+		IsCover:     media.IsCover,
+		Size:        media.Size,
+		Width:       media.Width,
+		Height:      media.Height,
+		CreatedOn:   media.CreatedOn,
+	}
+	if len(media.Renditions) > 0 {
+		res.Renditions = map[string]RenditionResponse{}
+		for _, rendition := range media.Renditions {
+			res.Renditions[rendition.Name] = RenditionResponse{
+				Url:    rendition.Url,
+				Width:  rendition.Width,
+				Height: rendition.Height,
+			}
+		}
+	}
+	return res
+}
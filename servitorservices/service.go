@@ -2,37 +2,183 @@ package servitorservices
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"servhunt/infra/geo"
+	"servhunt/infra/money"
 	"servhunt/infra/utils"
+	"servhunt/referral"
+	"servhunt/search"
 	"servhunt/servitorservices/dao"
+	"servhunt/storage"
+	userdao "servhunt/user/dao"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	defaultSearchLimit = 20
+	defaultPageSize    = 20
+
+	// availabilityBatch is how many matching services an availability filter checks for free slots
+	// at a time, slots are worked out per service outside the database.
+	availabilityBatch = 500
+)
+
+// MatchRadiusKm is how far from a job a service location may be for the service to match the job,
+// coverage areas are matched whatever their size.
+const MatchRadiusKm = 25
+
+// ratingFacets are the minimum ratings the rating facet counts services for.
+var ratingFacets = []float64{4, 3, 2, 1}
+
 var (
 	logger = utils.GetRootLogger()
+
+	ErrInvalidBoundingBox  = errors.New("bounding box corners are out of order")
+	ErrInvalidCoverage     = errors.New("radius coverage needs a latitude, a longitude and a radius")
+	ErrNotServiceOwner     = errors.New("service belongs to another servitor")
+	ErrUnknownCategory     = errors.New("category does not exist")
+	ErrDuplicateCategory   = errors.New("a category with this slug already exists")
+	ErrCategoryCycle       = errors.New("a category cannot be moved under itself or its descendants")
+	ErrInvalidPricing      = errors.New("invalid pricing")
+	ErrInvalidQuote        = errors.New("invalid quote request")
+	ErrInvalidTransition   = errors.New("the service cannot move to that status")
+	ErrReasonRequired      = errors.New("a reason is required when rejecting a service")
+	ErrUpcomingBookings    = errors.New("service has upcoming bookings")
+	ErrCategoryHasChildren = errors.New("category has subcategories, move or delete them first")
+	ErrInvalidFilter       = errors.New("invalid filter")
+)
+
+// Who may move a service between two statuses.
+const (
+	ownerMove = iota
+	adminMove
 )
 
+// serviceTransitions lists the statuses a service can move to from each status. Administrators may
+// make every move, servitors only the owner moves on their own services.
+var serviceTransitions = map[string]map[string]int{
+	dao.DraftStatus: {
+		dao.PendingReviewStatus: ownerMove,
+		dao.ArchivedStatus:      ownerMove,
+	},
+	dao.PendingReviewStatus: {
+		dao.PublishedStatus: adminMove,
+		dao.RejectedStatus:  adminMove,
+		dao.DraftStatus:     ownerMove,
+	},
+	dao.PublishedStatus: {
+		dao.PausedStatus:   ownerMove,
+		dao.ArchivedStatus: ownerMove,
+		dao.RejectedStatus: adminMove,
+	},
+	dao.PausedStatus: {
+		dao.PublishedStatus: ownerMove,
+		dao.ArchivedStatus:  ownerMove,
+	},
+	dao.RejectedStatus: {
+		dao.DraftStatus:         ownerMove,
+		dao.PendingReviewStatus: ownerMove,
+		dao.ArchivedStatus:      ownerMove,
+	},
+	dao.ArchivedStatus: {
+		dao.DraftStatus: ownerMove,
+	},
+}
+
+// ActionRecorder is notified of user actions that may qualify a referral for a reward.
+type ActionRecorder interface {
+	RecordQualifyingAction(ctx context.Context, userId int, action string) error
+}
+
+// AvailabilityChecker narrows services down to the ones that can be booked within a window.
+type AvailabilityChecker interface {
+	AvailableServices(ctx context.Context, serviceIds []int, from time.Time, to time.Time) ([]int, error)
+}
+
+// BookingGuard reports whether a service still has bookings to honour.
+type BookingGuard interface {
+	HasUpcomingBookings(ctx context.Context, serviceId int) (bool, error)
+}
+
 type ServitorServices interface {
 	CreateService(ctx context.Context, service ServiceRequest) (*ServiceResponse, error)
-	UpdateService(ctx context.Context, service UpdateServiceRequest) (*ServiceResponse, error)
-	CreateLocationInfo(ctx context.Context, service LocationInfoRequest) (*LocationInfoResponse, error)
-	UpdateLocationInfo(ctx context.Context, service UpdateLocationInfoRequest) (*LocationInfoResponse, error)
+	UpdateService(ctx context.Context, caller *utils.Caller, service UpdateServiceRequest) (*ServiceResponse, error)
+	CreateLocationInfo(ctx context.Context, caller *utils.Caller, service LocationInfoRequest) (*LocationInfoResponse, error)
+	UpdateLocationInfo(ctx context.Context, caller *utils.Caller, service UpdateLocationInfoRequest) (*LocationInfoResponse, error)
 	CreateCategory(ctx context.Context, category CategoryRequest) (*CategoryResponse, error)
 	UpdateCategory(ctx context.Context, category UpdateCategoryRequest) (*CategoryResponse, error)
 	ServiceLocations(ctx context.Context, serviceId int) (*[]LocationResponse, error)
 	GetAllLocations(ctx context.Context) (*[]LocationResponse, error)
 	ServiceCategories(ctx context.Context, serviceId int) (*[]CategoriesResponse, error)
 	GetAllCategories(ctx context.Context) (*[]CategoriesResponse, error)
+	CategoryTree(ctx context.Context) (*[]CategoryNodeResponse, error)
+	CategoryServices(ctx context.Context, categoryId int) (*[]ServicesResponse, error)
+	SetServiceCategories(ctx context.Context, caller *utils.Caller, serviceId int, request ServiceCategoriesRequest) (*[]CategoriesResponse, error)
+	SetPricing(ctx context.Context, caller *utils.Caller, serviceId int, request PricingRequest) (*Pricing, error)
+	SetCancellationPolicy(ctx context.Context, caller *utils.Caller, serviceId int, request CancellationPolicyRequest) (*CancellationPolicy, error)
+	Quote(ctx context.Context, viewer *utils.Caller, serviceId int, request QuoteRequest) (*QuoteResponse, error)
+	ChangeStatus(ctx context.Context, caller *utils.Caller, serviceId int, request StatusChangeRequest) (*ServicesResponse, error)
+	ModerationQueue(ctx context.Context) (*[]ServicesResponse, error)
+	StatusHistory(ctx context.Context, caller *utils.Caller, serviceId int) (*[]StatusChangeResponse, error)
+	ServiceHistory(ctx context.Context, caller *utils.Caller, serviceId int) (*[]ServiceVersionResponse, error)
+	RevertService(ctx context.Context, caller *utils.Caller, serviceId int, request RevertServiceRequest) (*ServicesResponse, error)
+	ImportServices(ctx context.Context, caller *utils.Caller, request ImportServicesRequest, file io.Reader) (*ImportReport, error)
+	ExportServices(ctx context.Context, caller *utils.Caller, request ExportServicesRequest, w io.Writer) error
 	GetAllServices(ctx context.Context) (*[]ServicesResponse, error)
-	ServitorServices(ctx context.Context, userId int) (*[]ServicesResponse, error)
-	GetServiceByID(ctx context.Context, id int) (*ServicesResponse, error)
+	ListServices(ctx context.Context, request ListServicesRequest) (*ServiceListResponse, error)
+	ServitorServices(ctx context.Context, viewer *utils.Caller, userId int) (*[]ServicesResponse, error)
+	GetServiceByID(ctx context.Context, viewer *utils.Caller, id int) (*ServicesResponse, error)
+	DeleteService(ctx context.Context, caller *utils.Caller, id int) (*ServiceResponse, error)
+	DeleteLocationInfo(ctx context.Context, caller *utils.Caller, id int) (*LocationInfoResponse, error)
+	DeleteCategory(ctx context.Context, id int) (*CategoryResponse, error)
+	RestoreService(ctx context.Context, id int) (*ServiceResponse, error)
+	RestoreLocationInfo(ctx context.Context, id int) (*LocationInfoResponse, error)
+	RestoreCategory(ctx context.Context, id int) (*CategoryResponse, error)
+	SearchServices(ctx context.Context, request SearchServicesRequest) (*[]SearchResultResponse, error)
+	RebuildSearchIndex(ctx context.Context) error
+	NearbyServices(ctx context.Context, request NearbyServicesRequest) (*[]NearbyServiceResponse, error)
+	ServicesWithin(ctx context.Context, request BoundingBoxRequest) (*[]NearbyServiceResponse, error)
+	CreateCoverageArea(ctx context.Context, caller *utils.Caller, serviceId int, request CoverageAreaRequest) (*CoverageAreaResponse, error)
+	ServiceCoverageAreas(ctx context.Context, serviceId int) (*[]CoverageAreaResponse, error)
+	DeleteCoverageArea(ctx context.Context, caller *utils.Caller, id int) (*CoverageAreaResponse, error)
+	ServicesCovering(ctx context.Context, request CoveringServicesRequest) (*[]ServicesResponse, error)
+	MatchingServices(ctx context.Context, categoryId int, point geo.Point) (*[]dao.Service, error)
+	ServicesForCategory(ctx context.Context, categoryId int) (*[]dao.Service, error)
+	UploadMedia(ctx context.Context, caller *utils.Caller, serviceId int, request UploadMediaRequest, file io.Reader) (*MediaResponse, error)
+	ServiceGallery(ctx context.Context, viewer *utils.Caller, serviceId int, request GalleryRequest) (*[]MediaResponse, error)
+	UpdateMedia(ctx context.Context, caller *utils.Caller, id int, request UpdateMediaRequest) (*MediaResponse, error)
+	SetCoverMedia(ctx context.Context, caller *utils.Caller, id int) (*MediaResponse, error)
+	ReorderGallery(ctx context.Context, caller *utils.Caller, serviceId int, request ReorderMediaRequest) (*[]MediaResponse, error)
+	DeleteMedia(ctx context.Context, caller *utils.Caller, id int) (*MediaResponse, error)
 }
 
 type ServitorSvcImpl struct {
 	dao.ServiceRepo
+	actions         ActionRecorder
+	users           userdao.UserRepo
+	index           search.SearchIndex
+	blobs           storage.BlobStore
+	bookings        BookingGuard
+	availability    AvailabilityChecker
+	defaultCurrency string
 }
 
-func NewServitorSvc(svc dao.ServiceRepo) ServitorServices {
-	return &ServitorSvcImpl{ServiceRepo: svc}
+// NewServitorSvc creates the service, defaultCurrency prices services created with only a service
+// cost and blobs keeps the gallery uploads. bookings and availability may be nil, services can then
+// always be deleted and are always listed as available.
+func NewServitorSvc(svc dao.ServiceRepo, actions ActionRecorder, users userdao.UserRepo,
+	index search.SearchIndex, blobs storage.BlobStore, bookings BookingGuard, availability AvailabilityChecker,
+	defaultCurrency string) ServitorServices {
+	return &ServitorSvcImpl{ServiceRepo: svc, actions: actions, users: users, index: index,
+		blobs: blobs, bookings: bookings, availability: availability, defaultCurrency: defaultCurrency}
 }
 
 func (s ServitorSvcImpl) CreateService(ctx context.Context, service ServiceRequest) (*ServiceResponse, error) {
@@ -49,31 +195,44 @@ func (s ServitorSvcImpl) CreateService(ctx context.Context, service ServiceReque
 			finalLoc = append(finalLoc, locReq)
 		}
 	}
-	var finalCat []dao.Category
-	if service.Category != nil {
-		for _, cat := range service.Category {
-			catReq := dao.Category{
-				CategoryImage: cat.CategoryImage,
-				CategoryName:  cat.CategoryName,
-			}
-			finalCat = append(finalCat, catReq)
-		}
+	finalCat, err := s.categoriesByIDs(ctx, service.CategoryIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	svcReq := dao.Service{
-		UserID:          service.UserID,
-		ServiceImage:    service.ServiceImage,
-		ServiceName:     service.ServiceName,
-		ServiceDuration: service.ServiceDuration,
-		ServiceCost:     service.ServiceCost,
-		LocationInfo:    finalLoc,
-		Category:        finalCat,
+	pricing := PricingRequest{
+		PricingModel: dao.FixedPricing,
+		Price:        money.FromMajor(service.ServiceCost, s.defaultCurrency),
+		Currency:     s.defaultCurrency,
+	}
+	if service.Pricing != nil {
+		pricing = *service.Pricing
+	}
+	svcReq, err := toPricedService(pricing)
+	if err != nil {
+		return nil, err
+	}
+	svcReq.UserID = service.UserID
+	svcReq.ServiceImage = service.ServiceImage
+	svcReq.ServiceName = service.ServiceName
+	svcReq.ServiceDuration = service.ServiceDuration
+	svcReq.LocationInfo = finalLoc
+	svcReq.Category = finalCat
+	svcReq.Status = dao.DraftStatus
+	if service.Submit {
+		svcReq.Status = dao.PendingReviewStatus
 	}
 
 	createService, err := s.ServiceRepo.CreateService(ctx, svcReq)
 	if err != nil {
 		return nil, err
 	}
+	s.reindex(ctx, createService.ID)
+	s.recordVersion(ctx, createService.ID, createService.UserID, "created the service")
+	if err = s.actions.RecordQualifyingAction(ctx, createService.UserID, referral.ServiceCreatedAction); err != nil {
+		logger.Error("error recording referral action", zap.Int("service.id", createService.ID),
+			zap.NamedError("error.message", err))
+	}
 
 	res := ServiceResponse{ServiceId: createService.ID}
 
@@ -81,24 +240,34 @@ func (s ServitorSvcImpl) CreateService(ctx context.Context, service ServiceReque
 
 }
 
-func (s ServitorSvcImpl) UpdateService(ctx context.Context, service UpdateServiceRequest) (*ServiceResponse, error) {
+func (s ServitorSvcImpl) UpdateService(ctx context.Context, caller *utils.Caller, service UpdateServiceRequest) (*ServiceResponse, error) {
+	if err := s.checkOwner(ctx, caller, service.ID); err != nil {
+		return nil, err
+	}
 	svcReq := dao.Service{
 		ServiceImage:    service.ServiceImage,
 		ServiceName:     service.ServiceName,
 		ServiceDuration: service.ServiceDuration,
-		ServiceCost:     service.ServiceCost,
 		ID:              service.ID,
 	}
 	updatedService, err := s.ServiceRepo.UpdateService(ctx, svcReq)
 	if err != nil {
 		return nil, err
 	}
+	if err = s.resubmitForReview(ctx, caller, updatedService.ID); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, updatedService.ID)
+	s.recordVersion(ctx, updatedService.ID, caller.ID, "updated the service details")
 	res := ServiceResponse{ServiceId: updatedService.ID}
 
 	return &res, nil
 }
 
-func (s ServitorSvcImpl) CreateLocationInfo(ctx context.Context, loc LocationInfoRequest) (*LocationInfoResponse, error) {
+func (s ServitorSvcImpl) CreateLocationInfo(ctx context.Context, caller *utils.Caller, loc LocationInfoRequest) (*LocationInfoResponse, error) {
+	if err := s.checkOwner(ctx, caller, loc.ServiceID); err != nil {
+		return nil, err
+	}
 	locReq := dao.Location{
 		LocationImage: loc.LocationImage,
 		LocationName:  loc.LocationName,
@@ -111,32 +280,56 @@ func (s ServitorSvcImpl) CreateLocationInfo(ctx context.Context, loc LocationInf
 	if err != nil {
 		return nil, err
 	}
+	if err = s.resubmitForReview(ctx, caller, locRes.ServiceID); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, locRes.ServiceID)
+	s.recordVersion(ctx, locRes.ServiceID, caller.ID, "added a location")
 	res := LocationInfoResponse{LocationID: locRes.ID}
 	return &res, nil
 }
 
-func (s ServitorSvcImpl) UpdateLocationInfo(ctx context.Context, loc UpdateLocationInfoRequest) (*LocationInfoResponse, error) {
+func (s ServitorSvcImpl) UpdateLocationInfo(ctx context.Context, caller *utils.Caller, loc UpdateLocationInfoRequest) (*LocationInfoResponse, error) {
+	current, err := s.ServiceRepo.GetLocationByID(ctx, loc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkOwner(ctx, caller, current.ServiceID); err != nil {
+		return nil, err
+	}
 	locReq := dao.Location{
+		ID:            loc.ID,
 		LocationImage: loc.LocationImage,
 		LocationName:  loc.LocationName,
 		Latitude:      loc.Latitude,
 		Longitude:     loc.Longitude,
 		Address:       loc.Address,
-		ServiceID:     loc.ServiceID,
+		ServiceID:     current.ServiceID,
 	}
 	locRes, err := s.ServiceRepo.UpdateLocationInfo(ctx, locReq)
 	if err != nil {
 		return nil, err
 	}
+	if err = s.resubmitForReview(ctx, caller, current.ServiceID); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, current.ServiceID)
+	s.recordVersion(ctx, current.ServiceID, caller.ID, "updated a location")
 	res := LocationInfoResponse{LocationID: locRes.ID}
 	return &res, nil
 }
 
 func (s ServitorSvcImpl) CreateCategory(ctx context.Context, category CategoryRequest) (*CategoryResponse, error) {
 	catReq := dao.Category{
+		ParentID:      category.ParentID,
+		Slug:          category.Slug,
 		CategoryImage: category.CategoryImage,
 		CategoryName:  category.CategoryName,
-		ServiceID:     category.ServiceID,
+		Icon:          category.Icon,
+		SortOrder:     category.SortOrder,
+	}
+	if err := s.checkTaxonomy(ctx, &catReq); err != nil {
+		return nil, err
 	}
 	cat, err := s.ServiceRepo.CreateCategory(ctx, catReq)
 	if err != nil {
@@ -148,18 +341,68 @@ func (s ServitorSvcImpl) CreateCategory(ctx context.Context, category CategoryRe
 
 func (s ServitorSvcImpl) UpdateCategory(ctx context.Context, category UpdateCategoryRequest) (*CategoryResponse, error) {
 	catReq := dao.Category{
+		ID:            category.ID,
+		ParentID:      category.ParentID,
+		Slug:          category.Slug,
 		CategoryImage: category.CategoryImage,
 		CategoryName:  category.CategoryName,
-		ServiceID:     category.ServiceID,
+		Icon:          category.Icon,
+		SortOrder:     category.SortOrder,
+	}
+	if err := s.checkTaxonomy(ctx, &catReq); err != nil {
+		return nil, err
 	}
 	cat, err := s.ServiceRepo.UpdateCategory(ctx, catReq)
 	if err != nil {
 		return nil, err
 	}
+	// Services are indexed with their category names
+	if services, err := s.ServiceRepo.ServicesInCategories(ctx, []int{cat.ID}); err == nil {
+		for _, svc := range *services {
+			s.reindex(ctx, svc.ID)
+		}
+	}
 	res := CategoryResponse{CategoryId: cat.ID}
 	return &res, nil
 }
 
+// checkTaxonomy fills in a missing slug and makes sure the category keeps the taxonomy a tree with
+// unique slugs.
+func (s ServitorSvcImpl) checkTaxonomy(ctx context.Context, category *dao.Category) error {
+	if category.Slug == "" {
+		category.Slug = dao.Slugify(category.CategoryName)
+	} else {
+		category.Slug = dao.Slugify(category.Slug)
+	}
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
+	if err != nil {
+		return err
+	}
+	parents := map[int]*int{}
+	found := category.ID == 0
+	for _, cat := range *categories {
+		parents[cat.ID] = cat.ParentID
+		if cat.ID == category.ID {
+			found = true
+		} else if cat.Slug == category.Slug {
+			return ErrDuplicateCategory
+		}
+	}
+	if !found {
+		return gorm.ErrRecordNotFound
+	}
+	// Walk up from the new parent, reaching the category itself means it would become its own ancestor
+	for parent := category.ParentID; parent != nil; parent = parents[*parent] {
+		if _, ok := parents[*parent]; !ok {
+			return ErrUnknownCategory
+		}
+		if *parent == category.ID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
 func (s ServitorSvcImpl) ServiceLocations(ctx context.Context, serviceId int) (*[]LocationResponse, error) {
 	var locs []LocationResponse
 	locations, err := s.ServiceRepo.ServiceLocations(ctx, serviceId)
@@ -218,13 +461,7 @@ func (s ServitorSvcImpl) ServiceCategories(ctx context.Context, serviceId int) (
 		return nil, errors.New("no categories found")
 	}
 	for _, cat := range *categories {
-		catt := CategoriesResponse{
-			ID:            cat.ID,
-			ServiceID:     cat.ServiceID,
-			CategoryImage: cat.CategoryImage,
-			CategoryName:  cat.CategoryName,
-		}
-		cats = append(cats, catt)
+		cats = append(cats, toCategoriesResponse(cat))
 	}
 	return &cats, nil
 }
@@ -239,144 +476,1615 @@ func (s ServitorSvcImpl) GetAllCategories(ctx context.Context) (*[]CategoriesRes
 		return nil, errors.New("no categories found")
 	}
 	for _, cat := range *categories {
-		catt := CategoriesResponse{
-			ID:            cat.ID,
-			ServiceID:     cat.ServiceID,
-			CategoryImage: cat.CategoryImage,
-			CategoryName:  cat.CategoryName,
-		}
-		cats = append(cats, catt)
+		cats = append(cats, toCategoriesResponse(cat))
 	}
 	return &cats, nil
 }
 
-func (s ServitorSvcImpl) GetAllServices(ctx context.Context) (*[]ServicesResponse, error) {
-	serviceList, err := s.ServiceRepo.GetAllServices(ctx)
+// CategoryTree returns the taxonomy as nested nodes, siblings keep the admin defined sort order.
+func (s ServitorSvcImpl) CategoryTree(ctx context.Context) (*[]CategoryNodeResponse, error) {
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var resP []ServicesResponse
-	var locs []Locations
-	var cats []Category
-	for _, svc := range *serviceList {
-		if svc.LocationInfo != nil {
-			for _, loc := range svc.LocationInfo {
-				finalLoc := Locations{
-					LocationImage: loc.LocationImage,
-					LocationName:  loc.LocationName,
-					Latitude:      loc.Latitude,
-					Longitude:     loc.Longitude,
-					Address:       loc.Address,
-				}
-				locs = append(locs, finalLoc)
-			}
+	children := map[int][]dao.Category{}
+	var roots []dao.Category
+	for _, cat := range *categories {
+		if cat.ParentID == nil {
+			roots = append(roots, cat)
+		} else {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat)
 		}
-		if svc.Category != nil {
-			for _, cat := range svc.Category {
-				finalCat := Category{
-					CategoryImage: cat.CategoryImage,
-					CategoryName:  cat.CategoryName,
-				}
-				cats = append(cats, finalCat)
-			}
+	}
+	var build func(nodes []dao.Category) []CategoryNodeResponse
+	build = func(nodes []dao.Category) []CategoryNodeResponse {
+		res := []CategoryNodeResponse{}
+		for _, node := range nodes {
+			res = append(res, CategoryNodeResponse{
+				CategoriesResponse: toCategoriesResponse(node),
+				Children:           build(children[node.ID]),
+			})
 		}
-		res := ServicesResponse{
-			ID:              svc.ID,
-			UserID:          svc.UserID,
-			ServiceImage:    svc.ServiceImage,
-			ServiceName:     svc.ServiceName,
-			ServiceDuration: svc.ServiceDuration,
-			ServiceCost:     svc.ServiceCost,
-			Locations:       locs,
-			Category:        cats,
+		return res
+	}
+	tree := build(roots)
+	return &tree, nil
+}
+
+// CategoryServices returns the services listed under the category or any of its descendants.
+func (s ServitorSvcImpl) CategoryServices(ctx context.Context, categoryId int) (*[]ServicesResponse, error) {
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := withDescendants(*categories, []int{categoryId})
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := s.ServiceRepo.ServicesInCategories(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	res := []ServicesResponse{}
+	for _, svc := range *services {
+		res = append(res, toServicesResponse(svc))
+	}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) SetServiceCategories(ctx context.Context, caller *utils.Caller, serviceId int,
+	request ServiceCategoriesRequest) (*[]CategoriesResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	categories, err := s.categoriesByIDs(ctx, request.CategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.SetServiceCategories(ctx, serviceId, categories); err != nil {
+		return nil, err
+	}
+	if err = s.resubmitForReview(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, serviceId)
+	s.recordVersion(ctx, serviceId, caller.ID, "updated the categories")
+	res := []CategoriesResponse{}
+	for _, cat := range categories {
+		res = append(res, toCategoriesResponse(cat))
+	}
+	return &res, nil
+}
+
+// ChangeStatus moves a service to the requested status if the transition is allowed for the caller.
+func (s ServitorSvcImpl) ChangeStatus(ctx context.Context, caller *utils.Caller, serviceId int,
+	request StatusChangeRequest) (*ServicesResponse, error) {
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && svc.UserID != caller.ID {
+		return nil, ErrNotServiceOwner
+	}
+	mover, ok := serviceTransitions[svc.Status][request.Status]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, svc.Status, request.Status)
+	}
+	if mover == adminMove && !caller.IsAdmin() {
+		return nil, ErrNotServiceOwner
+	}
+	if request.Status == dao.RejectedStatus && strings.TrimSpace(request.Reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	changed, err := s.ServiceRepo.ChangeServiceStatus(ctx, dao.StatusChange{
+		ServiceID:  serviceId,
+		FromStatus: svc.Status,
+		ToStatus:   request.Status,
+		Reason:     request.Reason,
+		ChangedBy:  caller.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, serviceId)
+	res := toServicesResponse(*changed)
+	return &res, nil
+}
+
+// ModerationQueue returns the services waiting for review, oldest first.
+func (s ServitorSvcImpl) ModerationQueue(ctx context.Context) (*[]ServicesResponse, error) {
+	services, err := s.ServiceRepo.ServicesByStatus(ctx, dao.PendingReviewStatus)
+	if err != nil {
+		return nil, err
+	}
+	res := []ServicesResponse{}
+	for _, svc := range *services {
+		res = append(res, toServicesResponse(svc))
+	}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) StatusHistory(ctx context.Context, caller *utils.Caller, serviceId int) (*[]StatusChangeResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	history, err := s.ServiceRepo.ServiceStatusHistory(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	res := []StatusChangeResponse{}
+	for _, change := range *history {
+		res = append(res, StatusChangeResponse{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Reason:     change.Reason,
+			ChangedBy:  change.ChangedBy,
+			ChangedOn:  change.CreatedOn,
+		})
+	}
+	return &res, nil
+}
+
+// ServiceHistory returns the versions of a service, each with the fields it changed from the
+// version before it.
+func (s ServitorSvcImpl) ServiceHistory(ctx context.Context, caller *utils.Caller, serviceId int) (*[]ServiceVersionResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	versions, err := s.ServiceRepo.ServiceVersions(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	res := []ServiceVersionResponse{}
+	previous := map[string]json.RawMessage{}
+	for _, version := range *versions {
+		current := map[string]json.RawMessage{}
+		if err = json.Unmarshal([]byte(version.Snapshot), &current); err != nil {
+			return nil, err
 		}
-		resP = append(resP, res)
+		res = append(res, ServiceVersionResponse{
+			Version:   version.Version,
+			Summary:   version.Summary,
+			ChangedBy: version.ChangedBy,
+			ChangedOn: version.CreatedOn,
+			Changes:   diffSnapshots(previous, current),
+		})
+		previous = current
 	}
-	return &resP, nil
+	return &res, nil
 }
 
-func (s ServitorSvcImpl) ServitorServices(ctx context.Context, userId int) (*[]ServicesResponse, error) {
-	serviceList, err := s.ServiceRepo.ServitorServices(ctx, userId)
+// RevertService puts the service back in the state of an earlier version, recorded as a new version.
+func (s ServitorSvcImpl) RevertService(ctx context.Context, caller *utils.Caller, serviceId int,
+	request RevertServiceRequest) (*ServicesResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	version, err := s.ServiceRepo.GetServiceVersion(ctx, serviceId, request.Version)
 	if err != nil {
 		return nil, err
 	}
-	var resP []ServicesResponse
-	var locs []Locations
-	var cats []Category
-	for _, svc := range *serviceList {
-		if svc.LocationInfo != nil {
-			for _, loc := range svc.LocationInfo {
-				finalLoc := Locations{
-					LocationImage: loc.LocationImage,
-					LocationName:  loc.LocationName,
-					Latitude:      loc.Latitude,
-					Longitude:     loc.Longitude,
-					Address:       loc.Address,
-				}
-				locs = append(locs, finalLoc)
+	var snapshot dao.ServiceSnapshot
+	if err = json.Unmarshal([]byte(version.Snapshot), &snapshot); err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.RestoreSnapshot(ctx, serviceId, snapshot); err != nil {
+		return nil, err
+	}
+	if err = s.resubmitForReview(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, serviceId)
+	s.recordVersion(ctx, serviceId, caller.ID, fmt.Sprintf("reverted to version %d", version.Version))
+	return s.GetServiceByID(ctx, caller, serviceId)
+}
+
+// ImportServices validates every record of the file and, unless it is a dry run, creates and
+// updates the caller's services in one transaction. Nothing is written when any row is invalid.
+// Records matching the current state of their service are left alone, updated services that were
+// live go back to review.
+func (s ServitorSvcImpl) ImportServices(ctx context.Context, caller *utils.Caller, request ImportServicesRequest,
+	file io.Reader) (*ImportReport, error) {
+	records, rowErrors, err := readRecords(request.Format, file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	report := ImportReport{DryRun: request.DryRun, Total: len(records) + len(rowErrors), ServiceIDs: []int{},
+		Errors: []RowError{}}
+	report.Errors = append(report.Errors, rowErrors...)
+
+	owned, err := s.ServiceRepo.ServitorServices(ctx, caller.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	ownedIDs := map[int]bool{}
+	current := map[int]dao.ServiceSnapshot{}
+	for _, svc := range *owned {
+		ownedIDs[svc.ID] = true
+		current[svc.ID] = svc.Snapshot()
+	}
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	categoryIDs := map[int]dao.Category{}
+	for _, cat := range *categories {
+		categoryIDs[cat.ID] = cat
+	}
+
+	var creates []dao.Service
+	updates := map[int]dao.ServiceSnapshot{}
+	seen := map[int]bool{}
+	for _, record := range records {
+		svc, recordErrors := validateRecord(record, ownedIDs, categoryIDs)
+		if record.ID > 0 {
+			if seen[record.ID] {
+				recordErrors = append(recordErrors, RowError{Row: record.Row, Field: "id",
+					Message: "the service appears more than once"})
 			}
+			seen[record.ID] = true
 		}
-		if svc.Category != nil {
-			for _, cat := range svc.Category {
-				finalCat := Category{
-					CategoryImage: cat.CategoryImage,
-					CategoryName:  cat.CategoryName,
-				}
-				cats = append(cats, finalCat)
+		if len(recordErrors) > 0 {
+			report.Errors = append(report.Errors, recordErrors...)
+			continue
+		}
+		if record.ID > 0 {
+			// the file does not carry the cancellation policy, it stays as it is
+			before := current[record.ID]
+			svc.FreeCancellationHours = before.FreeCancellationHours
+			svc.LateCancellationFeePercent = before.LateCancellationFeePercent
+			svc.NoShowFeePercent = before.NoShowFeePercent
+			after := svc.Snapshot()
+			if sameSnapshot(before, after) {
+				report.Unchanged++
+				continue
 			}
+			updates[record.ID] = after
+			report.Updated++
+		} else {
+			svc.UserID = caller.ID
+			svc.Status = dao.DraftStatus
+			creates = append(creates, svc)
+			report.Created++
+		}
+	}
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	if len(report.Errors) > 0 || request.DryRun {
+		return &report, nil
+	}
+
+	created, err := s.ServiceRepo.ImportServices(ctx, creates, updates)
+	if err != nil {
+		return nil, err
+	}
+	for id := range updates {
+		if err = s.resubmitForReview(ctx, caller, id); err != nil {
+			return nil, err
 		}
-		res := ServicesResponse{
-			ID:              svc.ID,
-			UserID:          svc.UserID,
-			ServiceImage:    svc.ServiceImage,
-			ServiceName:     svc.ServiceName,
-			ServiceDuration: svc.ServiceDuration,
-			ServiceCost:     svc.ServiceCost,
-			Locations:       locs,
-			Category:        cats,
+		s.reindex(ctx, id)
+		s.recordVersion(ctx, id, caller.ID, "updated the service by import")
+		report.ServiceIDs = append(report.ServiceIDs, id)
+	}
+	for _, id := range created {
+		s.reindex(ctx, id)
+		s.recordVersion(ctx, id, caller.ID, "created the service by import")
+		if err = s.actions.RecordQualifyingAction(ctx, caller.ID, referral.ServiceCreatedAction); err != nil {
+			logger.Error("error recording referral action", zap.Int("service.id", id),
+				zap.NamedError("error.message", err))
 		}
-		resP = append(resP, res)
+		report.ServiceIDs = append(report.ServiceIDs, id)
 	}
-	return &resP, nil
+	sort.Ints(report.ServiceIDs)
+	return &report, nil
 }
 
-func (s ServitorSvcImpl) GetServiceByID(ctx context.Context, id int) (*ServicesResponse, error) {
-	svc, err := s.ServiceRepo.GetServiceByID(ctx, id)
+// ExportServices writes the catalogue of a servitor in an import format, administrators may export
+// any servitor's catalogue and everyone else their own.
+func (s ServitorSvcImpl) ExportServices(ctx context.Context, caller *utils.Caller, request ExportServicesRequest,
+	w io.Writer) error {
+	userId := caller.ID
+	if request.UserID != 0 && request.UserID != caller.ID {
+		if !caller.IsAdmin() {
+			return ErrNotServiceOwner
+		}
+		userId = request.UserID
+	}
+	services, err := s.ServiceRepo.ServitorServices(ctx, userId, true)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var locs []Locations
-	var cats []Category
-	if svc.LocationInfo != nil {
-		for _, loc := range svc.LocationInfo {
-			finalLoc := Locations{
-				LocationImage: loc.LocationImage,
-				LocationName:  loc.LocationName,
-				Latitude:      loc.Latitude,
-				Longitude:     loc.Longitude,
-				Address:       loc.Address,
-			}
-			locs = append(locs, finalLoc)
+	records := []ServiceRecord{}
+	for _, svc := range *services {
+		records = append(records, toServiceRecord(svc))
+	}
+	return writeRecords(request.Format, w, records)
+}
+
+// validateRecord checks an import record and converts it to the service it describes.
+func validateRecord(record ServiceRecord, ownedIDs map[int]bool, categories map[int]dao.Category) (dao.Service, []RowError) {
+	var rowErrors []RowError
+	invalid := func(field string, message string) {
+		rowErrors = append(rowErrors, RowError{Row: record.Row, Field: field, Message: message})
+	}
+	if record.ID > 0 && !ownedIDs[record.ID] {
+		invalid("id", "not one of your services")
+	}
+	if strings.TrimSpace(record.ServiceName) == "" {
+		invalid("service_name", "is required")
+	}
+	if len(record.ServiceName) > 256 {
+		invalid("service_name", "must be at most 256 characters")
+	}
+	for _, pkg := range record.Packages {
+		if pkg.Tier != dao.BasicTier && pkg.Tier != dao.StandardTier && pkg.Tier != dao.PremiumTier {
+			invalid("packages", fmt.Sprintf("unknown tier %q", pkg.Tier))
+		}
+		if pkg.Name == "" || pkg.Price < 0 {
+			invalid("packages", "every package needs a name and a price of zero or more")
 		}
 	}
-	if svc.Category != nil {
-		for _, cat := range svc.Category {
-			finalCat := Category{
-				CategoryImage: cat.CategoryImage,
-				CategoryName:  cat.CategoryName,
-			}
-			cats = append(cats, finalCat)
+	for _, addOn := range record.AddOns {
+		if addOn.Name == "" || addOn.Price < 0 {
+			invalid("add_ons", "every add-on needs a name and a price of zero or more")
 		}
 	}
-	res := ServicesResponse{
-		ID:              svc.ID,
-		UserID:          svc.UserID,
-		ServiceImage:    svc.ServiceImage,
-		ServiceName:     svc.ServiceName,
-		ServiceDuration: svc.ServiceDuration,
-		ServiceCost:     svc.ServiceCost,
-		Locations:       locs,
-		Category:        cats,
+	switch record.PricingModel {
+	case dao.FixedPricing, dao.HourlyPricing, dao.PerUnitPricing, dao.TieredPricing:
+	default:
+		invalid("pricing_model", "must be one of fixed, hourly, per_unit or tiered")
 	}
-	return &res, nil
+	if record.Price < 0 || record.DurationMinutes < 0 {
+		invalid("price", "prices and durations cannot be negative")
+	}
+	svc, err := toPricedService(PricingRequest{
+		PricingModel:    record.PricingModel,
+		Price:           record.Price,
+		Currency:        record.Currency,
+		UnitName:        record.UnitName,
+		DurationMinutes: record.DurationMinutes,
+		Packages:        record.Packages,
+		AddOns:          record.AddOns,
+	})
+	if err != nil && len(rowErrors) == 0 {
+		invalid("pricing", strings.TrimPrefix(err.Error(), ErrInvalidPricing.Error()+": "))
+	}
+	for _, loc := range record.Locations {
+		if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+			invalid("locations", fmt.Sprintf("%q has coordinates out of range", loc.LocationName))
+			continue
+		}
+		svc.LocationInfo = append(svc.LocationInfo, dao.Location{
+			ID:            loc.ID,
+			LocationImage: loc.LocationImage,
+			LocationName:  loc.LocationName,
+			Latitude:      loc.Latitude,
+			Longitude:     loc.Longitude,
+			Address:       loc.Address,
+		})
+	}
+	seen := map[int]bool{}
+	for _, id := range record.CategoryIDs {
+		cat, ok := categories[id]
+		if !ok {
+			invalid("category_ids", fmt.Sprintf("category %d does not exist", id))
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			svc.Category = append(svc.Category, cat)
+		}
+	}
+	svc.ServiceName = record.ServiceName
+	svc.ServiceImage = record.ServiceImage
+	svc.ServiceDuration = record.ServiceDuration
+	return svc, rowErrors
+}
+
+// resubmitForReview sends a published or paused service back to the moderation queue after its
+// servitor changed what customers see, so the change goes live only once an administrator approved
+// it. Administrators' own changes need no review.
+func (s ServitorSvcImpl) resubmitForReview(ctx context.Context, caller *utils.Caller, serviceId int) error {
+	if caller.IsAdmin() {
+		return nil
+	}
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return err
+	}
+	if svc.Status != dao.PublishedStatus && svc.Status != dao.PausedStatus {
+		return nil
+	}
+	_, err = s.ServiceRepo.ChangeServiceStatus(ctx, dao.StatusChange{
+		ServiceID:  serviceId,
+		FromStatus: svc.Status,
+		ToStatus:   dao.PendingReviewStatus,
+		Reason:     "changed by the servitor, awaiting review",
+		ChangedBy:  caller.ID,
+	})
+	return err
+}
+
+// recordVersion snapshots the service after a change. Failures are logged rather than failing the
+// change that triggered them.
+func (s ServitorSvcImpl) recordVersion(ctx context.Context, serviceId int, changedBy int, summary string) {
+	if _, err := s.ServiceRepo.RecordVersion(ctx, serviceId, changedBy, summary); err != nil {
+		logger.Error("error recording service version", zap.Int("service.id", serviceId),
+			zap.NamedError("error.message", err))
+	}
+}
+
+// sameSnapshot tells whether two snapshots describe the same state of a service.
+func sameSnapshot(a, b dao.ServiceSnapshot) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+// diffSnapshots lists the snapshot fields whose values differ, in field name order.
+func diffSnapshots(before, after map[string]json.RawMessage) []FieldChange {
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if string(before[field]) == string(after[field]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, From: before[field], To: after[field]})
+	}
+	return changes
+}
+
+// SetPricing replaces the pricing model of a service along with its packages and add-ons. A live
+// service goes back to review until the new prices are approved.
+func (s ServitorSvcImpl) SetPricing(ctx context.Context, caller *utils.Caller, serviceId int,
+	request PricingRequest) (*Pricing, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	svcReq, err := toPricedService(request)
+	if err != nil {
+		return nil, err
+	}
+	svcReq.ID = serviceId
+	if err = s.ServiceRepo.SetPricing(ctx, svcReq); err != nil {
+		return nil, err
+	}
+	if err = s.resubmitForReview(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, serviceId)
+	s.recordVersion(ctx, serviceId, caller.ID, "updated the pricing")
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	res := toPricing(*svc)
+	return &res, nil
+}
+
+// SetCancellationPolicy replaces the cancellation policy of a service, bookings already made keep
+// the policy they were made under.
+func (s ServitorSvcImpl) SetCancellationPolicy(ctx context.Context, caller *utils.Caller, serviceId int,
+	request CancellationPolicyRequest) (*CancellationPolicy, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	err := s.ServiceRepo.SetCancellationPolicy(ctx, dao.Service{
+		ID:                         serviceId,
+		FreeCancellationHours:      request.FreeCancellationHours,
+		LateCancellationFeePercent: request.LateCancellationFeePercent,
+		NoShowFeePercent:           request.NoShowFeePercent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.recordVersion(ctx, serviceId, caller.ID, "updated the cancellation policy")
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	res := toCancellationPolicy(*svc)
+	return &res, nil
+}
+
+// Quote computes the price of the service for the chosen package, duration, units and add-ons.
+// Services that are not published are only quoted to their servitor and administrators.
+func (s ServitorSvcImpl) Quote(ctx context.Context, viewer *utils.Caller, serviceId int,
+	request QuoteRequest) (*QuoteResponse, error) {
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if svc.Status != dao.PublishedStatus && !viewer.IsAdmin() && svc.UserID != viewer.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if request.Package != "" && svc.PricingModel != dao.TieredPricing {
+		return nil, fmt.Errorf("%w: the service has no packages", ErrInvalidQuote)
+	}
+
+	res := QuoteResponse{ServiceID: svc.ID, Currency: svc.Currency, Lines: []QuoteLine{}}
+	switch svc.PricingModel {
+	case dao.HourlyPricing:
+		minutes := request.DurationMinutes
+		if minutes == 0 {
+			minutes = svc.DurationMinutes
+		}
+		if minutes == 0 {
+			return nil, fmt.Errorf("%w: a duration is required for hourly services", ErrInvalidQuote)
+		}
+		// Part hours are charged pro rata, rounding up to the next minor unit
+		res.Lines = append(res.Lines, QuoteLine{
+			Description: fmt.Sprintf("%s (%d minutes at the hourly rate)", svc.ServiceName, minutes),
+			Quantity:    minutes,
+			UnitAmount:  svc.Price,
+			Amount:      (svc.Price*int64(minutes) + 59) / 60,
+		})
+	case dao.PerUnitPricing:
+		if request.Units == 0 {
+			return nil, fmt.Errorf("%w: the number of %s is required", ErrInvalidQuote, svc.UnitName)
+		}
+		res.Lines = append(res.Lines, QuoteLine{
+			Description: fmt.Sprintf("%s (per %s)", svc.ServiceName, svc.UnitName),
+			Quantity:    request.Units,
+			UnitAmount:  svc.Price,
+			Amount:      svc.Price * int64(request.Units),
+		})
+	case dao.TieredPricing:
+		var chosen *dao.Package
+		for i, pkg := range svc.Packages {
+			if pkg.Tier == request.Package {
+				chosen = &svc.Packages[i]
+			}
+		}
+		if chosen == nil {
+			return nil, fmt.Errorf("%w: choose one of the service packages", ErrInvalidQuote)
+		}
+		res.Lines = append(res.Lines, QuoteLine{
+			Description: fmt.Sprintf("%s (%s)", svc.ServiceName, chosen.Name),
+			Quantity:    1,
+			UnitAmount:  chosen.Price,
+			Amount:      chosen.Price,
+		})
+	default:
+		res.Lines = append(res.Lines, QuoteLine{
+			Description: svc.ServiceName,
+			Quantity:    1,
+			UnitAmount:  svc.Price,
+			Amount:      svc.Price,
+		})
+	}
+
+	addOns := map[int]dao.AddOn{}
+	for _, addOn := range svc.AddOns {
+		addOns[addOn.ID] = addOn
+	}
+	for _, item := range request.AddOns {
+		addOn, ok := addOns[item.ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: add-on %d is not offered with the service", ErrInvalidQuote, item.ID)
+		}
+		quantity := item.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		res.Lines = append(res.Lines, QuoteLine{
+			Description: addOn.Name,
+			Quantity:    quantity,
+			UnitAmount:  addOn.Price,
+			Amount:      addOn.Price * int64(quantity),
+		})
+	}
+	for _, line := range res.Lines {
+		res.Total += line.Amount
+	}
+	return &res, nil
+}
+
+// toPricedService validates the pricing and returns a service carrying it. The legacy service cost
+// is kept in step with the price, or the cheapest package of a tiered service.
+func toPricedService(request PricingRequest) (dao.Service, error) {
+	svc := dao.Service{
+		PricingModel:    request.PricingModel,
+		Price:           request.Price,
+		Currency:        money.Normalize(request.Currency),
+		UnitName:        request.UnitName,
+		DurationMinutes: request.DurationMinutes,
+	}
+	if !money.Valid(svc.Currency) {
+		return svc, fmt.Errorf("%w: unsupported currency %q", ErrInvalidPricing, request.Currency)
+	}
+	if svc.PricingModel == dao.PerUnitPricing && svc.UnitName == "" {
+		return svc, fmt.Errorf("%w: per unit pricing needs a unit name", ErrInvalidPricing)
+	}
+	if svc.PricingModel == dao.TieredPricing && len(request.Packages) == 0 {
+		return svc, fmt.Errorf("%w: tiered pricing needs at least one package", ErrInvalidPricing)
+	}
+	if svc.PricingModel != dao.TieredPricing && len(request.Packages) > 0 {
+		return svc, fmt.Errorf("%w: packages are only used by tiered pricing", ErrInvalidPricing)
+	}
+
+	tiers := map[string]bool{}
+	for i, pkg := range request.Packages {
+		if tiers[pkg.Tier] {
+			return svc, fmt.Errorf("%w: more than one %s package", ErrInvalidPricing, pkg.Tier)
+		}
+		tiers[pkg.Tier] = true
+		svc.Packages = append(svc.Packages, dao.Package{
+			ID:              pkg.ID,
+			Tier:            pkg.Tier,
+			Name:            pkg.Name,
+			Description:     pkg.Description,
+			Price:           pkg.Price,
+			DurationMinutes: pkg.DurationMinutes,
+		})
+		if i == 0 || pkg.Price < svc.Price {
+			svc.Price = pkg.Price
+		}
+	}
+	names := map[string]bool{}
+	for _, addOn := range request.AddOns {
+		if names[strings.ToLower(addOn.Name)] {
+			return svc, fmt.Errorf("%w: duplicate add-on %q", ErrInvalidPricing, addOn.Name)
+		}
+		names[strings.ToLower(addOn.Name)] = true
+		svc.AddOns = append(svc.AddOns, dao.AddOn{ID: addOn.ID, Name: addOn.Name, Price: addOn.Price})
+	}
+	svc.ServiceCost = money.ToMajor(svc.Price, svc.Currency)
+	return svc, nil
+}
+
+// categoriesByIDs loads the taxonomy nodes, failing if any of them does not exist.
+func (s ServitorSvcImpl) categoriesByIDs(ctx context.Context, ids []int) ([]dao.Category, error) {
+	unique := map[int]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	categories, err := s.ServiceRepo.GetCategoriesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(*categories) != len(unique) {
+		return nil, ErrUnknownCategory
+	}
+	return *categories, nil
+}
+
+func (s ServitorSvcImpl) GetAllServices(ctx context.Context) (*[]ServicesResponse, error) {
+	serviceList, err := s.ServiceRepo.GetAllServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resP []ServicesResponse
+	for _, svc := range *serviceList {
+		resP = append(resP, toServicesResponse(svc))
+	}
+	return &resP, nil
+}
+
+// ListServices pages through the published services matching the request, newest first, along
+// with the facet counts of the matching services.
+func (s ServitorSvcImpl) ListServices(ctx context.Context, request ListServicesRequest) (*ServiceListResponse, error) {
+	if (request.AvailableFrom == nil) != (request.AvailableTo == nil) {
+		return nil, fmt.Errorf("%w: available_from and available_to must be given together", ErrInvalidFilter)
+	}
+	if request.AvailableFrom != nil && !request.AvailableTo.After(*request.AvailableFrom) {
+		return nil, fmt.Errorf("%w: available_to must be after available_from", ErrInvalidFilter)
+	}
+	if request.MinPrice != nil && request.MaxPrice != nil && *request.MinPrice > *request.MaxPrice {
+		return nil, fmt.Errorf("%w: min_price must not exceed max_price", ErrInvalidFilter)
+	}
+	if request.MinDuration != nil && request.MaxDuration != nil && *request.MinDuration > *request.MaxDuration {
+		return nil, fmt.Errorf("%w: min_duration must not exceed max_duration", ErrInvalidFilter)
+	}
+	if request.Page == 0 {
+		request.Page = 1
+	}
+	if request.PageSize == 0 {
+		request.PageSize = defaultPageSize
+	}
+
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := dao.ServiceFilter{
+		MinPrice:    request.MinPrice,
+		MaxPrice:    request.MaxPrice,
+		MinDuration: request.MinDuration,
+		MaxDuration: request.MaxDuration,
+		Currency:    money.Normalize(request.Currency),
+		Verified:    request.Verified,
+		MinRating:   request.MinRating,
+		Language:    strings.TrimSpace(request.Language),
+		Location:    strings.TrimSpace(request.Location),
+	}
+	if len(request.CategoryIDs) > 0 {
+		if filter.CategoryIDs, err = withDescendants(*categories, request.CategoryIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.AvailableFrom != nil && s.availability != nil {
+		// Candidates match every filter a facet can drop, so the available set covers all facets
+		candidates := filter
+		candidates.CategoryIDs = nil
+		candidates.Currency = ""
+		candidates.Language = ""
+		candidates.Verified = nil
+		candidates.MinRating = nil
+		filter.ServiceIDs = []int{}
+		for offset := 0; ; offset += availabilityBatch {
+			ids, total, err := s.ServiceRepo.FilterServiceIDs(ctx, candidates, offset, availabilityBatch)
+			if err != nil {
+				return nil, err
+			}
+			available, err := s.availability.AvailableServices(ctx, ids, *request.AvailableFrom, *request.AvailableTo)
+			if err != nil {
+				return nil, err
+			}
+			filter.ServiceIDs = append(filter.ServiceIDs, available...)
+			if len(ids) < availabilityBatch || int64(offset+len(ids)) >= total {
+				break
+			}
+		}
+	}
+
+	// Every facet is counted over the services matching the other filters
+	facetFilters := dao.FacetFilters{Categories: filter, Currencies: filter, Languages: filter, Verified: filter,
+		Ratings: filter}
+	facetFilters.Categories.CategoryIDs = nil
+	facetFilters.Currencies.Currency = ""
+	facetFilters.Languages.Language = ""
+	facetFilters.Verified.Verified = nil
+	facetFilters.Ratings.MinRating = nil
+	counts, err := s.ServiceRepo.CountServiceFacets(ctx, facetFilters, ratingFacets)
+	if err != nil {
+		return nil, err
+	}
+
+	pageIDs, total, err := s.ServiceRepo.FilterServiceIDs(ctx, filter, (request.Page-1)*request.PageSize,
+		request.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	res := ServiceListResponse{
+		Total:    int(total),
+		Page:     request.Page,
+		PageSize: request.PageSize,
+		Services: []ServicesResponse{},
+		Facets:   toFacets(*categories, *counts),
+	}
+	if len(pageIDs) == 0 {
+		return &res, nil
+	}
+	services, err := s.ServiceRepo.GetServicesByIDs(ctx, pageIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]dao.Service{}
+	for _, svc := range *services {
+		byID[svc.ID] = svc
+	}
+	for _, id := range pageIDs {
+		if svc, ok := byID[id]; ok {
+			res.Services = append(res.Services, toServicesResponse(svc))
+		}
+	}
+	return &res, nil
+}
+
+// toFacets builds the facets from their counts, category counts roll up to the ancestors of a
+// service's categories.
+func toFacets(categories []dao.Category, counts dao.FacetCounts) Facets {
+	parents := map[int]*int{}
+	for _, cat := range categories {
+		parents[cat.ID] = cat.ParentID
+	}
+	facets := Facets{
+		Categories: []CategoryFacet{},
+		Currencies: []CurrencyFacet{},
+		Languages:  []ValueFacet{},
+		Verified:   []ValueFacet{},
+		Ratings:    []RatingFacet{},
+	}
+
+	categoryCounts := map[int]int{}
+	for _, set := range counts.CategorySets {
+		counted := map[int]bool{}
+		for _, categoryId := range set.CategoryIDs {
+			for current := &categoryId; current != nil && !counted[*current]; current = parents[*current] {
+				counted[*current] = true
+				categoryCounts[*current] += set.Count
+			}
+		}
+	}
+	for _, cat := range categories {
+		if count := categoryCounts[cat.ID]; count > 0 {
+			facets.Categories = append(facets.Categories, CategoryFacet{
+				ID: cat.ID, Slug: cat.Slug, CategoryName: cat.CategoryName, Count: count,
+			})
+		}
+	}
+
+	for _, currency := range counts.Currencies {
+		facets.Currencies = append(facets.Currencies, CurrencyFacet{
+			Currency: currency.Currency, Count: currency.Count, MinPrice: currency.MinPrice, MaxPrice: currency.MaxPrice,
+		})
+	}
+	for _, language := range counts.Languages {
+		facets.Languages = append(facets.Languages, ValueFacet{Value: language.Value, Count: language.Count})
+	}
+	for _, value := range []bool{true, false} {
+		if counts.Verified[value] > 0 {
+			facets.Verified = append(facets.Verified, ValueFacet{Value: strconv.FormatBool(value), Count: counts.Verified[value]})
+		}
+	}
+	for i, minRating := range ratingFacets {
+		count := 0
+		if i < len(counts.Ratings) {
+			count = counts.Ratings[i]
+		}
+		facets.Ratings = append(facets.Ratings, RatingFacet{MinRating: minRating, Count: count})
+	}
+
+	sort.Slice(facets.Currencies, func(i, j int) bool {
+		return facets.Currencies[i].Count > facets.Currencies[j].Count ||
+			facets.Currencies[i].Count == facets.Currencies[j].Count &&
+				facets.Currencies[i].Currency < facets.Currencies[j].Currency
+	})
+	sort.Slice(facets.Languages, func(i, j int) bool {
+		return facets.Languages[i].Count > facets.Languages[j].Count ||
+			facets.Languages[i].Count == facets.Languages[j].Count &&
+				facets.Languages[i].Value < facets.Languages[j].Value
+	})
+	return facets
+}
+
+// withDescendants expands the categories to include all their subcategories.
+func withDescendants(categories []dao.Category, roots []int) ([]int, error) {
+	children := map[int][]int{}
+	known := map[int]bool{}
+	for _, cat := range categories {
+		known[cat.ID] = true
+		if cat.ParentID != nil {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat.ID)
+		}
+	}
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, root := range roots {
+		if !known[root] {
+			return nil, ErrUnknownCategory
+		}
+		if !seen[root] {
+			seen[root] = true
+			ids = append(ids, root)
+		}
+	}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (s ServitorSvcImpl) ServitorServices(ctx context.Context, viewer *utils.Caller, userId int) (*[]ServicesResponse, error) {
+	serviceList, err := s.ServiceRepo.ServitorServices(ctx, userId, viewer.IsAdmin() || viewer.ID == userId)
+	if err != nil {
+		return nil, err
+	}
+	var resP []ServicesResponse
+	for _, svc := range *serviceList {
+		resP = append(resP, toServicesResponse(svc))
+	}
+	return &resP, nil
+}
+
+// GetServiceByID returns the service, unpublished services are only found by their servitor and
+// administrators.
+func (s ServitorSvcImpl) GetServiceByID(ctx context.Context, viewer *utils.Caller, id int) (*ServicesResponse, error) {
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if svc.Status != dao.PublishedStatus && !viewer.IsAdmin() && svc.UserID != viewer.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	res := toServicesResponse(*svc)
+	return &res, nil
+}
+
+// DeleteService soft deletes a service of the caller with its locations, coverage areas and prices.
+// Services with upcoming bookings have to be paused instead until the bookings are honoured.
+func (s ServitorSvcImpl) DeleteService(ctx context.Context, caller *utils.Caller, id int) (*ServiceResponse, error) {
+	if err := s.checkOwner(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	if s.bookings != nil {
+		upcoming, err := s.bookings.HasUpcomingBookings(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if upcoming {
+			return nil, ErrUpcomingBookings
+		}
+	}
+	if err := s.ServiceRepo.DeleteService(ctx, id); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, id)
+	res := ServiceResponse{ServiceId: id}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) DeleteLocationInfo(ctx context.Context, caller *utils.Caller, id int) (*LocationInfoResponse, error) {
+	loc, err := s.ServiceRepo.GetLocationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkOwner(ctx, caller, loc.ServiceID); err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.DeleteLocation(ctx, id); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, loc.ServiceID)
+	s.recordVersion(ctx, loc.ServiceID, caller.ID, "deleted a location")
+	res := LocationInfoResponse{LocationID: id}
+	return &res, nil
+}
+
+// DeleteCategory removes a taxonomy node, nodes with subcategories are refused so no category is
+// left without a parent.
+func (s ServitorSvcImpl) DeleteCategory(ctx context.Context, id int) (*CategoryResponse, error) {
+	children, err := s.ServiceRepo.CountChildCategories(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if children > 0 {
+		return nil, ErrCategoryHasChildren
+	}
+	services, err := s.ServiceRepo.ServicesInCategories(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.DeleteCategory(ctx, id); err != nil {
+		return nil, err
+	}
+	for _, svc := range *services {
+		s.reindex(ctx, svc.ID)
+	}
+	res := CategoryResponse{CategoryId: id}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) RestoreService(ctx context.Context, id int) (*ServiceResponse, error) {
+	if err := s.ServiceRepo.RestoreService(ctx, id); err != nil {
+		return nil, err
+	}
+	s.reindex(ctx, id)
+	res := ServiceResponse{ServiceId: id}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) RestoreLocationInfo(ctx context.Context, id int) (*LocationInfoResponse, error) {
+	if err := s.ServiceRepo.RestoreLocation(ctx, id); err != nil {
+		return nil, err
+	}
+	res := LocationInfoResponse{LocationID: id}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) RestoreCategory(ctx context.Context, id int) (*CategoryResponse, error) {
+	if err := s.ServiceRepo.RestoreCategory(ctx, id); err != nil {
+		return nil, err
+	}
+	res := CategoryResponse{CategoryId: id}
+	return &res, nil
+}
+
+// SearchServices runs the query against the search index and returns the matching services that
+// still exist, in relevance order.
+func (s ServitorSvcImpl) SearchServices(ctx context.Context, request SearchServicesRequest) (*[]SearchResultResponse, error) {
+	limit := request.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	hits, err := s.index.Search(ctx, request.Query, limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, hit := range hits {
+		ids = append(ids, hit.ServiceID)
+	}
+	services, err := s.ServiceRepo.GetServicesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]dao.Service{}
+	for _, svc := range *services {
+		byID[svc.ID] = svc
+	}
+
+	res := []SearchResultResponse{}
+	for _, hit := range hits {
+		svc, ok := byID[hit.ServiceID]
+		if !ok {
+			continue
+		}
+		res = append(res, SearchResultResponse{
+			Service:    toServicesResponse(svc),
+			Score:      hit.Score,
+			Highlights: hit.Highlights,
+		})
+	}
+	return &res, nil
+}
+
+// RebuildSearchIndex indexes every service, it runs on start up so the index catches up with
+// changes it missed such as servitors editing their description.
+func (s ServitorSvcImpl) RebuildSearchIndex(ctx context.Context) error {
+	services, err := s.ServiceRepo.GetAllServices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, svc := range *services {
+		if err = s.index.Index(ctx, s.searchDocument(ctx, svc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindex refreshes the search document of a service, removing it when the service no longer
+// exists or is not published. Indexing failures are logged rather than failing the write that triggered them.
+func (s ServitorSvcImpl) reindex(ctx context.Context, serviceId int) {
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil || svc.Status != dao.PublishedStatus {
+		err = s.index.Remove(ctx, serviceId)
+	} else {
+		err = s.index.Index(ctx, s.searchDocument(ctx, *svc))
+	}
+	if err != nil {
+		logger.Error("error updating search index", zap.Int("service.id", serviceId),
+			zap.NamedError("error.message", err))
+	}
+}
+
+func (s ServitorSvcImpl) searchDocument(ctx context.Context, svc dao.Service) search.Document {
+	document := search.Document{
+		ServiceID:   svc.ID,
+		ServiceName: svc.ServiceName,
+	}
+	for _, cat := range svc.Category {
+		document.Categories = append(document.Categories, cat.CategoryName)
+	}
+	for _, loc := range svc.LocationInfo {
+		document.Locations = append(document.Locations, loc.LocationName, loc.Address)
+	}
+	if servitor, err := s.users.GetUserById(ctx, svc.UserID); err == nil {
+		document.Description = servitor.Description
+	}
+	return document
+}
+
+// NearbyServices returns the services with a location within the radius, nearest first.
+func (s ServitorSvcImpl) NearbyServices(ctx context.Context, request NearbyServicesRequest) (*[]NearbyServiceResponse, error) {
+	center := geo.Point{Latitude: *request.Latitude, Longitude: *request.Longitude}
+	locations, err := s.ServiceRepo.LocationsWithin(ctx, geo.RadiusBoundingBox(center, request.RadiusKm))
+	if err != nil {
+		return nil, err
+	}
+	var inRadius []dao.Location
+	for _, loc := range *locations {
+		if geo.DistanceKm(center, loc.Point()) <= request.RadiusKm {
+			inRadius = append(inRadius, loc)
+		}
+	}
+	return s.servicesByDistance(ctx, center, inRadius, request.Limit)
+}
+
+// ServicesWithin returns the services with a location inside the box, nearest to its center first.
+func (s ServitorSvcImpl) ServicesWithin(ctx context.Context, request BoundingBoxRequest) (*[]NearbyServiceResponse, error) {
+	box := geo.BoundingBox{
+		MinLatitude:  *request.MinLatitude,
+		MinLongitude: *request.MinLongitude,
+		MaxLatitude:  *request.MaxLatitude,
+		MaxLongitude: *request.MaxLongitude,
+	}
+	if !box.Valid() {
+		return nil, ErrInvalidBoundingBox
+	}
+	locations, err := s.ServiceRepo.LocationsWithin(ctx, box)
+	if err != nil {
+		return nil, err
+	}
+	center := geo.Point{
+		Latitude:  (box.MinLatitude + box.MaxLatitude) / 2,
+		Longitude: (box.MinLongitude + box.MaxLongitude) / 2,
+	}
+	return s.servicesByDistance(ctx, center, *locations, request.Limit)
+}
+
+// servicesByDistance collapses the locations to their services, keeping each service's nearest
+// location, and returns the services sorted by that distance.
+func (s ServitorSvcImpl) servicesByDistance(ctx context.Context, center geo.Point, locations []dao.Location,
+	limit int) (*[]NearbyServiceResponse, error) {
+	nearest := map[int]dao.Location{}
+	distances := map[int]float64{}
+	for _, loc := range locations {
+		distance := geo.DistanceKm(center, loc.Point())
+		if current, ok := distances[loc.ServiceID]; !ok || distance < current {
+			nearest[loc.ServiceID] = loc
+			distances[loc.ServiceID] = distance
+		}
+	}
+	ids := make([]int, 0, len(distances))
+	for id := range distances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if distances[ids[i]] != distances[ids[j]] {
+			return distances[ids[i]] < distances[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	services, err := s.ServiceRepo.GetServicesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]dao.Service{}
+	for _, svc := range *services {
+		byID[svc.ID] = svc
+	}
+	res := []NearbyServiceResponse{}
+	for _, id := range ids {
+		svc, ok := byID[id]
+		if !ok {
+			continue
+		}
+		res = append(res, NearbyServiceResponse{
+			Service:      toServicesResponse(svc),
+			DistanceKm:   distances[id],
+			LocationName: nearest[id].LocationName,
+		})
+	}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) CreateCoverageArea(ctx context.Context, caller *utils.Caller, serviceId int,
+	request CoverageAreaRequest) (*CoverageAreaResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+
+	area := dao.CoverageArea{
+		ServiceID: serviceId,
+		AreaType:  request.AreaType,
+	}
+	var box geo.BoundingBox
+	switch request.AreaType {
+	case dao.PolygonCoverage:
+		polygons, err := geo.ParseGeoJSON(request.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		area.GeoJSON = string(request.Geometry)
+		box = polygons.BoundingBox()
+	case dao.RadiusCoverage:
+		if request.Latitude == nil || request.Longitude == nil || request.RadiusKm <= 0 {
+			return nil, ErrInvalidCoverage
+		}
+		center := geo.Point{Latitude: *request.Latitude, Longitude: *request.Longitude}
+		area.CenterLatitude = center.Latitude
+		area.CenterLongitude = center.Longitude
+		area.RadiusKm = request.RadiusKm
+		box = geo.RadiusBoundingBox(center, request.RadiusKm)
+	}
+	area.MinLatitude, area.MinLongitude = box.MinLatitude, box.MinLongitude
+	area.MaxLatitude, area.MaxLongitude = box.MaxLatitude, box.MaxLongitude
+
+	saved, err := s.ServiceRepo.CreateCoverageArea(ctx, area)
+	if err != nil {
+		return nil, err
+	}
+	res := toCoverageAreaResponse(*saved)
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) ServiceCoverageAreas(ctx context.Context, serviceId int) (*[]CoverageAreaResponse, error) {
+	areas, err := s.ServiceRepo.ServiceCoverageAreas(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	res := []CoverageAreaResponse{}
+	for _, area := range *areas {
+		res = append(res, toCoverageAreaResponse(area))
+	}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) DeleteCoverageArea(ctx context.Context, caller *utils.Caller, id int) (*CoverageAreaResponse, error) {
+	area, err := s.ServiceRepo.GetCoverageAreaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkOwner(ctx, caller, area.ServiceID); err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.DeleteCoverageArea(ctx, id); err != nil {
+		return nil, err
+	}
+	res := toCoverageAreaResponse(*area)
+	return &res, nil
+}
+
+// ServicesCovering returns the services with a coverage area containing the point.
+func (s ServitorSvcImpl) ServicesCovering(ctx context.Context, request CoveringServicesRequest) (*[]ServicesResponse, error) {
+	point := geo.Point{Latitude: *request.Latitude, Longitude: *request.Longitude}
+	areas, err := s.ServiceRepo.CoverageAreasAround(ctx, point)
+	if err != nil {
+		return nil, err
+	}
+	covering := map[int]bool{}
+	var ids []int
+	for _, area := range *areas {
+		if covering[area.ServiceID] || !coverageContains(area, point) {
+			continue
+		}
+		covering[area.ServiceID] = true
+		ids = append(ids, area.ServiceID)
+	}
+	services, err := s.ServiceRepo.GetServicesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	res := []ServicesResponse{}
+	for _, svc := range *services {
+		res = append(res, toServicesResponse(svc))
+	}
+	return &res, nil
+}
+
+// MatchingServices returns the published services that could take on a job in the category at the
+// point: services listed for the category that cover the point with a coverage area or have a
+// location within MatchRadiusKm of it.
+func (s ServitorSvcImpl) MatchingServices(ctx context.Context, categoryId int, point geo.Point) (*[]dao.Service, error) {
+	services, err := s.ServicesForCategory(ctx, categoryId)
+	if err != nil {
+		return nil, err
+	}
+
+	reaching := map[int]bool{}
+	areas, err := s.ServiceRepo.CoverageAreasAround(ctx, point)
+	if err != nil {
+		return nil, err
+	}
+	for _, area := range *areas {
+		if !reaching[area.ServiceID] && coverageContains(area, point) {
+			reaching[area.ServiceID] = true
+		}
+	}
+	locations, err := s.ServiceRepo.LocationsWithin(ctx, geo.RadiusBoundingBox(point, MatchRadiusKm))
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range *locations {
+		if geo.DistanceKm(point, loc.Point()) <= MatchRadiusKm {
+			reaching[loc.ServiceID] = true
+		}
+	}
+
+	matching := []dao.Service{}
+	for _, svc := range *services {
+		if reaching[svc.ID] {
+			matching = append(matching, svc)
+		}
+	}
+	return &matching, nil
+}
+
+// ServicesForCategory returns the published services listed under the category, one of its
+// subcategories or one of its parents, the services that could take on work in the category.
+func (s ServitorSvcImpl) ServicesForCategory(ctx context.Context, categoryId int) (*[]dao.Service, error) {
+	categories, err := s.ServiceRepo.GetAllCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := withDescendants(*categories, []int{categoryId})
+	if err != nil {
+		return nil, err
+	}
+	parents := map[int]*int{}
+	for _, cat := range *categories {
+		parents[cat.ID] = cat.ParentID
+	}
+	// stop at categories seen before in case the taxonomy has a cycle
+	seen := map[int]bool{categoryId: true}
+	for parent := parents[categoryId]; parent != nil && !seen[*parent]; parent = parents[*parent] {
+		seen[*parent] = true
+		ids = append(ids, *parent)
+	}
+	return s.ServiceRepo.ServicesInCategories(ctx, ids)
+}
+
+// UploadMedia adds an image or video to the gallery of the service, or of one of its locations.
+func (s ServitorSvcImpl) UploadMedia(ctx context.Context, caller *utils.Caller, serviceId int,
+	request UploadMediaRequest, file io.Reader) (*MediaResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	if request.LocationID != nil {
+		if err := s.checkLocation(ctx, serviceId, *request.LocationID); err != nil {
+			return nil, err
+		}
+	}
+	media, err := storeMedia(ctx, s.blobs, serviceId, file)
+	if err != nil {
+		return nil, err
+	}
+	media.LocationID = request.LocationID
+	media.Caption = request.Caption
+	created, err := s.ServiceRepo.CreateMedia(ctx, *media)
+	if err != nil {
+		deleteBlobs(ctx, s.blobs, *media)
+		return nil, err
+	}
+	if created.IsCover && created.LocationID == nil {
+		s.recordVersion(ctx, serviceId, caller.ID, "changed the cover image")
+	}
+	res := toMediaResponse(*created)
+	return &res, nil
+}
+
+// ServiceGallery lists the gallery of the service, or of one of its locations, in display order.
+// Galleries of unpublished services are only shown to their owner and admins.
+func (s ServitorSvcImpl) ServiceGallery(ctx context.Context, viewer *utils.Caller, serviceId int,
+	request GalleryRequest) (*[]MediaResponse, error) {
+	if _, err := s.GetServiceByID(ctx, viewer, serviceId); err != nil {
+		return nil, err
+	}
+	media, err := s.ServiceRepo.GalleryMedia(ctx, serviceId, request.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]MediaResponse, 0, len(*media))
+	for _, item := range *media {
+		res = append(res, toMediaResponse(item))
+	}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) UpdateMedia(ctx context.Context, caller *utils.Caller, id int,
+	request UpdateMediaRequest) (*MediaResponse, error) {
+	media, err := s.ownedMedia(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.UpdateMediaCaption(ctx, id, request.Caption); err != nil {
+		return nil, err
+	}
+	media.Caption = request.Caption
+	res := toMediaResponse(*media)
+	return &res, nil
+}
+
+// SetCoverMedia makes the image the cover of its gallery, the service or location image follows it.
+func (s ServitorSvcImpl) SetCoverMedia(ctx context.Context, caller *utils.Caller, id int) (*MediaResponse, error) {
+	media, err := s.ownedMedia(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if media.Kind != dao.ImageMedia {
+		return nil, ErrCoverNotImage
+	}
+	if err = s.ServiceRepo.SetCoverMedia(ctx, id); err != nil {
+		return nil, err
+	}
+	if media.LocationID == nil {
+		s.recordVersion(ctx, media.ServiceID, caller.ID, "changed the cover image")
+	}
+	media.IsCover = true
+	res := toMediaResponse(*media)
+	return &res, nil
+}
+
+// ReorderGallery puts the gallery in the order of request.MediaIDs, which must list every item of it.
+func (s ServitorSvcImpl) ReorderGallery(ctx context.Context, caller *utils.Caller, serviceId int,
+	request ReorderMediaRequest) (*[]MediaResponse, error) {
+	if err := s.checkOwner(ctx, caller, serviceId); err != nil {
+		return nil, err
+	}
+	if err := s.ServiceRepo.ReorderMedia(ctx, serviceId, request.LocationID, request.MediaIDs); err != nil {
+		return nil, err
+	}
+	return s.ServiceGallery(ctx, caller, serviceId, GalleryRequest{LocationID: request.LocationID})
+}
+
+// DeleteMedia removes the item from its gallery, its blobs are deleted once the retention window
+// has passed.
+func (s ServitorSvcImpl) DeleteMedia(ctx context.Context, caller *utils.Caller, id int) (*MediaResponse, error) {
+	media, err := s.ownedMedia(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.ServiceRepo.DeleteMedia(ctx, id); err != nil {
+		return nil, err
+	}
+	if media.IsCover && media.LocationID == nil {
+		s.recordVersion(ctx, media.ServiceID, caller.ID, "changed the cover image")
+	}
+	res := MediaResponse{ID: id, ServiceID: media.ServiceID, LocationID: media.LocationID}
+	return &res, nil
+}
+
+func (s ServitorSvcImpl) ownedMedia(ctx context.Context, caller *utils.Caller, id int) (*dao.Media, error) {
+	media, err := s.ServiceRepo.GetMediaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkOwner(ctx, caller, media.ServiceID); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// checkLocation fails with gorm.ErrRecordNotFound unless the location belongs to the service.
+func (s ServitorSvcImpl) checkLocation(ctx context.Context, serviceId int, locationId int) error {
+	loc, err := s.ServiceRepo.GetLocationByID(ctx, locationId)
+	if err != nil {
+		return err
+	}
+	if loc.ServiceID != serviceId {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// checkOwner allows the servitor offering the service and administrators through.
+func (s ServitorSvcImpl) checkOwner(ctx context.Context, caller *utils.Caller, serviceId int) error {
+	svc, err := s.ServiceRepo.GetServiceByID(ctx, serviceId)
+	if err != nil {
+		return err
+	}
+	if !caller.IsAdmin() && svc.UserID != caller.ID {
+		return ErrNotServiceOwner
+	}
+	return nil
+}
+
+func coverageContains(area dao.CoverageArea, point geo.Point) bool {
+	if area.AreaType == dao.RadiusCoverage {
+		center := geo.Point{Latitude: area.CenterLatitude, Longitude: area.CenterLongitude}
+		return geo.DistanceKm(center, point) <= area.RadiusKm
+	}
+	polygons, err := geo.ParseGeoJSON([]byte(area.GeoJSON))
+	if err != nil {
+		logger.Error("stored coverage area is invalid", zap.Int("coverage.id", area.ID),
+			zap.NamedError("error.message", err))
+		return false
+	}
+	return polygons.Contains(point)
+}
+
+func toCoverageAreaResponse(area dao.CoverageArea) CoverageAreaResponse {
+	res := CoverageAreaResponse{
+		ID:        area.ID,
+		ServiceID: area.ServiceID,
+		AreaType:  area.AreaType,
+	}
+	if area.AreaType == dao.PolygonCoverage {
+		res.Geometry = json.RawMessage(area.GeoJSON)
+	} else {
+		res.Latitude = area.CenterLatitude
+		res.Longitude = area.CenterLongitude
+		res.RadiusKm = area.RadiusKm
+	}
+	return res
+}
+
+func toServicesResponse(svc dao.Service) ServicesResponse {
+	var locs []Locations
+	for _, loc := range svc.LocationInfo {
+		locs = append(locs, Locations{
+			ID:            loc.ID,
+			LocationImage: loc.LocationImage,
+			LocationName:  loc.LocationName,
+			Latitude:      loc.Latitude,
+			Longitude:     loc.Longitude,
+			Address:       loc.Address,
+		})
+	}
+	var cats []Category
+	for _, cat := range svc.Category {
+		cats = append(cats, Category{
+			ID:            cat.ID,
+			Slug:          cat.Slug,
+			CategoryImage: cat.CategoryImage,
+			CategoryName:  cat.CategoryName,
+			Icon:          cat.Icon,
+		})
+	}
+	return ServicesResponse{
+		ID:              svc.ID,
+		UserID:          svc.UserID,
+		ServiceImage:    svc.ServiceImage,
+		ServiceName:     svc.ServiceName,
+		ServiceDuration: svc.ServiceDuration,
+		ServiceCost:     svc.ServiceCost,
+		Pricing:         toPricing(svc),
+		Cancellation:    toCancellationPolicy(svc),
+		Status:          svc.Status,
+		Locations:       locs,
+		Category:        cats,
+	}
+}
+
+func toCategoriesResponse(cat dao.Category) CategoriesResponse {
+	return CategoriesResponse{
+		ID:            cat.ID,
+		ParentID:      cat.ParentID,
+		Slug:          cat.Slug,
+		CategoryImage: cat.CategoryImage,
+		CategoryName:  cat.CategoryName,
+		Icon:          cat.Icon,
+		SortOrder:     cat.SortOrder,
+	}
+}
+
+func toCancellationPolicy(svc dao.Service) CancellationPolicy {
+	return CancellationPolicy{
+		FreeCancellationHours:      svc.FreeCancellationHours,
+		LateCancellationFeePercent: svc.LateCancellationFeePercent,
+		NoShowFeePercent:           svc.NoShowFeePercent,
+	}
+}
+
+func toPricing(svc dao.Service) Pricing {
+	res := Pricing{
+		PricingModel:    svc.PricingModel,
+		Price:           svc.Price,
+		Currency:        svc.Currency,
+		UnitName:        svc.UnitName,
+		DurationMinutes: svc.DurationMinutes,
+		Packages:        []PackageResponse{},
+		AddOns:          []AddOnResponse{},
+	}
+	for _, pkg := range svc.Packages {
+		res.Packages = append(res.Packages, PackageResponse{
+			ID:              pkg.ID,
+			Tier:            pkg.Tier,
+			Name:            pkg.Name,
+			Description:     pkg.Description,
+			Price:           pkg.Price,
+			DurationMinutes: pkg.DurationMinutes,
+		})
+	}
+	for _, addOn := range svc.AddOns {
+		res.AddOns = append(res.AddOns, AddOnResponse{ID: addOn.ID, Name: addOn.Name, Price: addOn.Price})
+	}
+	return res
 }
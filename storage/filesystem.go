@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystemStore writes blobs below a root directory, the directory is expected to be served
+// statically at the base URL.
+type FileSystemStore struct {
+	root    string
+	baseURL string
+}
+
+func NewFileSystemStore(root string, baseURL string) BlobStore {
+	return &FileSystemStore{root: root, baseURL: baseURL}
+}
+
+// Put writes the content to a temporary file first so readers never see a partial blob.
+func (f *FileSystemStore) Put(ctx context.Context, key string, content io.Reader, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(f.root, filepath.FromSlash(key))
+	if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return f.URL(key), nil
+}
+
+func (f *FileSystemStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(f.root, filepath.FromSlash(key)))
+}
+
+// Delete removes the blob, deleting a blob that does not exist is not an error.
+func (f *FileSystemStore) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(f.root, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *FileSystemStore) URL(key string) string {
+	return joinURL(f.baseURL, key)
+}
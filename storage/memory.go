@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// MemoryStore keeps blobs in process, it is meant for tests and local development.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	blobs   map[string][]byte
+	baseURL string
+}
+
+func NewMemoryStore(baseURL string) BlobStore {
+	return &MemoryStore{blobs: map[string][]byte{}, baseURL: baseURL}
+}
+
+func (m *MemoryStore) Put(ctx context.Context, key string, content io.Reader, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[key] = data
+	return m.URL(key), nil
+}
+
+func (m *MemoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, key)
+	return nil
+}
+
+func (m *MemoryStore) URL(key string) string {
+	return joinURL(m.baseURL, key)
+}
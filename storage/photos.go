@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"servhunt/infra/imaging"
+	"servhunt/infra/utils"
+)
+
+const (
+	// MaxPhotoBytes bounds the size of an uploaded photo.
+	MaxPhotoBytes = 10 << 20
+
+	// maxPhotoSize is the longest side, in pixels, photos are stored at.
+	maxPhotoSize = 2048
+)
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrUnsupportedPhoto = errors.New("only JPEG, PNG and GIF photos can be uploaded")
+	ErrPhotoTooLarge    = fmt.Errorf("photos can be at most %d MB", MaxPhotoBytes>>20)
+)
+
+var photoTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+// Photo is an uploaded photo as PutPhoto stored it.
+type Photo struct {
+	Key    string
+	Url    string
+	Width  int
+	Height int
+}
+
+// PutPhoto stores the upload under dir as a JPEG of at most maxPhotoSize pixels. Re-encoding also
+// drops the metadata of the original, such as where a photo of the customer's home was taken.
+func PutPhoto(ctx context.Context, blobs BlobStore, dir string, file io.Reader) (*Photo, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxPhotoBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxPhotoBytes {
+		return nil, ErrPhotoTooLarge
+	}
+	if !photoTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedPhoto
+	}
+	img, err := imaging.Decode(bytes.NewReader(data))
+	if errors.Is(err, imaging.ErrTooManyPixels) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrUnsupportedPhoto
+	}
+	resized := imaging.Fit(img, maxPhotoSize)
+	encoded, err := imaging.EncodeJPEG(resized)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/%s.jpg", dir, uuid.NewString())
+	url, err := blobs.Put(ctx, key, bytes.NewReader(encoded), "image/jpeg")
+	if err != nil {
+		return nil, err
+	}
+	return &Photo{Key: key, Url: url, Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy()}, nil
+}
+
+// DeletePhoto removes the blob of a photo, failures are only logged.
+func DeletePhoto(ctx context.Context, blobs BlobStore, key string) {
+	if err := blobs.Delete(ctx, key); err != nil {
+		logger.Error("error deleting photo blob", zap.String("blob.key", key),
+			zap.NamedError("error.message", err))
+	}
+}
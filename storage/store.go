@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("blob keys must be relative paths without .. segments")
+
+// BlobStore keeps uploaded files under slash separated keys and hands out the URL each one is
+// served from.
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, contentType string) (string, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// cleanKey rejects keys that could escape the store, such as absolute paths or .. segments.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." || segment == "" {
+			return "", ErrInvalidKey
+		}
+	}
+	return path.Clean(key), nil
+}
+
+// joinURL appends the key to the base URL the store is served from.
+func joinURL(baseURL string, key string) string {
+	return strings.TrimRight(baseURL, "/") + "/" + key
+}
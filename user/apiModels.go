@@ -17,7 +17,7 @@ type CreateUserRequest struct {
 	SecondName    string   `json:"second_name" binding:"required,alphanum"`
 	Email         string   `json:"email" binding:"required,email"`
 	PhoneNo       string   `json:"phone_no" binding:"required"`
-	UserType      string   `json:"user_type" binding:"required"`
+	UserType      string   `json:"user_type" binding:"required,oneof=servitor customer"`
 	Password      string   `json:"password" binding:"required,min=6"`
 	Location      string   `json:"location"`
 	Address       string   `json:"address"`
@@ -28,6 +28,8 @@ type CreateUserRequest struct {
 	OnlineStatus  string   `json:"online_status"`
 	AvailableTime string   `json:"available_time"`
 	About         string   `json:"about"`
+	ReferralCode  string   `json:"referral_code"`
+	DeviceID      string   `json:"device_id"`
 }
 
 type UpdateUserRequest struct {
@@ -36,7 +38,6 @@ type UpdateUserRequest struct {
 	SecondName    string   `json:"second_name"`
 	Email         string   `json:"email"`
 	PhoneNo       string   `json:"phone_no"`
-	UserType      string   `json:"user_type"`
 	Location      string   `json:"location"`
 	Address       string   `json:"address"`
 	Currency      string   `json:"currency"`
@@ -64,20 +65,27 @@ type FetchByIdEmailRequest struct {
 	Email string `json:"email" `
 }
 
+type FetchUsersRequest struct {
+	Verified *bool  `form:"verified"`
+	UserType string `form:"user_type"`
+}
+
 type Response struct {
 	ID            int       `json:"id"`
 	FirstName     string    `json:"first_name"`
 	SecondName    string    `json:"second_name"`
 	FullName      string    `json:"full_name"`
-	Email         string    `json:"email"`
-	PhoneNo       string    `json:"phone_no"`
+	Email         string    `json:"email,omitempty"`
+	PhoneNo       string    `json:"phone_no,omitempty"`
 	UserType      string    `json:"user_type"`
 	Location      string    `json:"location"`
+	Address       string    `json:"address,omitempty"`
 	Currency      string    `json:"currency"`
 	Languages     []string  `json:"languages"`
 	Description   string    `json:"description"`
 	Ratings       string    `json:"ratings"`
 	OnlineStatus  string    `json:"online_status"`
+	Verified      bool      `json:"verified"`
 	CreatedOn     time.Time `json:"created_on"`
 	LastUpdatedOn time.Time `json:"last_updated_on"`
 }
@@ -93,3 +101,31 @@ type LocationInfoResponse struct {
 	CreatedOn     time.Time `json:"created_on"`
 	LastUpdatedOn time.Time `json:"last_updated_on"`
 }
+
+type NotificationPreferenceRequest struct {
+	EventType string `json:"event_type" binding:"required,oneof=booking_requested booking_confirmed booking_reminder booking_cancelled waitlist_offer referral_rewarded verification_reviewed marketing"`
+	Channel   string `json:"channel" binding:"required,oneof=email sms push"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type FieldVisibility struct {
+	PhoneNo string `json:"phone_no" binding:"omitempty,oneof=public private"`
+	Email   string `json:"email" binding:"omitempty,oneof=public private"`
+	Address string `json:"address" binding:"omitempty,oneof=public private"`
+}
+
+type PreferencesRequest struct {
+	Notifications   []NotificationPreferenceRequest `json:"notifications" binding:"dive"`
+	QuietHoursStart string                          `json:"quiet_hours_start"`
+	QuietHoursEnd   string                          `json:"quiet_hours_end"`
+	TimeZone        string                          `json:"time_zone"`
+	Visibility      FieldVisibility                 `json:"visibility"`
+}
+
+type PreferencesResponse struct {
+	Notifications   []NotificationPreferenceRequest `json:"notifications"`
+	QuietHoursStart string                          `json:"quiet_hours_start"`
+	QuietHoursEnd   string                          `json:"quiet_hours_end"`
+	TimeZone        string                          `json:"time_zone"`
+	Visibility      FieldVisibility                 `json:"visibility"`
+}
@@ -1,28 +1,36 @@
 package dao
 
 import (
+	"gorm.io/gorm"
 	"time"
 )
 
+// User is an account. Admin grants administrator rights apart from UserType, operators set it in the
+// database and no request can change it.
 type User struct {
-	ID            int        `gorm:"primary_key; auto_increment" json:"id"`
-	FirstName     string     `gorm:"type:varchar(256)" json:"first_name"`
-	SecondName    string     `gorm:"type:varchar(256)" json:"second_name"`
-	Email         string     `gorm:"type:varchar(256);unique" json:"email"`
-	Password      string     `gorm:"not null;unique" json:"password"`
-	PhoneNo       string     `gorm:"type:varchar(256);not null;unique" json:"phone_no"`
-	Currency      string     `gorm:"type:varchar(256)" json:"currency"`
-	Languages     []Language `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"languages"`
-	Description   string     `gorm:"type:varchar(256)" json:"description"`
-	Ratings       string     `gorm:"type:varchar(256)" json:"ratings"`
-	OnlineStatus  string     `gorm:"type:varchar(256)" json:"online_status"`
-	UserType      string     `gorm:"type:varchar(256)" json:"user_type"`
-	Location      string     `gorm:"type:varchar(256)" json:"location"`
-	Address       string     `gorm:"type:varchar(256)" json:"address"`
-	AvailableTime string     `gorm:"type:varchar(256)" json:"available_time"`
-	About         string     `json:"about"`
-	CreatedOn     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
-	LastUpdatedOn time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	ID            int            `gorm:"primary_key; auto_increment" json:"id"`
+	FirstName     string         `gorm:"type:varchar(256)" json:"first_name"`
+	SecondName    string         `gorm:"type:varchar(256)" json:"second_name"`
+	Email         string         `gorm:"type:varchar(256);unique" json:"email"`
+	Password      string         `gorm:"not null;unique" json:"password"`
+	PhoneNo       string         `gorm:"type:varchar(256);not null;unique" json:"phone_no"`
+	Currency      string         `gorm:"type:varchar(256)" json:"currency"`
+	Languages     []Language     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"languages"`
+	Description   string         `gorm:"type:varchar(256)" json:"description"`
+	Ratings       string         `gorm:"type:varchar(256)" json:"ratings"`
+	OnlineStatus  string         `gorm:"type:varchar(256)" json:"online_status"`
+	UserType      string         `gorm:"type:varchar(256)" json:"user_type"`
+	Location      string         `gorm:"type:varchar(256)" json:"location"`
+	Address       string         `gorm:"type:varchar(256)" json:"address"`
+	AvailableTime string         `gorm:"type:varchar(256)" json:"available_time"`
+	About         string         `json:"about"`
+	Verified      bool           `gorm:"default:false;index" json:"verified"`
+	Admin         bool           `gorm:"default:false" json:"-"`
+	ReferralCode  *string        `gorm:"type:varchar(16);uniqueIndex" json:"referral_code"`
+	DeviceID      string         `gorm:"type:varchar(256)" json:"device_id"`
+	CreatedOn     time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
 type Language struct {
@@ -30,3 +38,37 @@ type Language struct {
 	UserID   int    `json:"user_id"`
 	Language string `json:"language"`
 }
+
+// UserFilter narrows down the users returned by GetAllUsers, empty fields are ignored.
+type UserFilter struct {
+	Verified *bool
+	UserType string
+}
+
+// Visibility levels of a profile field, private fields are only shown to the user and administrators.
+const (
+	PublicVisibility  = "public"
+	PrivateVisibility = "private"
+)
+
+// Preference holds a user's privacy settings and quiet hours, QuietHoursStart and QuietHoursEnd are
+// wall clock times formatted as HH:MM in TimeZone.
+type Preference struct {
+	UserID            int                      `gorm:"primary_key" json:"user_id"`
+	PhoneVisibility   string                   `gorm:"type:varchar(32)" json:"phone_visibility"`
+	EmailVisibility   string                   `gorm:"type:varchar(32)" json:"email_visibility"`
+	AddressVisibility string                   `gorm:"type:varchar(32)" json:"address_visibility"`
+	QuietHoursStart   string                   `gorm:"type:varchar(5)" json:"quiet_hours_start"`
+	QuietHoursEnd     string                   `gorm:"type:varchar(5)" json:"quiet_hours_end"`
+	TimeZone          string                   `gorm:"type:varchar(64)" json:"time_zone"`
+	Notifications     []NotificationPreference `gorm:"foreignKey:UserID;references:UserID" json:"notifications"`
+	LastUpdatedOn     time.Time                `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+type NotificationPreference struct {
+	ID        int    `gorm:"primary_key; auto_increment" json:"id"`
+	UserID    int    `gorm:"index" json:"user_id"`
+	EventType string `gorm:"type:varchar(64)" json:"event_type"`
+	Channel   string `gorm:"type:varchar(32)" json:"channel"`
+	Enabled   bool   `json:"enabled"`
+}
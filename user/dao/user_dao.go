@@ -2,17 +2,36 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"servhunt/infra/dao"
+	"servhunt/infra/token"
+	svcdao "servhunt/servitorservices/dao"
+	"strings"
+	"time"
+)
+
+const (
+	referralCodeLength   = 8
+	referralCodeAttempts = 5
 )
 
 type UserRepo interface {
 	SaveUser(ctx context.Context, request User) (*User, error)
 	UpdateUser(ctx context.Context, request User) (*User, error)
-	GetAllUsers(ctx context.Context) (*[]User, error)
+	GetAllUsers(ctx context.Context, filter UserFilter) (*[]User, error)
 	GetUserById(ctx context.Context, id int) (*User, error)
 	GetUserByPhone(ctx context.Context, phone string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByReferralCode(ctx context.Context, code string) (*User, error)
+	AssignReferralCode(ctx context.Context, id int) (string, error)
+	GetPreferences(ctx context.Context, userId int) (*Preference, error)
+	GetPreferencesForUsers(ctx context.Context, userIds []int) (*[]Preference, error)
+	SavePreferences(ctx context.Context, preference Preference) (*Preference, error)
+	DeleteUser(ctx context.Context, id int) error
+	RestoreUser(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
 type UserRepoImpl struct {
@@ -37,7 +56,6 @@ func (u *UserRepoImpl) UpdateUser(ctx context.Context, request User) (*User, err
 		SecondName:    request.SecondName,
 		Email:         request.Email,
 		PhoneNo:       request.PhoneNo,
-		UserType:      request.UserType,
 		Currency:      request.Currency,
 		Languages:     request.Languages,
 		Description:   request.Description,
@@ -54,9 +72,16 @@ func (u *UserRepoImpl) UpdateUser(ctx context.Context, request User) (*User, err
 	return &request, nil
 }
 
-func (u *UserRepoImpl) GetAllUsers(ctx context.Context) (*[]User, error) {
+func (u *UserRepoImpl) GetAllUsers(ctx context.Context, filter UserFilter) (*[]User, error) {
 	var users []User
-	err := u.repo.DB.WithContext(ctx).Model(&User{}).Preload(clause.Associations).Find(&users).Error
+	db := u.repo.DB.WithContext(ctx).Model(&User{})
+	if filter.Verified != nil {
+		db = db.Where("verified = ?", *filter.Verified)
+	}
+	if filter.UserType != "" {
+		db = db.Where("user_type = ?", filter.UserType)
+	}
+	err := db.Preload(clause.Associations).Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
@@ -89,3 +114,149 @@ func (u *UserRepoImpl) GetUserByEmail(ctx context.Context, email string) (*User,
 	}
 	return &user, nil
 }
+
+func (u *UserRepoImpl) GetUserByReferralCode(ctx context.Context, code string) (*User, error) {
+	var user User
+	err := u.repo.DB.WithContext(ctx).Model(&User{}).Where("referral_code = ?", strings.ToUpper(code)).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AssignReferralCode returns the user's referral code, generating a unique one if they have none yet.
+func (u *UserRepoImpl) AssignReferralCode(ctx context.Context, id int) (string, error) {
+	user, err := u.GetUserById(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if user.ReferralCode != nil {
+		return *user.ReferralCode, nil
+	}
+	for i := 0; i < referralCodeAttempts; i++ {
+		code := strings.ToUpper(token.RandomString(referralCodeLength))
+		var taken int64
+		err = u.repo.DB.WithContext(ctx).Unscoped().Model(&User{}).Where("referral_code = ?", code).Count(&taken).Error
+		if err != nil {
+			return "", err
+		}
+		if taken > 0 {
+			continue
+		}
+		res := u.repo.DB.WithContext(ctx).Model(&User{}).Where("id = ? AND referral_code IS NULL", id).
+			Update("referral_code", code)
+		if res.Error != nil {
+			return "", res.Error
+		}
+		if res.RowsAffected == 0 {
+			// a concurrent request assigned a code first
+			return u.AssignReferralCode(ctx, id)
+		}
+		return code, nil
+	}
+	return "", errors.New("failed to generate a unique referral code")
+}
+
+func (u *UserRepoImpl) GetPreferences(ctx context.Context, userId int) (*Preference, error) {
+	var preference Preference
+	err := u.repo.DB.WithContext(ctx).Model(&Preference{}).Where("user_id = ?", userId).Preload(clause.Associations).
+		Take(&preference).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preference, nil
+}
+
+func (u *UserRepoImpl) GetPreferencesForUsers(ctx context.Context, userIds []int) (*[]Preference, error) {
+	var preferences []Preference
+	if len(userIds) == 0 {
+		return &preferences, nil
+	}
+	err := u.repo.DB.WithContext(ctx).Model(&Preference{}).Where("user_id IN ?", userIds).Find(&preferences).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+// SavePreferences creates or replaces the preferences of a user, including every notification setting.
+func (u *UserRepoImpl) SavePreferences(ctx context.Context, preference Preference) (*Preference, error) {
+	err := u.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		notifications := preference.Notifications
+		preference.Notifications = nil
+		preference.LastUpdatedOn = time.Now()
+		err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Model(&Preference{}).Create(&preference).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("user_id = ?", preference.UserID).Delete(&NotificationPreference{}).Error; err != nil {
+			return err
+		}
+		for i := range notifications {
+			notifications[i].ID = 0
+			notifications[i].UserID = preference.UserID
+		}
+		if len(notifications) > 0 {
+			if err = tx.Model(&NotificationPreference{}).Create(&notifications).Error; err != nil {
+				return err
+			}
+		}
+		preference.Notifications = notifications
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &preference, nil
+}
+
+// DeleteUser soft deletes a user and cascades the deletion to the services they offer.
+func (u *UserRepoImpl) DeleteUser(ctx context.Context, id int) error {
+	return u.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Model(&User{}).Where("id = ?", id).Take(&user).Error; err != nil {
+			return err
+		}
+		deletedAt := time.Now()
+		if err := svcdao.DeleteServicesWhere(tx, deletedAt, "user_id = ?", id); err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", id).Update("deleted_at", deletedAt).Error
+	})
+}
+
+// RestoreUser restores a user and the services that were deleted along with them.
+func (u *UserRepoImpl) RestoreUser(ctx context.Context, id int) error {
+	return u.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		err := tx.Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", id).Take(&user).Error
+		if err != nil {
+			return err
+		}
+		if err = svcdao.RestoreServicesWhere(tx, user.DeletedAt.Time, "user_id = ?", id); err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	})
+}
+
+// PurgeDeleted permanently removes users deleted before the given time along with their languages.
+func (u *UserRepoImpl) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := u.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []int
+		err := tx.Unscoped().Model(&User{}).Where("deleted_at < ?", before).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		for _, model := range []interface{}{&Language{}, &NotificationPreference{}, &Preference{}} {
+			if err = tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		res := tx.Unscoped().Where("id IN ?", ids).Delete(&User{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
@@ -1,7 +1,9 @@
 package user
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"net/http"
 	"servhunt/infra/utils"
 	"strconv"
@@ -17,6 +19,10 @@ type UsersHandler interface {
 	GetUserById(ctx *gin.Context)
 	GetUserByPhoneNo(ctx *gin.Context)
 	GetUserByEmail(ctx *gin.Context)
+	DeleteUserAccount(ctx *gin.Context)
+	RestoreUserAccount(ctx *gin.Context)
+	GetPreferences(ctx *gin.Context)
+	UpdatePreferences(ctx *gin.Context)
 }
 
 type UsersHandlerImpl struct {
@@ -66,6 +72,10 @@ func (user *UsersHandlerImpl) CreateUserAccount(ctx *gin.Context) {
 	}
 
 	account, err := user.UserService.CreateUserAccount(ctx, req)
+	if errors.Is(err, ErrInvalidReferralCode) {
+		utils.APIResponse(ctx, "Failed to create user account", http.StatusBadRequest, false, err.Error())
+		return
+	}
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -115,7 +125,14 @@ func (user *UsersHandlerImpl) UpdateUserAccount(ctx *gin.Context) {
 }
 
 func (user *UsersHandlerImpl) GetAllUsers(ctx *gin.Context) {
-	users, err := user.UserService.GetAllUsers(ctx)
+	filter := FetchUsersRequest{}
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	users, err := user.UserService.GetAllUsers(ctx, caller, filter)
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -136,7 +153,12 @@ func (user *UsersHandlerImpl) GetUserByPhoneNo(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	userRes, err := user.UserService.GetUserByPhone(ctx, fetchReq.PhoneNo)
+	caller, _ := utils.GetCaller(ctx)
+	userRes, err := user.UserService.GetUserByPhone(ctx, caller, fetchReq.PhoneNo)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "User not found", http.StatusNotFound, false, nil)
+		return
+	}
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -157,7 +179,12 @@ func (user *UsersHandlerImpl) GetUserByEmail(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	userRes, err := user.UserService.GetUserByEmail(ctx, fetchReq.Email)
+	caller, _ := utils.GetCaller(ctx)
+	userRes, err := user.UserService.GetUserByEmail(ctx, caller, fetchReq.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "User not found", http.StatusNotFound, false, nil)
+		return
+	}
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -184,7 +211,8 @@ func (user *UsersHandlerImpl) GetUserById(ctx *gin.Context) {
 			false, err.Error())
 		return
 	}
-	userRes, err := user.UserService.GetUserById(ctx, fetchReq.UserId)
+	caller, _ := utils.GetCaller(ctx)
+	userRes, err := user.UserService.GetUserById(ctx, caller, fetchReq.UserId)
 	if err != nil {
 		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
 			false, err.Error())
@@ -196,3 +224,92 @@ func (user *UsersHandlerImpl) GetUserById(ctx *gin.Context) {
 	}
 	utils.APIResponse(ctx, "Failed to return user", http.StatusBadRequest, false, nil)
 }
+
+func (user *UsersHandlerImpl) DeleteUserAccount(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if !caller.IsAdmin() && caller.ID != id {
+		utils.APIResponse(ctx, "You can only delete your own account", http.StatusForbidden, false, nil)
+		return
+	}
+	account, err := user.UserService.DeleteUserAccount(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "User account deleted successfully", http.StatusOK, true, account)
+}
+
+func (user *UsersHandlerImpl) RestoreUserAccount(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	account, err := user.UserService.RestoreUserAccount(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "User account restored successfully", http.StatusOK, true, account)
+}
+
+func (user *UsersHandlerImpl) GetPreferences(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if !caller.IsAdmin() && caller.ID != id {
+		utils.APIResponse(ctx, "You can only view your own preferences", http.StatusForbidden, false, nil)
+		return
+	}
+	preferences, err := user.UserService.GetPreferences(ctx, id)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Preferences successfully returned", http.StatusOK, true, preferences)
+}
+
+func (user *UsersHandlerImpl) UpdatePreferences(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	if caller.ID != id {
+		utils.APIResponse(ctx, "You can only update your own preferences", http.StatusForbidden, false, nil)
+		return
+	}
+	req := PreferencesRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	preferences, err := user.UserService.UpdatePreferences(ctx, id, req)
+	if errors.Is(err, ErrInvalidPreferences) {
+		utils.APIResponse(ctx, "Failed to update preferences", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Preferences updated successfully", http.StatusOK, true, preferences)
+}
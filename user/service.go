@@ -2,31 +2,72 @@ package user
 
 import (
 	"context"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"servhunt/infra/token"
+	"servhunt/infra/utils"
 	"servhunt/user/dao"
 	"strings"
 	"time"
 )
 
+var (
+	logger = utils.GetRootLogger()
+
+	ErrInvalidReferralCode = errors.New("referral code is invalid")
+	ErrInvalidPreferences  = errors.New("quiet hours must be formatted as HH:MM with a valid time zone")
+)
+
+// Notification events and channels users can opt in or out of.
+const (
+	BookingRequestedEvent     = "booking_requested"
+	BookingConfirmedEvent     = "booking_confirmed"
+	BookingReminderEvent      = "booking_reminder"
+	BookingCancelledEvent     = "booking_cancelled"
+	WaitlistOfferEvent        = "waitlist_offer"
+	ReferralRewardedEvent     = "referral_rewarded"
+	VerificationReviewedEvent = "verification_reviewed"
+	MarketingEvent            = "marketing"
+
+	EmailChannel = "email"
+	SMSChannel   = "sms"
+	PushChannel  = "push"
+)
+
+const quietHoursLayout = "15:04"
+
+// ReferralRegistrar records who referred a newly created account.
+type ReferralRegistrar interface {
+	RegisterSignup(ctx context.Context, referrerId int, referredId int, deviceId string) error
+}
+
 type UserService interface {
 	Login(ctx context.Context, request LoginRequest) (*LoginResponse, error)
 	CreateUserAccount(ctx context.Context, user CreateUserRequest) (*CreateUserResponse, error)
 	UpdateUserAccount(ctx context.Context, user UpdateUserRequest) (*CreateUserResponse, error)
-	GetAllUsers(ctx context.Context) (*[]Response, error)
-	GetUserById(ctx context.Context, id int) (*Response, error)
-	GetUserByPhone(ctx context.Context, phone string) (*Response, error)
-	GetUserByEmail(ctx context.Context, email string) (*Response, error)
+	GetAllUsers(ctx context.Context, viewer *utils.Caller, filter FetchUsersRequest) (*[]Response, error)
+	GetUserById(ctx context.Context, viewer *utils.Caller, id int) (*Response, error)
+	GetUserByPhone(ctx context.Context, viewer *utils.Caller, phone string) (*Response, error)
+	GetUserByEmail(ctx context.Context, viewer *utils.Caller, email string) (*Response, error)
+	DeleteUserAccount(ctx context.Context, id int) (*CreateUserResponse, error)
+	RestoreUserAccount(ctx context.Context, id int) (*CreateUserResponse, error)
+	GetPreferences(ctx context.Context, userId int) (*PreferencesResponse, error)
+	UpdatePreferences(ctx context.Context, userId int, request PreferencesRequest) (*PreferencesResponse, error)
+	ShouldNotify(ctx context.Context, userId int, eventType string, channel string, at time.Time) (bool, error)
 }
 
 type UserServiceImpl struct {
 	dao.UserRepo
 	token.Maker
+	referrals ReferralRegistrar
 }
 
-func NewUserServiceImpl(userDao dao.UserRepo, token token.Maker) UserService {
+func NewUserServiceImpl(userDao dao.UserRepo, token token.Maker, referrals ReferralRegistrar) UserService {
 	return &UserServiceImpl{
-		UserRepo: userDao,
-		Maker:    token,
+		UserRepo:  userDao,
+		Maker:     token,
+		referrals: referrals,
 	}
 }
 
@@ -47,29 +88,7 @@ func (u *UserServiceImpl) Login(ctx context.Context, request LoginRequest) (*Log
 	if err != nil {
 		return nil, err
 	}
-	var langs []string
-	if user.Languages != nil {
-		for _, lang := range user.Languages {
-			langs = append(langs, lang.Language)
-		}
-	}
-	finalUser := Response{
-		ID:            user.ID,
-		FirstName:     user.FirstName,
-		SecondName:    user.SecondName,
-		FullName:      strings.Join([]string{user.FirstName, user.SecondName}, ""),
-		Email:         user.Email,
-		PhoneNo:       user.PhoneNo,
-		UserType:      user.PhoneNo,
-		Location:      user.Location,
-		Currency:      user.Currency,
-		Languages:     langs,
-		Description:   user.Description,
-		Ratings:       user.Ratings,
-		OnlineStatus:  user.OnlineStatus,
-		CreatedOn:     user.CreatedOn,
-		LastUpdatedOn: user.LastUpdatedOn,
-	}
+	finalUser := toResponse(*user)
 	res := LoginResponse{
 		AccessToken: createdToken,
 		User:        finalUser,
@@ -79,6 +98,15 @@ func (u *UserServiceImpl) Login(ctx context.Context, request LoginRequest) (*Log
 
 func (u *UserServiceImpl) CreateUserAccount(ctx context.Context, user CreateUserRequest) (*CreateUserResponse, error) {
 
+	var referrer *dao.User
+	if user.ReferralCode != "" {
+		var err error
+		referrer, err = u.UserRepo.GetUserByReferralCode(ctx, user.ReferralCode)
+		if err != nil {
+			return nil, ErrInvalidReferralCode
+		}
+	}
+
 	hashedPassword, errH := token.HashPassword(user.Password)
 	if errH != nil {
 		return nil, errH
@@ -107,12 +135,25 @@ func (u *UserServiceImpl) CreateUserAccount(ctx context.Context, user CreateUser
 		OnlineStatus: user.OnlineStatus,
 		Location:     user.Location,
 		Address:      user.Address,
+		DeviceID:     user.DeviceID,
 	}
 	savedUser, err := u.UserRepo.SaveUser(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
+	// the account is already created, referral bookkeeping failures must not fail the signup
+	if _, err = u.UserRepo.AssignReferralCode(ctx, savedUser.ID); err != nil {
+		logger.Error("error assigning referral code", zap.Int("user.id", savedUser.ID),
+			zap.NamedError("error.message", err))
+	}
+	if referrer != nil {
+		if err = u.referrals.RegisterSignup(ctx, referrer.ID, savedUser.ID, user.DeviceID); err != nil {
+			logger.Error("error registering referral", zap.Int("user.id", savedUser.ID),
+				zap.NamedError("error.message", err))
+		}
+	}
+
 	res := CreateUserResponse{
 		UserId: savedUser.ID,
 	}
@@ -135,7 +176,6 @@ func (u *UserServiceImpl) UpdateUserAccount(ctx context.Context, user UpdateUser
 		SecondName:    user.SecondName,
 		Email:         user.Email,
 		PhoneNo:       user.PhoneNo,
-		UserType:      user.UserType,
 		Currency:      user.Currency,
 		Languages:     langs,
 		Description:   user.Description,
@@ -157,132 +197,302 @@ func (u *UserServiceImpl) UpdateUserAccount(ctx context.Context, user UpdateUser
 	return &res, nil
 }
 
-func (u *UserServiceImpl) GetAllUsers(ctx context.Context) (*[]Response, error) {
+func (u *UserServiceImpl) GetAllUsers(ctx context.Context, viewer *utils.Caller,
+	filter FetchUsersRequest) (*[]Response, error) {
 
-	users, err := u.UserRepo.GetAllUsers(ctx)
+	users, err := u.UserRepo.GetAllUsers(ctx, dao.UserFilter{
+		Verified: filter.Verified,
+		UserType: filter.UserType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, user := range *users {
+		ids = append(ids, user.ID)
+	}
+	preferences, err := u.UserRepo.GetPreferencesForUsers(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
+	preferenceByUser := map[int]dao.Preference{}
+	for _, preference := range *preferences {
+		preferenceByUser[preference.UserID] = preference
+	}
 
 	var userList []Response
 	for _, user := range *users {
-		var langs []string
-		if user.Languages != nil {
-			for _, lang := range user.Languages {
-				langs = append(langs, lang.Language)
-			}
+		preference, ok := preferenceByUser[user.ID]
+		if !ok {
+			preference = defaultPreference(user.ID)
 		}
-		finalUser := Response{
-			ID:            user.ID,
-			FirstName:     user.FirstName,
-			SecondName:    user.SecondName,
-			FullName:      strings.Join([]string{user.FirstName, user.SecondName}, " "),
-			Email:         user.Email,
-			PhoneNo:       user.PhoneNo,
-			UserType:      user.PhoneNo,
-			Location:      user.Location,
-			Currency:      user.Currency,
-			Languages:     langs,
-			Description:   user.Description,
-			Ratings:       user.Ratings,
-			OnlineStatus:  user.OnlineStatus,
-			CreatedOn:     user.CreatedOn,
-			LastUpdatedOn: user.LastUpdatedOn,
-		}
-		userList = append(userList, finalUser)
+		userList = append(userList, projectResponse(toResponse(user), preference, viewer))
 	}
 	return &userList, nil
 }
 
-func (u *UserServiceImpl) GetUserById(ctx context.Context, id int) (*Response, error) {
+func (u *UserServiceImpl) GetUserById(ctx context.Context, viewer *utils.Caller, id int) (*Response, error) {
 	user, err := u.UserRepo.GetUserById(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	var langs []string
-	if user.Languages != nil {
-		for _, lang := range user.Languages {
-			langs = append(langs, lang.Language)
+	return u.projectUser(ctx, *user, viewer)
+}
+
+// GetUserByPhone finds the user with the phone number. A number the user keeps private is only
+// looked up for the user themselves and administrators, anyone else is told nobody has it.
+func (u *UserServiceImpl) GetUserByPhone(ctx context.Context, viewer *utils.Caller, phone string) (*Response, error) {
+	user, err := u.UserRepo.GetUserByPhone(ctx, phone)
+	if err != nil {
+		return nil, err
+	}
+	return u.projectLookup(ctx, *user, viewer, func(preference dao.Preference) string {
+		return preference.PhoneVisibility
+	})
+}
+
+// GetUserByEmail finds the user with the email address, private addresses are treated like phone
+// numbers in GetUserByPhone.
+func (u *UserServiceImpl) GetUserByEmail(ctx context.Context, viewer *utils.Caller, email string) (*Response, error) {
+	user, err := u.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return u.projectLookup(ctx, *user, viewer, func(preference dao.Preference) string {
+		return preference.EmailVisibility
+	})
+}
+
+func (u *UserServiceImpl) DeleteUserAccount(ctx context.Context, id int) (*CreateUserResponse, error) {
+	if err := u.UserRepo.DeleteUser(ctx, id); err != nil {
+		return nil, err
+	}
+	res := CreateUserResponse{
+		UserId: id,
+	}
+	return &res, nil
+}
+
+func (u *UserServiceImpl) RestoreUserAccount(ctx context.Context, id int) (*CreateUserResponse, error) {
+	if err := u.UserRepo.RestoreUser(ctx, id); err != nil {
+		return nil, err
+	}
+	res := CreateUserResponse{
+		UserId: id,
+	}
+	return &res, nil
+}
+
+// NewCallerResolver resolves the token username, which is the user's phone number, to the caller.
+func NewCallerResolver(userDao dao.UserRepo) utils.CallerResolver {
+	return func(ctx context.Context, username string) (*utils.Caller, error) {
+		user, err := userDao.GetUserByPhone(ctx, username)
+		if err != nil {
+			return nil, err
 		}
+		return &utils.Caller{ID: user.ID, UserType: user.UserType, Admin: user.Admin}, nil
 	}
-	finalUser := Response{
-		ID:            user.ID,
-		FirstName:     user.FirstName,
-		SecondName:    user.SecondName,
-		FullName:      strings.Join([]string{user.FirstName, user.SecondName}, ""),
-		Email:         user.Email,
-		PhoneNo:       user.PhoneNo,
-		UserType:      user.PhoneNo,
-		Location:      user.Location,
-		Currency:      user.Currency,
-		Languages:     langs,
-		Description:   user.Description,
-		Ratings:       user.Ratings,
-		OnlineStatus:  user.OnlineStatus,
-		CreatedOn:     user.CreatedOn,
-		LastUpdatedOn: user.LastUpdatedOn,
+}
+
+func (u *UserServiceImpl) GetPreferences(ctx context.Context, userId int) (*PreferencesResponse, error) {
+	preference, err := u.preferences(ctx, userId)
+	if err != nil {
+		return nil, err
 	}
-	return &finalUser, nil
+	res := toPreferencesResponse(*preference)
+	return &res, nil
 }
 
-func (u *UserServiceImpl) GetUserByPhone(ctx context.Context, phone string) (*Response, error) {
-	user, err := u.UserRepo.GetUserByPhone(ctx, phone)
+func (u *UserServiceImpl) UpdatePreferences(ctx context.Context, userId int,
+	request PreferencesRequest) (*PreferencesResponse, error) {
+	if (request.QuietHoursStart == "") != (request.QuietHoursEnd == "") {
+		return nil, ErrInvalidPreferences
+	}
+	for _, clock := range []string{request.QuietHoursStart, request.QuietHoursEnd} {
+		if _, err := time.Parse(quietHoursLayout, clock); clock != "" && err != nil {
+			return nil, ErrInvalidPreferences
+		}
+	}
+	if _, err := time.LoadLocation(request.TimeZone); err != nil {
+		return nil, ErrInvalidPreferences
+	}
+
+	preference := defaultPreference(userId)
+	preference.QuietHoursStart = request.QuietHoursStart
+	preference.QuietHoursEnd = request.QuietHoursEnd
+	preference.TimeZone = request.TimeZone
+	if request.Visibility.PhoneNo != "" {
+		preference.PhoneVisibility = request.Visibility.PhoneNo
+	}
+	if request.Visibility.Email != "" {
+		preference.EmailVisibility = request.Visibility.Email
+	}
+	if request.Visibility.Address != "" {
+		preference.AddressVisibility = request.Visibility.Address
+	}
+	for _, notification := range request.Notifications {
+		preference.Notifications = append(preference.Notifications, dao.NotificationPreference{
+			EventType: notification.EventType,
+			Channel:   notification.Channel,
+			Enabled:   notification.Enabled,
+		})
+	}
+
+	saved, err := u.UserRepo.SavePreferences(ctx, preference)
 	if err != nil {
 		return nil, err
 	}
-	var langs []string
-	if user.Languages != nil {
-		for _, lang := range user.Languages {
-			langs = append(langs, lang.Language)
+	res := toPreferencesResponse(*saved)
+	return &res, nil
+}
+
+// ShouldNotify reports whether the user wants to receive the event on the channel at the given time.
+// Events without an explicit setting are sent, except marketing which is opt in, and quiet hours hold
+// back SMS and push notifications but not email.
+func (u *UserServiceImpl) ShouldNotify(ctx context.Context, userId int, eventType string, channel string,
+	at time.Time) (bool, error) {
+	preference, err := u.preferences(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	enabled := eventType != MarketingEvent
+	for _, notification := range preference.Notifications {
+		if notification.EventType == eventType && notification.Channel == channel {
+			enabled = notification.Enabled
 		}
 	}
-	finalUser := Response{
-		ID:            user.ID,
-		FirstName:     user.FirstName,
-		SecondName:    user.SecondName,
-		FullName:      strings.Join([]string{user.FirstName, user.SecondName}, ""),
-		Email:         user.Email,
-		PhoneNo:       user.PhoneNo,
-		UserType:      user.PhoneNo,
-		Location:      user.Location,
-		Currency:      user.Currency,
-		Languages:     langs,
-		Description:   user.Description,
-		Ratings:       user.Ratings,
-		OnlineStatus:  user.OnlineStatus,
-		CreatedOn:     user.CreatedOn,
-		LastUpdatedOn: user.LastUpdatedOn,
+	if !enabled || channel == EmailChannel {
+		return enabled, nil
 	}
-	return &finalUser, nil
+	return !inQuietHours(*preference, at), nil
 }
 
-func (u *UserServiceImpl) GetUserByEmail(ctx context.Context, email string) (*Response, error) {
-	user, err := u.UserRepo.GetUserByEmail(ctx, email)
+// preferences returns the stored preferences of the user or the defaults if they never saved any.
+func (u *UserServiceImpl) preferences(ctx context.Context, userId int) (*dao.Preference, error) {
+	preference, err := u.UserRepo.GetPreferences(ctx, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		defaults := defaultPreference(userId)
+		return &defaults, nil
+	}
+	return preference, err
+}
+
+func (u *UserServiceImpl) projectUser(ctx context.Context, user dao.User, viewer *utils.Caller) (*Response, error) {
+	preference, err := u.preferences(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := projectResponse(toResponse(user), *preference, viewer)
+	return &res, nil
+}
+
+// projectLookup projects a user found by one of their contact fields, failing with
+// gorm.ErrRecordNotFound, just like a lookup that matched nobody, when the field is hidden from the
+// viewer.
+func (u *UserServiceImpl) projectLookup(ctx context.Context, user dao.User, viewer *utils.Caller,
+	visibility func(dao.Preference) string) (*Response, error) {
+	preference, err := u.preferences(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
+	if visibility(*preference) != dao.PublicVisibility && (viewer == nil || !viewer.IsAdmin() && viewer.ID != user.ID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	res := projectResponse(toResponse(user), *preference, viewer)
+	return &res, nil
+}
+
+func defaultPreference(userId int) dao.Preference {
+	return dao.Preference{
+		UserID:            userId,
+		PhoneVisibility:   dao.PrivateVisibility,
+		EmailVisibility:   dao.PrivateVisibility,
+		AddressVisibility: dao.PrivateVisibility,
+	}
+}
+
+func toResponse(user dao.User) Response {
 	var langs []string
-	if user.Languages != nil {
-		for _, lang := range user.Languages {
-			langs = append(langs, lang.Language)
-		}
+	for _, lang := range user.Languages {
+		langs = append(langs, lang.Language)
 	}
-	finalUser := Response{
+	return Response{
 		ID:            user.ID,
 		FirstName:     user.FirstName,
 		SecondName:    user.SecondName,
-		FullName:      strings.Join([]string{user.FirstName, user.SecondName}, ""),
+		FullName:      strings.Join([]string{user.FirstName, user.SecondName}, " "),
 		Email:         user.Email,
 		PhoneNo:       user.PhoneNo,
-		UserType:      user.PhoneNo,
+		UserType:      user.UserType,
 		Location:      user.Location,
+		Address:       user.Address,
 		Currency:      user.Currency,
 		Languages:     langs,
 		Description:   user.Description,
 		Ratings:       user.Ratings,
 		OnlineStatus:  user.OnlineStatus,
+		Verified:      user.Verified,
 		CreatedOn:     user.CreatedOn,
 		LastUpdatedOn: user.LastUpdatedOn,
 	}
-	return &finalUser, nil
+}
+
+// projectResponse hides the private contact fields of a user from everyone but the user themselves
+// and administrators.
+func projectResponse(res Response, preference dao.Preference, viewer *utils.Caller) Response {
+	if viewer != nil && (viewer.IsAdmin() || viewer.ID == res.ID) {
+		return res
+	}
+	if preference.PhoneVisibility != dao.PublicVisibility {
+		res.PhoneNo = ""
+	}
+	if preference.EmailVisibility != dao.PublicVisibility {
+		res.Email = ""
+	}
+	if preference.AddressVisibility != dao.PublicVisibility {
+		res.Address = ""
+	}
+	return res
+}
+
+func toPreferencesResponse(preference dao.Preference) PreferencesResponse {
+	res := PreferencesResponse{
+		QuietHoursStart: preference.QuietHoursStart,
+		QuietHoursEnd:   preference.QuietHoursEnd,
+		TimeZone:        preference.TimeZone,
+		Visibility: FieldVisibility{
+			PhoneNo: preference.PhoneVisibility,
+			Email:   preference.EmailVisibility,
+			Address: preference.AddressVisibility,
+		},
+	}
+	for _, notification := range preference.Notifications {
+		res.Notifications = append(res.Notifications, NotificationPreferenceRequest{
+			EventType: notification.EventType,
+			Channel:   notification.Channel,
+			Enabled:   notification.Enabled,
+		})
+	}
+	return res
+}
+
+func inQuietHours(preference dao.Preference, at time.Time) bool {
+	start, errS := time.Parse(quietHoursLayout, preference.QuietHoursStart)
+	end, errE := time.Parse(quietHoursLayout, preference.QuietHoursEnd)
+	if errS != nil || errE != nil || start.Equal(end) {
+		return false
+	}
+	location, err := time.LoadLocation(preference.TimeZone)
+	if err != nil {
+		location = time.Local
+	}
+	local := at.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	// quiet hours that wrap past midnight
+	return minute >= from || minute < to
 }
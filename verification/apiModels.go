@@ -0,0 +1,36 @@
+package verification
+
+import "time"
+
+// SubmitDocumentRequest is the form the document file is uploaded with.
+type SubmitDocumentRequest struct {
+	DocumentType string `form:"document_type" binding:"required,oneof=national_id passport certificate"`
+}
+
+type ReviewDocumentRequest struct {
+	Reason string `json:"reason"`
+}
+
+type FetchQueueRequest struct {
+	Status string `form:"status"`
+}
+
+type DocumentResponse struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	DocumentType string     `json:"document_type"`
+	FileUrl      string     `json:"file_url"`
+	Status       string     `json:"status"`
+	Reason       string     `json:"reason,omitempty"`
+	ReviewedBy   int        `json:"reviewed_by,omitempty"`
+	ReviewedOn   *time.Time `json:"reviewed_on,omitempty"`
+	CreatedOn    time.Time  `json:"created_on"`
+}
+
+type StatusHistoryResponse struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedBy  int       `json:"changed_by"`
+	ChangedOn  time.Time `json:"changed_on"`
+}
@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"time"
+)
+
+// Document types a servitor can submit for verification.
+const (
+	NationalIDDocument  = "national_id"
+	PassportDocument    = "passport"
+	CertificateDocument = "certificate"
+)
+
+// IdentityDocuments are the document types that prove who the servitor is, an approved one verifies
+// the servitor.
+var IdentityDocuments = []string{NationalIDDocument, PassportDocument}
+
+// Review statuses of a verification document.
+const (
+	PendingStatus  = "pending"
+	ApprovedStatus = "approved"
+	RejectedStatus = "rejected"
+)
+
+// Document is a file a servitor uploaded for verification, StorageKey locates it in the private
+// document store.
+type Document struct {
+	ID            int        `gorm:"primary_key; auto_increment" json:"id"`
+	UserID        int        `gorm:"index" json:"user_id"`
+	DocumentType  string     `gorm:"type:varchar(64)" json:"document_type"`
+	StorageKey    string     `gorm:"type:varchar(255)" json:"-"`
+	ContentType   string     `gorm:"type:varchar(64)" json:"content_type"`
+	Status        string     `gorm:"type:varchar(64);index" json:"status"`
+	Reason        string     `gorm:"type:varchar(512)" json:"reason"`
+	ReviewedBy    int        `json:"reviewed_by"`
+	ReviewedOn    *time.Time `json:"reviewed_on"`
+	CreatedOn     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+	LastUpdatedOn time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_updated_on"`
+}
+
+type StatusHistory struct {
+	ID         int       `gorm:"primary_key; auto_increment" json:"id"`
+	DocumentID int       `gorm:"index" json:"document_id"`
+	UserID     int       `json:"user_id"`
+	FromStatus string    `gorm:"type:varchar(64)" json:"from_status"`
+	ToStatus   string    `gorm:"type:varchar(64)" json:"to_status"`
+	Reason     string    `gorm:"type:varchar(512)" json:"reason"`
+	ChangedBy  int       `json:"changed_by"`
+	CreatedOn  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_on"`
+}
@@ -0,0 +1,141 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"servhunt/infra/dao"
+	userdao "servhunt/user/dao"
+	"time"
+)
+
+// ErrDocumentReviewed is returned when reviewing a document that is no longer pending.
+var ErrDocumentReviewed = errors.New("document has already been reviewed")
+
+type VerificationRepo interface {
+	SubmitDocument(ctx context.Context, document Document) (*Document, error)
+	UserDocuments(ctx context.Context, userId int) (*[]Document, error)
+	GetDocumentByID(ctx context.Context, id int) (*Document, error)
+	DocumentsByStatus(ctx context.Context, status string) (*[]Document, error)
+	ReviewDocument(ctx context.Context, id int, status string, reason string, reviewerId int) (*Document, error)
+	DocumentHistory(ctx context.Context, documentId int) (*[]StatusHistory, error)
+}
+
+type VerificationRepoImpl struct {
+	repo *dao.Repository
+}
+
+func NewVerificationRepoImpl(repo *dao.Repository) VerificationRepo {
+	return &VerificationRepoImpl{repo: repo}
+}
+
+func (v *VerificationRepoImpl) SubmitDocument(ctx context.Context, document Document) (*Document, error) {
+	document.Status = PendingStatus
+	err := v.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Document{}).Create(&document).Error; err != nil {
+			return err
+		}
+		return tx.Model(&StatusHistory{}).Create(&StatusHistory{
+			DocumentID: document.ID,
+			UserID:     document.UserID,
+			ToStatus:   PendingStatus,
+			ChangedBy:  document.UserID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func (v *VerificationRepoImpl) UserDocuments(ctx context.Context, userId int) (*[]Document, error) {
+	var documents []Document
+	err := v.repo.DB.WithContext(ctx).Model(&Document{}).Where("user_id = ?", userId).Order("created_on").Find(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return &documents, nil
+}
+
+func (v *VerificationRepoImpl) GetDocumentByID(ctx context.Context, id int) (*Document, error) {
+	var document Document
+	err := v.repo.DB.WithContext(ctx).Model(&Document{}).Where("id = ?", id).Take(&document).Error
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// DocumentsByStatus returns documents in the given status, oldest first so the review queue is fair.
+func (v *VerificationRepoImpl) DocumentsByStatus(ctx context.Context, status string) (*[]Document, error) {
+	var documents []Document
+	err := v.repo.DB.WithContext(ctx).Model(&Document{}).Where("status = ?", status).Order("created_on").Find(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return &documents, nil
+}
+
+// ReviewDocument moves a pending document to approved or rejected, records the transition and
+// recomputes whether the owner holds an approved identity document.
+func (v *VerificationRepoImpl) ReviewDocument(ctx context.Context, id int, status string, reason string,
+	reviewerId int) (*Document, error) {
+	var document Document
+	err := v.repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Document{}).Where("id = ?", id).Take(&document).Error
+		if err != nil {
+			return err
+		}
+		if document.Status != PendingStatus {
+			return ErrDocumentReviewed
+		}
+		now := time.Now()
+		err = tx.Model(&Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":          status,
+			"reason":          reason,
+			"reviewed_by":     reviewerId,
+			"reviewed_on":     now,
+			"last_updated_on": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&StatusHistory{}).Create(&StatusHistory{
+			DocumentID: document.ID,
+			UserID:     document.UserID,
+			FromStatus: document.Status,
+			ToStatus:   status,
+			Reason:     reason,
+			ChangedBy:  reviewerId,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var approved int64
+		err = tx.Model(&Document{}).Where("user_id = ? AND status = ? AND document_type IN ?",
+			document.UserID, ApprovedStatus, IdentityDocuments).Count(&approved).Error
+		if err != nil {
+			return err
+		}
+		document.Status = status
+		document.Reason = reason
+		document.ReviewedBy = reviewerId
+		document.ReviewedOn = &now
+		return tx.Model(&userdao.User{}).Where("id = ?", document.UserID).Update("verified", approved > 0).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func (v *VerificationRepoImpl) DocumentHistory(ctx context.Context, documentId int) (*[]StatusHistory, error) {
+	var history []StatusHistory
+	err := v.repo.DB.WithContext(ctx).Model(&StatusHistory{}).Where("document_id = ?", documentId).Order("id").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
@@ -0,0 +1,188 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"servhunt/infra/utils"
+	"servhunt/verification/dao"
+	"strconv"
+)
+
+type VerificationHandler interface {
+	SubmitDocument(ctx *gin.Context)
+	MyDocuments(ctx *gin.Context)
+	DocumentFile(ctx *gin.Context)
+	DocumentHistory(ctx *gin.Context)
+	ReviewQueue(ctx *gin.Context)
+	ApproveDocument(ctx *gin.Context)
+	RejectDocument(ctx *gin.Context)
+}
+
+type VerificationHandlerImpl struct {
+	VerificationService
+}
+
+func NewVerificationHandlerImpl(svc VerificationService) VerificationHandler {
+	return &VerificationHandlerImpl{VerificationService: svc}
+}
+
+func (v *VerificationHandlerImpl) SubmitDocument(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	if caller.UserType != utils.ServitorUserType {
+		utils.APIResponse(ctx, "Only servitors can submit verification documents", http.StatusForbidden,
+			false, nil)
+		return
+	}
+	// Leave room for the multipart framing around the largest accepted document
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxDocumentBytes+1<<20)
+	req := SubmitDocumentRequest{}
+	if err := ctx.ShouldBind(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read the upload form", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		utils.APIResponse(ctx, "A file is required", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	defer file.Close()
+	document, err := v.VerificationService.SubmitDocument(ctx, caller.ID, req, file)
+	if errors.Is(err, ErrUnsupportedDocument) {
+		utils.APIResponse(ctx, "Failed to submit document", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if errors.Is(err, ErrDocumentTooLarge) {
+		utils.APIResponse(ctx, "Document is too large", http.StatusRequestEntityTooLarge, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Document submitted for review", http.StatusOK, true, document)
+}
+
+func (v *VerificationHandlerImpl) MyDocuments(ctx *gin.Context) {
+	caller, _ := utils.GetCaller(ctx)
+	documents, err := v.VerificationService.UserDocuments(ctx, caller.ID)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Documents successfully returned", http.StatusOK, true, documents)
+}
+
+func (v *VerificationHandlerImpl) DocumentFile(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	file, contentType, err := v.VerificationService.DocumentFile(ctx, id, caller.ID, caller.IsAdmin())
+	if errors.Is(err, ErrNotDocumentOwner) {
+		utils.APIResponse(ctx, "You can only view your own documents", http.StatusForbidden, false, nil)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.APIResponse(ctx, "Document not found", http.StatusNotFound, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	ctx.Header("Cache-Control", "private, no-store")
+	ctx.Data(http.StatusOK, contentType, file)
+}
+
+func (v *VerificationHandlerImpl) DocumentHistory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	caller, _ := utils.GetCaller(ctx)
+	history, err := v.VerificationService.DocumentHistory(ctx, id, caller.ID, caller.IsAdmin())
+	if errors.Is(err, ErrNotDocumentOwner) {
+		utils.APIResponse(ctx, "You can only view your own documents", http.StatusForbidden, false, nil)
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Document history successfully returned", http.StatusOK, true, history)
+}
+
+func (v *VerificationHandlerImpl) ReviewQueue(ctx *gin.Context) {
+	req := FetchQueueRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.APIResponse(ctx, "Failed to read query parameters", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	documents, err := v.VerificationService.ReviewQueue(ctx, req.Status)
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, "Review queue successfully returned", http.StatusOK, true, documents)
+}
+
+func (v *VerificationHandlerImpl) ApproveDocument(ctx *gin.Context) {
+	v.reviewDocument(ctx, v.VerificationService.ApproveDocument, "Document approved")
+}
+
+func (v *VerificationHandlerImpl) RejectDocument(ctx *gin.Context) {
+	v.reviewDocument(ctx, v.VerificationService.RejectDocument, "Document rejected")
+}
+
+type reviewFunc func(ctx context.Context, id int, reviewerId int, review ReviewDocumentRequest) (*DocumentResponse, error)
+
+func (v *VerificationHandlerImpl) reviewDocument(ctx *gin.Context, review reviewFunc, message string) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.APIResponse(ctx, "Failed to convert string to int", http.StatusBadRequest,
+			false, err.Error())
+		return
+	}
+	// the review reason is optional for approvals so an empty body is allowed
+	req := ReviewDocumentRequest{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.APIResponse(ctx, "Failed to convert request to JSON", http.StatusBadRequest,
+				false, err.Error())
+			return
+		}
+	}
+	caller, _ := utils.GetCaller(ctx)
+	document, err := review(ctx, id, caller.ID, req)
+	if errors.Is(err, ErrReasonRequired) || errors.Is(err, dao.ErrDocumentReviewed) {
+		utils.APIResponse(ctx, "Failed to review document", http.StatusBadRequest, false, err.Error())
+		return
+	}
+	if err != nil {
+		utils.APIResponse(ctx, "Failed, please try again later", http.StatusInternalServerError,
+			false, err.Error())
+		return
+	}
+	utils.APIResponse(ctx, message, http.StatusOK, true, document)
+}
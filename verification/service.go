@@ -0,0 +1,200 @@
+package verification
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"servhunt/infra/utils"
+	"servhunt/storage"
+	"servhunt/verification/dao"
+)
+
+// MaxDocumentBytes bounds the size of an uploaded verification document.
+const MaxDocumentBytes = 10 << 20
+
+var (
+	logger = utils.GetRootLogger()
+
+	ErrReasonRequired      = errors.New("a reason is required when rejecting a document")
+	ErrNotDocumentOwner    = errors.New("document belongs to another user")
+	ErrUnsupportedDocument = errors.New("only JPEG, PNG and PDF documents can be uploaded")
+	ErrDocumentTooLarge    = fmt.Errorf("documents can be at most %d MB", MaxDocumentBytes>>20)
+)
+
+// documentExtensions maps the accepted document content types to the extension they are stored under.
+var documentExtensions = map[string]string{"image/jpeg": "jpg", "image/png": "png", "application/pdf": "pdf"}
+
+type VerificationService interface {
+	SubmitDocument(ctx context.Context, userId int, document SubmitDocumentRequest, file io.Reader) (*DocumentResponse, error)
+	DocumentFile(ctx context.Context, id int, userId int, isAdmin bool) ([]byte, string, error)
+	UserDocuments(ctx context.Context, userId int) (*[]DocumentResponse, error)
+	ReviewQueue(ctx context.Context, status string) (*[]DocumentResponse, error)
+	ApproveDocument(ctx context.Context, id int, reviewerId int, review ReviewDocumentRequest) (*DocumentResponse, error)
+	RejectDocument(ctx context.Context, id int, reviewerId int, review ReviewDocumentRequest) (*DocumentResponse, error)
+	DocumentHistory(ctx context.Context, id int, userId int, isAdmin bool) (*[]StatusHistoryResponse, error)
+}
+
+type VerificationServiceImpl struct {
+	dao.VerificationRepo
+	// documents keeps the uploaded files, it must not be served publicly
+	documents storage.BlobStore
+}
+
+func NewVerificationServiceImpl(repo dao.VerificationRepo, documents storage.BlobStore) VerificationService {
+	return &VerificationServiceImpl{VerificationRepo: repo, documents: documents}
+}
+
+// SubmitDocument stores the uploaded file as it is, so reviewers see the original scan, and queues
+// it for review.
+func (v *VerificationServiceImpl) SubmitDocument(ctx context.Context, userId int, document SubmitDocumentRequest,
+	file io.Reader) (*DocumentResponse, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxDocumentBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxDocumentBytes {
+		return nil, ErrDocumentTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	extension, ok := documentExtensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedDocument
+	}
+	key := fmt.Sprintf("verifications/%d/%s.%s", userId, uuid.NewString(), extension)
+	if _, err = v.documents.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return nil, err
+	}
+	saved, err := v.VerificationRepo.SubmitDocument(ctx, dao.Document{
+		UserID:       userId,
+		DocumentType: document.DocumentType,
+		StorageKey:   key,
+		ContentType:  contentType,
+	})
+	if err != nil {
+		if deleteErr := v.documents.Delete(ctx, key); deleteErr != nil {
+			logger.Error("error deleting verification document blob", zap.String("blob.key", key),
+				zap.NamedError("error.message", deleteErr))
+		}
+		return nil, err
+	}
+	res := toDocumentResponse(*saved)
+	return &res, nil
+}
+
+// DocumentFile returns the uploaded file and its content type to the servitor who uploaded it or
+// an administrator.
+func (v *VerificationServiceImpl) DocumentFile(ctx context.Context, id int, userId int,
+	isAdmin bool) ([]byte, string, error) {
+	document, err := v.VerificationRepo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isAdmin && document.UserID != userId {
+		return nil, "", ErrNotDocumentOwner
+	}
+	file, err := v.documents.Open(ctx, document.StorageKey)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, document.ContentType, nil
+}
+
+func (v *VerificationServiceImpl) UserDocuments(ctx context.Context, userId int) (*[]DocumentResponse, error) {
+	documents, err := v.VerificationRepo.UserDocuments(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return toDocumentResponses(*documents), nil
+}
+
+func (v *VerificationServiceImpl) ReviewQueue(ctx context.Context, status string) (*[]DocumentResponse, error) {
+	if status == "" {
+		status = dao.PendingStatus
+	}
+	documents, err := v.VerificationRepo.DocumentsByStatus(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	return toDocumentResponses(*documents), nil
+}
+
+func (v *VerificationServiceImpl) ApproveDocument(ctx context.Context, id int, reviewerId int,
+	review ReviewDocumentRequest) (*DocumentResponse, error) {
+	document, err := v.VerificationRepo.ReviewDocument(ctx, id, dao.ApprovedStatus, review.Reason, reviewerId)
+	if err != nil {
+		return nil, err
+	}
+	res := toDocumentResponse(*document)
+	return &res, nil
+}
+
+func (v *VerificationServiceImpl) RejectDocument(ctx context.Context, id int, reviewerId int,
+	review ReviewDocumentRequest) (*DocumentResponse, error) {
+	if review.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+	document, err := v.VerificationRepo.ReviewDocument(ctx, id, dao.RejectedStatus, review.Reason, reviewerId)
+	if err != nil {
+		return nil, err
+	}
+	res := toDocumentResponse(*document)
+	return &res, nil
+}
+
+func (v *VerificationServiceImpl) DocumentHistory(ctx context.Context, id int, userId int,
+	isAdmin bool) (*[]StatusHistoryResponse, error) {
+	document, err := v.VerificationRepo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin && document.UserID != userId {
+		return nil, ErrNotDocumentOwner
+	}
+	history, err := v.VerificationRepo.DocumentHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var res []StatusHistoryResponse
+	for _, entry := range *history {
+		res = append(res, StatusHistoryResponse{
+			FromStatus: entry.FromStatus,
+			ToStatus:   entry.ToStatus,
+			Reason:     entry.Reason,
+			ChangedBy:  entry.ChangedBy,
+			ChangedOn:  entry.CreatedOn,
+		})
+	}
+	return &res, nil
+}
+
+func toDocumentResponse(document dao.Document) DocumentResponse {
+	return DocumentResponse{
+		ID:           document.ID,
+		UserID:       document.UserID,
+		DocumentType: document.DocumentType,
+		FileUrl:      fmt.Sprintf("/verifications/documents/%d/file", document.ID),
+		Status:       document.Status,
+		Reason:       document.Reason,
+		ReviewedBy:   document.ReviewedBy,
+		ReviewedOn:   document.ReviewedOn,
+		CreatedOn:    document.CreatedOn,
+	}
+}
+
+func toDocumentResponses(documents []dao.Document) *[]DocumentResponse {
+	var res []DocumentResponse
+	for _, document := range documents {
+		res = append(res, toDocumentResponse(document))
+	}
+	return &res
+}